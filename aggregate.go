@@ -0,0 +1,268 @@
+package pfftdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Aggregate computes a value over the bindings of a group. Op is count,
+// sum, avg, min, max or group_concat of the variable Var, count without
+// Var or with * counts the bindings. Distinct uses every value once and
+// Separator joins the group_concat values, a space by default. The value
+// is bound to As, op or op_var if empty.
+//
+// Unbound values are skipped, sum and avg skip values which aren't
+// numbers and min and max values not comparable to the ones before. avg,
+// min and max of a group without values are unbound.
+type Aggregate struct {
+	Op        string `json:"op"`
+	Var       string `json:"var"`
+	Distinct  bool   `json:"distinct"`
+	Separator string `json:"separator"`
+	As        string `json:"as"`
+}
+
+// aggregateOps are the ops of Aggregate.
+var aggregateOps = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true, "group_concat": true,
+}
+
+// name returns the variable the aggregate is bound to.
+func (a *Aggregate) name() string {
+	switch {
+	case a.As != "":
+		return a.As
+	case a.Var == "" || a.Var == "*":
+		return a.Op
+	}
+	return a.Op + "_" + a.Var
+}
+
+// check validates the op and that it has a variable.
+func (a *Aggregate) check() error {
+	if !aggregateOps[a.Op] {
+		return fmt.Errorf("unknown aggregate %q", a.Op)
+	}
+	if a.Op != "count" && (a.Var == "" || a.Var == "*") {
+		return fmt.Errorf("%s needs a variable", a.Op)
+	}
+	return nil
+}
+
+// checkGrouping validates the aggregates and having of a query.
+func checkGrouping(options *Options) error {
+	for _, a := range options.Aggregates {
+		if err := a.check(); err != nil {
+			return err
+		}
+	}
+	if options.Having != nil {
+		return options.Having.check()
+	}
+	return nil
+}
+
+// grouped reports whether query results are groups.
+func (o *Options) grouped() bool {
+	return len(o.GroupBy) > 0 || len(o.Aggregates) > 0
+}
+
+// aggregateState accumulates the values of an aggregate for a group.
+type aggregateState struct {
+	agg   *Aggregate
+	seen  map[string]bool
+	count uint
+	sum   float64
+	best  interface{}
+	strs  []string
+}
+
+// add adds the value of a binding.
+func (s *aggregateState) add(b Bindings) {
+	var val interface{}
+	all := s.agg.Var == "" || s.agg.Var == "*"
+	if all {
+		val = b
+	} else {
+		var ok bool
+		val, ok = b[s.agg.Var]
+		if !ok || val == nil {
+			return
+		}
+	}
+	if s.agg.Distinct {
+		key := ""
+		if all {
+			key = fmt.Sprintf("%v", b)
+		} else {
+			key = objKey(val)
+		}
+		if s.seen[key] {
+			return
+		}
+		s.seen[key] = true
+	}
+
+	switch s.agg.Op {
+	case "count":
+		s.count++
+	case "sum", "avg":
+		if f, ok := toFloat(val); ok {
+			s.sum += f
+			s.count++
+		}
+	case "min", "max":
+		if s.best == nil {
+			s.best = val
+			return
+		}
+		c, ok := compareObjects(val, s.best)
+		if ok && (c < 0 && s.agg.Op == "min" || c > 0 && s.agg.Op == "max") {
+			s.best = val
+		}
+	case "group_concat":
+		switch v := val.(type) {
+		case string:
+			s.strs = append(s.strs, v)
+		case Literal:
+			s.strs = append(s.strs, v.Value)
+		default:
+			s.strs = append(s.strs, fmt.Sprintf("%v", v))
+		}
+	}
+}
+
+// value returns the aggregate, ok is false if it is unbound.
+func (s *aggregateState) value() (interface{}, bool) {
+	switch s.agg.Op {
+	case "count":
+		return s.count, true
+	case "sum":
+		return s.sum, true
+	case "avg":
+		if s.count == 0 {
+			return nil, false
+		}
+		return s.sum / float64(s.count), true
+	case "min", "max":
+		return s.best, s.best != nil
+	}
+	sep := s.agg.Separator
+	if sep == "" {
+		sep = " "
+	}
+	return strings.Join(s.strs, sep), true
+}
+
+// group is the bindings of the group variables and the aggregate states.
+type group struct {
+	binding Bindings
+	states  []*aggregateState
+}
+
+// groupBindings groups the bindings next returns by the groupBy variables
+// and binds the aggregates of each group. Groups are in the order of their
+// first binding and the ones not matching having are removed. Without
+// groupBy all bindings are one group, even if there are none.
+func groupBindings(next func() (Bindings, bool), groupBy []string, aggregates []*Aggregate, having *Expr) []Bindings {
+	newGroup := func(binding Bindings) *group {
+		g := &group{binding: Bindings{}, states: make([]*aggregateState, len(aggregates))}
+		for _, variable := range groupBy {
+			if val, ok := binding[variable]; ok && val != nil {
+				g.binding[variable] = val
+			}
+		}
+		for i, agg := range aggregates {
+			g.states[i] = &aggregateState{agg: agg, seen: map[string]bool{}}
+		}
+		return g
+	}
+
+	groups := map[string]*group{}
+	order := []*group{}
+	keys := make([]string, len(groupBy))
+	for binding, ok := next(); ok; binding, ok = next() {
+		for i, variable := range groupBy {
+			keys[i] = objKey(binding[variable])
+		}
+		key := strings.Join(keys, "\x00")
+		g, ok := groups[key]
+		if !ok {
+			g = newGroup(binding)
+			groups[key] = g
+			order = append(order, g)
+		}
+		for _, state := range g.states {
+			state.add(binding)
+		}
+	}
+	if len(order) == 0 && len(groupBy) == 0 {
+		order = append(order, newGroup(Bindings{}))
+	}
+
+	bindings := make([]Bindings, 0, len(order))
+	for _, g := range order {
+		for _, state := range g.states {
+			if val, ok := state.value(); ok {
+				g.binding[state.agg.name()] = val
+			}
+		}
+		if having != nil && !having.Match(g.binding) {
+			continue
+		}
+		bindings = append(bindings, g.binding)
+	}
+	return bindings
+}
+
+// countable reports whether a query is a count of the triples matching a
+// single clause, which the driver counts without reading them.
+func countable(clauses []*Triple, options *Options) bool {
+	if len(clauses) != 1 || len(options.Aggregates) != 1 || len(options.GroupBy) > 0 ||
+		options.Having != nil || len(options.Filter) > 0 || options.Where != nil ||
+		len(options.ClauseGraphs) > 0 {
+		return false
+	}
+	agg := options.Aggregates[0]
+	if agg.Op != "count" || agg.Distinct {
+		return false
+	}
+	// a property path isn't a predicate the driver knows
+	if pred, ok := clauses[0][1].(string); ok && isPath(pred) {
+		return false
+	}
+	vars := map[string]bool{}
+	for _, item := range clauses[0] {
+		if s, ok := item.(string); ok && strings.HasPrefix(s, "?") {
+			vars[s[1:]] = true
+		}
+	}
+	return agg.Var == "" || agg.Var == "*" || vars[agg.Var]
+}
+
+// clauseCount returns the number of triples matching a clause in the
+// graphs of a query from the driver.
+func (g *Graph) clauseCount(clause *Triple, options *Options) (uint, error) {
+	query := &Triple{}
+	for i, item := range clause {
+		if s, ok := item.(string); ok && strings.HasPrefix(s, "?") {
+			query[i] = SPEMPTY
+			continue
+		}
+		query[i] = item
+	}
+	sub, pred, err := SubPred(query[0], query[1])
+	if err != nil {
+		return 0, err
+	}
+	graphs, _ := g.clauseGraphs(0, options)
+	var total uint
+	for _, graph := range graphs {
+		count, err := g.Driver.Count(graph, sub, pred, query[2])
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
@@ -0,0 +1,128 @@
+package pfftdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupBindings(t *testing.T) {
+	bindings := []Bindings{
+		{"dept": "a", "name": "x", "age": 20},
+		{"dept": "a", "name": "y", "age": 30.0},
+		{"dept": "a", "name": "y", "age": "n/a"},
+		{"dept": "b", "name": "z", "age": 50},
+		{"name": "w"},
+	}
+	next := (&bindingSliceIter{bindings: bindings}).Next
+	aggregates := []*Aggregate{
+		&Aggregate{Op: "count"},
+		&Aggregate{Op: "count", Var: "name", Distinct: true, As: "names"},
+		&Aggregate{Op: "sum", Var: "age"},
+		&Aggregate{Op: "avg", Var: "age"},
+		&Aggregate{Op: "min", Var: "age"},
+		&Aggregate{Op: "max", Var: "name"},
+		&Aggregate{Op: "group_concat", Var: "name", Separator: ","},
+	}
+	groups := groupBindings(next, []string{"dept"}, aggregates, nil)
+	expected := []Bindings{
+		{"dept": "a", "count": uint(3), "names": uint(2), "sum_age": 50.0, "avg_age": 25.0, "min_age": 20, "max_name": "y", "group_concat_name": "x,y,y"},
+		{"dept": "b", "count": uint(1), "names": uint(1), "sum_age": 50.0, "avg_age": 50.0, "min_age": 50, "max_name": "z", "group_concat_name": "z"},
+		{"count": uint(1), "names": uint(1), "sum_age": 0.0, "max_name": "w", "group_concat_name": "w"},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("%v", groups)
+	}
+
+	having, _ := ParseExpr("?count > 1")
+	next = (&bindingSliceIter{bindings: bindings}).Next
+	groups = groupBindings(next, []string{"dept"}, aggregates[:1], having)
+	if len(groups) != 1 || groups[0]["dept"] != "a" {
+		t.Error(groups)
+	}
+
+	// without group by there is always a group
+	next = (&bindingSliceIter{}).Next
+	groups = groupBindings(next, nil, aggregates[:1], nil)
+	if !reflect.DeepEqual(groups, []Bindings{{"count": uint(0)}}) {
+		t.Error(groups)
+	}
+
+	if err := checkGrouping(&Options{Aggregates: []*Aggregate{&Aggregate{Op: "sum"}}}); err == nil {
+		t.Error("sum should need a variable")
+	}
+	if err := checkGrouping(&Options{Aggregates: []*Aggregate{&Aggregate{Op: "median", Var: "a"}}}); err == nil {
+		t.Error("should have gotten error for unknown aggregate")
+	}
+}
+
+// countingDriver records the calls to Count and Triples of the test graph.
+type countingDriver struct {
+	Driver
+	counts  int
+	triples int
+}
+
+func (d *countingDriver) Count(graph, sub, pred string, obj interface{}) (uint, error) {
+	if graph == TESTGRAPH {
+		d.counts++
+	}
+	return d.Driver.Count(graph, sub, pred, obj)
+}
+
+func (d *countingDriver) Triples(graph, sub, pred string, obj interface{}, options *Options) TripleIter {
+	if graph == TESTGRAPH {
+		d.triples++
+	}
+	return d.Driver.Triples(graph, sub, pred, obj, options)
+}
+
+func TestQueryAggregates(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	GRPH.Add("_:1", "dept", "sales")
+	GRPH.Add("_:1", "salary", 10)
+	GRPH.Add("_:2", "dept", "sales")
+	GRPH.Add("_:2", "salary", 20)
+	GRPH.Add("_:3", "dept", "it")
+	GRPH.Add("_:3", "salary", 40)
+
+	clauses := []*Triple{
+		&Triple{"?id", "dept", "?dept"},
+		&Triple{"?id", "salary", "?salary"},
+	}
+	having, _ := ParseExpr("?employees > 1")
+	res := GRPH.Query(clauses, &Options{
+		GroupBy:    []string{"dept"},
+		Aggregates: []*Aggregate{&Aggregate{Op: "count", As: "employees"}, &Aggregate{Op: "avg", Var: "salary"}},
+		OrderBy:    "dept",
+	})
+	if len(res) != 2 || res[0]["dept"] != "it" || res[1]["avg_salary"] != 15.0 || res[1]["employees"] != uint(2) {
+		t.Error(res)
+	}
+	res = GRPH.Query(clauses, &Options{
+		GroupBy:    []string{"dept"},
+		Aggregates: []*Aggregate{&Aggregate{Op: "count", As: "employees"}},
+		Having:     having,
+		Select:     []string{"dept"},
+	})
+	if !reflect.DeepEqual(res, []Bindings{{"dept": "sales"}}) {
+		t.Error(res)
+	}
+
+	// a single clause count is done by the driver
+	driver := &countingDriver{Driver: GRPH.Driver}
+	g := &Graph{GraphID: GRPH.GraphID, Driver: driver}
+	res = g.Query(clauses[:1], &Options{Aggregates: []*Aggregate{&Aggregate{Op: "count", Var: "id"}}})
+	if !reflect.DeepEqual(res, []Bindings{{"count_id": uint(3)}}) || driver.counts != 1 || driver.triples != 0 {
+		t.Error(res, driver.counts, driver.triples)
+	}
+	count, err := g.QueryCount(clauses[:1], &Options{Offset: 1, Limit: 5})
+	if err != nil || count != 2 || driver.triples != 0 {
+		t.Error(count, err, driver.triples)
+	}
+	count, err = g.QueryCount(clauses, &Options{Select: []string{"dept"}, Distinct: true})
+	if err != nil || count != 2 {
+		t.Error(count, err)
+	}
+}
@@ -0,0 +1,424 @@
+package pfftdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// AnalyticsPrefix is the prefix of the predicates analytics results are
+// written with, like _:1 analytics:pagerank 0.013.
+const AnalyticsPrefix = "analytics:"
+
+// AnalyticsOptions are the options of the analytics algorithms. Preds are
+// the predicates of the edges, the nodes are their subjects and the
+// objects which aren't literals. Damping, 0.85 if 0, Iterations and
+// Tolerance, 1e-6 if 0, are for pagerank, which iterates until the ranks
+// change less than Tolerance in total. Iterations limits pagerank and
+// labels, 100 if 0. With Write the results are written back into the
+// graph.
+type AnalyticsOptions struct {
+	Preds      []string `json:"preds"`
+	Damping    float64  `json:"damping"`
+	Iterations int      `json:"iterations"`
+	Tolerance  float64  `json:"tolerance"`
+	Write      bool     `json:"write"`
+}
+
+// adjacency is a graph of the edges of some predicates with the nodes
+// numbered in the order of their ids.
+type adjacency struct {
+	ids []string
+	out [][]int // edges from each node, one per triple
+	in  [][]int // edges to each node, one per triple
+	nbr [][]int // sorted neighbours ignoring direction and loops
+}
+
+// analyticsAlgorithms compute the results of each node by name, which
+// are written with AnalyticsPrefix.
+var analyticsAlgorithms = map[string]func(*adjacency, *AnalyticsOptions) map[string]Bindings{
+	"degree":    degrees,
+	"pagerank":  pageRank,
+	"wcc":       weakComponents,
+	"scc":       strongComponents,
+	"triangles": triangles,
+	"labels":    labelPropagation,
+}
+
+// loadAdjacency reads the edges of preds.
+func (g *Graph) loadAdjacency(preds []string) (*adjacency, error) {
+	if len(preds) == 0 {
+		return nil, fmt.Errorf("no preds")
+	}
+	edges := [][2]string{}
+	nodes := map[string]int{}
+	for _, pred := range preds {
+		iter := g.TriplesIter(SPEMPTY, pred, SPEMPTY, nil)
+		for triple, ok := iter.Next(); ok; triple, ok = iter.Next() {
+			sub, ok := triple[0].(string)
+			if !ok {
+				continue
+			}
+			obj, ok := triple[2].(string)
+			if !ok {
+				continue
+			}
+			nodes[sub], nodes[obj] = 0, 0
+			edges = append(edges, [2]string{sub, obj})
+		}
+		err := iter.Err()
+		iter.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a := &adjacency{ids: make([]string, 0, len(nodes))}
+	for id := range nodes {
+		a.ids = append(a.ids, id)
+	}
+	sort.Strings(a.ids)
+	for i, id := range a.ids {
+		nodes[id] = i
+	}
+	a.out = make([][]int, len(a.ids))
+	a.in = make([][]int, len(a.ids))
+	a.nbr = make([][]int, len(a.ids))
+	seen := map[[2]int]bool{}
+	for _, edge := range edges {
+		from, to := nodes[edge[0]], nodes[edge[1]]
+		a.out[from] = append(a.out[from], to)
+		a.in[to] = append(a.in[to], from)
+		if from == to {
+			continue
+		}
+		if from > to {
+			from, to = to, from
+		}
+		if !seen[[2]int{from, to}] {
+			seen[[2]int{from, to}] = true
+			a.nbr[from] = append(a.nbr[from], to)
+			a.nbr[to] = append(a.nbr[to], from)
+		}
+	}
+	for _, nbr := range a.nbr {
+		sort.Ints(nbr)
+	}
+	return a, nil
+}
+
+// results binds a value of each node to name.
+func (a *adjacency) results(name string, value func(int) interface{}) map[string]Bindings {
+	res := make(map[string]Bindings, len(a.ids))
+	for i, id := range a.ids {
+		res[id] = Bindings{name: value(i)}
+	}
+	return res
+}
+
+// degrees counts the edges from and to each node.
+func degrees(a *adjacency, options *AnalyticsOptions) map[string]Bindings {
+	res := make(map[string]Bindings, len(a.ids))
+	for i, id := range a.ids {
+		res[id] = Bindings{
+			"outdegree": len(a.out[i]),
+			"indegree":  len(a.in[i]),
+			"degree":    len(a.out[i]) + len(a.in[i]),
+		}
+	}
+	return res
+}
+
+// pageRank ranks the nodes, the ranks add up to 1. Nodes without edges
+// from them link to every node.
+func pageRank(a *adjacency, options *AnalyticsOptions) map[string]Bindings {
+	n := len(a.ids)
+	damping, iterations, tolerance := options.Damping, options.Iterations, options.Tolerance
+	if damping == 0 {
+		damping = 0.85
+	}
+	if iterations == 0 {
+		iterations = 100
+	}
+	if tolerance == 0 {
+		tolerance = 1e-6
+	}
+
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iter := 0; iter < iterations; iter++ {
+		dangling := 0.0
+		for i, out := range a.out {
+			if len(out) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, out := range a.out {
+			for _, to := range out {
+				next[to] += damping * rank[i] / float64(len(out))
+			}
+		}
+		change := 0.0
+		for i := range rank {
+			if d := next[i] - rank[i]; d > 0 {
+				change += d
+			} else {
+				change -= d
+			}
+		}
+		rank, next = next, rank
+		if change < tolerance {
+			break
+		}
+	}
+	return a.results("pagerank", func(i int) interface{} { return rank[i] })
+}
+
+// weakComponents labels each node with the smallest id of the nodes
+// connected to it ignoring the direction of edges.
+func weakComponents(a *adjacency, options *AnalyticsOptions) map[string]Bindings {
+	parent := make([]int, len(a.ids))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i, nbr := range a.nbr {
+		for _, j := range nbr {
+			ri, rj := find(i), find(j)
+			// the smaller root keeps the smallest id as the label
+			if ri < rj {
+				parent[rj] = ri
+			} else if rj < ri {
+				parent[ri] = rj
+			}
+		}
+	}
+	return a.results("wcc", func(i int) interface{} { return a.ids[find(i)] })
+}
+
+// strongComponents labels each node with the smallest id of the nodes it
+// can reach and which can reach it, with Tarjan's algorithm.
+func strongComponents(a *adjacency, options *AnalyticsOptions) map[string]Bindings {
+	n := len(a.ids)
+	index := make([]int, n)
+	low := make([]int, n)
+	onStack := make([]bool, n)
+	label := make([]int, n)
+	for i := range index {
+		index[i] = -1
+	}
+	stack := []int{}
+	counter := 0
+
+	// frames of the depth first search, a node and its next edge
+	type frame struct{ node, edge int }
+	for root := 0; root < n; root++ {
+		if index[root] >= 0 {
+			continue
+		}
+		frames := []frame{{root, 0}}
+		index[root], low[root] = counter, counter
+		counter++
+		stack = append(stack, root)
+		onStack[root] = true
+		for len(frames) > 0 {
+			f := &frames[len(frames)-1]
+			if f.edge < len(a.out[f.node]) {
+				to := a.out[f.node][f.edge]
+				f.edge++
+				if index[to] < 0 {
+					index[to], low[to] = counter, counter
+					counter++
+					stack = append(stack, to)
+					onStack[to] = true
+					frames = append(frames, frame{to, 0})
+				} else if onStack[to] && index[to] < low[f.node] {
+					low[f.node] = index[to]
+				}
+				continue
+			}
+
+			node := f.node
+			frames = frames[:len(frames)-1]
+			if len(frames) > 0 {
+				if parent := frames[len(frames)-1].node; low[node] < low[parent] {
+					low[parent] = low[node]
+				}
+			}
+			if low[node] != index[node] {
+				continue
+			}
+			i := len(stack) - 1
+			smallest := node
+			for ; stack[i] != node; i-- {
+				if stack[i] < smallest {
+					smallest = stack[i]
+				}
+			}
+			for _, member := range stack[i:] {
+				onStack[member] = false
+				label[member] = smallest
+			}
+			stack = stack[:i]
+		}
+	}
+	return a.results("scc", func(i int) interface{} { return a.ids[label[i]] })
+}
+
+// triangles counts the triangles of each node ignoring the direction of
+// edges.
+func triangles(a *adjacency, options *AnalyticsOptions) map[string]Bindings {
+	counts := make([]int, len(a.ids))
+	connected := func(i, j int) bool {
+		nbr := a.nbr[i]
+		k := sort.SearchInts(nbr, j)
+		return k < len(nbr) && nbr[k] == j
+	}
+	for i, nbr := range a.nbr {
+		// every triangle once, by its nodes in order
+		for x, j := range nbr {
+			if j <= i {
+				continue
+			}
+			for _, k := range nbr[x+1:] {
+				if connected(j, k) {
+					counts[i]++
+					counts[j]++
+					counts[k]++
+				}
+			}
+		}
+	}
+	return a.results("triangles", func(i int) interface{} { return counts[i] })
+}
+
+// labelPropagation finds communities, every node takes the label most of
+// its neighbours have, the smallest on ties, until none changes. Nodes
+// start with their own id as label and are updated in order.
+func labelPropagation(a *adjacency, options *AnalyticsOptions) map[string]Bindings {
+	iterations := options.Iterations
+	if iterations == 0 {
+		iterations = 100
+	}
+	label := make([]int, len(a.ids))
+	for i := range label {
+		label[i] = i
+	}
+	counts := map[int]int{}
+	for iter := 0; iter < iterations; iter++ {
+		changed := false
+		for i, nbr := range a.nbr {
+			if len(nbr) == 0 {
+				continue
+			}
+			for k := range counts {
+				delete(counts, k)
+			}
+			best := label[i]
+			for _, j := range nbr {
+				counts[label[j]]++
+			}
+			for l, c := range counts {
+				if c > counts[best] || c == counts[best] && l < best {
+					best = l
+				}
+			}
+			if best != label[i] {
+				label[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return a.results("community", func(i int) interface{} { return a.ids[label[i]] })
+}
+
+// Analytics runs an algorithm on the edges of options.Preds and returns
+// the results of each node by name, see analyticsAlgorithms. The
+// algorithms are degree (outdegree, indegree and degree), pagerank, wcc
+// and scc, the weakly and strongly connected components, triangles and
+// labels (community). With options.Write they are also written as
+// triples, see WriteAnalytics.
+func (g *Graph) Analytics(algorithm string, options *AnalyticsOptions) (map[string]Bindings, error) {
+	return g.AnalyticsContext(context.Background(), algorithm, options)
+}
+
+// AnalyticsContext is Analytics which stops between loading the edges,
+// running the algorithm and writing the results when the context is
+// done.
+func (g *Graph) AnalyticsContext(ctx context.Context, algorithm string, options *AnalyticsOptions) (map[string]Bindings, error) {
+	run, ok := analyticsAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+	if options == nil {
+		return nil, fmt.Errorf("no preds")
+	}
+	if options.Damping < 0 || options.Damping >= 1 {
+		return nil, fmt.Errorf("damping %v not in [0, 1)", options.Damping)
+	}
+	a, err := g.loadAdjacency(options.Preds)
+	if err != nil {
+		return nil, err
+	}
+	progress(ctx, 1, 3)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	results := run(a, options)
+	progress(ctx, 2, 3)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if options.Write {
+		if err := g.WriteAnalytics(results); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// WriteAnalytics writes the results of each node as triples with the
+// names prefixed by AnalyticsPrefix, replacing the ones written before.
+func (g *Graph) WriteAnalytics(results map[string]Bindings) error {
+	add := []*Triple{}
+	preds := map[string]bool{}
+	for id, values := range results {
+		for name, val := range values {
+			pred := AnalyticsPrefix + name
+			preds[pred] = true
+			add = append(add, &Triple{id, pred, val})
+		}
+	}
+	for pred := range preds {
+		old, err := g.Triples(SPEMPTY, pred, SPEMPTY, &Options{Entailment: EntailNone})
+		if err != nil {
+			return err
+		}
+		if len(old) > 0 {
+			if err := g.RemoveBulk(g.GraphID, old); err != nil {
+				return err
+			}
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	_, err := g.AddBulk(g.GraphID, add)
+	return err
+}
@@ -0,0 +1,89 @@
+package pfftdb
+
+import (
+	"math"
+	"testing"
+)
+
+// addFollows adds a cycle a b c with a tail to d and e and a separate f
+// following g.
+func addFollows() {
+	for _, edge := range [][2]string{{"a", "b"}, {"b", "c"}, {"c", "a"}, {"c", "d"}, {"d", "e"}, {"f", "g"}} {
+		GRPH.Add(edge[0], "follows", edge[1])
+	}
+	GRPH.Add("a", "name", "Ann")
+}
+
+func TestAnalytics(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	addFollows()
+
+	options := &AnalyticsOptions{Preds: []string{"follows"}}
+	var tests = []struct {
+		algorithm string
+		expected  map[string]Bindings
+	}{
+		{"degree", map[string]Bindings{
+			"c": {"outdegree": 2, "indegree": 1, "degree": 3},
+			"e": {"outdegree": 0, "indegree": 1, "degree": 1},
+		}},
+		{"wcc", map[string]Bindings{"a": {"wcc": "a"}, "e": {"wcc": "a"}, "f": {"wcc": "f"}, "g": {"wcc": "f"}}},
+		{"scc", map[string]Bindings{"b": {"scc": "a"}, "c": {"scc": "a"}, "d": {"scc": "d"}, "g": {"scc": "g"}}},
+		{"triangles", map[string]Bindings{"a": {"triangles": 1}, "c": {"triangles": 1}, "d": {"triangles": 0}}},
+		{"labels", map[string]Bindings{"a": {"community": "b"}, "e": {"community": "b"}, "f": {"community": "g"}}},
+	}
+	for _, tt := range tests {
+		res, err := GRPH.Analytics(tt.algorithm, options)
+		if err != nil {
+			t.Fatal(tt.algorithm, err)
+		}
+		if len(res) != 7 {
+			t.Errorf("%s should have 7 nodes got %v", tt.algorithm, res)
+		}
+		for id, expected := range tt.expected {
+			for name, val := range expected {
+				if res[id][name] != val {
+					t.Errorf("%s %s %s should be %v got %v", tt.algorithm, id, name, val, res[id][name])
+				}
+			}
+		}
+	}
+
+	res, err := GRPH.Analytics("pagerank", &AnalyticsOptions{Preds: []string{"follows"}, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, b := range res {
+		total += b["pagerank"].(float64)
+	}
+	if math.Abs(total-1) > 1e-6 || res["a"]["pagerank"].(float64) <= res["f"]["pagerank"].(float64) {
+		t.Error(total, res)
+	}
+
+	// writing again replaces the ranks
+	_, err = GRPH.Analytics("pagerank", &AnalyticsOptions{Preds: []string{"follows"}, Damping: 0.5, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindings := GRPH.Query([]*Triple{&Triple{"?node", AnalyticsPrefix + "pagerank", "?rank"}}, nil)
+	if len(bindings) != 7 {
+		t.Error(bindings)
+	}
+
+	var bad = []struct {
+		algorithm string
+		options   *AnalyticsOptions
+	}{
+		{"closeness", options},
+		{"degree", nil},
+		{"degree", &AnalyticsOptions{}},
+		{"pagerank", &AnalyticsOptions{Preds: []string{"follows"}, Damping: 1}},
+	}
+	for i, b := range bad {
+		if _, err := GRPH.Analytics(b.algorithm, b.options); err == nil {
+			t.Error(i, "should have gotten error")
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package pfftdb
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -16,7 +19,11 @@ type API struct {
 	Env    string
 	Port   string
 	Driver Driver
-	WebDir string // only used for demo graph visualization.
+	WebDir string // serves the graph visualization from disk instead of assets.
+
+	cursors      cursors
+	jobs         jobs
+	transactions transactions
 }
 
 // GraphsResponse for getting a graph list.
@@ -24,17 +31,21 @@ type GraphsResponse struct {
 	Data []string `json:"data"`
 }
 
-// DataRequest for add and remove.
+// DataRequest for add and remove. Objects can be typed literals, see
+// Literal.
 type DataRequest struct {
 	Graph  string            `json:"graph"`
 	Prefix map[string]string `json:"prefix"`
 	Data   []*Triple         `json:"data"`
+	Strict bool              `json:"strict"`
 }
 
-// DataResponse for add and remove.
+// DataResponse for add and remove, Data is the number of triples added
+// and Result reports each add and remove, see BulkResult.
 type DataResponse struct {
-	Graph string `json:"graph"`
-	Data  uint   `json:"data"`
+	Graph  string      `json:"graph"`
+	Data   uint        `json:"data"`
+	Result *BulkResult `json:"result,omitempty"`
 }
 
 // TriplesRequest is the json used to query the triples endpoint.
@@ -47,12 +58,22 @@ type TriplesRequest struct {
 	Limit   uint              `json:"limit"`
 	Offset  uint              `json:"offset"`
 	OrderBy string            `json:"orderby"`
+
+	// Entailment also returns the consequences of the triples, see
+	// Options.Entailment.
+	Entailment string `json:"entailment"`
+
+	// Page returns at most page triples and a cursor if there are more,
+	// Cursor continues reading from one.
+	Page   uint   `json:"page"`
+	Cursor string `json:"cursor"`
 }
 
 // TriplesResponse is whats returned from the triples endpoint.
 type TriplesResponse struct {
-	Graph string    `json:"graph"`
-	Data  []*Triple `json:"data"`
+	Graph  string    `json:"graph"`
+	Data   []*Triple `json:"data"`
+	Cursor string    `json:"cursor,omitempty"`
 }
 
 // TriplesCountResponse returns the number of triples for a request.
@@ -88,12 +109,31 @@ type QueryRequest struct {
 	Offset   uint              `json:"offset"`
 	OrderBy  string            `json:"orderby"`
 	Filter   []*Filter         `json:"filter"`
+	Where    *Expr             `json:"where"`
+
+	GroupBy    []string     `json:"groupby"`
+	Aggregates []*Aggregate `json:"aggregates"`
+	Having     *Expr        `json:"having"`
+
+	Graphs       []string        `json:"graphs"`
+	ClauseGraphs map[uint]string `json:"clausegraphs"`
+	Entailment   string          `json:"entailment"`
+
+	// Explain returns the plan for the query without running it.
+	Explain bool `json:"explain"`
+
+	// Page returns at most page results and a cursor if there are more,
+	// Cursor continues reading from one.
+	Page   uint   `json:"page"`
+	Cursor string `json:"cursor"`
 }
 
 // QueryResponse is whats returned from the query endpoint.
 type QueryResponse struct {
-	Graph string     `json:"graph"`
-	Data  []Bindings `json:"data"`
+	Graph  string     `json:"graph"`
+	Data   []Bindings `json:"data"`
+	Plan   *QueryPlan `json:"plan,omitempty"`
+	Cursor string     `json:"cursor,omitempty"`
 }
 
 // QueryCountResponse returns the number of results for a query.
@@ -103,11 +143,117 @@ type QueryCountResponse struct {
 	Data    uint `json:"data"`
 }
 
-// PathResponse returns a path for given query.
+// PathRequest asks for the shortest paths between two nodes, see
+// Graph.ShortestPaths. With Name start and end are the values of the
+// name predicate of the nodes instead of their ids.
+type PathRequest struct {
+	Graph     string            `json:"graph"`
+	Prefix    map[string]string `json:"prefix"`
+	Start     string            `json:"start"`
+	End       string            `json:"end"`
+	Name      string            `json:"name"`
+	Edges     []*PathEdge       `json:"edges"`
+	Heuristic *PathHeuristic    `json:"heuristic"`
+	K         int               `json:"k"`
+}
+
+// PathResponse returns the paths for a request.
 type PathResponse struct {
 	Graph  string            `json:"graph"`
 	Prefix map[string]string `json:"prefix"`
-	Data   []string          `json:"data"`
+	Data   []*PathResult     `json:"data"`
+}
+
+// SubgraphRequest asks for the nodes and edges around seed nodes, see
+// Graph.Subgraph.
+type SubgraphRequest struct {
+	Graph    string            `json:"graph"`
+	Prefix   map[string]string `json:"prefix"`
+	Seeds    []string          `json:"seeds"`
+	Depth    int               `json:"depth"`
+	Include  []string          `json:"include"`
+	Exclude  []string          `json:"exclude"`
+	MaxNodes int               `json:"max_nodes"`
+	MaxEdges int               `json:"max_edges"`
+}
+
+// SubgraphResponse returns the subgraph for a request.
+type SubgraphResponse struct {
+	Graph  string            `json:"graph"`
+	Prefix map[string]string `json:"prefix"`
+	Data   *Subgraph         `json:"data"`
+}
+
+// AnalyticsRequest runs an analytics algorithm on a graph, see
+// Graph.Analytics.
+type AnalyticsRequest struct {
+	Graph      string            `json:"graph"`
+	Prefix     map[string]string `json:"prefix"`
+	Algorithm  string            `json:"algorithm"`
+	Preds      []string          `json:"preds"`
+	Damping    float64           `json:"damping"`
+	Iterations int               `json:"iterations"`
+	Tolerance  float64           `json:"tolerance"`
+	Write      bool              `json:"write"`
+	Async      bool              `json:"async"` // run as a job, see JobsHandler
+}
+
+// AnalyticsResponse returns the results of each node for a request.
+type AnalyticsResponse struct {
+	Graph  string              `json:"graph"`
+	Prefix map[string]string   `json:"prefix"`
+	Data   map[string]Bindings `json:"data"`
+}
+
+// TransactionRequest begins or writes to a transaction, see Graph.Begin.
+// Remove is applied before Add and with Commit the transaction is
+// committed after them.
+type TransactionRequest struct {
+	Graph  string            `json:"graph"`
+	Prefix map[string]string `json:"prefix"`
+	Add    []*Triple         `json:"add"`
+	Remove []*Triple         `json:"remove"`
+	Commit bool              `json:"commit"`
+}
+
+// TransactionResponse returns the id and number of operations of an open
+// transaction, or the result of a committed one.
+type TransactionResponse struct {
+	Graph string    `json:"graph"`
+	ID    string    `json:"id,omitempty"`
+	Ops   int       `json:"ops"`
+	Data  *TxResult `json:"data,omitempty"`
+}
+
+// JobResponse returns the status of a job.
+type JobResponse struct {
+	Data *Job `json:"data"`
+}
+
+// JobsResponse returns the status of every job.
+type JobsResponse struct {
+	Data []*Job `json:"data"`
+}
+
+// TriggersResponse returns the triggers of a graph.
+type TriggersResponse struct {
+	Graph string   `json:"graph"`
+	Data  []string `json:"data"`
+}
+
+// RuleRequest registers a rule on a graph, see ParseRule. Prefixes are
+// replaced in the rule.
+type RuleRequest struct {
+	Graph  string            `json:"graph"`
+	Prefix map[string]string `json:"prefix"`
+	Name   string            `json:"name"`
+	Rule   string            `json:"rule"`
+}
+
+// RulesResponse returns the rules of a graph.
+type RulesResponse struct {
+	Graph string  `json:"graph"`
+	Data  []*Rule `json:"data"`
 }
 
 // PrefixMap replaces in place defined prefixes in a set of triples.
@@ -194,6 +340,12 @@ func (a *API) IndexHandler(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		b = true
 	}
+	if async, _ := strconv.ParseBool(req.FormValue("async")); async {
+		a.startJob(w, "index", name, func(ctx context.Context) (interface{}, error) {
+			return nil, a.Driver.Index(name, b)
+		})
+		return
+	}
 	err = a.Driver.Index(name, b)
 	if err != nil {
 		log.Error(err)
@@ -225,7 +377,13 @@ func (a *API) DropHandler(w http.ResponseWriter, req *http.Request) {
 		return
 
 	}
-	err := a.Driver.Drop(name)
+	var err error
+	// dropping through the graph drops its entailed consequences too
+	if g, ok := a.Driver.Graph(name); ok {
+		err = g.Drop(name)
+	} else {
+		err = a.Driver.Drop(name)
+	}
 	if err != nil {
 		e := internalServerError(err.Error() + " graph:" + name)
 		log.Error(e)
@@ -269,6 +427,8 @@ func (a *API) GraphsListHandler(w http.ResponseWriter, req *http.Request) {
 //		["_:1", "rdf:type", "foaf:Person"],
 //	]
 // }
+// The response reports the inserted, duplicate and invalid triples, with
+// strict an invalid triple rejects the whole request with a 400.
 func (a *API) DataHandler(w http.ResponseWriter, req *http.Request) {
 	if req.Body == nil {
 		http.Error(w, "no request body", http.StatusBadRequest)
@@ -302,40 +462,40 @@ func (a *API) DataHandler(w http.ResponseWriter, req *http.Request) {
 
 	PrefixMap(data.Prefix, data.Data)
 
+	var result *BulkResult
 	switch req.Method {
 	case "POST":
-		total, err := g.AddBulk(data.Graph, data.Data)
-		if err != nil {
-			e := badRequest(err.Error())
-			log.Error(e)
-			http.Error(w, e["err"].(string), http.StatusBadRequest)
-			return
-		}
-		p, err := json.Marshal(&DataResponse{Graph: data.Graph, Data: uint(total)})
-		if err != nil {
-			e := internalServerError(err.Error())
-			log.Error(e)
-			http.Error(w, e["err"].(string), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprint(w, string(p))
-		return
+		result, err = g.AddBulkReport(data.Graph, data.Data, data.Strict)
 	case "DELETE":
-		err := g.RemoveBulk(data.Graph, data.Data)
-		if err != nil {
-			e := badRequest(err.Error())
-			log.Error(e)
-			http.Error(w, e["err"].(string), http.StatusBadRequest)
-			return
-		}
+		result, err = g.RemoveBulkReport(data.Graph, data.Data, data.Strict)
+	default:
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+	code := http.StatusOK
+	if err == ErrInvalidTriples {
+		// the result says which triples were rejected
+		log.Error(badRequest(err.Error()))
+		code = http.StatusBadRequest
+	} else if err != nil {
+		e := badRequest(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
 
-		fmt.Fprint(w, "OK")
+	p, err := json.Marshal(&DataResponse{Graph: data.Graph, Data: uint(result.Inserted), Result: result})
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
 		return
 	}
-	e := methodNotAllowed(req.Method)
-	log.Error(e)
-	http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprint(w, string(p))
 }
 
 // ValueHandler returns a singular value given a sub, pred, obj
@@ -362,6 +522,9 @@ func (a *API) ValueHandler(w http.ResponseWriter, req *http.Request) {
 
 	data := ValueRequest{}
 	err = json.Unmarshal(body, &data)
+	if err == nil {
+		data.Obj, err = typedValue(data.Obj)
+	}
 	if err != nil {
 		e := badRequest(err.Error() + string(body))
 		log.Error(e)
@@ -424,6 +587,9 @@ func (a *API) TriplesHandler(w http.ResponseWriter, req *http.Request) {
 
 	data := TriplesRequest{}
 	err = json.Unmarshal(body, &data)
+	if err == nil {
+		data.Obj, err = typedValue(data.Obj)
+	}
 	if err != nil {
 		e := badRequest(err.Error() + string(body))
 		log.Error(e)
@@ -431,6 +597,18 @@ func (a *API) TriplesHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if data.Cursor != "" {
+		c, ok := a.cursors.take(data.Cursor, cursorTriples)
+		if !ok {
+			e := badRequest("Cursor not found: " + data.Cursor)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		a.writeResults(w, req, c, data.Page)
+		return
+	}
+
 	g, ok := a.Graph(data.Graph)
 	if !ok {
 		e := badRequest("Graph not found: " + data.Graph)
@@ -440,30 +618,13 @@ func (a *API) TriplesHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	sub, pred, obj := PrefixMapTriple(data.Prefix, data.Sub, data.Pred, data.Obj)
-	opts := &Options{Limit: data.Limit, Offset: data.Offset, OrderBy: data.OrderBy}
-	triples, err := g.Triples(sub, pred, obj, opts)
-	if err != nil {
-		e := internalServerError(err.Error())
-		log.Error(e)
-		http.Error(w, e["err"].(string), http.StatusInternalServerError)
-		return
-	}
-
-	triplesResponse := TriplesResponse{}
-	for _, triple := range triples {
-		triplesResponse.Data = append(triplesResponse.Data, triple)
-	}
-	triplesResponse.Graph = data.Graph
-	p, err := json.Marshal(triplesResponse)
-	if err != nil {
-		e := internalServerError(err.Error())
-		log.Error(e)
-		http.Error(w, e["err"].(string), http.StatusInternalServerError)
-		return
+	opts := &Options{Limit: data.Limit, Offset: data.Offset, OrderBy: data.OrderBy, Entailment: data.Entailment}
+	c := &cursor{
+		kind:  cursorTriples,
+		graph: data.Graph,
+		iter:  tripleResults{g.TriplesIter(sub, pred, obj, opts)},
 	}
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprint(w, string(p))
-	return
+	a.writeResults(w, req, c, data.Page)
 }
 
 // TriplesCountHandler returns the number of triples for a query.
@@ -490,6 +651,9 @@ func (a *API) TriplesCountHandler(w http.ResponseWriter, req *http.Request) {
 
 	data := TriplesRequest{}
 	err = json.Unmarshal(body, &data)
+	if err == nil {
+		data.Obj, err = typedValue(data.Obj)
+	}
 	if err != nil {
 		e := badRequest(err.Error() + string(body))
 		log.Error(e)
@@ -558,6 +722,21 @@ func (a *API) QueryHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if data.Cursor != "" {
+		c, ok := a.cursors.take(data.Cursor, cursorQuery)
+		if !ok {
+			e := badRequest("Cursor not found: " + data.Cursor)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		a.writeResults(w, req, c, data.Page)
+		return
+	}
+
+	if data.Graph == "" && len(data.Graphs) > 0 {
+		data.Graph = data.Graphs[0]
+	}
 	g, ok := a.Graph(data.Graph)
 	if !ok {
 		e := badRequest("Graph not found: " + data.Graph)
@@ -566,6 +745,29 @@ func (a *API) QueryHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// other graphs have to exist
+	names := append([]string{}, data.Graphs...)
+	for _, name := range data.ClauseGraphs {
+		if !strings.HasPrefix(name, "?") {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if _, ok := a.Driver.Graph(name); !ok {
+			e := badRequest("Graph not found: " + name)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = PrefixMapPaths(data.Prefix, data.Data)
+	if err != nil {
+		e := badRequest(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
 	PrefixMap(data.Prefix, data.Data)
 
 	opts := &Options{
@@ -575,17 +777,45 @@ func (a *API) QueryHandler(w http.ResponseWriter, req *http.Request) {
 		Offset:   data.Offset,
 		OrderBy:  data.OrderBy,
 		Filter:   data.Filter,
+		Where:    data.Where,
 		Distinct: data.Distinct,
+
+		GroupBy:    data.GroupBy,
+		Aggregates: data.Aggregates,
+		Having:     data.Having,
+
+		Graphs:       data.Graphs,
+		ClauseGraphs: data.ClauseGraphs,
+		Entailment:   data.Entailment,
+	}
+	if data.Explain {
+		queryResponse := QueryResponse{Graph: data.Graph, Plan: g.Plan(data.Data, opts)}
+		p, err := json.Marshal(queryResponse)
+		if err != nil {
+			e := internalServerError(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(p))
+		return
 	}
-	bindings := g.Query(data.Data, opts)
-	queryResponse := QueryResponse{Graph: data.Graph, Data: bindings}
 
 	// return count if requested
 	if len(data.Select) > 0 && data.Select[0] == "?COUNT" {
+		opts.Select = nil
+		count, err := g.QueryCount(data.Data, opts)
+		if err != nil {
+			e := internalServerError(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusInternalServerError)
+			return
+		}
 		queryResponse := QueryCountResponse{
 			Graph:   data.Graph,
 			Request: data,
-			Data:    uint(len(bindings)),
+			Data:    count,
 		}
 		p, err := json.Marshal(queryResponse)
 		if err != nil {
@@ -599,7 +829,105 @@ func (a *API) QueryHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	p, err := json.Marshal(queryResponse)
+	iter := g.QueryIter(data.Data, opts)
+	c := &cursor{kind: cursorQuery, graph: data.Graph, iter: bindingResults{iter}}
+	a.writeResults(w, req, c, data.Page)
+}
+
+// NDJSONContentType is accepted by the triples and query endpoints to
+// stream one json result per line.
+const NDJSONContentType = "application/x-ndjson"
+
+// ndjsonFlush is the number of lines written between flushes.
+const ndjsonFlush = 100
+
+// writeResults writes up to page results of a cursor, all of them if page
+// is 0. While there are more the cursor is kept open and its id returned,
+// in the X-Cursor header for ndjson.
+func (a *API) writeResults(w http.ResponseWriter, req *http.Request, c *cursor, page uint) {
+	ndjson := strings.Contains(req.Header.Get("Accept"), NDJSONContentType)
+	if ndjson && page == 0 {
+		// nothing to page, stream every result as it is read
+		defer c.iter.Close()
+		w.Header().Set("Content-Type", NDJSONContentType)
+		enc := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		n := 0
+		for val, ok := c.next(); ok; val, ok = c.next() {
+			err := enc.Encode(val)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			n++
+			if flusher != nil && n%ndjsonFlush == 0 {
+				flusher.Flush()
+			}
+		}
+		if err := c.iter.Err(); err != nil {
+			// the status is already sent, the error is the last line
+			e := internalServerError(err.Error())
+			log.Error(e)
+			enc.Encode(map[string]interface{}{"err": e["err"]})
+		}
+		return
+	}
+
+	vals, more := c.page(page)
+	if err := c.iter.Err(); err != nil {
+		c.iter.Close()
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	id := ""
+	if more {
+		var err error
+		id, err = a.cursors.put(c)
+		if err != nil {
+			c.iter.Close()
+			e := internalServerError(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		c.iter.Close()
+	}
+
+	if ndjson {
+		if id != "" {
+			w.Header().Set("X-Cursor", id)
+		}
+		w.Header().Set("Content-Type", NDJSONContentType)
+		enc := json.NewEncoder(w)
+		for _, val := range vals {
+			err := enc.Encode(val)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+		}
+		return
+	}
+
+	var resp interface{}
+	switch c.kind {
+	case cursorTriples:
+		triplesResponse := TriplesResponse{Graph: c.graph, Cursor: id}
+		for _, val := range vals {
+			triplesResponse.Data = append(triplesResponse.Data, val.(*Triple))
+		}
+		resp = triplesResponse
+	case cursorQuery:
+		queryResponse := QueryResponse{Graph: c.graph, Cursor: id}
+		for _, val := range vals {
+			queryResponse.Data = append(queryResponse.Data, val.(Bindings))
+		}
+		resp = queryResponse
+	}
+	p, err := json.Marshal(resp)
 	if err != nil {
 		e := internalServerError(err.Error())
 		log.Error(e)
@@ -608,33 +936,54 @@ func (a *API) QueryHandler(w http.ResponseWriter, req *http.Request) {
 	}
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprint(w, string(p))
-	return
 }
 
-// InferenceHandler ...
-func (a *API) InferenceHandler(w http.ResponseWriter, req *http.Request) {
-	if req.Body == nil {
-		http.Error(w, "no request body", http.StatusBadRequest)
+// SPARQLHandler runs a SPARQL SELECT query and returns W3C SPARQL JSON results.
+// The query is the query form value or a POST body with content type
+// application/sparql-query, the graph is the graph or default-graph-uri value.
+func (a *API) SPARQLHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "POST" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
 		return
 	}
 
-	if req.Method != "PUT" {
-		e := methodNotAllowed(req.Method)
+	var query string
+	if req.Method == "POST" && strings.HasPrefix(req.Header.Get("Content-Type"), "application/sparql-query") {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		query = string(body)
+	} else {
+		query = req.FormValue("query")
+	}
+	if query == "" {
+		e := badRequest("query not provided")
 		log.Error(e)
-		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
 		return
 	}
 
-	inferenceVar := req.FormValue("inference")
-	graphName := req.FormValue("graph")
-	inf, ok := Inferences[inferenceVar]
-	if !ok {
-		e := badRequest("Inference not found: " + inferenceVar)
+	q, err := ParseSPARQL(query)
+	if err != nil {
+		e := badRequest(err.Error())
 		log.Error(e)
 		http.Error(w, e["err"].(string), http.StatusBadRequest)
 		return
 	}
 
+	graphName := req.FormValue("graph")
+	if graphName == "" {
+		graphName = req.FormValue("default-graph-uri")
+	}
+	if graphName == "" && len(q.Options.Graphs) > 0 {
+		graphName = q.Options.Graphs[0]
+	}
 	g, ok := a.Graph(graphName)
 	if !ok {
 		e := badRequest("Graph not found: " + graphName)
@@ -642,76 +991,1002 @@ func (a *API) InferenceHandler(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, e["err"].(string), http.StatusBadRequest)
 		return
 	}
+	q.Options.Entailment = req.FormValue("entailment")
 
-	g.ApplyInference(inf)
-	fmt.Fprint(w, "OK")
+	p, err := json.Marshal(q.Results(q.Run(g)))
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/sparql-results+json")
+	fmt.Fprint(w, string(p))
 }
 
-// PathHandler returns path from a start to end.
-func (a *API) PathHandler(w http.ResponseWriter, req *http.Request) {
+// rdfContentTypes maps import and export formats to their content types.
+var rdfContentTypes = map[string]string{
+	FormatCSV:      "text/csv",
+	FormatNTriples: "application/n-triples",
+	FormatTurtle:   "text/turtle",
+}
+
+// rdfFormat returns the format given by name or content type, it
+// defaults to ntriples.
+func rdfFormat(format, contentType string) (string, bool) {
+	if format != "" {
+		_, ok := rdfContentTypes[format]
+		return format, ok
+	}
+	for f, ct := range rdfContentTypes {
+		if strings.HasPrefix(contentType, ct) {
+			return f, true
+		}
+	}
+	return FormatNTriples, true
+}
+
+// ImportHandler streams csv, ntriples or turtle from the request body
+// into a graph.
+func (a *API) ImportHandler(w http.ResponseWriter, req *http.Request) {
 	if req.Body == nil {
 		http.Error(w, "no request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Method != "GET" {
+	if req.Method != "POST" {
 		e := methodNotAllowed(req.Method)
 		log.Error(e)
 		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
 		return
 	}
 
-	start := req.FormValue("start")
-	end := req.FormValue("end")
-	predName := req.FormValue("predicateName")
-	predAdj := req.FormValue("predicateAdjacent")
-	graphName := req.FormValue("graph")
-	g, ok := a.Graph(graphName)
+	format, ok := rdfFormat(req.URL.Query().Get("format"), req.Header.Get("Content-Type"))
 	if !ok {
-		e := badRequest("Graph not found: " + graphName)
+		e := badRequest("Unknown format: " + format)
 		log.Error(e)
 		http.Error(w, e["err"].(string), http.StatusBadRequest)
 		return
 	}
 
-	result, err := g.Path(start, end, predName, predAdj)
-	if err != nil {
-		e := badRequest(err.Error())
+	graphName := req.URL.Query().Get("graph")
+	if graphName == "" {
+		e := badRequest("graph not provided")
 		log.Error(e)
 		http.Error(w, e["err"].(string), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	resp := PathResponse{Graph: graphName, Data: result}
-	p, err := json.Marshal(resp)
-	if err != nil {
-		e := internalServerError(err.Error())
+	g, ok := a.Graph(graphName)
+	if !ok {
+		e := badRequest("Graph not found: " + graphName)
 		log.Error(e)
-		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprint(w, string(p))
-}
-
-// Run starts up a server and endpoints. It serves
-// files from the web directory.
-func (a *API) Run() {
-	http.HandleFunc("/v1/ping", a.PingHandler)
-	http.HandleFunc("/v1/graphs", a.GraphsListHandler)
-	http.HandleFunc("/v1/data", a.DataHandler)
+	if async, _ := strconv.ParseBool(req.URL.Query().Get("async")); async {
+		// the body is gone after the request, the job reads a copy
+		f, err := ioutil.TempFile("", "pfftdb-import")
+		if err != nil {
+			e := internalServerError(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusInternalServerError)
+			return
+		}
+		if _, err := io.Copy(f, req.Body); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		a.startJob(w, "import", graphName, func(ctx context.Context) (interface{}, error) {
+			defer os.Remove(f.Name())
+			defer f.Close()
+			if _, err := f.Seek(0, 0); err != nil {
+				return 0, err
+			}
+			return g.ImportContext(ctx, f, format)
+		})
+		return
+	}
+
+	total, err := g.Import(req.Body, format)
+	if err != nil {
+		e := badRequest(fmt.Sprintf("%s, %d triples added", err, total))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	p, err := json.Marshal(&DataResponse{Graph: graphName, Data: uint(total)})
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(p))
+}
+
+// graphContentTypes maps graph export formats to their content types.
+var graphContentTypes = map[string]string{
+	FormatGraphML: "application/graphml+xml",
+	FormatGEXF:    "application/gexf+xml",
+	FormatDOT:     "text/vnd.graphviz",
+}
+
+// ExportHandler streams a graph as csv, ntriples or turtle, or as graphml,
+// gexf or dot. In the graph formats seed parameters export the subgraph
+// around them instead and a POST of a query exports the triples it
+// matched.
+func (a *API) ExportHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "POST" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the query string only, a posted query isn't a form
+	query := req.URL.Query()
+	format := query.Get("format")
+	contentType, ok := graphContentTypes[format]
+	if !ok {
+		format, ok = rdfFormat(format, "")
+		contentType = rdfContentTypes[format]
+	}
+	if !ok {
+		e := badRequest("Unknown format: " + format)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+	if (req.Method == "POST" || len(query["seed"]) > 0) && !graphFormat(format) {
+		e := badRequest("Subgraphs and queries export as graphml, gexf or dot, not " + format)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == "POST" {
+		a.exportQuery(w, req, format, contentType)
+		return
+	}
+
+	graphName := req.FormValue("graph")
+	g, ok := a.Driver.Graph(graphName)
+	if !ok {
+		e := badRequest("Graph not found: " + graphName)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	// prefix=foaf:http://xmlns.com/foaf/0.1/ for turtle, seeds and preds
+	prefixes := map[string]string{}
+	for _, prefix := range req.Form["prefix"] {
+		if i := strings.Index(prefix, ":"); i > 0 {
+			prefixes[prefix[:i]] = prefix[i+1:]
+		}
+	}
+
+	if len(req.Form["seed"]) > 0 {
+		options := &SubgraphOptions{}
+		var err error
+		for name, n := range map[string]*int{"depth": &options.Depth, "max_nodes": &options.MaxNodes, "max_edges": &options.MaxEdges} {
+			if v := req.FormValue(name); v != "" && err == nil {
+				*n, err = strconv.Atoi(v)
+			}
+		}
+		for _, seed := range req.Form["seed"] {
+			seed, _, _ = PrefixMapTriple(prefixes, seed, "", nil)
+			options.Seeds = append(options.Seeds, seed)
+		}
+		for _, pred := range req.Form["include"] {
+			_, pred, _ = PrefixMapTriple(prefixes, "", pred, nil)
+			options.Include = append(options.Include, pred)
+		}
+		for _, pred := range req.Form["exclude"] {
+			_, pred, _ = PrefixMapTriple(prefixes, "", pred, nil)
+			options.Exclude = append(options.Exclude, pred)
+		}
+		var sg *Subgraph
+		if err == nil {
+			sg, err = g.Subgraph(options)
+		}
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		err = sg.export(w, format, g.GraphID)
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	err := g.Export(w, format, prefixes)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// exportQuery exports the triples matched by the query in the request
+// body, see Graph.QuerySubgraph.
+func (a *API) exportQuery(w http.ResponseWriter, req *http.Request, format, contentType string) {
+	if req.Body == nil {
+		http.Error(w, "no request body", http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	data := QueryRequest{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	g, ok := a.Driver.Graph(data.Graph)
+	if !ok {
+		e := badRequest("Graph not found: " + data.Graph)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	err = PrefixMapPaths(data.Prefix, data.Data)
+	if err != nil {
+		e := badRequest(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+	PrefixMap(data.Prefix, data.Data)
+
+	opts := &Options{
+		Optional: data.Optional,
+		Limit:    data.Limit,
+		Offset:   data.Offset,
+		OrderBy:  data.OrderBy,
+		Filter:   data.Filter,
+		Where:    data.Where,
+		Distinct: data.Distinct,
+
+		Graphs:       data.Graphs,
+		ClauseGraphs: data.ClauseGraphs,
+		Entailment:   data.Entailment,
+	}
+	w.Header().Set("Content-Type", contentType)
+	err = g.QuerySubgraph(data.Data, opts).export(w, format, g.GraphID)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// InferenceHandler applies an inference to a graph as a job, its result
+// is the report of the inference, see JobsHandler.
+func (a *API) InferenceHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		http.Error(w, "no request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method != "PUT" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	inferenceVar := req.FormValue("inference")
+	graphName := req.FormValue("graph")
+	inf, ok := Inferences[inferenceVar]
+	if !ok {
+		e := badRequest("Inference not found: " + inferenceVar)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	g, ok := a.Graph(graphName)
+	if !ok {
+		e := badRequest("Graph not found: " + graphName)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	a.startJob(w, "inference", graphName, func(ctx context.Context) (interface{}, error) {
+		return g.ApplyInferenceContext(ctx, inf)
+	})
+}
+
+// startJob starts a task as a job and responds with its status, see
+// JobsHandler.
+func (a *API) startJob(w http.ResponseWriter, kind, graph string, task func(ctx context.Context) (interface{}, error)) {
+	id, err := a.jobs.start(kind, graph, task)
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	job, _ := a.jobs.get(id)
+	p, err := json.Marshal(&JobResponse{Data: job})
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/v1/jobs/"+id)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprint(w, string(p))
+}
+
+// JobsHandler lists the jobs with GET /v1/jobs, returns the status of one
+// with GET /v1/jobs/{id} and cancels it with DELETE /v1/jobs/{id}.
+func (a *API) JobsHandler(w http.ResponseWriter, req *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(req.URL.Path, "/v1/jobs"), "/")
+
+	var resp interface{}
+	switch {
+	case req.Method == "GET" && id == "":
+		resp = &JobsResponse{Data: a.jobs.list()}
+	case req.Method == "GET" || req.Method == "DELETE":
+		get := a.jobs.get
+		if req.Method == "DELETE" {
+			get = a.jobs.cancel
+		}
+		job, ok := get(id)
+		if !ok {
+			e := badRequest("Job not found: " + id)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusNotFound)
+			return
+		}
+		resp = &JobResponse{Data: job}
+	default:
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, err := json.Marshal(resp)
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(p))
+}
+
+// transactionRequest reads a transaction request and its operations.
+func transactionRequest(req *http.Request) (*TransactionRequest, []*TxOp, error) {
+	if req.Body == nil {
+		return nil, nil, fmt.Errorf("no request body")
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v%s", err, body)
+	}
+	data := &TransactionRequest{}
+	err = json.Unmarshal(body, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v%s", err, body)
+	}
+	PrefixMap(data.Prefix, data.Remove)
+	PrefixMap(data.Prefix, data.Add)
+	ops := append(txOps(TxRemove, data.Remove), txOps(TxAdd, data.Add)...)
+	return data, ops, nil
+}
+
+// TransactionHandler begins a transaction with POST /v1/transaction,
+// writes to it with PUT /v1/transaction/{id}, returns its state with GET
+// and rolls it back with DELETE. Either request commits it with commit,
+// a POST which commits returns the result without keeping the
+// transaction.
+func (a *API) TransactionHandler(w http.ResponseWriter, req *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(req.URL.Path, "/v1/transaction"), "/")
+
+	if (req.Method == "POST") != (id == "") {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := http.StatusOK
+	var ot *openTx
+	var data *TransactionRequest
+	var ops []*TxOp
+	var err error
+	switch req.Method {
+	case "POST":
+		data, ops, err = transactionRequest(req)
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		g, ok := a.Graph(data.Graph)
+		if !ok {
+			e := badRequest("Graph not found: " + data.Graph)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		ot = &openTx{tx: g.Begin(), graph: data.Graph}
+	case "PUT":
+		data, ops, err = transactionRequest(req)
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		fallthrough
+	case "GET", "DELETE":
+		get := a.transactions.get
+		if req.Method == "DELETE" || data != nil && data.Commit {
+			get = a.transactions.take
+		}
+		var ok bool
+		ot, ok = get(id)
+		if !ok {
+			e := badRequest("Transaction not found: " + id)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusNotFound)
+			return
+		}
+	default:
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if data != nil {
+		err = ot.tx.Push(ops...)
+		if err != nil {
+			if data.Commit {
+				ot.tx.Rollback()
+			}
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp := &TransactionResponse{Graph: ot.graph, ID: id, Ops: ot.tx.Len()}
+	switch {
+	case req.Method == "DELETE":
+		ot.tx.Rollback()
+		resp.Ops = 0
+	case data != nil && data.Commit:
+		resp.Data, err = ot.tx.Commit()
+		if err != nil {
+			e := internalServerError(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusInternalServerError)
+			return
+		}
+	case req.Method == "POST":
+		resp.ID, err = a.transactions.put(ot.graph, ot.tx)
+		if err != nil {
+			e := internalServerError(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", "/v1/transaction/"+resp.ID)
+		code = http.StatusCreated
+	}
+
+	p, err := json.Marshal(resp)
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprint(w, string(p))
+}
+
+// PathHandler returns the shortest paths from a start to end.
+func (a *API) PathHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		http.Error(w, "no request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method != "POST" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	data := PathRequest{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	g, ok := a.Graph(data.Graph)
+	if !ok {
+		e := badRequest("Graph not found: " + data.Graph)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	start, end := data.Start, data.End
+	name := data.Name
+	for _, edge := range data.Edges {
+		if edge != nil {
+			_, edge.Pred, _ = PrefixMapTriple(data.Prefix, "", edge.Pred, nil)
+			_, edge.Weight, _ = PrefixMapTriple(data.Prefix, "", edge.Weight, nil)
+		}
+	}
+	if h := data.Heuristic; h != nil {
+		_, h.Lat, _ = PrefixMapTriple(data.Prefix, "", h.Lat, nil)
+		_, h.Lng, _ = PrefixMapTriple(data.Prefix, "", h.Lng, nil)
+	}
+	if name != "" {
+		_, name, _ = PrefixMapTriple(data.Prefix, "", name, nil)
+		start, err = g.Node(name, start)
+		if err == nil {
+			end, err = g.Node(name, end)
+		}
+	} else {
+		start, _, _ = PrefixMapTriple(data.Prefix, start, "", nil)
+		end, _, _ = PrefixMapTriple(data.Prefix, end, "", nil)
+	}
+	var result []*PathResult
+	if err == nil {
+		result, err = g.ShortestPaths(start, end, &PathOptions{Edges: data.Edges, Heuristic: data.Heuristic, K: data.K})
+	}
+	if err != nil {
+		e := badRequest(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+	resp := PathResponse{Graph: data.Graph, Prefix: data.Prefix, Data: result}
+	p, err := json.Marshal(resp)
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(p))
+}
+
+// SubgraphHandler returns the nodes and edges around seed nodes, for the
+// web visualization.
+func (a *API) SubgraphHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		http.Error(w, "no request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method != "POST" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	data := SubgraphRequest{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	g, ok := a.Graph(data.Graph)
+	if !ok {
+		e := badRequest("Graph not found: " + data.Graph)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	options := &SubgraphOptions{Depth: data.Depth, MaxNodes: data.MaxNodes, MaxEdges: data.MaxEdges}
+	for _, seed := range data.Seeds {
+		seed, _, _ = PrefixMapTriple(data.Prefix, seed, "", nil)
+		options.Seeds = append(options.Seeds, seed)
+	}
+	for _, pred := range data.Include {
+		_, pred, _ = PrefixMapTriple(data.Prefix, "", pred, nil)
+		options.Include = append(options.Include, pred)
+	}
+	for _, pred := range data.Exclude {
+		_, pred, _ = PrefixMapTriple(data.Prefix, "", pred, nil)
+		options.Exclude = append(options.Exclude, pred)
+	}
+	result, err := g.Subgraph(options)
+	if err != nil {
+		e := badRequest(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+	resp := SubgraphResponse{Graph: data.Graph, Prefix: data.Prefix, Data: result}
+	p, err := json.Marshal(resp)
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(p))
+}
+
+// AnalyticsHandler runs an analytics algorithm and returns the results of
+// each node.
+func (a *API) AnalyticsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		http.Error(w, "no request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method != "POST" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	data := AnalyticsRequest{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		e := badRequest(err.Error() + string(body))
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	g, ok := a.Graph(data.Graph)
+	if !ok {
+		e := badRequest("Graph not found: " + data.Graph)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	for i, pred := range data.Preds {
+		_, data.Preds[i], _ = PrefixMapTriple(data.Prefix, "", pred, nil)
+	}
+	options := &AnalyticsOptions{
+		Preds:      data.Preds,
+		Damping:    data.Damping,
+		Iterations: data.Iterations,
+		Tolerance:  data.Tolerance,
+		Write:      data.Write,
+	}
+	if data.Async {
+		if _, ok := analyticsAlgorithms[data.Algorithm]; !ok {
+			e := badRequest("Unknown algorithm: " + data.Algorithm)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		a.startJob(w, "analytics", data.Graph, func(ctx context.Context) (interface{}, error) {
+			return g.AnalyticsContext(ctx, data.Algorithm, options)
+		})
+		return
+	}
+	result, err := g.Analytics(data.Algorithm, options)
+	if err != nil {
+		e := badRequest(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+	resp := AnalyticsResponse{Graph: data.Graph, Prefix: data.Prefix, Data: result}
+	p, err := json.Marshal(resp)
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(p))
+}
+
+// RulesHandler lists the rules of a graph with GET, registers one with POST
+// and removes one by name with DELETE. Rules are applied by the rules
+// inference.
+func (a *API) RulesHandler(w http.ResponseWriter, req *http.Request) {
+	var g *Graph
+	var ok bool
+	switch req.Method {
+	case "GET", "DELETE":
+		graphName := req.FormValue("graph")
+		g, ok = a.Graph(graphName)
+		if !ok {
+			e := badRequest("Graph not found: " + graphName)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+	case "POST":
+		if req.Body == nil {
+			http.Error(w, "no request body", http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			e := badRequest(err.Error() + string(body))
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		data := RuleRequest{}
+		err = json.Unmarshal(body, &data)
+		if err != nil {
+			e := badRequest(err.Error() + string(body))
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		g, ok = a.Graph(data.Graph)
+		if !ok {
+			e := badRequest("Graph not found: " + data.Graph)
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		rule, err := ParseRule(data.Name, data.Rule)
+		if err == nil {
+			PrefixMap(data.Prefix, rule.Head)
+			err = PrefixMapPaths(data.Prefix, rule.Body)
+		}
+		if err == nil {
+			PrefixMap(data.Prefix, rule.Body)
+			err = g.AddRule(rule)
+		}
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "OK")
+		return
+	default:
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if req.Method == "DELETE" {
+		err := g.RemoveRule(req.FormValue("name"))
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "OK")
+		return
+	}
+
+	rules, err := g.Rules()
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	p, err := json.Marshal(RulesResponse{Graph: g.GraphID, Data: rules})
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(p))
+}
+
+// EntailmentHandler returns the default entailment mode of a graph with GET
+// and sets it with PUT, see Graph.SetEntailment.
+func (a *API) EntailmentHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "PUT" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	graphName := req.FormValue("graph")
+	g, ok := a.Graph(graphName)
+	if !ok {
+		e := badRequest("Graph not found: " + graphName)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == "PUT" {
+		err := g.SetEntailment(req.FormValue("entailment"))
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "OK")
+		return
+	}
+
+	mode, err := g.Entailment()
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, mode)
+}
+
+// TriggersHandler returns the triggers of a graph with GET and turns one
+// on or off with PUT, see Graph.SetTrigger.
+func (a *API) TriggersHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "PUT" {
+		e := methodNotAllowed(req.Method)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	graphName := req.FormValue("graph")
+	g, ok := a.Graph(graphName)
+	if !ok {
+		e := badRequest("Graph not found: " + graphName)
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == "PUT" {
+		on := true
+		if v := req.FormValue("on"); v != "" {
+			var err error
+			on, err = strconv.ParseBool(v)
+			if err != nil {
+				e := badRequest(err.Error())
+				log.Error(e)
+				http.Error(w, e["err"].(string), http.StatusBadRequest)
+				return
+			}
+		}
+		err := g.SetTrigger(req.FormValue("name"), on)
+		if err != nil {
+			e := badRequest(err.Error())
+			log.Error(e)
+			http.Error(w, e["err"].(string), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "OK")
+		return
+	}
+
+	names, err := g.Triggers()
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	p, err := json.Marshal(&TriggersResponse{Graph: graphName, Data: names})
+	if err != nil {
+		e := internalServerError(err.Error())
+		log.Error(e)
+		http.Error(w, e["err"].(string), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(p))
+}
+
+// Run starts up a server and endpoints. It serves
+// files from the web directory.
+func (a *API) Run() {
+	http.HandleFunc("/v1/ping", a.PingHandler)
+	http.HandleFunc("/v1/graphs", a.GraphsListHandler)
+	http.HandleFunc("/v1/data", a.DataHandler)
 	http.HandleFunc("/v1/triples", a.TriplesHandler)
 	http.HandleFunc("/v1/triples/count", a.TriplesCountHandler)
 	http.HandleFunc("/v1/value", a.ValueHandler)
 	http.HandleFunc("/v1/query", a.QueryHandler)
+	http.HandleFunc("/v1/sparql", a.SPARQLHandler)
+	http.HandleFunc("/v1/import", a.ImportHandler)
+	http.HandleFunc("/v1/export", a.ExportHandler)
 	http.HandleFunc("/v1/index", a.IndexHandler)
 	http.HandleFunc("/v1/drop", a.DropHandler)
 	http.HandleFunc("/v1/path", a.PathHandler)
+	http.HandleFunc("/v1/subgraph", a.SubgraphHandler)
+	http.HandleFunc("/v1/analytics", a.AnalyticsHandler)
+	http.HandleFunc("/v1/rules", a.RulesHandler)
+	http.HandleFunc("/v1/entailment", a.EntailmentHandler)
+	http.HandleFunc("/v1/triggers", a.TriggersHandler)
 	http.HandleFunc("/v1/inference", a.InferenceHandler)
-	// graph viz
+	http.HandleFunc("/v1/jobs", a.JobsHandler)
+	http.HandleFunc("/v1/jobs/", a.JobsHandler)
+	http.HandleFunc("/v1/transaction", a.TransactionHandler)
+	http.HandleFunc("/v1/transaction/", a.TransactionHandler)
+	// graph viz, the web directory overrides the embedded one
 	if a.WebDir != "" {
 		http.Handle("/", http.FileServer(http.Dir(a.WebDir)))
+	} else {
+		http.Handle("/", assetHandler{})
 	}
 	err := http.ListenAndServe(":"+a.Port, nil)
 	if err != nil {
@@ -719,12 +1994,16 @@ func (a *API) Run() {
 	}
 }
 
-// Close noop
+// Close stops reaping and closes the open cursors, cancels the running jobs and rolls back the
+// open transactions.
 func (a *API) Close() {
-
+	a.cursors.closeAll()
+	a.jobs.cancelAll()
+	a.transactions.rollbackAll()
 }
 
-// NewAPI creates an api server, it runs with a.Run() in a separate goroutine.
+// NewAPI creates an api server, it runs with a.Run() in a separate goroutine
+// and closes expired cursors every CursorReapInterval.
 func NewAPI(port, env, webDir string, driver Driver) (*API, error) {
 	a := &API{
 		Env:    env,
@@ -733,6 +2012,7 @@ func NewAPI(port, env, webDir string, driver Driver) (*API, error) {
 		WebDir: webDir,
 	}
 
+	a.cursors.reap(CursorReapInterval)
 	go a.Run()
 	return a, nil
 }
@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestPrefixMap(t *testing.T) {
@@ -150,31 +152,60 @@ func TestDataHandler(t *testing.T) {
 		t.Fatal(triples)
 	}
 
-	/*
-		// invalid triple
-		rec = fmt.Sprintf(`{
-			"graph": "%s",
-			"data":[
-				["a", "foaf:knows", "b"],
-				["b", "foaf:knows", "a"],
-				null
-			],
-			"prefix": {
-				"foaf": "http://foaf/"
-			}
-		}`, TESTGRAPH)
-
-		req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/data", APIPORT), strings.NewReader(rec))
+	// invalid triples are reported, strict rejects the batch
+	cleanupGraph()
+	defer cleanupGraph()
+	rec = fmt.Sprintf(`{
+		"graph": "%s",
+		"data":[
+			["a", "foaf:knows", "b"],
+			["b", "foaf:knows", "a"],
+			null,
+			["a", "foaf:knows", "b"],
+			["c", 1, "a"]
+		],
+		"prefix": {
+			"foaf": "http://foaf/"
+		}
+	}`, TESTGRAPH)
+	for _, strict := range []bool{true, false} {
+		body := strings.Replace(rec, `"data"`, fmt.Sprintf(`"strict": %v, "data"`, strict), 1)
+		req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/data", APIPORT), strings.NewReader(body))
 		if err != nil {
 			t.Fatal(err)
 		}
-
 		w = httptest.NewRecorder()
 		TESTAPI.DataHandler(w, req)
-		if w.Code != 400 {
-			t.Fatal(w.Code, w.Body.String())
+		resp := DataResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Result == nil {
+			t.Fatal(w.Code, w.Body.String(), err)
 		}
-	*/
+		result := resp.Result
+		if result.Invalid != 2 || len(result.Errors) != 2 || result.Errors[0].Index != 2 || result.Errors[1].Index != 4 {
+			t.Errorf("%+v", result)
+		}
+		count, _ := g.Count("", "", nil)
+		if strict && (w.Code != http.StatusBadRequest || result.Inserted != 0 || count != 0) {
+			t.Error("strict should reject the batch", w.Code, result, count)
+		}
+		if !strict && (w.Code != 200 || resp.Data != 2 || result.Inserted != 2 || result.Duplicate != 1 || count != 2) {
+			t.Error(w.Code, resp.Data, result, count)
+		}
+	}
+
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("http://localhost:%s/v1/data", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.DataHandler(w, req)
+	resp := DataResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != 200 || resp.Result.Invalid != 2 {
+		t.Error(w.Code, w.Body.String(), err)
+	}
+	if count, _ := g.Count("", "", nil); count != 0 {
+		t.Error(count)
+	}
 }
 
 func TestValueHandler(t *testing.T) {
@@ -310,6 +341,204 @@ func TestQueryHandler(t *testing.T) {
 	}
 }
 
+func TestQueryGraphsHandler(t *testing.T) {
+	defer STORE.Driver.RemoveAll(TESTGRAPH2)
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	g.Add("a", "livesAt", "loc")
+	g2, _ := STORE.Driver.Graph(TESTGRAPH2)
+	g2.Add("loc", "city", "Chicago")
+
+	rec := fmt.Sprintf(`{
+		"graphs": ["%s", "%s"],
+		"clausegraphs": {"1": "?where"},
+		"data":[
+			["?person", "livesAt", "?loc"],
+			["?loc", "city", "?city"]
+		]
+	}`, TESTGRAPH, TESTGRAPH2)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	bindings := QueryResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bindings.Graph != TESTGRAPH || len(bindings.Data) != 1 || bindings.Data[0]["where"] != TESTGRAPH2 {
+		t.Fatal(w.Body.String())
+	}
+
+	rec = strings.Replace(rec, `"data"`, `"explain": true, "data"`, 1)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	bindings = QueryResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bindings.Data != nil || bindings.Plan == nil || len(bindings.Plan.Steps) != 2 {
+		t.Fatal(w.Body.String())
+	}
+
+	rec = `{"graph": "test", "graphs": ["missing"], "data": [["?a", "?b", "?c"]]}`
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code != 400 {
+		t.Error(w.Code, w.Body.String())
+	}
+}
+
+func TestQueryCursorHandler(t *testing.T) {
+	defer cleanupGraph()
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	g.Add("a", "friends_with", "b")
+	g.Add("b", "friends_with", "a")
+	g.Add("c", "friends_with", "a")
+
+	// page through the triples with a cursor
+	rec := fmt.Sprintf(`{"graph": "%s", "pred": "friends_with", "page": 2}`, TESTGRAPH)
+	seen := 0
+	for i := 0; i < 3 && rec != ""; i++ {
+		req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/triples", APIPORT), strings.NewReader(rec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		TESTAPI.TriplesHandler(w, req)
+		if w.Code != 200 {
+			t.Fatal(w.Code, w.Body.String())
+		}
+		triples := TriplesResponse{}
+		err = json.Unmarshal(w.Body.Bytes(), &triples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen += len(triples.Data)
+		rec = ""
+		if triples.Cursor != "" {
+			rec = fmt.Sprintf(`{"cursor": "%s"}`, triples.Cursor)
+		}
+	}
+	if seen != 3 || rec != "" {
+		t.Error("should have paged 3 triples got:", seen, rec)
+	}
+
+	// a used cursor is gone
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/triples", APIPORT), strings.NewReader(`{"cursor": "missing"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	TESTAPI.TriplesHandler(w, req)
+	if w.Code != 400 {
+		t.Error(w.Code, w.Body.String())
+	}
+
+	// stream query results as ndjson
+	rec = fmt.Sprintf(`{
+		"graph": "%s",
+		"data":[
+			["?person", "friends_with", "a"]
+		],
+		"page": 1
+	}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", NDJSONContentType)
+	w = httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	cursor := w.Header().Get("X-Cursor")
+	if len(lines) != 1 || cursor == "" {
+		t.Fatal("should have 1 line and a cursor", lines, cursor)
+	}
+
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(`{"cursor": "`+cursor+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", NDJSONContentType)
+	w = httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	lines = append(lines, strings.Split(strings.TrimSpace(w.Body.String()), "\n")...)
+	if len(lines) != 2 || w.Header().Get("X-Cursor") != "" {
+		t.Fatal("should have 2 lines without a cursor", lines)
+	}
+	for _, line := range lines {
+		binding := Bindings{}
+		err := json.Unmarshal([]byte(line), &binding)
+		if err != nil {
+			t.Fatal(err, line)
+		}
+		if binding["person"] != "b" && binding["person"] != "c" {
+			t.Error(binding)
+		}
+	}
+}
+
+// closedResults records when a cursor's iterator is closed.
+type closedResults struct {
+	closed chan struct{}
+}
+
+func (r closedResults) next() (interface{}, bool) { return nil, false }
+func (r closedResults) Err() error                { return nil }
+func (r closedResults) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestCursorReap(t *testing.T) {
+	timeout := CursorTimeout
+	CursorTimeout = time.Millisecond
+	defer func() { CursorTimeout = timeout }()
+
+	cs := &cursors{}
+	cs.reap(5 * time.Millisecond)
+	defer cs.closeAll()
+	iter := closedResults{closed: make(chan struct{})}
+	_, err := cs.put(&cursor{kind: cursorTriples, iter: iter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-iter.closed:
+	case <-time.After(time.Second):
+		t.Fatal("expired cursor should be closed without another put or take")
+	}
+	cs.mu.Lock()
+	n := len(cs.open)
+	cs.mu.Unlock()
+	if n != 0 {
+		t.Error("expired cursor should be removed got:", n)
+	}
+}
+
 func TestQueryCountHandler(t *testing.T) {
 	g, _ := STORE.Driver.Graph(TESTGRAPH)
 	g.Add("a", "friends_with", "b")
@@ -344,6 +573,55 @@ func TestQueryCountHandler(t *testing.T) {
 	}
 }
 
+func TestQueryAggregateHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	defer cleanupGraph()
+	g.Add("a", "friends_with", "b")
+	g.Add("a", "friends_with", "c")
+	g.Add("c", "friends_with", "b")
+
+	rec := fmt.Sprintf(`{
+		"graph": "%s",
+		"groupby": ["person"],
+		"aggregates": [{"op": "count", "as": "friends"}],
+		"having": "?friends > 1",
+		"data":[
+			["?person", "friends_with", "?friend"]
+		]
+	}`, TESTGRAPH)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	bindings := QueryResponse{}
+	err = json.Unmarshal([]byte(w.Body.String()), &bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bindings.Data) != 1 || bindings.Data[0]["person"] != "a" || bindings.Data[0]["friends"] != 2.0 {
+		t.Errorf("should have gotten a with 2 friends got: %v", bindings.Data)
+	}
+
+	rec = fmt.Sprintf(`{"graph": "%s", "aggregates": [{"op": "median", "var": "friend"}], "data": [["?person", "friends_with", "?friend"]]}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code == 200 {
+		t.Error("unknown aggregate should fail", w.Body.String())
+	}
+}
+
 func TestDropHandler(t *testing.T) {
 	g, _ := STORE.Driver.Graph(TESTGRAPH)
 	g.Add("a", "b", "c")
@@ -363,6 +641,57 @@ func TestDropHandler(t *testing.T) {
 	}
 }
 
+func TestDropHandlerEntailment(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+	g.Add("_:1", "http://www.w3.org/1999/02/22-rdf-syntax-ns#type", "http://xmlns.com/foaf/0.1/Person")
+	g.Add("http://xmlns.com/foaf/0.1/Person", "http://www.w3.org/2000/01/rdf-schema#subClassOf", "http://xmlns.com/foaf/0.1/Agent")
+
+	query := func() string {
+		rec := fmt.Sprintf(`{
+			"graph": "%s",
+			"prefix": {"foaf": "http://xmlns.com/foaf/0.1/", "rdf": "http://www.w3.org/1999/02/22-rdf-syntax-ns#"},
+			"entailment": "rdfs",
+			"data": [["?x", "rdf:type", "foaf:Agent"]]
+		}`, TESTGRAPH)
+		req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		TESTAPI.QueryHandler(w, req)
+		if w.Code != 200 {
+			t.Fatal(w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	if res := query(); !strings.Contains(res, `"x":"_:1"`) {
+		t.Fatal("should entail _:1 got:", res)
+	}
+
+	v := url.Values{}
+	v.Set("graph", TESTGRAPH)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/drop", APIPORT), strings.NewReader(v.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	TESTAPI.DropHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	if res := query(); strings.Contains(res, `"x":"_:1"`) {
+		t.Error("dropped triples should not be entailed got:", res)
+	}
+	if c, _ := STORE.Driver.Count(TESTGRAPH+EntailedGraphSuffix, "", "", nil); c != 0 {
+		t.Error("entailed graph should be empty got:", c)
+	}
+}
+
 func TestIndexHandler(t *testing.T) {
 	g, _ := STORE.Driver.Graph(TESTGRAPH)
 	g.Add("a", "b", "c")
@@ -384,7 +713,19 @@ func TestIndexHandler(t *testing.T) {
 
 func TestInferenceHandler(t *testing.T) {
 	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	defer cleanupGraph()
+	defer STORE.Driver.RemoveAll(TESTGRAPH + GeocacheGraphSuffix)
 	g.Add("location:barncompany60614", "location:address", "950 W Wrightwood Ave Chicago, IL 60614")
+	g.Add("location:nowhere", "location:address", "1 Nowhere Lane")
+
+	geocoder, err := ReadCSVGeocoder(strings.NewReader(`"950 W Wrightwood Ave Chicago, IL 60614",41.9289,-87.6526`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo := Inferences["geo"]
+	Inferences["geo"] = GeoRule{Geocoder: geocoder}
+	defer func() { Inferences["geo"] = geo }()
 
 	v := url.Values{}
 	v.Set("graph", TESTGRAPH)
@@ -397,12 +738,762 @@ func TestInferenceHandler(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	TESTAPI.InferenceHandler(w, req)
-	if w.Code != 200 {
+	if w.Code != http.StatusAccepted {
 		t.Fatal(w.Code, w.Body.String())
 	}
+	resp := JobResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Kind != "inference" || w.Header().Get("Location") != "/v1/jobs/"+resp.Data.ID {
+		t.Errorf("%+v", resp.Data)
+	}
+	job := waitJob(t, &TESTAPI.jobs, resp.Data.ID)
+	report, ok := job.Result.(*InferenceReport)
+	if job.Status != JobDone || !ok {
+		t.Fatalf("%+v", job)
+	}
+	if report.Added != 2 || !reflect.DeepEqual(report.Succeeded, []string{"location:barncompany60614"}) {
+		t.Errorf("%+v", report)
+	}
+	if _, ok := report.Failed["location:nowhere"]; !ok || len(report.Failed) != 1 {
+		t.Errorf("%+v", report)
+	}
 }
 
-func TestPathHandler(t *testing.T) {
-	//g, _ := STORE.Driver.Graph(TESTGRAPH)
+func TestJobsHandler(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	body := "<a> <knows> <b> .\n<b> <knows> <c> .\n"
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/import?graph=%s&format=ntriples&async=true", APIPORT, TESTGRAPH), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	TESTAPI.ImportHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp := JobResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, &TESTAPI.jobs, resp.Data.ID)
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/jobs/%s", APIPORT, resp.Data.ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.JobsHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp = JobResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if job := resp.Data; job.Status != JobDone || job.Kind != "import" || job.Result != 2.0 {
+		t.Errorf("%+v", job)
+	}
+	if count, _ := GRPH.Count("a", "knows", "b"); count != 1 {
+		t.Error("a knows b should be imported")
+	}
+
+	rec := fmt.Sprintf(`{"graph": "%s", "algorithm": "degree", "preds": ["knows"], "async": true}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/analytics", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.AnalyticsHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp = JobResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// cancelling a finished job keeps its result
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("http://localhost:%s/v1/jobs/%s", APIPORT, resp.Data.ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.JobsHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	if job := waitJob(t, &TESTAPI.jobs, resp.Data.ID); job.Status == JobRunning {
+		t.Errorf("%+v", job)
+	}
 
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/jobs", APIPORT), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.JobsHandler(w, req)
+	list := JobsResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Data) < 2 {
+		t.Error(list, err)
+	}
+
+	var bad = []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/v1/jobs/missing", http.StatusNotFound},
+		{"DELETE", "/v1/jobs/missing", http.StatusNotFound},
+		{"POST", "/v1/jobs", http.StatusMethodNotAllowed},
+	}
+	for _, b := range bad {
+		req, err = http.NewRequest(b.method, fmt.Sprintf("http://localhost:%s%s", APIPORT, b.path), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = httptest.NewRecorder()
+		TESTAPI.JobsHandler(w, req)
+		if w.Code != b.code {
+			t.Error(b, w.Code)
+		}
+	}
+}
+
+func TestRulesHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+	g.Add("http://foaf/a", "http://foaf/knows", "http://foaf/b")
+
+	rec := fmt.Sprintf(`{
+		"graph": "%s",
+		"prefix": {"foaf": "http://foaf/"},
+		"name": "symmetric",
+		"rule": "[?a foaf:knows ?b] => [?b foaf:knows ?a]"
+	}`, TESTGRAPH)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/rules", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	TESTAPI.RulesHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/rules?graph=%s", APIPORT, TESTGRAPH), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.RulesHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp := RulesResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].String() != "[?a http://foaf/knows ?b] => [?b http://foaf/knows ?a]" {
+		t.Fatal(w.Body.String())
+	}
+
+	v := url.Values{}
+	v.Set("graph", TESTGRAPH)
+	v.Add("inference", "rules")
+	req, err = http.NewRequest("PUT", fmt.Sprintf("http://localhost:%s/v1/inference", APIPORT), strings.NewReader(v.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	TESTAPI.InferenceHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	job := JobResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job := waitJob(t, &TESTAPI.jobs, job.Data.ID); job.Status != JobDone {
+		t.Fatalf("%+v", job)
+	}
+	if count, _ := g.Count("http://foaf/b", "http://foaf/knows", "http://foaf/a"); count != 1 {
+		t.Error("b should know a")
+	}
+
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("http://localhost:%s/v1/rules?graph=%s&name=symmetric", APIPORT, TESTGRAPH), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.RulesHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	if count, _ := g.Count("http://foaf/b", "http://foaf/knows", "http://foaf/a"); count != 0 {
+		t.Error("b knows a should be retracted")
+	}
+
+	rec = fmt.Sprintf(`{"graph": "%s", "name": "bad", "rule": "[?a knows ?b] => [?a knows ?c]"}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/rules", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.RulesHandler(w, req)
+	if w.Code != 400 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestEntailmentHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+	g.Add("_:1", "http://www.w3.org/1999/02/22-rdf-syntax-ns#type", "http://xmlns.com/foaf/0.1/Person")
+	g.Add("http://xmlns.com/foaf/0.1/Person", "http://www.w3.org/2000/01/rdf-schema#subClassOf", "http://xmlns.com/foaf/0.1/Agent")
+
+	rec := fmt.Sprintf(`{
+		"graph": "%s",
+		"prefix": {"foaf": "http://xmlns.com/foaf/0.1/", "rdf": "http://www.w3.org/1999/02/22-rdf-syntax-ns#"},
+		"entailment": "rdfs",
+		"data": [["?x", "rdf:type", "foaf:Agent"]]
+	}`, TESTGRAPH)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/query", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	TESTAPI.QueryHandler(w, req)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"x":"_:1"`) {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	v := url.Values{}
+	v.Set("graph", TESTGRAPH)
+	v.Set("entailment", "owl")
+	req, err = http.NewRequest("PUT", fmt.Sprintf("http://localhost:%s/v1/entailment", APIPORT), strings.NewReader(v.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	TESTAPI.EntailmentHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	defer g.SetEntailment(EntailNone)
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/entailment?graph=%s", APIPORT, TESTGRAPH), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.EntailmentHandler(w, req)
+	if w.Code != 200 || w.Body.String() != "owl" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	v.Set("entailment", "rdfs++")
+	req, err = http.NewRequest("PUT", fmt.Sprintf("http://localhost:%s/v1/entailment", APIPORT), strings.NewReader(v.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	TESTAPI.EntailmentHandler(w, req)
+	if w.Code != 400 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestPathHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	defer cleanupGraph()
+	g.Add("_:a", "name", "a")
+	g.Add("_:b", "name", "b")
+	g.Add("_:c", "name", "c")
+	g.Add("_:a", "friends_with", "_:b")
+	g.Add("_:c", "friends_with", "_:b")
+
+	rec := fmt.Sprintf(`{
+		"graph": "%s",
+		"start": "a",
+		"end": "c",
+		"name": "name",
+		"edges": [{"pred": "friends_with", "dir": "both"}]
+	}`, TESTGRAPH)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/path", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	TESTAPI.PathHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp := PathResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || !reflect.DeepEqual(resp.Data[0].Nodes, []string{"_:a", "_:b", "_:c"}) || resp.Data[0].Cost != 2 {
+		t.Fatal(w.Body.String())
+	}
+
+	rec = fmt.Sprintf(`{"graph": "%s", "start": "a", "end": "c", "name": "name", "edges": [{"pred": "friends_with"}]}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/path", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.PathHandler(w, req)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"data":[]`) {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	rec = fmt.Sprintf(`{"graph": "%s", "start": "a", "end": "x", "name": "name", "edges": [{"pred": "friends_with"}]}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/path", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.PathHandler(w, req)
+	if w.Code != 400 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/path", APIPORT), strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.PathHandler(w, req)
+	if w.Code != 405 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestSubgraphHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	defer cleanupGraph()
+	g.Add("_:a", "name", "a")
+	g.Add("_:a", "friends_with", "_:b")
+	g.Add("_:c", "friends_with", "_:b")
+
+	rec := fmt.Sprintf(`{"graph": "%s", "seeds": ["_:a"], "depth": 2}`, TESTGRAPH)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/subgraph", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	TESTAPI.SubgraphHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp := SubgraphResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data == nil || len(resp.Data.Nodes) != 3 || len(resp.Data.Edges) != 2 || resp.Data.Nodes[0].Attrs["name"] != "a" {
+		t.Fatal(w.Body.String())
+	}
+
+	rec = fmt.Sprintf(`{"graph": "%s", "seeds": []}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/subgraph", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.SubgraphHandler(w, req)
+	if w.Code != 400 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/subgraph", APIPORT), strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.SubgraphHandler(w, req)
+	if w.Code != 405 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestAnalyticsHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	defer cleanupGraph()
+	g.Add("a", "friends_with", "b")
+	g.Add("c", "friends_with", "b")
+
+	rec := fmt.Sprintf(`{"graph": "%s", "algorithm": "degree", "preds": ["friends_with"], "write": true}`, TESTGRAPH)
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/analytics", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	TESTAPI.AnalyticsHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp := AnalyticsResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 3 || resp.Data["b"]["indegree"] != 2.0 {
+		t.Fatal(w.Body.String())
+	}
+	if v, err := g.Value("b", AnalyticsPrefix+"indegree", ""); err != nil || v != 2 {
+		t.Error(v, err)
+	}
+
+	rec = fmt.Sprintf(`{"graph": "%s", "algorithm": "closeness", "preds": ["friends_with"]}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/analytics", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.AnalyticsHandler(w, req)
+	if w.Code != 400 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestSPARQLHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	g.Add("a", "friends_with", "b")
+	g.Add("c", "friends_with", "b")
+
+	v := url.Values{}
+	v.Set("graph", TESTGRAPH)
+	v.Set("query", `SELECT ?person WHERE { ?person <friends_with> "b" } ORDER BY ?person`)
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/sparql?%s", APIPORT, v.Encode()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	TESTAPI.SPARQLHandler(w, req)
+	if w.Code != 200 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	resp := SPARQLResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results.Bindings) != 2 || resp.Results.Bindings[0]["person"].Value != "a" {
+		t.Fatal(w.Body.String())
+	}
+
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/sparql?graph=%s", APIPORT, TESTGRAPH), strings.NewReader(`SELECT ?x WHERE { ?x`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/sparql-query")
+	w = httptest.NewRecorder()
+	TESTAPI.SPARQLHandler(w, req)
+	if w.Code != 400 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestImportExportHandler(t *testing.T) {
+	defer STORE.Driver.RemoveAll(TESTGRAPH2)
+
+	body := `<http://eurisko.io/paul> <http://xmlns.com/foaf/0.1/name> "Paul"@en .
+_:b1 <http://eurisko.io/age> "30"^^<http://www.w3.org/2001/XMLSchema#integer> .
+`
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/import?graph=%s", APIPORT, TESTGRAPH2), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/n-triples")
+	w := httptest.NewRecorder()
+	TESTAPI.ImportHandler(w, req)
+	if w.Code != 200 || w.Body.String() != `{"graph":"test2","data":2}` {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/export?graph=%s&format=turtle&prefix=foaf:http://xmlns.com/foaf/0.1/", APIPORT, TESTGRAPH2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.ExportHandler(w, req)
+	if w.Code != 200 || w.Header().Get("Content-Type") != "text/turtle" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	out := w.Body.String()
+	if !strings.Contains(out, `<http://eurisko.io/paul> foaf:name "Paul"@en .`) || !strings.Contains(out, `_:b1 <http://eurisko.io/age> 30 .`) {
+		t.Error(out)
+	}
+
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/import?graph=%s&format=xml", APIPORT, TESTGRAPH2), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.ImportHandler(w, req)
+	if w.Code != 400 {
+		t.Error(w.Code, w.Body.String())
+	}
+}
+
+func TestExportGraphHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	defer cleanupGraph()
+	g.Add("_:a", "name", "a")
+	g.Add("_:a", "friends_with", "_:b")
+	g.Add("_:b", "friends_with", "_:c")
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/export?graph=%s&format=dot", APIPORT, TESTGRAPH), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	TESTAPI.ExportHandler(w, req)
+	if w.Code != 200 || w.Header().Get("Content-Type") != "text/vnd.graphviz" || strings.Count(w.Body.String(), "->") != 2 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	// the subgraph around a seed
+	req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/export?graph=%s&format=dot&seed=_:a&depth=1", APIPORT, TESTGRAPH), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.ExportHandler(w, req)
+	if w.Code != 200 || strings.Count(w.Body.String(), "->") != 1 || !strings.Contains(w.Body.String(), `"_:a" ["name"="a"];`) {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	// the triples matched by a query
+	rec := fmt.Sprintf(`{"graph": "%s", "data": [["?a", "friends_with", "?b"], ["?a", "name", "a"]]}`, TESTGRAPH)
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:%s/v1/export?format=graphml", APIPORT), strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	TESTAPI.ExportHandler(w, req)
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/graphml+xml" || strings.Count(w.Body.String(), "<edge ") != 1 {
+		t.Fatal(w.Code, w.Body.String())
+	}
+
+	var bad = []struct {
+		method, query string
+	}{
+		{"GET", "format=turtle&seed=_:a"},
+		{"GET", "format=dot&seed=_:a&depth=x"},
+		{"POST", "format=ntriples"},
+		{"GET", "format=svg"},
+	}
+	for _, tt := range bad {
+		req, err = http.NewRequest(tt.method, fmt.Sprintf("http://localhost:%s/v1/export?graph=%s&%s", APIPORT, TESTGRAPH, tt.query), strings.NewReader(rec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = httptest.NewRecorder()
+		TESTAPI.ExportHandler(w, req)
+		if w.Code != 400 {
+			t.Error(tt.query, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestTransactionHandler(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	GRPH.Add("a", "age", 30)
+
+	transaction := func(method, path, body string) (int, *TransactionResponse) {
+		req, err := http.NewRequest(method, fmt.Sprintf("http://localhost:%s%s", APIPORT, path), strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		TESTAPI.TransactionHandler(w, req)
+		resp := &TransactionResponse{}
+		if w.Code < 300 {
+			if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+				t.Fatal(err, w.Body.String())
+			}
+		}
+		return w.Code, resp
+	}
+
+	// a single request which commits
+	code, resp := transaction("POST", "/v1/transaction", fmt.Sprintf(`{"graph": "%s", "prefix": {"ex": "http://example.com/"}, "remove": [["a", "age", ""]], "add": [["a", "age", 31], ["ex:b", "knows", "a"]], "commit": true}`, TESTGRAPH))
+	if code != 200 || resp.Data == nil || resp.Data.Added != 2 || resp.Data.Removed != 1 || resp.ID != "" {
+		t.Fatal(code, resp)
+	}
+	if age, _ := GRPH.Value("a", "age", ""); age != 31.0 {
+		t.Error(age)
+	}
+	if count, _ := GRPH.Count("http://example.com/b", "knows", "a"); count != 1 {
+		t.Error("ex:b should be mapped")
+	}
+
+	// across requests
+	code, resp = transaction("POST", "/v1/transaction", fmt.Sprintf(`{"graph": "%s", "add": [["c", "knows", "a"]]}`, TESTGRAPH))
+	if code != http.StatusCreated || resp.ID == "" || resp.Ops != 1 {
+		t.Fatal(code, resp)
+	}
+	path := "/v1/transaction/" + resp.ID
+	if code, _ := transaction("PUT", path, `{"add": [["c", "knows"]]}`); code != http.StatusBadRequest {
+		t.Error("an invalid add should fail", code)
+	}
+	if code, resp := transaction("PUT", path, `{"remove": [["a", "age", ""]]}`); code != 200 || resp.Ops != 2 {
+		t.Error(code, resp)
+	}
+	if count, _ := GRPH.Count("c", "knows", "a"); count != 0 {
+		t.Error("nothing should be written before the commit")
+	}
+	if code, resp := transaction("GET", path, ""); code != 200 || resp.Ops != 2 || resp.Graph != TESTGRAPH {
+		t.Error(code, resp)
+	}
+	code, resp = transaction("PUT", path, `{"commit": true}`)
+	if code != 200 || resp.Data == nil || resp.Data.Added != 1 || resp.Data.Removed != 1 {
+		t.Fatal(code, resp)
+	}
+	if count, _ := GRPH.Count("c", "knows", "a"); count != 1 {
+		t.Error("c knows a should be committed")
+	}
+	if code, _ := transaction("GET", path, ""); code != http.StatusNotFound {
+		t.Error("a committed transaction should be gone", code)
+	}
+
+	// rolled back
+	_, resp = transaction("POST", "/v1/transaction", fmt.Sprintf(`{"graph": "%s", "add": [["d", "knows", "a"]]}`, TESTGRAPH))
+	if code, _ := transaction("DELETE", "/v1/transaction/"+resp.ID, ""); code != 200 {
+		t.Error(code)
+	}
+	if count, _ := GRPH.Count("d", "knows", "a"); count != 0 {
+		t.Error("d knows a should be rolled back")
+	}
+
+	var bad = []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/v1/transaction", fmt.Sprintf(`{"graph": "%s", "add": [["", "knows", "a"]]}`, TESTGRAPH), http.StatusBadRequest},
+		{"POST", "/v1/transaction", `{`, http.StatusBadRequest},
+		{"GET", "/v1/transaction", "", http.StatusMethodNotAllowed},
+		{"POST", "/v1/transaction/missing", "", http.StatusMethodNotAllowed},
+		{"PUT", "/v1/transaction/missing", `{}`, http.StatusNotFound},
+		{"DELETE", "/v1/transaction/missing", "", http.StatusNotFound},
+	}
+	for _, tt := range bad {
+		if code, _ := transaction(tt.method, tt.path, tt.body); code != tt.code {
+			t.Error(tt.method, tt.path, "should be", tt.code, "got", code)
+		}
+	}
+}
+
+func TestTriggersHandler(t *testing.T) {
+	g, _ := STORE.Driver.Graph(TESTGRAPH)
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+
+	rule, err := ParseRule("symmetric", `[?a knows ?b] => [?b knows ?a]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	var puts = []struct {
+		name, on string
+		code     int
+	}{
+		{"symmetric", "", 200},
+		{"missing", "true", 400},
+		{"symmetric", "maybe", 400},
+	}
+	for _, p := range puts {
+		v := url.Values{}
+		v.Set("graph", TESTGRAPH)
+		v.Set("name", p.name)
+		v.Set("on", p.on)
+		req, err := http.NewRequest("PUT", fmt.Sprintf("http://localhost:%s/v1/triggers", APIPORT), strings.NewReader(v.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		TESTAPI.TriggersHandler(w, req)
+		if w.Code != p.code {
+			t.Error(p, w.Code, w.Body.String())
+		}
+	}
+	defer g.SetTrigger("symmetric", false)
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%s/v1/triggers?graph=%s", APIPORT, TESTGRAPH), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	TESTAPI.TriggersHandler(w, req)
+	resp := TriggersResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || !reflect.DeepEqual(resp.Data, []string{"symmetric"}) {
+		t.Fatal(w.Body.String(), err)
+	}
+
+	g.Add("a", "knows", "b")
+	g.WaitTriggers()
+	if v, _ := g.Value("b", "knows", ""); v != "a" {
+		t.Error(v)
+	}
+}
+
+func TestAssetHandler(t *testing.T) {
+	var tests = []struct {
+		method, path string
+		code         int
+		ctype        string
+	}{
+		{"GET", "/", 200, "text/html"},
+		{"GET", "/exp.html", 200, "text/html"},
+		{"HEAD", "/static/index.js", 200, "javascript"},
+		{"GET", "/static/images/dracula.png", 200, "image/png"},
+		{"GET", "/static/../../assets.go", 404, ""},
+		{"GET", "/missing.html", 404, ""},
+		{"POST", "/", 405, ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, fmt.Sprintf("http://localhost:%s%s", APIPORT, tt.path), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		assetHandler{}.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Error(tt.path, w.Code)
+		}
+		if !strings.Contains(w.Header().Get("Content-Type"), tt.ctype) {
+			t.Error(tt.path, w.Header().Get("Content-Type"))
+		}
+	}
 }
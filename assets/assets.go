@@ -1,4 +1,4 @@
-package pfftdb
+package assets
 
 import (
 	"bytes"
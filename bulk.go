@@ -0,0 +1,128 @@
+package pfftdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// ErrInvalidTriples is returned by a strict bulk write with an invalid
+// triple, nothing is written.
+var ErrInvalidTriples = fmt.Errorf("invalid triples, none were written")
+
+// BulkError is why the triple at Index of a bulk write was rejected.
+type BulkError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// BulkResult reports a bulk write. Inserted is the number of triples
+// added, Duplicate the ones already in the graph or earlier in the batch
+// and Invalid the ones rejected, with an entry in Errors for each. Removes
+// only report invalid triples.
+type BulkResult struct {
+	Inserted  int          `json:"inserted"`
+	Duplicate int          `json:"duplicate"`
+	Invalid   int          `json:"invalid"`
+	Errors    []*BulkError `json:"errors"`
+}
+
+// checkTriple validates a triple to add, or with pattern a triple to
+// remove where empty items match everything. Every driver stores the
+// triples which pass it.
+func checkTriple(tr *Triple, pattern bool) error {
+	if tr == nil {
+		return fmt.Errorf("missing triple")
+	}
+	sub, ok := tr[0].(string)
+	if !ok {
+		return fmt.Errorf("subject not a string %v", tr[0])
+	}
+	pred, ok := tr[1].(string)
+	if !ok {
+		return fmt.Errorf("predicate not a string %v", tr[1])
+	}
+	if pattern {
+		return nil
+	}
+	switch {
+	case sub == "":
+		return fmt.Errorf("missing subject")
+	case pred == "":
+		return fmt.Errorf("missing predicate")
+	case isEmpty(tr[2]):
+		return fmt.Errorf("missing object")
+	}
+	if _, err := json.Marshal(tr[2]); err != nil {
+		return fmt.Errorf("invalid object %v: %v", tr[2], err)
+	}
+	return nil
+}
+
+// checkBulk returns the valid triples and a result with the invalid ones.
+func checkBulk(triples []*Triple, pattern bool) ([]*Triple, *BulkResult) {
+	result := &BulkResult{Errors: []*BulkError{}}
+	valid := make([]*Triple, 0, len(triples))
+	for i, tr := range triples {
+		if err := checkTriple(tr, pattern); err != nil {
+			result.Invalid++
+			result.Errors = append(result.Errors, &BulkError{Index: i, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, tr)
+	}
+	return valid, result
+}
+
+// AddBulkReport is AddBulk which reports the inserted, duplicate and
+// invalid triples. With strict an invalid triple rejects the whole batch
+// with ErrInvalidTriples.
+func (g *Graph) AddBulkReport(graph string, triples []*Triple, strict bool) (*BulkResult, error) {
+	start := time.Now()
+	defer func() { log.Info("Graph.AddBulkReport ", time.Since(start)) }()
+
+	valid, result := checkBulk(triples, false)
+	if strict && result.Invalid > 0 {
+		return result, ErrInvalidTriples
+	}
+
+	unique := make([]*Triple, 0, len(valid))
+	seen := map[string]bool{}
+	for _, tr := range valid {
+		key := tripleKey(tr[0].(string), tr[1].(string), tr[2])
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, tr)
+		}
+	}
+	if len(unique) == 0 {
+		result.Duplicate = len(valid)
+		return result, nil
+	}
+	n, err := g.AddBulk(graph, unique)
+	result.Inserted = n
+	if err != nil {
+		return result, err
+	}
+	result.Duplicate = len(valid) - n
+	return result, nil
+}
+
+// RemoveBulkReport is RemoveBulk which reports the invalid triples. With
+// strict an invalid triple rejects the whole batch with
+// ErrInvalidTriples.
+func (g *Graph) RemoveBulkReport(graph string, triples []*Triple, strict bool) (*BulkResult, error) {
+	start := time.Now()
+	defer func() { log.Info("Graph.RemoveBulkReport ", time.Since(start)) }()
+
+	valid, result := checkBulk(triples, true)
+	if strict && result.Invalid > 0 {
+		return result, ErrInvalidTriples
+	}
+	if len(valid) == 0 {
+		return result, nil
+	}
+	return result, g.RemoveBulk(graph, valid)
+}
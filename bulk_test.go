@@ -0,0 +1,64 @@
+package pfftdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAddBulkReport(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	GRPH.Add("a", "knows", "b")
+
+	triples := []*Triple{
+		{"a", "knows", "b"},
+		{"a", "knows", "c"},
+		nil,
+		{"a", "knows", "c"},
+		{"", "knows", "c"},
+		{"a", 1, "c"},
+		{"a", "age", math.NaN()},
+		{"a", "age", 30},
+	}
+	result, err := GRPH.AddBulkReport(GRPH.GraphID, triples, true)
+	if err != ErrInvalidTriples || result.Invalid != 4 || result.Inserted != 0 {
+		t.Errorf("%+v %v", result, err)
+	}
+	if n, _ := GRPH.Count("", "", nil); n != 1 {
+		t.Error("strict should write nothing", n)
+	}
+
+	result, err = GRPH.AddBulkReport(GRPH.GraphID, triples, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 2 || result.Duplicate != 2 || result.Invalid != 4 {
+		t.Errorf("%+v", result)
+	}
+	indexes := []int{}
+	for _, e := range result.Errors {
+		indexes = append(indexes, e.Index)
+	}
+	if len(indexes) != 4 || indexes[0] != 2 || indexes[1] != 4 || indexes[2] != 5 || indexes[3] != 6 {
+		t.Error(indexes)
+	}
+	if n, _ := GRPH.Count("", "", nil); n != 3 {
+		t.Error(n)
+	}
+
+	remove := []*Triple{{"a", "knows", ""}, {"a", 1, nil}}
+	result, err = GRPH.RemoveBulkReport(GRPH.GraphID, remove, true)
+	if err != ErrInvalidTriples || result.Invalid != 1 || result.Errors[0].Index != 1 {
+		t.Errorf("%+v %v", result, err)
+	}
+	if n, _ := GRPH.Count("", "", nil); n != 3 {
+		t.Error("strict should remove nothing", n)
+	}
+	result, err = GRPH.RemoveBulkReport(GRPH.GraphID, remove, false)
+	if err != nil || result.Invalid != 1 {
+		t.Errorf("%+v %v", result, err)
+	}
+	if n, _ := GRPH.Count("", "", nil); n != 1 {
+		t.Error(n)
+	}
+}
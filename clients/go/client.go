@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -60,17 +61,23 @@ func NewClient(hostPorts string) (*Client, error) {
 			continue
 		}
 		urls := map[string]string{
-			"ping":      "http://" + hostPort + "/v1/ping",
-			"add":       "http://" + hostPort + "/v1/data",
-			"remove":    "http://" + hostPort + "/v1/data",
-			"value":     "http://" + hostPort + "/v1/value",
-			"triples":   "http://" + hostPort + "/v1/triples",
-			"count":     "http://" + hostPort + "/v1/triples/count",
-			"query":     "http://" + hostPort + "/v1/query",
-			"drop":      "http://" + hostPort + "/v1/drop",
-			"index":     "http://" + hostPort + "/v1/index",
-			"path":      "http://" + hostPort + "/v1/path",
-			"inference": "http://" + hostPort + "/v1/inference",
+			"ping":        "http://" + hostPort + "/v1/ping",
+			"add":         "http://" + hostPort + "/v1/data",
+			"remove":      "http://" + hostPort + "/v1/data",
+			"value":       "http://" + hostPort + "/v1/value",
+			"triples":     "http://" + hostPort + "/v1/triples",
+			"count":       "http://" + hostPort + "/v1/triples/count",
+			"query":       "http://" + hostPort + "/v1/query",
+			"drop":        "http://" + hostPort + "/v1/drop",
+			"index":       "http://" + hostPort + "/v1/index",
+			"path":        "http://" + hostPort + "/v1/path",
+			"subgraph":    "http://" + hostPort + "/v1/subgraph",
+			"transaction": "http://" + hostPort + "/v1/transaction",
+			"inference":   "http://" + hostPort + "/v1/inference",
+			"analytics":   "http://" + hostPort + "/v1/analytics",
+			"rules":       "http://" + hostPort + "/v1/rules",
+			"jobs":        "http://" + hostPort + "/v1/jobs/",
+			"triggers":    "http://" + hostPort + "/v1/triggers",
 		}
 		conn := &Connection{URLS: urls, HostPort: hostPort, Client: &http.Client{}}
 		pool = append(pool, conn)
@@ -284,6 +291,67 @@ func (c *Client) Remove(grph string, triples []*pfftdb.Triple) error {
 	return nil
 }
 
+// AddReport adds triples to the given graph and reports the inserted,
+// duplicate and invalid ones. With strict an invalid triple rejects them
+// all, the result is returned with the error.
+func (c *Client) AddReport(grph string, triples []*pfftdb.Triple, strict bool) (*pfftdb.BulkResult, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.AddReport ", time.Since(start)) }()
+	return c.bulk("POST", "add", grph, triples, strict)
+}
+
+// RemoveReport removes triples from the given graph and reports the
+// invalid ones. With strict an invalid triple rejects them all, the result
+// is returned with the error.
+func (c *Client) RemoveReport(grph string, triples []*pfftdb.Triple, strict bool) (*pfftdb.BulkResult, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.RemoveReport ", time.Since(start)) }()
+	return c.bulk("DELETE", "remove", grph, triples, strict)
+}
+
+// bulk sends triples to the data endpoint and returns its result.
+func (c *Client) bulk(method, url, grph string, triples []*pfftdb.Triple, strict bool) (*pfftdb.BulkResult, error) {
+	conn := c.Next()
+
+	req := pfftdb.DataRequest{
+		Graph:  grph,
+		Data:   triples,
+		Prefix: Prefix,
+		Strict: strict,
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	r, err := http.NewRequest(method, conn.URLS[url], strings.NewReader(string(b)))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// a strict request which was rejected has a result
+	data := pfftdb.DataResponse{}
+	if err := json.Unmarshal(body, &data); err != nil || data.Result == nil {
+		return nil, fmt.Errorf("%s", body)
+	}
+	if resp.StatusCode != 200 {
+		return data.Result, pfftdb.ErrInvalidTriples
+	}
+	return data.Result, nil
+}
+
 // Get a unique value
 func (c *Client) Value(grph string, sub, pred string, obj interface{}) (interface{}, error) {
 	start := time.Now()
@@ -352,6 +420,7 @@ func (c *Client) Triples(grph, sub, pred string, obj interface{}, options *pfftd
 		req.Limit = options.Limit
 		req.Offset = options.Offset
 		req.OrderBy = options.OrderBy
+		req.Entailment = options.Entailment
 	}
 	b, err := json.Marshal(req)
 	if err != nil {
@@ -486,8 +555,9 @@ func (c *Client) Query(grph string, clauses []*pfftdb.Triple, options *pfftdb.Op
 	return data.Data, nil
 }
 
-// Inference [...]
-func (c *Client) Inference(grph, name string) error {
+// Inference starts applying an inference to a graph and returns its job,
+// the result of the job is the report of the inference, see Job.
+func (c *Client) Inference(grph, name string) (*pfftdb.Job, error) {
 	start := time.Now()
 	defer func() { log.Info("Client.Inference ", time.Since(start)) }()
 
@@ -500,10 +570,342 @@ func (c *Client) Inference(grph, name string) error {
 	req, err := http.NewRequest("PUT", conn.URLS["inference"], strings.NewReader(v.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	resp, err := conn.Client.Do(req)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	jr := &pfftdb.JobResponse{}
+	err = json.Unmarshal(body, jr)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return jr.Data, nil
+}
+
+// Job returns the status of a job. Jobs are kept by the server which
+// started them, with several hosts this asks the next one.
+func (c *Client) Job(id string) (*pfftdb.Job, error) {
+	return c.job("GET", id)
+}
+
+// CancelJob cancels a job and returns its status, it is running until the job
+// stopped.
+func (c *Client) CancelJob(id string) (*pfftdb.Job, error) {
+	return c.job("DELETE", id)
+}
+
+func (c *Client) job(method, id string) (*pfftdb.Job, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.Job ", method, " ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	r, err := http.NewRequest(method, conn.URLS["jobs"]+url.QueryEscape(id), nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	jr := &pfftdb.JobResponse{}
+	err = json.Unmarshal(body, jr)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return jr.Data, nil
+}
+
+// Path returns the shortest paths from start to end, see
+// pfftdb.Graph.ShortestPaths.
+func (c *Client) Path(grph, start, end string, options *pfftdb.PathOptions) ([]*pfftdb.PathResult, error) {
+	startT := time.Now()
+	defer func() { log.Info("Client.Path ", time.Since(startT)) }()
+
+	conn := c.Next()
+
+	req := pfftdb.PathRequest{
+		Graph:  grph,
+		Prefix: Prefix,
+		Start:  start,
+		End:    end,
+	}
+	if options != nil {
+		req.Edges = options.Edges
+		req.Heuristic = options.Heuristic
+		req.K = options.K
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	r, err := http.NewRequest("POST", conn.URLS["path"], strings.NewReader(string(b)))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	data := pfftdb.PathResponse{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// Subgraph returns the nodes and edges around the seeds of options, see
+// pfftdb.Graph.Subgraph.
+func (c *Client) Subgraph(grph string, options *pfftdb.SubgraphOptions) (*pfftdb.Subgraph, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.Subgraph ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	req := pfftdb.SubgraphRequest{
+		Graph:  grph,
+		Prefix: Prefix,
+	}
+	if options != nil {
+		req.Seeds = options.Seeds
+		req.Depth = options.Depth
+		req.Include = options.Include
+		req.Exclude = options.Exclude
+		req.MaxNodes = options.MaxNodes
+		req.MaxEdges = options.MaxEdges
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	r, err := http.NewRequest("POST", conn.URLS["subgraph"], strings.NewReader(string(b)))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	data := pfftdb.SubgraphResponse{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// Transaction removes the triples matching remove and adds add in a single
+// transaction, either all of them or none, see pfftdb.Graph.Begin.
+func (c *Client) Transaction(grph string, add, remove []*pfftdb.Triple) (*pfftdb.TxResult, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.Transaction ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	req := pfftdb.TransactionRequest{
+		Graph:  grph,
+		Prefix: Prefix,
+		Add:    add,
+		Remove: remove,
+		Commit: true,
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	r, err := http.NewRequest("POST", conn.URLS["transaction"], strings.NewReader(string(b)))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	data := pfftdb.TransactionResponse{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// Analytics runs an analytics algorithm and returns the results of each
+// node, see pfftdb.Graph.Analytics.
+func (c *Client) Analytics(grph, algorithm string, options *pfftdb.AnalyticsOptions) (map[string]pfftdb.Bindings, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.Analytics ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	req := pfftdb.AnalyticsRequest{
+		Graph:     grph,
+		Prefix:    Prefix,
+		Algorithm: algorithm,
+	}
+	if options != nil {
+		req.Preds = options.Preds
+		req.Damping = options.Damping
+		req.Iterations = options.Iterations
+		req.Tolerance = options.Tolerance
+		req.Write = options.Write
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	r, err := http.NewRequest("POST", conn.URLS["analytics"], strings.NewReader(string(b)))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	data := pfftdb.AnalyticsResponse{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// AddRule registers a rule on a graph, see pfftdb.ParseRule.
+func (c *Client) AddRule(grph, name, rule string) error {
+	start := time.Now()
+	defer func() { log.Info("Client.AddRule ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	b, err := json.Marshal(pfftdb.RuleRequest{Graph: grph, Prefix: Prefix, Name: name, Rule: rule})
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	r, err := http.NewRequest("POST", conn.URLS["rules"], strings.NewReader(string(b)))
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s", body)
+	}
+	return nil
+}
+
+// RemoveRule removes a rule from a graph and retracts what only it
+// inferred.
+func (c *Client) RemoveRule(grph, name string) error {
+	start := time.Now()
+	defer func() { log.Info("Client.RemoveRule ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	v := url.Values{}
+	v.Set("graph", grph)
+	v.Set("name", name)
+
+	r, err := http.NewRequest("DELETE", conn.URLS["rules"]+"?"+v.Encode(), nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -513,31 +915,101 @@ func (c *Client) Inference(grph, name string) error {
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("%s", body)
 	}
+	return nil
+}
+
+// Rules returns the rules of a graph.
+func (c *Client) Rules(grph string) ([]*pfftdb.Rule, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.Rules ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	v := url.Values{}
+	v.Set("graph", grph)
 
+	r, err := http.NewRequest("GET", conn.URLS["rules"]+"?"+v.Encode(), nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", body)
+	}
+
+	data := pfftdb.RulesResponse{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// SetTrigger turns a trigger of a graph on or off, see
+// pfftdb.Graph.SetTrigger.
+func (c *Client) SetTrigger(grph, name string, on bool) error {
+	start := time.Now()
+	defer func() { log.Info("Client.SetTrigger ", time.Since(start)) }()
+
+	conn := c.Next()
+
+	v := url.Values{}
+	v.Set("graph", grph)
+	v.Set("name", name)
+	v.Set("on", strconv.FormatBool(on))
+
+	r, err := http.NewRequest("PUT", conn.URLS["triggers"], strings.NewReader(v.Encode()))
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s", body)
+	}
 	return nil
 }
 
-// Path [...]
-func (c *Client) Path(grph, start, end, predName, predAdj string) ([]string, error) {
-	startT := time.Now()
-	defer func() { log.Info("Client.Path ", time.Since(startT)) }()
+// Triggers returns the triggers of a graph.
+func (c *Client) Triggers(grph string) ([]string, error) {
+	start := time.Now()
+	defer func() { log.Info("Client.Triggers ", time.Since(start)) }()
 
 	conn := c.Next()
 
 	v := url.Values{}
 	v.Set("graph", grph)
-	v.Set("start", start)
-	v.Set("end", end)
-	v.Set("predicateName", predName)
-	v.Set("predicateAdjacent", predAdj)
 
-	req, err := http.NewRequest("GET", conn.URLS["path"], strings.NewReader(v.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := conn.Client.Do(req)
+	r, err := http.NewRequest("GET", conn.URLS["triggers"]+"?"+v.Encode(), nil)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
+	resp, err := c.Do(r, conn)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -548,7 +1020,7 @@ func (c *Client) Path(grph, start, end, predName, predAdj string) ([]string, err
 		return nil, fmt.Errorf("%s", body)
 	}
 
-	data := pfftdb.PathResponse{}
+	data := pfftdb.TriggersResponse{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
 		log.Error(err)
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/pkar/pfftdb"
 )
@@ -205,9 +206,19 @@ func TestQuery(t *testing.T) {
 func TestInference(t *testing.T) {
 	cleanup()
 	defer cleanup()
-	err := cl.Inference(TESTGRAPH, "geo")
+	job, err := cl.Inference(TESTGRAPH, "geo")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	for job.Status == pfftdb.JobRunning {
+		time.Sleep(10 * time.Millisecond)
+		job, err = cl.Job(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != pfftdb.JobDone {
+		t.Error(job)
 	}
 }
 
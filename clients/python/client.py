@@ -40,16 +40,18 @@ class Pfft:
     self.graph = graph
     self.debug = debug
 
-  def add(self, triples):
+  def add(self, triples, strict=False):
     """
-    Add a list of triples
+    Add a list of triples, the result has the inserted, duplicate and
+    invalid triples. With strict an invalid triple rejects them all
 
-    >>> self.add([("a", "b", "c"), ("b", "c", "d")])
-    OK
+    >>> self.add([("a", "b", "c"), ("b", "c", "d"), ("a", "", "c")])
+    {"graph": "user", "data": 2, "result": {"inserted": 2, "duplicate": 0, "invalid": 1, "errors": [{"index": 2, "error": "missing predicate"}]}}
     """
     req = {
       'graph': self.graph, 
       'data': triples,
+      'strict': strict,
       'prefix': PREFIX,
     }
     if self.debug:
@@ -71,16 +73,18 @@ class Pfft:
     r = requests.delete('http://' + self.host_port + '/v1/data', data=json.dumps(req))
     return r.text
 
-  def remove(self, triples):
+  def remove(self, triples, strict=False):
     """
-    Remove a list of triples
+    Remove a list of triples, the result has the invalid triples. With
+    strict an invalid triple rejects them all
 
     >>> self.remove([("a", "b", "c"), ("b", "c", "d")])
-    OK
+    {"graph": "user", "data": 0, "result": {"inserted": 0, "duplicate": 0, "invalid": 0, "errors": []}}
     """
     req = {
       'graph': self.graph, 
       'data': triples,
+      'strict': strict,
       'prefix': PREFIX,
     }
     if self.debug:
@@ -172,33 +176,113 @@ class Pfft:
       return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
     return r.text
 
-  def path(self, start, end, pred_name, pred_adj):
+  def path(self, start, end, edges, name=None, k=1, heuristic=None):
     """
-    Find a path
+    Find the k shortest paths, edges are the adjacency predicates
+    [{"pred": "to", "dir": "out", "weight": "distance"}], with name start
+    and end are the values of that predicate instead of node ids
 
-    >>> self.path("a", "c", "name", "to")
-    {graph: "graph", data: ["a", "to", "b", "c"]}
+    >>> self.path("a", "c", [{"pred": "to"}], name="name")
+    [{"nodes": ["_:a", "_:b", "_:c"], "edges": [["_:a", "to", "_:b"], ["_:b", "to", "_:c"]], "cost": 2}]
     """
     req = {
       "graph": self.graph,
       "start": start,
       "end": end,
-      "predicateName": pred_name,
-      "predicateAdjacent": pred_adj,
+      "edges": edges,
+      "k": k,
+      'prefix': PREFIX,
+    }
+    if name:
+      req["name"] = name
+    if heuristic:
+      req["heuristic"] = heuristic
+    if self.debug:
+      pprint.pprint(req)
+    r = requests.post('http://' + self.host_port + '/v1/path', data=json.dumps(req))
+    if r.status_code == requests.codes.ok:
+      return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
+    return r.text
+
+  def subgraph(self, seeds, depth=1, include=None, exclude=None, max_nodes=0, max_edges=0):
+    """
+    Get the nodes within depth hops of the seeds and the edges between
+    them, following only the include predicates if given and never the
+    exclude ones. Literal objects are the attrs of their node
+
+    >>> self.subgraph(["_:a"], depth=1, include=["friends_with"])
+    {"nodes": [{"id": "_:a", "depth": 0, "attrs": {"name": "a"}}, {"id": "_:b", "depth": 1, "attrs": {"name": "b"}}], "edges": [{"source": "_:a", "target": "_:b", "label": "friends_with"}], "truncated": False}
+    """
+    req = {
+      "graph": self.graph,
+      "seeds": seeds,
+      "depth": depth,
+      "include": include or [],
+      "exclude": exclude or [],
+      "max_nodes": max_nodes,
+      "max_edges": max_edges,
+      'prefix': PREFIX,
+    }
+    if self.debug:
+      pprint.pprint(req)
+    r = requests.post('http://' + self.host_port + '/v1/subgraph', data=json.dumps(req))
+    if r.status_code == requests.codes.ok:
+      return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
+    return r.text
+
+  def transaction(self, add=None, remove=None):
+    """
+    Remove the triples matching remove and add add in a single
+    transaction, either all of them or none
+
+    >>> self.transaction(add=[["_:a", "age", 31]], remove=[["_:a", "age", ""]])
+    {"added": 1, "removed": 1}
+    """
+    req = {
+      "graph": self.graph,
+      "add": add or [],
+      "remove": remove or [],
+      "commit": True,
       'prefix': PREFIX,
     }
     if self.debug:
       pprint.pprint(req)
-    r = requests.get('http://' + self.host_port + '/v1/path', params=req)
+    r = requests.post('http://' + self.host_port + '/v1/transaction', data=json.dumps(req))
+    if r.status_code == requests.codes.ok:
+      return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
+    return r.text
+
+  def analytics(self, algorithm, preds, options=None):
+    """
+    Run an analytics algorithm, degree, pagerank, wcc, scc, triangles or
+    labels, on the edges of preds. With {"write": True} in options the
+    results are also added as analytics: triples
+
+    >>> self.analytics("pagerank", ["foaf:knows"])
+    {"_:1": {"pagerank": 0.013}, "_:2": {"pagerank": 0.021}}
+    """
+    req = {
+      "graph": self.graph,
+      "algorithm": algorithm,
+      "preds": preds,
+      'prefix': PREFIX,
+    }
+    if options:
+      for k, v in options.iteritems():
+        req[k] = v
+    if self.debug:
+      pprint.pprint(req)
+    r = requests.post('http://' + self.host_port + '/v1/analytics', data=json.dumps(req))
     if r.status_code == requests.codes.ok:
       return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
     return r.text
 
   def inference(self, name):
     """
-    Apply an inference
+    Start applying an inference, returns its job, the result of the job is
+    the report of the inference
     >>> self.inference("geo")
-    OK
+    {u'id': u'8f0b...', u'kind': u'inference', u'graph': u'user', u'status': u'running', u'done': 0, u'total': 0, ...}
     """
     req = {
       "graph": self.graph,
@@ -207,6 +291,70 @@ class Pfft:
     if self.debug:
       pprint.pprint(req)
     r = requests.put('http://' + self.host_port + '/v1/inference', data=req)
+    return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
+
+  def job(self, id):
+    """
+    The status of a job, its result once it is done
+    """
+    r = requests.get('http://' + self.host_port + '/v1/jobs/' + id)
+    if r.status_code == requests.codes.ok:
+      return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
+    return r.text
+
+  def cancel_job(self, id):
+    r = requests.delete('http://' + self.host_port + '/v1/jobs/' + id)
+    if r.status_code == requests.codes.ok:
+      return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
+    return r.text
+
+  def add_rule(self, name, rule):
+    """
+    Register a rule, apply it with the rules inference
+
+    >>> self.add_rule("symmetric", "[?a foaf:knows ?b] => [?b foaf:knows ?a]")
+    OK
+    """
+    req = {
+      "graph": self.graph,
+      "name": name,
+      "rule": rule,
+      'prefix': PREFIX,
+    }
+    if self.debug:
+      pprint.pprint(req)
+    r = requests.post('http://' + self.host_port + '/v1/rules', data=json.dumps(req))
+    return r.text
+
+  def remove_rule(self, name):
+    r = requests.delete('http://' + self.host_port + '/v1/rules', params={"graph": self.graph, "name": name})
+    return r.text
+
+  def rules(self):
+    r = requests.get('http://' + self.host_port + '/v1/rules', params={"graph": self.graph})
+    if r.status_code == requests.codes.ok:
+      return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
+    return r.text
+
+  def set_trigger(self, name, on=True):
+    """
+    Turn a trigger on or off, a rule of the graph or an inference like geo
+    which then applies to every write
+    >>> self.set_trigger("geo")
+    OK
+    """
+    req = {
+      "graph": self.graph,
+      "name": name,
+      "on": "true" if on else "false",
+    }
+    r = requests.put('http://' + self.host_port + '/v1/triggers', data=req)
+    return r.text
+
+  def triggers(self):
+    r = requests.get('http://' + self.host_port + '/v1/triggers', params={"graph": self.graph})
+    if r.status_code == requests.codes.ok:
+      return r.json['data'] if isinstance(r.json, dict) else r.json()['data']
     return r.text
 
   def load(self, filename):
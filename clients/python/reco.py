@@ -129,6 +129,9 @@ if __name__ == '__main__':
   # Get all US Sports
   #reco.db.query([["?catid", "rdfs:subClassOf", "category:5"], ["?itemid", "item:category", "?catid"], ["?itemid", "?key", "?val"]])
 
+  # Get all Sports, any level of subcategories with a property path
+  #reco.db.query([["?catid", "rdfs:subClassOf*", "category:4"], ["?itemid", "item:category", "?catid"], ["?itemid", "?key", "?val"]])
+
   # Get russian politics in english
   #reco.db.query([["?catid", "rdfs:subClassOf", "category:1"], ["?itemid", "item:category", "?catid"], ["?itemid", "item:data", "?dataid"], ["?dataid", "dc:language", "en"], ["?dataid", "?key", "?val"]])
 
@@ -17,13 +17,14 @@ import (
 func main() {
 	httpApiPort := flag.String("httpApiPort", "9666", "port for the http api")
 	env := flag.String("env", "development", "environment")
-	webDir := flag.String("webDir", "", "web directory for graph visualization full path")
-	dbType := flag.String("dbType", "mongo", "mongo or postgres(not currently implemented)")
-	dbHosts := flag.String("dbHosts", "localhost", "hosts to db uri, comma seperated")
+	webDir := flag.String("webDir", "", "web directory full path to serve the graph visualization from instead of the embedded one")
+	dbType := flag.String("dbType", "mongo", "mongo, memory, disk or postgres")
+	dbHosts := flag.String("dbHosts", "localhost", "hosts to db uri, comma seperated, a postgres:// url, or the data directory for disk")
 	dbName := flag.String("dbName", "eurisko", "db name")
 	dbUser := flag.String("dbUser", "", "database user")
 	dbPass := flag.String("dbPass", "", "database password")
 	graphs := flag.String("graphs", "", "comma seperated graph names")
+	geocoder := flag.String("geocoder", "", "geo inference backend, a nominatim compatible search url, a csv of address,lat,lng or a geonames gazetteer file, public nominatim if empty")
 	maxProcs := flag.Int("maxProcs", runtime.NumCPU(), "number of process")
 	profile := flag.Bool("profile", false, "enable profiling")
 	flag.Parse()
@@ -101,6 +102,12 @@ func main() {
 		*graphs,
 	)
 
+	geo, err := pfftdb.NewGeocoder(*geocoder)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pfftdb.Inferences["geo"] = pfftdb.GeoRule{Geocoder: geo}
+
 	store, err := pfftdb.New(
 		*httpApiPort,
 		*env, *dbType,
@@ -0,0 +1,176 @@
+package pfftdb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// CursorTimeout is how long an unused cursor is kept open.
+var CursorTimeout = 5 * time.Minute
+
+// CursorReapInterval is how often the api closes expired cursors.
+var CursorReapInterval = time.Minute
+
+// results is the part of TripleIter and BindingIter the api writes out.
+type results interface {
+	next() (interface{}, bool)
+	Err() error
+	Close() error
+}
+
+// tripleResults reads triples as results.
+type tripleResults struct {
+	TripleIter
+}
+
+func (r tripleResults) next() (interface{}, bool) {
+	return r.Next()
+}
+
+// bindingResults reads bindings as results.
+type bindingResults struct {
+	BindingIter
+}
+
+func (r bindingResults) next() (interface{}, bool) {
+	return r.Next()
+}
+
+// cursor kinds, a cursor is only continued by the endpoint it came from.
+const (
+	cursorTriples = "triples"
+	cursorQuery   = "query"
+)
+
+// cursor is an open result iterator a client continues reading from.
+// peeked is the result read to know there are more.
+type cursor struct {
+	kind    string
+	graph   string
+	iter    results
+	peeked  interface{}
+	expires time.Time
+}
+
+// next returns the peeked result before reading from the iterator.
+func (c *cursor) next() (interface{}, bool) {
+	if c.peeked != nil {
+		val := c.peeked
+		c.peeked = nil
+		return val, true
+	}
+	return c.iter.next()
+}
+
+// page reads up to size results, all of them if size is 0. It reports
+// whether there are more and keeps the one read to find out.
+func (c *cursor) page(size uint) ([]interface{}, bool) {
+	vals := []interface{}{}
+	for size == 0 || uint(len(vals)) < size {
+		val, ok := c.next()
+		if !ok {
+			return vals, false
+		}
+		vals = append(vals, val)
+	}
+	val, ok := c.next()
+	if !ok {
+		return vals, false
+	}
+	c.peeked = val
+	return vals, true
+}
+
+// cursors holds the open cursors by id. Cursors are removed when taken and
+// put back while there are more results, expired ones are closed.
+type cursors struct {
+	mu   sync.Mutex
+	open map[string]*cursor
+	stop chan struct{}
+}
+
+// reap closes expired cursors every interval until closeAll, so cursors
+// aren't left open when no more are put or taken.
+func (cs *cursors) reap(interval time.Duration) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	cs.stop = stop
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cs.mu.Lock()
+				cs.expire()
+				cs.mu.Unlock()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// put stores a cursor and returns its id.
+func (cs *cursors) put(c *cursor) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	c.expires = time.Now().Add(CursorTimeout)
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.expire()
+	if cs.open == nil {
+		cs.open = map[string]*cursor{}
+	}
+	cs.open[id] = c
+	return id, nil
+}
+
+// take removes and returns the cursor of kind with id.
+func (cs *cursors) take(id, kind string) (*cursor, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.expire()
+	c, ok := cs.open[id]
+	if !ok || c.kind != kind {
+		return nil, false
+	}
+	delete(cs.open, id)
+	return c, true
+}
+
+// expire closes cursors past their timeout, the caller must hold the lock.
+func (cs *cursors) expire() {
+	now := time.Now()
+	for id, c := range cs.open {
+		if now.After(c.expires) {
+			c.iter.Close()
+			delete(cs.open, id)
+		}
+	}
+}
+
+// closeAll stops reaping and closes every open cursor.
+func (cs *cursors) closeAll() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.stop != nil {
+		close(cs.stop)
+		cs.stop = nil
+	}
+	for id, c := range cs.open {
+		c.iter.Close()
+		delete(cs.open, id)
+	}
+}
@@ -0,0 +1,732 @@
+package pfftdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	diskSnapshotFile = "snapshot.dat"
+	diskWALFile      = "wal.log"
+	// checkpoint the write ahead log once it is larger than this
+	diskCheckpointSize = 4 << 20
+	// number of triples per snapshot record
+	diskSnapshotChunk = 1000
+)
+
+// wal record operations
+const (
+	walAdd    = "add"
+	walRemove = "rm"
+	walClear  = "clear"
+	walTx     = "tx" // removes Removed then adds Triples
+)
+
+// DiskGraph is a graph stored in its own directory. Triples and the s, p, o,
+// sp, so, po indexes are held by a MemoryGraph which is rebuilt from
+// the snapshot and write ahead log on open.
+type DiskGraph struct {
+	Dir     string
+	mem     *MemoryGraph
+	wal     *os.File
+	walSize int64
+}
+
+// Disk is an embedded Driver that stores graphs in local files. Every write
+// is appended to a write ahead log and synced before it is applied, so a
+// crash loses at most the write in progress. The log is folded into a
+// snapshot once it grows past CheckpointSize.
+type Disk struct {
+	Dir            string
+	Sync           bool  // fsync the log on every write
+	CheckpointSize int64 // log size in bytes that triggers a snapshot
+	Graphs         map[string]*DiskGraph
+	muGraph        sync.Mutex
+}
+
+// walRecord is a single logged write.
+type walRecord struct {
+	Op      string        `json:"op"`
+	Triples []*diskTriple `json:"t,omitempty"`
+	Removed []*diskTriple `json:"r,omitempty"`
+}
+
+// diskTriple is the stored form of a triple, the object keeps its type
+// so ints don't come back as floats. Uints too large for an int are
+// tagged "u".
+type diskTriple struct {
+	Sub  string          `json:"s"`
+	Pred string          `json:"p"`
+	Type string          `json:"t"`
+	Obj  json.RawMessage `json:"o"`
+}
+
+// NewDisk opens or creates a data directory, loads every graph in it
+// and creates each of the given graphs.
+func NewDisk(dir string, graphs []string) (*Disk, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("missing data directory")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	d := &Disk{
+		Dir:            dir,
+		Sync:           true,
+		CheckpointSize: diskCheckpointSize,
+		Graphs:         map[string]*DiskGraph{},
+		muGraph:        sync.Mutex{},
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		name, err := url.PathUnescape(info.Name())
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		_, err = d.Create(name)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	for _, graphName := range graphs {
+		if graphName == "" {
+			continue
+		}
+		_, err := d.Create(graphName)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// encodeDiskTriple converts a triple to its stored form.
+func encodeDiskTriple(tr *Triple) (*diskTriple, error) {
+	sub, pred, err := SubPred(tr[0], tr[1])
+	if err != nil {
+		return nil, err
+	}
+	dt := &diskTriple{Sub: sub, Pred: pred}
+	var val interface{}
+	switch o := tr[2].(type) {
+	case string:
+		dt.Type, val = "s", o
+	case bool:
+		dt.Type, val = "b", o
+	case int, int8, int16, int32, int64:
+		dt.Type, val = "i", o
+	case uint, uint8, uint16, uint32, uint64:
+		// uints past an int keep their own tag so replay doesn't overflow
+		dt.Type, val = "i", o
+		if reflect.ValueOf(o).Uint() > math.MaxInt64 {
+			dt.Type = "u"
+		}
+	case float32, float64:
+		dt.Type, val = "f", o
+	case Literal:
+		dt.Type, val = "l", o
+	default:
+		dt.Type, val = "j", o
+	}
+	dt.Obj, err = json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// decode converts a stored triple back to a triple.
+func (dt *diskTriple) decode() (*Triple, error) {
+	var obj interface{}
+	var err error
+	switch dt.Type {
+	case "s":
+		var o string
+		err = json.Unmarshal(dt.Obj, &o)
+		obj = o
+	case "b":
+		var o bool
+		err = json.Unmarshal(dt.Obj, &o)
+		obj = o
+	case "i":
+		var o int
+		err = json.Unmarshal(dt.Obj, &o)
+		obj = o
+	case "u":
+		var o uint64
+		err = json.Unmarshal(dt.Obj, &o)
+		obj = o
+	case "f":
+		var o float64
+		err = json.Unmarshal(dt.Obj, &o)
+		obj = o
+	case "l":
+		var o Literal
+		err = json.Unmarshal(dt.Obj, &o)
+		obj = o
+	default:
+		err = json.Unmarshal(dt.Obj, &obj)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Triple{dt.Sub, dt.Pred, obj}, nil
+}
+
+// writeRecord frames a record as length, crc32 and json payload.
+func writeRecord(w io.Writer, rec *walRecord) (int64, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload))
+	_, err = w.Write(append(header, payload...))
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(header) + len(payload)), nil
+}
+
+// readRecords calls fn for each valid record and returns the offset after
+// the last one. A short or corrupt record ends the read, it is the result
+// of a write interrupted by a crash.
+func readRecords(r io.Reader, fn func(*walRecord) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(br, header)
+		if err != nil {
+			return offset, nil
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		sum := binary.BigEndian.Uint32(header[4:8])
+		payload := make([]byte, size)
+		_, err = io.ReadFull(br, payload)
+		if err != nil || crc32.ChecksumIEEE(payload) != sum {
+			return offset, nil
+		}
+		rec := &walRecord{}
+		err = json.Unmarshal(payload, rec)
+		if err != nil {
+			return offset, nil
+		}
+		err = fn(rec)
+		if err != nil {
+			return offset, err
+		}
+		offset += int64(len(header)) + int64(size)
+	}
+}
+
+// apply applies a record to the in memory graph, the caller must hold the lock.
+func (dg *DiskGraph) apply(rec *walRecord) error {
+	switch rec.Op {
+	case walClear:
+		dg.mem.reset()
+		return nil
+	case walAdd, walRemove:
+	case walTx:
+		for _, dt := range rec.Removed {
+			tr, err := dt.decode()
+			if err != nil {
+				return err
+			}
+			dg.mem.remove(tripleKey(dt.Sub, dt.Pred, tr[2]))
+		}
+	default:
+		return fmt.Errorf("unknown log operation %s", rec.Op)
+	}
+	for _, dt := range rec.Triples {
+		tr, err := dt.decode()
+		if err != nil {
+			return err
+		}
+		if rec.Op != walRemove {
+			dg.mem.add(dt.Sub, dt.Pred, tr[2])
+		} else {
+			dg.mem.remove(tripleKey(dt.Sub, dt.Pred, tr[2]))
+		}
+	}
+	return nil
+}
+
+// load reads the snapshot and replays the write ahead log, a torn record
+// at the end of the log is truncated.
+func (dg *DiskGraph) load() error {
+	snapshot, err := os.Open(filepath.Join(dg.Dir, diskSnapshotFile))
+	if err == nil {
+		_, err = readRecords(snapshot, dg.apply)
+		snapshot.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dg.wal, err = os.OpenFile(filepath.Join(dg.Dir, diskWALFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	valid, err := readRecords(dg.wal, dg.apply)
+	if err != nil {
+		return err
+	}
+	info, err := dg.wal.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != valid {
+		log.Errorf("truncating write ahead log %s from %d to %d", dg.Dir, info.Size(), valid)
+		err = dg.wal.Truncate(valid)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dg.wal.Seek(valid, os.SEEK_SET)
+	if err != nil {
+		return err
+	}
+	dg.walSize = valid
+	return nil
+}
+
+// write appends a record to the write ahead log and applies it, the caller
+// must hold the lock.
+func (d *Disk) write(dg *DiskGraph, rec *walRecord) error {
+	if dg.wal == nil {
+		return fmt.Errorf("graph closed %s", dg.mem.Graph.GraphID)
+	}
+	n, err := writeRecord(dg.wal, rec)
+	if err == nil && d.Sync {
+		err = dg.wal.Sync()
+	}
+	if err != nil {
+		// drop a partial record so later writes aren't lost on replay
+		dg.wal.Truncate(dg.walSize)
+		dg.wal.Seek(dg.walSize, os.SEEK_SET)
+		return err
+	}
+	dg.walSize += n
+	err = dg.apply(rec)
+	if err != nil {
+		return err
+	}
+	if dg.walSize > d.CheckpointSize {
+		return dg.checkpoint()
+	}
+	return nil
+}
+
+// checkpoint writes every triple to a new snapshot and empties the write
+// ahead log. The snapshot is renamed into place so a crash leaves either
+// the old or the new one, the caller must hold the lock.
+func (dg *DiskGraph) checkpoint() error {
+	tmpName := filepath.Join(dg.Dir, diskSnapshotFile+".tmp")
+	tmp, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	triples := dg.mem.find(SPEMPTY, SPEMPTY, nil, nil)
+	for start := 0; start < len(triples); start += diskSnapshotChunk {
+		end := start + diskSnapshotChunk
+		if end > len(triples) {
+			end = len(triples)
+		}
+		rec := &walRecord{Op: walAdd}
+		for _, tr := range triples[start:end] {
+			dt, err := encodeDiskTriple(tr)
+			if err != nil {
+				tmp.Close()
+				return err
+			}
+			rec.Triples = append(rec.Triples, dt)
+		}
+		_, err = writeRecord(w, rec)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpName, filepath.Join(dg.Dir, diskSnapshotFile))
+	if err != nil {
+		return err
+	}
+	syncDir(dg.Dir)
+
+	err = dg.wal.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = dg.wal.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return err
+	}
+	dg.walSize = 0
+	return dg.wal.Sync()
+}
+
+// syncDir flushes directory entries so renames survive a crash.
+func syncDir(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer f.Close()
+	f.Sync()
+}
+
+// GraphsList returns a list of created graphs.
+func (d *Disk) GraphsList() []string {
+	d.muGraph.Lock()
+	defer d.muGraph.Unlock()
+
+	graphs := []string{}
+	for k, _ := range d.Graphs {
+		graphs = append(graphs, k)
+	}
+	sort.Strings(graphs)
+	return graphs
+}
+
+// Graph returns the internal graph given a name.
+func (d *Disk) Graph(name string) (*Graph, bool) {
+	dg, ok := d.diskGraph(name)
+	if ok {
+		return dg.mem.Graph, true
+	}
+	return nil, false
+}
+
+// diskGraph returns the disk graph given a name.
+func (d *Disk) diskGraph(name string) (*DiskGraph, bool) {
+	d.muGraph.Lock()
+	defer d.muGraph.Unlock()
+	dg, ok := d.Graphs[name]
+	return dg, ok
+}
+
+// Create adds a graph, loading it from disk if it already exists.
+func (d *Disk) Create(name string) (*Graph, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	// path escaping leaves dot segments, they would escape the data directory
+	if name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid graph name %q", name)
+	}
+	d.muGraph.Lock()
+	defer d.muGraph.Unlock()
+
+	// Check if graph already exists
+	dg, ok := d.Graphs[name]
+	if ok {
+		return dg.mem.Graph, nil
+	}
+
+	graph, err := NewGraph(name, d)
+	if err != nil {
+		return nil, err
+	}
+	dg = &DiskGraph{
+		Dir: filepath.Join(d.Dir, url.PathEscape(name)),
+		mem: &MemoryGraph{Graph: graph},
+	}
+	dg.mem.reset()
+	err = os.MkdirAll(dg.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = dg.load()
+	if err != nil {
+		if dg.wal != nil {
+			dg.wal.Close()
+		}
+		return nil, err
+	}
+	d.Graphs[name] = dg
+	return graph, nil
+}
+
+// Connect noop
+func (d *Disk) Connect(hosts string) {
+}
+
+// Drop removes all triples of a graph and compacts its files.
+func (d *Disk) Drop(gid string) error {
+	return d.RemoveAll(gid)
+}
+
+// Index rebuilds the indexes of a graph and compacts the write ahead log
+// into the snapshot.
+func (d *Disk) Index(gid string, background bool) error {
+	dg, ok := d.diskGraph(gid)
+	if !ok {
+		return fmt.Errorf("graph not found %s", gid)
+	}
+	dg.mem.mu.Lock()
+	defer dg.mem.mu.Unlock()
+
+	triples := dg.mem.find(SPEMPTY, SPEMPTY, nil, nil)
+	dg.mem.reset()
+	for _, tr := range triples {
+		sub, pred, err := SubPred(tr[0], tr[1])
+		if err != nil {
+			continue
+		}
+		dg.mem.add(sub, pred, tr[2])
+	}
+	return dg.checkpoint()
+}
+
+// AddBulk inserts triples skipping invalid ones and returns the number inserted.
+func (d *Disk) AddBulk(graph string, triples []*Triple) (int, error) {
+	dg, ok := d.diskGraph(graph)
+	if !ok {
+		return 0, fmt.Errorf("graph not found %s", graph)
+	}
+	dg.mem.mu.Lock()
+	defer dg.mem.mu.Unlock()
+
+	rec := &walRecord{Op: walAdd}
+	seen := map[string]struct{}{}
+	for _, tr := range triples {
+		if tr == nil {
+			continue
+		}
+		sub, ok := tr[0].(string)
+		if !ok || sub == "" {
+			continue
+		}
+		pred, ok := tr[1].(string)
+		if !ok || pred == "" {
+			continue
+		}
+		if isEmpty(tr[2]) {
+			continue
+		}
+		key := tripleKey(sub, pred, tr[2])
+		if _, ok := dg.mem.triples[key]; ok {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		dt, err := encodeDiskTriple(tr)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		seen[key] = struct{}{}
+		rec.Triples = append(rec.Triples, dt)
+	}
+	if len(rec.Triples) == 0 {
+		return 0, nil
+	}
+	err := d.write(dg, rec)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	return len(rec.Triples), nil
+}
+
+// Add inserts a single triple, duplicates are ignored.
+func (d *Disk) Add(graph, sub, pred string, obj interface{}) error {
+	if _, ok := d.diskGraph(graph); !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	if graph == "" || sub == "" || pred == "" || isEmpty(obj) {
+		return fmt.Errorf("missing components graph:%s sub:%s pred:%s obj:%s", graph, sub, pred, obj)
+	}
+	_, err := d.AddBulk(graph, []*Triple{&Triple{sub, pred, obj}})
+	return err
+}
+
+// removeMatching logs and removes every triple matching the given
+// patterns. A pattern with all empty items clears the graph.
+func (d *Disk) removeMatching(dg *DiskGraph, patterns []*Triple) error {
+	dg.mem.mu.Lock()
+	defer dg.mem.mu.Unlock()
+
+	rec := &walRecord{Op: walRemove}
+	seen := map[string]struct{}{}
+	for _, tr := range patterns {
+		if tr == nil {
+			continue
+		}
+		sub, pred, err := SubPred(tr[0], tr[1])
+		if err != nil {
+			continue
+		}
+		if sub == SPEMPTY && pred == SPEMPTY && isEmpty(tr[2]) {
+			err := d.write(dg, &walRecord{Op: walClear})
+			if err != nil {
+				return err
+			}
+			return dg.checkpoint()
+		}
+		for _, key := range dg.mem.match(sub, pred, tr[2]) {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			dt, err := encodeDiskTriple(dg.mem.triples[key].triple)
+			if err != nil {
+				return err
+			}
+			rec.Triples = append(rec.Triples, dt)
+		}
+	}
+	if len(rec.Triples) == 0 {
+		return nil
+	}
+	return d.write(dg, rec)
+}
+
+// RemoveBulk removes each triple, empty items match everything.
+func (d *Disk) RemoveBulk(graph string, triples []*Triple) error {
+	dg, ok := d.diskGraph(graph)
+	if !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	return d.removeMatching(dg, triples)
+}
+
+// Transact logs the net effect of the operations of a transaction as a
+// single record and applies it, see TxDriver.
+func (d *Disk) Transact(graph string, ops []*TxOp) ([]*Triple, []*Triple, error) {
+	dg, ok := d.diskGraph(graph)
+	if !ok {
+		return nil, nil, fmt.Errorf("graph not found %s", graph)
+	}
+	dg.mem.mu.Lock()
+	defer dg.mem.mu.Unlock()
+
+	added, removed, err := planTx(ops, func(sub, pred string, obj interface{}) ([]*Triple, error) {
+		return dg.mem.find(sub, pred, obj, nil), nil
+	})
+	if err != nil || len(added) == 0 && len(removed) == 0 {
+		return added, removed, err
+	}
+	rec := &walRecord{Op: walTx}
+	for _, tr := range added {
+		dt, err := encodeDiskTriple(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		rec.Triples = append(rec.Triples, dt)
+	}
+	for _, tr := range removed {
+		dt, err := encodeDiskTriple(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		rec.Removed = append(rec.Removed, dt)
+	}
+	err = d.write(dg, rec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
+
+// RemoveAll clears out all triples in a graph.
+func (d *Disk) RemoveAll(graph string) error {
+	dg, ok := d.diskGraph(graph)
+	if !ok {
+		return nil
+	}
+	return d.removeMatching(dg, []*Triple{&Triple{SPEMPTY, SPEMPTY, nil}})
+}
+
+// Remove removes set of triples from a graph depending on the given sub, pred, obj.
+func (d *Disk) Remove(graph, sub, pred string, obj interface{}) error {
+	dg, ok := d.diskGraph(graph)
+	if !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	return d.removeMatching(dg, []*Triple{&Triple{sub, pred, obj}})
+}
+
+// Count returns the number of triples matching sub, pred, obj.
+func (d *Disk) Count(graph, sub, pred string, obj interface{}) (uint, error) {
+	dg, ok := d.diskGraph(graph)
+	if !ok {
+		return 0, fmt.Errorf("missing graph %s", graph)
+	}
+	dg.mem.mu.RLock()
+	defer dg.mem.mu.RUnlock()
+	return uint(len(dg.mem.match(sub, pred, obj))), nil
+}
+
+// Triples returns triples matching sub, pred, obj and the given options.
+func (d *Disk) Triples(graph, sub, pred string, obj interface{}, options *Options) TripleIter {
+	dg, ok := d.diskGraph(graph)
+	if !ok {
+		return errIter(fmt.Errorf("missing graph %s", graph))
+	}
+	dg.mem.mu.RLock()
+	defer dg.mem.mu.RUnlock()
+	return newSliceIter(dg.mem.find(sub, pred, obj, options))
+}
+
+// Pinger noop
+func (d *Disk) Pinger() {
+}
+
+// Close syncs and closes every write ahead log.
+func (d *Disk) Close() {
+	d.muGraph.Lock()
+	defer d.muGraph.Unlock()
+	for name, dg := range d.Graphs {
+		dg.mem.mu.Lock()
+		if dg.wal != nil {
+			err := dg.wal.Sync()
+			if err != nil {
+				log.Error(err, " graph:", name)
+			}
+			dg.wal.Close()
+			dg.wal = nil
+		}
+		dg.mem.mu.Unlock()
+	}
+}
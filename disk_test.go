@@ -0,0 +1,232 @@
+package pfftdb
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDisk(t *testing.T) (*Disk, string) {
+	dir, err := ioutil.TempDir("", "pfftdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDisk(dir, []string{TESTGRAPH, TESTGRAPH2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, dir
+}
+
+func TestDiskReopen(t *testing.T) {
+	d, dir := newTestDisk(t)
+	defer os.RemoveAll(dir)
+
+	data := []*Triple{
+		&Triple{"a", "b", "c"},
+		&Triple{"a", "b", 2},
+		&Triple{"a", "c", 1.5},
+		&Triple{"a", "c", 1.5},
+		&Triple{"a", "d", true},
+		&Triple{"a", "", "d"},
+	}
+	total, err := d.AddBulk(TESTGRAPH, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 {
+		t.Error("should have inserted 4 got:", total)
+	}
+	d.Remove(TESTGRAPH, "a", "d", nil)
+	d.Add(TESTGRAPH2, "x", "y", "z")
+	d.Close()
+
+	d, err = NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if len(d.GraphsList()) != 2 {
+		t.Error("should have loaded 2 graphs got:", d.GraphsList())
+	}
+	triples, _ := ReadTriples(d.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "o"}))
+	if len(triples) != 3 {
+		t.Fatal("should have 3 triples got:", triples)
+	}
+	if _, ok := triples[0][2].(float64); !ok {
+		t.Errorf("1.5 should be a float got %T", triples[0][2])
+	}
+	if _, ok := triples[1][2].(int); !ok {
+		t.Errorf("2 should be an int got %T", triples[1][2])
+	}
+	if c, _ := d.Count(TESTGRAPH2, "x", "", nil); c != 1 {
+		t.Error("should have 1 triple in graph2 got:", c)
+	}
+}
+
+func TestDiskBigUint(t *testing.T) {
+	d, dir := newTestDisk(t)
+	defer os.RemoveAll(dir)
+
+	d.Add(TESTGRAPH, "a", "b", uint64(math.MaxUint64))
+	d.Add(TESTGRAPH, "a", "c", uint(3))
+	d.Close()
+
+	d, err := NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	triples, _ := ReadTriples(d.Triples(TESTGRAPH, "a", "", nil, &Options{OrderBy: "p"}))
+	if len(triples) != 2 {
+		t.Fatal("should have 2 triples got:", triples)
+	}
+	if o, ok := triples[0][2].(uint64); !ok || o != math.MaxUint64 {
+		t.Errorf("max uint64 should come back exactly got %T %v", triples[0][2], triples[0][2])
+	}
+	if o, ok := triples[1][2].(int); !ok || o != 3 {
+		t.Errorf("small uints should come back as ints got %T %v", triples[1][2], triples[1][2])
+	}
+}
+
+func TestDiskDotNames(t *testing.T) {
+	parent, err := ioutil.TempDir("", "pfftdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "data")
+	d, err := NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", ".", ".."} {
+		if _, err := d.Create(name); err == nil {
+			t.Errorf("%q should be rejected", name)
+		}
+	}
+	d.Add("..", "a", "b", "c")
+	d.Close()
+
+	d, err = NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if len(d.GraphsList()) != 0 {
+		t.Error("should have no graphs got:", d.GraphsList())
+	}
+	for _, f := range []string{filepath.Join(parent, diskWALFile), filepath.Join(dir, diskWALFile)} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Error("should not have written", f)
+		}
+	}
+}
+
+func TestDiskTornWAL(t *testing.T) {
+	d, dir := newTestDisk(t)
+	defer os.RemoveAll(dir)
+
+	d.Add(TESTGRAPH, "a", "b", "c")
+	d.Add(TESTGRAPH, "a", "b", "d")
+	d.Close()
+
+	// simulate a crash halfway through writing a record
+	walName := filepath.Join(dir, TESTGRAPH, diskWALFile)
+	f, err := os.OpenFile(walName, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, '{', '"'})
+	f.Close()
+
+	d, err = NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if c, _ := d.Count(TESTGRAPH, "", "", nil); c != 2 {
+		t.Error("should have recovered 2 triples got:", c)
+	}
+	err = d.Add(TESTGRAPH, "a", "b", "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d, err = NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := d.Count(TESTGRAPH, "", "", nil); c != 3 {
+		t.Error("write after recovery should be kept got:", c)
+	}
+}
+
+func TestDiskCheckpoint(t *testing.T) {
+	d, dir := newTestDisk(t)
+	defer os.RemoveAll(dir)
+	d.CheckpointSize = 256
+
+	for i := 0; i < 50; i++ {
+		d.Add(TESTGRAPH, "a", "b", i)
+	}
+	d.RemoveBulk(TESTGRAPH, []*Triple{&Triple{"a", "b", 0}, &Triple{"a", "b", 1}})
+	err := d.Index(TESTGRAPH, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, TESTGRAPH, diskWALFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Error("index should have emptied the log got size:", info.Size())
+	}
+	d.Close()
+
+	d, err = NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if c, _ := d.Count(TESTGRAPH, "a", "b", nil); c != 48 {
+		t.Error("should have 48 triples got:", c)
+	}
+
+	d.RemoveAll(TESTGRAPH)
+	if c, _ := d.Count(TESTGRAPH, "", "", nil); c != 0 {
+		t.Error("remove all failed got:", c)
+	}
+}
+
+func TestDiskTransact(t *testing.T) {
+	d, dir := newTestDisk(t)
+	defer os.RemoveAll(dir)
+
+	d.AddBulk(TESTGRAPH, []*Triple{&Triple{"a", "b", 1}, &Triple{"a", "b", 2}})
+	added, removed, err := d.Transact(TESTGRAPH, []*TxOp{
+		&TxOp{Op: TxRemove, Triple: &Triple{"a", "b", nil}},
+		&TxOp{Op: TxAdd, Triple: &Triple{"a", "b", 2}},
+		&TxOp{Op: TxAdd, Triple: &Triple{"a", "c", 1.5}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || len(removed) != 1 || removed[0][2] != 1 {
+		t.Error(added, removed)
+	}
+	d.Close()
+
+	d, err = NewDisk(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	triples, _ := ReadTriples(d.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "o"}))
+	if len(triples) != 2 || triples[0][2] != 1.5 || triples[1][2] != 2 {
+		t.Error("the transaction should be replayed got:", triples)
+	}
+}
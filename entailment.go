@@ -0,0 +1,248 @@
+package pfftdb
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// EntailNone, EntailRDFS and EntailOWL are the entailment modes,
+	// EntailOWL includes the RDFS rules.
+	EntailNone = "none"
+	EntailRDFS = "rdfs"
+	EntailOWL  = "owl"
+
+	// EntailedGraphSuffix names the graph the consequences of a graph
+	// are materialized in.
+	EntailedGraphSuffix = ".entailed"
+
+	// entailmentPred is the predicate of the entailment of a graph in its
+	// rules graph.
+	entailmentPred = "entailment"
+)
+
+// entailmentPrefixes are the namespaces of the entailment rules.
+var entailmentPrefixes = map[string]string{
+	"rdf":  "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+	"rdfs": "http://www.w3.org/2000/01/rdf-schema#",
+	"owl":  "http://www.w3.org/2002/07/owl#",
+}
+
+// entailmentRules are the rules of each mode by name, the RDFS ones and
+// an OWL RL subset of sameAs, inverseOf, transitive, symmetric and
+// equivalent classes and properties.
+var entailmentRules = map[string]map[string]string{
+	EntailRDFS: {
+		"rdfs2":  `[?p rdfs:domain ?c] [?s ?p ?o] => [?s rdf:type ?c]`,
+		"rdfs3":  `[?p rdfs:range ?c] [?s ?p ?o] => [?o rdf:type ?c]`,
+		"rdfs5":  `[?p rdfs:subPropertyOf ?q] [?q rdfs:subPropertyOf ?r] => [?p rdfs:subPropertyOf ?r]`,
+		"rdfs7":  `[?p rdfs:subPropertyOf ?q] [?s ?p ?o] => [?s ?q ?o]`,
+		"rdfs9":  `[?c rdfs:subClassOf ?d] [?x rdf:type ?c] => [?x rdf:type ?d]`,
+		"rdfs11": `[?c rdfs:subClassOf ?d] [?d rdfs:subClassOf ?e] => [?c rdfs:subClassOf ?e]`,
+	},
+	EntailOWL: {
+		"eq-sym":   `[?x owl:sameAs ?y] => [?y owl:sameAs ?x]`,
+		"eq-trans": `[?x owl:sameAs ?y] [?y owl:sameAs ?z] => [?x owl:sameAs ?z]`,
+		"eq-rep-s": `[?s owl:sameAs ?t] [?s ?p ?o] => [?t ?p ?o]`,
+		"eq-rep-o": `[?o owl:sameAs ?t] [?s ?p ?o] => [?s ?p ?t]`,
+		"prp-inv1": `[?p owl:inverseOf ?q] [?x ?p ?y] => [?y ?q ?x]`,
+		"prp-inv2": `[?p owl:inverseOf ?q] [?x ?q ?y] => [?y ?p ?x]`,
+		"prp-trp":  `[?p rdf:type owl:TransitiveProperty] [?x ?p ?y] [?y ?p ?z] => [?x ?p ?z]`,
+		"prp-symp": `[?p rdf:type owl:SymmetricProperty] [?x ?p ?y] => [?y ?p ?x]`,
+		"cax-eqc":  `[?c owl:equivalentClass ?d] => [?c rdfs:subClassOf ?d] [?d rdfs:subClassOf ?c]`,
+		"prp-eqp":  `[?p owl:equivalentProperty ?q] => [?p rdfs:subPropertyOf ?q] [?q rdfs:subPropertyOf ?p]`,
+	},
+}
+
+// EntailmentRules returns the rules of an entailment mode, none for
+// EntailNone.
+func EntailmentRules(mode string) ([]*Rule, error) {
+	var modes []string
+	switch mode {
+	case EntailNone:
+	case EntailRDFS:
+		modes = []string{EntailRDFS}
+	case EntailOWL:
+		modes = []string{EntailRDFS, EntailOWL}
+	default:
+		return nil, fmt.Errorf("unknown entailment %q", mode)
+	}
+	rules := []*Rule{}
+	for _, m := range modes {
+		for name, text := range entailmentRules[m] {
+			rule, err := ParseRule(name, text)
+			if err != nil {
+				return nil, err
+			}
+			PrefixMap(entailmentPrefixes, rule.Body)
+			PrefixMap(entailmentPrefixes, rule.Head)
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// entailState is the entailment of a graph, its default mode and the mode
+// of the materialized consequences, empty if they are stale.
+type entailState struct {
+	mu          sync.Mutex
+	defaultMode string
+	loaded      bool
+	mode        string
+}
+
+// changed marks the materialized consequences of the graph stale.
+func (g *Graph) changed() {
+	if g.entail == nil {
+		return
+	}
+	g.entail.mu.Lock()
+	g.entail.mode = ""
+	g.entail.mu.Unlock()
+}
+
+// Entailment returns the default entailment mode of queries on the graph,
+// EntailNone if it was never set.
+func (g *Graph) Entailment() (string, error) {
+	if g.entail != nil {
+		g.entail.mu.Lock()
+		defer g.entail.mu.Unlock()
+		if g.entail.loaded {
+			return g.entail.defaultMode, nil
+		}
+	}
+	mode := EntailNone
+	// the rules graph is read through the driver, a graph lookup would
+	// look for the entailment of the rules graph
+	if _, ok := g.Driver.Graph(g.GraphID + RulesGraphSuffix); ok {
+		triples, err := ReadTriples(g.Driver.Triples(g.GraphID+RulesGraphSuffix, g.GraphID, entailmentPred, SPEMPTY, nil))
+		if err != nil {
+			return "", err
+		}
+		if len(triples) > 0 {
+			mode, _ = triples[0][2].(string)
+		}
+	}
+	if g.entail != nil {
+		g.entail.defaultMode, g.entail.loaded = mode, true
+	}
+	return mode, nil
+}
+
+// SetEntailment sets the default entailment mode of queries on the graph,
+// it is kept in the rules graph.
+func (g *Graph) SetEntailment(mode string) error {
+	if _, err := EntailmentRules(mode); err != nil {
+		return err
+	}
+	rg, err := g.sideGraph(RulesGraphSuffix)
+	if err != nil {
+		return err
+	}
+	if err := rg.Remove(g.GraphID, entailmentPred, SPEMPTY); err != nil {
+		return err
+	}
+	if err := rg.Add(g.GraphID, entailmentPred, mode); err != nil {
+		return err
+	}
+	if g.entail != nil {
+		g.entail.mu.Lock()
+		g.entail.defaultMode, g.entail.loaded = mode, true
+		g.entail.mu.Unlock()
+	}
+	return nil
+}
+
+// entailmentMode returns the entailment mode of a query, the default of
+// the graph unless the options have one.
+func (g *Graph) entailmentMode(options *Options) (string, error) {
+	if options != nil && options.Entailment != "" {
+		if _, err := EntailmentRules(options.Entailment); err != nil {
+			return "", err
+		}
+		return options.Entailment, nil
+	}
+	return g.Entailment()
+}
+
+// entailed returns the graph with the consequences of the graph in a
+// mode, which aren't in the graph itself. They are materialized with the
+// entailment rules when the graph changed since or the mode is another.
+func (g *Graph) entailed(mode string) (*Graph, error) {
+	eg, err := g.sideGraph(EntailedGraphSuffix)
+	if err != nil {
+		return nil, err
+	}
+	state := g.entail
+	if state == nil {
+		state = &entailState{}
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.mode == mode {
+		return eg, nil
+	}
+
+	rules, err := EntailmentRules(mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.Driver.RemoveAll(eg.GraphID); err != nil {
+		return nil, err
+	}
+	r := &reasoner{g: g, out: eg, opts: &Options{Graphs: []string{g.GraphID, eg.GraphID}, Entailment: EntailNone}}
+	if _, err := r.run(rules); err != nil {
+		return nil, err
+	}
+	state.mode = mode
+	return eg, nil
+}
+
+// entailedOptions returns the options of a query matching the graphs of
+// options and the consequences of the graph in the entailment mode, or
+// options if it is EntailNone.
+func (g *Graph) entailedOptions(options *Options) (*Options, error) {
+	mode, err := g.entailmentMode(options)
+	if err != nil || mode == EntailNone {
+		return options, err
+	}
+	eg, err := g.entailed(mode)
+	if err != nil {
+		return nil, err
+	}
+	entailed := Options{}
+	if options != nil {
+		entailed = *options
+	}
+	entailed.Graphs = append([]string{}, entailed.Graphs...)
+	if len(entailed.Graphs) == 0 {
+		entailed.Graphs = []string{g.GraphID}
+	}
+	entailed.Graphs = append(entailed.Graphs, eg.GraphID)
+	entailed.Entailment = EntailNone
+	return &entailed, nil
+}
+
+// entailedTriples returns the triples matching sub, pred, obj in the
+// graph and its consequences, which follow the triples of the graph
+// unless options orders them.
+func (g *Graph) entailedTriples(sub, pred string, obj interface{}, options *Options) TripleIter {
+	entailed, err := g.entailedOptions(options)
+	if err != nil {
+		return errIter(err)
+	}
+	if entailed == options {
+		return g.Driver.Triples(g.GraphID, sub, pred, obj, options)
+	}
+	opts := *entailed
+	opts.Limit, opts.Offset = 0, 0
+	triples := []*Triple{}
+	for _, graph := range entailed.Graphs {
+		graphTriples, err := ReadTriples(g.Driver.Triples(graph, sub, pred, obj, &opts))
+		if err != nil {
+			return errIter(err)
+		}
+		triples = append(triples, graphTriples...)
+	}
+	return newSliceIter(limitTriples(triples, options))
+}
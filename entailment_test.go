@@ -0,0 +1,109 @@
+package pfftdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEntailment(t *testing.T) {
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+	defer STORE.Driver.RemoveAll(TESTGRAPH + EntailedGraphSuffix)
+
+	rdf := entailmentPrefixes["rdf"]
+	rdfs := entailmentPrefixes["rdfs"]
+	owl := entailmentPrefixes["owl"]
+	triples := []*Triple{
+		&Triple{"Person", rdfs + "subClassOf", "Agent"},
+		&Triple{"knows", rdfs + "domain", "Person"},
+		&Triple{"knows", rdfs + "subPropertyOf", "met"},
+		&Triple{"_:1", rdf + "type", "Person"},
+		&Triple{"_:2", "knows", "_:3"},
+		&Triple{"parent", owl + "inverseOf", "child"},
+		&Triple{"ancestor", rdf + "type", owl + "TransitiveProperty"},
+		&Triple{"a", "parent", "b"},
+		&Triple{"a", "ancestor", "b"},
+		&Triple{"b", "ancestor", "c"},
+		&Triple{"c", owl + "sameAs", "c2"},
+	}
+	if _, err := GRPH.AddBulk(GRPH.GraphID, triples); err != nil {
+		t.Fatal(err)
+	}
+
+	agents := []*Triple{&Triple{"?x", rdf + "type", "Agent"}}
+	if res := GRPH.Query(agents, nil); len(res) != 0 {
+		t.Error(res)
+	}
+	res := GRPH.Query(agents, &Options{Entailment: EntailRDFS})
+	if vals := pathValues(res, "x"); !reflect.DeepEqual(vals, []string{"_:1", "_:2"}) {
+		t.Error(vals)
+	}
+	if v, err := GRPH.Value("_:2", "met", ""); err == nil {
+		t.Error("met should only be entailed", v)
+	}
+	met, err := GRPH.Triples("_:2", "met", SPEMPTY, &Options{Entailment: EntailRDFS})
+	if err != nil || len(met) != 1 {
+		t.Error(met, err)
+	}
+	// rdfs doesn't know owl
+	if res := GRPH.Query([]*Triple{&Triple{"b", "child", "?x"}}, &Options{Entailment: EntailRDFS}); len(res) != 0 {
+		t.Error(res)
+	}
+
+	var tests = []struct {
+		clause   *Triple
+		key      string
+		expected []string
+	}{
+		{&Triple{"b", "child", "?x"}, "x", []string{"a"}},
+		{&Triple{"a", "ancestor", "?x"}, "x", []string{"b", "c", "c2"}},
+		{&Triple{"?x", owl + "sameAs", "c"}, "x", []string{"c", "c2"}},
+		{&Triple{"?x", rdf + "type", "Agent"}, "x", []string{"_:1", "_:2"}},
+	}
+	for i, tt := range tests {
+		res := GRPH.Query([]*Triple{tt.clause}, &Options{Entailment: EntailOWL})
+		if vals := pathValues(res, tt.key); !reflect.DeepEqual(vals, tt.expected) {
+			t.Errorf("%d %v should be %v got %v", i, tt.clause, tt.expected, vals)
+		}
+	}
+
+	// the default of the graph, none overrides it
+	if err := GRPH.SetEntailment(EntailRDFS); err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := GRPH.Entailment(); err != nil || mode != EntailRDFS {
+		t.Error(mode, err)
+	}
+	if res := GRPH.Query(agents, nil); len(res) != 2 {
+		t.Error(res)
+	}
+	if res := GRPH.Query(agents, &Options{Entailment: EntailNone}); len(res) != 0 {
+		t.Error(res)
+	}
+
+	// writes are entailed on the next query
+	GRPH.Add("_:4", rdf+"type", "Person")
+	if res := GRPH.Query(agents, nil); len(res) != 3 {
+		t.Error(res)
+	}
+	GRPH.Remove("Person", rdfs+"subClassOf", "Agent")
+	if res := GRPH.Query(agents, nil); len(res) != 0 {
+		t.Error(res)
+	}
+	triples, err = GRPH.Triples(SPEMPTY, SPEMPTY, SPEMPTY, &Options{Limit: 3, Offset: 1})
+	if err != nil || len(triples) != 3 {
+		t.Error(triples, err)
+	}
+
+	if err := GRPH.SetEntailment("rdfs++"); err == nil {
+		t.Error("should have gotten error for unknown entailment")
+	}
+	if _, err := GRPH.Triples(SPEMPTY, SPEMPTY, SPEMPTY, &Options{Entailment: "rdfs++"}); err == nil {
+		t.Error("should have gotten error for unknown entailment")
+	}
+	if err := GRPH.SetEntailment(EntailNone); err != nil {
+		t.Fatal(err)
+	}
+}
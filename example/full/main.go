@@ -12,9 +12,9 @@ import (
 func main() {
 	httpApiPort := flag.String("httpApiPort", "9666", "port for the http api")
 	env := flag.String("env", "development", "environment")
-	webDir := flag.String("webDir", "", "web directory for graph visualization, src/web")
-	dbType := flag.String("dbType", "mongo", "mongo or postgres(not currently implemented)")
-	dbHosts := flag.String("dbHosts", "localhost", "hosts to db uri, comma seperated")
+	webDir := flag.String("webDir", "", "web directory to serve the graph visualization from instead of the embedded one, src/web")
+	dbType := flag.String("dbType", "mongo", "mongo, memory, disk or postgres")
+	dbHosts := flag.String("dbHosts", "localhost", "hosts to db uri, comma seperated, a postgres:// url, or the data directory for disk")
 	dbName := flag.String("dbName", "eurisko", "db name")
 	dbUser := flag.String("dbUser", "", "database user")
 	dbPass := flag.String("dbPass", "", "database password")
@@ -0,0 +1,352 @@
+package pfftdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// graph export formats, nodes and edges for Gephi and Graphviz
+	FormatGraphML = "graphml"
+	FormatGEXF    = "gexf"
+	FormatDOT     = "dot"
+)
+
+// graphFormat reports whether a format is a graph export format.
+func graphFormat(format string) bool {
+	switch format {
+	case FormatGraphML, FormatGEXF, FormatDOT:
+		return true
+	}
+	return false
+}
+
+// exportGraph writes all triples as a graph export format.
+func (g *Graph) exportGraph(w io.Writer, format string) error {
+	triples, err := g.Triples(SPEMPTY, SPEMPTY, nil, &Options{OrderBy: "s", Entailment: EntailNone})
+	if err != nil {
+		return err
+	}
+	return g.subgraphOf(triples, true).export(w, format, g.GraphID)
+}
+
+// QuerySubgraph runs a query and returns the subgraph of the triples its
+// clauses matched, see SubgraphOf. Select, groups and aggregates of the
+// options are ignored and clauses with a path or unbound variables are
+// left out.
+func (g *Graph) QuerySubgraph(clauses []*Triple, options *Options) *Subgraph {
+	o := Options{}
+	if options != nil {
+		o = *options
+	}
+	o.Select, o.GroupBy, o.Aggregates, o.Having = nil, nil, nil, nil
+
+	triples := []*Triple{}
+	for _, binding := range g.Query(clauses, &o) {
+		for _, clause := range clauses {
+			if clause == nil {
+				continue
+			}
+			if pred, ok := clause[1].(string); ok && isPath(pred) {
+				continue
+			}
+			triple := substitute(clause, binding)
+			if isVar(triple[0]) || isVar(triple[1]) || isVar(triple[2]) {
+				continue
+			}
+			triples = append(triples, triple)
+		}
+	}
+	return g.SubgraphOf(triples)
+}
+
+// Export writes the subgraph as graphml, gexf or dot.
+func (sg *Subgraph) Export(w io.Writer, format string) error {
+	return sg.export(w, format, "")
+}
+
+// export writes the subgraph with a name, graphml and dot name the graph.
+func (sg *Subgraph) export(w io.Writer, format, name string) error {
+	switch format {
+	case FormatGraphML:
+		return sg.writeGraphML(w, name)
+	case FormatGEXF:
+		return sg.writeGEXF(w)
+	case FormatDOT:
+		return sg.writeDOT(w, name)
+	}
+	return fmt.Errorf("unknown format %s", format)
+}
+
+// attrKeys returns the attr names of the nodes, sorted, and their types,
+// double if every value is a number, boolean if every value is a bool and
+// string otherwise.
+func (sg *Subgraph) attrKeys() ([]string, map[string]string) {
+	types := map[string]string{}
+	for _, node := range sg.Nodes {
+		for name, val := range node.Attrs {
+			t := "string"
+			if _, ok := val.(bool); ok {
+				t = "boolean"
+			} else if _, ok := toFloat(val); ok {
+				t = "double"
+			}
+			if prev, ok := types[name]; ok && prev != t {
+				t = "string"
+			}
+			types[name] = t
+		}
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, types
+}
+
+// attrString formats an attr value, literals by their value and lists of
+// values as json.
+func attrString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case Literal:
+		return v.Value
+	case *Literal:
+		return v.Value
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = attrString(item)
+		}
+		b, _ := json.Marshal(values)
+		return string(b)
+	}
+	if f, ok := toFloat(val); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprint(val)
+	}
+	return string(b)
+}
+
+// graphml elements.
+type graphmlDoc struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlGraph struct {
+	ID          string        `xml:"id,attr,omitempty"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML writes the subgraph as GraphML, attrs are node keys and
+// edges have a label key.
+func (sg *Subgraph) writeGraphML(w io.Writer, name string) error {
+	names, types := sg.attrKeys()
+	doc := graphmlDoc{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Graph: graphmlGraph{ID: name, EdgeDefault: "directed"},
+	}
+	ids := map[string]string{}
+	for i, name := range names {
+		ids[name] = "n" + strconv.Itoa(i)
+		doc.Keys = append(doc.Keys, graphmlKey{ID: ids[name], For: "node", Name: name, Type: types[name]})
+	}
+	doc.Keys = append(doc.Keys, graphmlKey{ID: "label", For: "edge", Name: "label", Type: "string"})
+
+	for _, node := range sg.Nodes {
+		gn := graphmlNode{ID: node.ID}
+		for _, name := range names {
+			if val, ok := node.Attrs[name]; ok {
+				gn.Data = append(gn.Data, graphmlData{Key: ids[name], Value: attrString(val)})
+			}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gn)
+	}
+	for i, edge := range sg.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: edge.Source,
+			Target: edge.Target,
+			Data:   []graphmlData{{Key: "label", Value: edge.Label}},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+// gexf elements.
+type gexfDoc struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string          `xml:"defaultedgetype,attr"`
+	Attributes      *gexfAttributes `xml:"attributes,omitempty"`
+	Nodes           []gexfNode      `xml:"nodes>node"`
+	Edges           []gexfEdge      `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue,omitempty"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfEdge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Label  string `xml:"label,attr"`
+}
+
+// writeGEXF writes the subgraph as GEXF 1.2, attrs are node attributes
+// and nodes are labeled by their id.
+func (sg *Subgraph) writeGEXF(w io.Writer) error {
+	names, types := sg.attrKeys()
+	doc := gexfDoc{
+		XMLNS:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Graph:   gexfGraph{DefaultEdgeType: "directed"},
+	}
+	ids := map[string]string{}
+	if len(names) > 0 {
+		doc.Graph.Attributes = &gexfAttributes{Class: "node"}
+		for i, name := range names {
+			ids[name] = strconv.Itoa(i)
+			doc.Graph.Attributes.Attributes = append(doc.Graph.Attributes.Attributes, gexfAttribute{ID: ids[name], Title: name, Type: types[name]})
+		}
+	}
+
+	for _, node := range sg.Nodes {
+		gn := gexfNode{ID: node.ID, Label: node.ID}
+		for _, name := range names {
+			if val, ok := node.Attrs[name]; ok {
+				gn.AttValues = append(gn.AttValues, gexfAttValue{For: ids[name], Value: attrString(val)})
+			}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gn)
+	}
+	for i, edge := range sg.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     strconv.Itoa(i),
+			Source: edge.Source,
+			Target: edge.Target,
+			Label:  edge.Label,
+		})
+	}
+	return writeXML(w, doc)
+}
+
+// writeXML writes an indented xml document with its header.
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// dotEscaper escapes quoted dot ids.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+// dotID quotes a dot id.
+func dotID(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// writeDOT writes the subgraph as a Graphviz digraph, attrs are node
+// attributes and edges are labeled by their predicate.
+func (sg *Subgraph) writeDOT(w io.Writer, name string) error {
+	bw := bufio.NewWriter(w)
+	if name != "" {
+		fmt.Fprintf(bw, "digraph %s {\n", dotID(name))
+	} else {
+		fmt.Fprint(bw, "digraph {\n")
+	}
+	for _, node := range sg.Nodes {
+		names := make([]string, 0, len(node.Attrs))
+		for name := range node.Attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		attrs := make([]string, len(names))
+		for i, name := range names {
+			attrs[i] = dotID(name) + "=" + dotID(attrString(node.Attrs[name]))
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(bw, "\t%s;\n", dotID(node.ID))
+			continue
+		}
+		fmt.Fprintf(bw, "\t%s [%s];\n", dotID(node.ID), strings.Join(attrs, ", "))
+	}
+	for _, edge := range sg.Edges {
+		fmt.Fprintf(bw, "\t%s -> %s [label=%s];\n", dotID(edge.Source), dotID(edge.Target), dotID(edge.Label))
+	}
+	fmt.Fprint(bw, "}\n")
+	return bw.Flush()
+}
@@ -0,0 +1,117 @@
+package pfftdb
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// addPeople adds people who know each other with literal attrs.
+func addPeople() {
+	GRPH.Add("_:paul", "name", "Paul")
+	GRPH.Add("_:paul", "age", 30)
+	GRPH.Add("_:paul", "nick", Literal{Value: "P", Lang: "en"})
+	GRPH.Add("_:paul", "knows", "_:kevin")
+	GRPH.Add("_:kevin", "name", `Kevin "K"`)
+	GRPH.Add("_:kevin", "homepage", "http://example.com/kevin")
+}
+
+func TestSubgraphOf(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	addPeople()
+
+	sg := GRPH.SubgraphOf([]*Triple{
+		{"_:paul", "knows", "_:kevin"},
+		{"_:paul", "name", "Paul"},
+		{"_:paul", "name", "Paul"},
+		{"_:kevin", "name", "Kevin"},
+	})
+	ids, edges := subgraphIDs(sg)
+	if !reflect.DeepEqual(ids, []string{"_:paul", "_:kevin"}) || len(edges) != 1 {
+		t.Errorf("%v %+v", ids, edges)
+	}
+	if sg.Nodes[0].Attrs["name"] != "Paul" {
+		t.Errorf("%+v", sg.Nodes[0])
+	}
+
+	// query results, the path clause is left out
+	sg = GRPH.QuerySubgraph([]*Triple{
+		{"?a", "knows", "?b"},
+		{"?b", "name", "?name"},
+		{"?a", "knows+", "?c"},
+	}, &Options{Select: []string{"?name"}})
+	ids, edges = subgraphIDs(sg)
+	if !reflect.DeepEqual(ids, []string{"_:paul", "_:kevin"}) || len(edges) != 1 || sg.Nodes[1].Attrs["name"] != `Kevin "K"` {
+		t.Errorf("%v %+v", ids, sg)
+	}
+	if len(sg.Nodes[0].Attrs) != 0 {
+		t.Errorf("%+v", sg.Nodes[0])
+	}
+}
+
+func TestExportGraph(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	addPeople()
+
+	buf := &bytes.Buffer{}
+	if err := GRPH.Export(buf, FormatGraphML, nil); err != nil {
+		t.Fatal(err)
+	}
+	graphml := graphmlDoc{}
+	if err := xml.Unmarshal(buf.Bytes(), &graphml); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	keys := map[string]string{}
+	for _, key := range graphml.Keys {
+		keys[key.Name] = key.Type
+	}
+	if !reflect.DeepEqual(keys, map[string]string{"age": "double", "name": "string", "nick": "string", "label": "string"}) {
+		t.Error(keys)
+	}
+	// the homepage is an iri so a node
+	if graphml.Graph.ID != TESTGRAPH || len(graphml.Graph.Nodes) != 3 || len(graphml.Graph.Edges) != 2 {
+		t.Errorf("%+v", graphml.Graph)
+	}
+
+	buf.Reset()
+	if err := GRPH.Export(buf, FormatGEXF, nil); err != nil {
+		t.Fatal(err)
+	}
+	gexf := gexfDoc{}
+	if err := xml.Unmarshal(buf.Bytes(), &gexf); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	if len(gexf.Graph.Nodes) != 3 || len(gexf.Graph.Edges) != 2 || len(gexf.Graph.Attributes.Attributes) != 3 {
+		t.Errorf("%+v", gexf.Graph)
+	}
+	for _, node := range gexf.Graph.Nodes {
+		if node.ID == "_:paul" && len(node.AttValues) != 3 {
+			t.Errorf("%+v", node)
+		}
+	}
+
+	buf.Reset()
+	if err := GRPH.Export(buf, FormatDOT, nil); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, line := range []string{
+		`digraph "test" {`,
+		`	"_:kevin" ["name"="Kevin \"K\""];`,
+		`	"_:paul" ["age"="30", "name"="Paul", "nick"="P"];`,
+		`	"http://example.com/kevin";`,
+		`	"_:paul" -> "_:kevin" [label="knows"];`,
+	} {
+		if !strings.Contains(dot, line+"\n") {
+			t.Errorf("missing %s in %s", line, dot)
+		}
+	}
+
+	if err := (&Subgraph{}).Export(buf, "xml"); err == nil {
+		t.Error("unknown format should be an error")
+	}
+}
@@ -0,0 +1,641 @@
+package pfftdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Expr is a filter expression. A leaf is a variable with Var or a constant
+// with Val, otherwise Op is applied to Args. In json an expression is this
+// tree or a string in SPARQL FILTER syntax, see ParseExpr.
+//
+// Ops are and, or, not, the comparisons ==, !=, <, <=, >, >=, the
+// arithmetic +, -, *, / and the functions regex(text, pattern, flags),
+// contains(text, sub), strstarts(text, prefix), strends(text, suffix),
+// in(val, vals...) and bound(var). - with a single arg negates it.
+// Comparisons use compareObjects so numbers compare by value and dates as
+// times, strings compare case sensitively.
+type Expr struct {
+	Op   string      `json:"op,omitempty"`
+	Args []*Expr     `json:"args,omitempty"`
+	Var  string      `json:"var,omitempty"`
+	Val  interface{} `json:"val,omitempty"`
+}
+
+// exprArity is the number of args of each op, -1 is at least one and -2
+// at least two.
+var exprArity = map[string]int{
+	"and": -2, "or": -2, "not": 1,
+	"==": 2, "!=": 2, "<": 2, "<=": 2, ">": 2, ">=": 2,
+	"+": 2, "-": -1, "*": 2, "/": 2,
+	"regex": -2, "contains": 2, "strstarts": 2, "strends": 2,
+	"in": -1, "bound": 1,
+}
+
+// errUnbound is returned when an expression uses an unbound variable.
+var errUnbound = fmt.Errorf("unbound variable")
+
+// Vars returns the variables an expression uses, sorted.
+func (e *Expr) Vars() []string {
+	seen := map[string]bool{}
+	var walk func(e *Expr)
+	walk = func(e *Expr) {
+		if e.Var != "" {
+			seen[e.Var] = true
+		}
+		for _, arg := range e.Args {
+			walk(arg)
+		}
+	}
+	walk(e)
+	vars := make([]string, 0, len(seen))
+	for v := range seen {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// check validates the ops and their number of args.
+func (e *Expr) check() error {
+	if e.Op == "" {
+		if len(e.Args) > 0 {
+			return fmt.Errorf("args without op")
+		}
+		return nil
+	}
+	arity, ok := exprArity[e.Op]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown op %q", e.Op)
+	case arity >= 0 && len(e.Args) != arity,
+		arity < 0 && len(e.Args) < -arity:
+		return fmt.Errorf("wrong number of args for %s", e.Op)
+	case e.Op == "-" && len(e.Args) > 2:
+		return fmt.Errorf("wrong number of args for -")
+	case e.Op == "regex" && len(e.Args) > 3:
+		return fmt.Errorf("wrong number of args for regex")
+	case e.Op == "bound" && e.Args[0].Var == "":
+		return fmt.Errorf("bound needs a variable")
+	}
+	for _, arg := range e.Args {
+		if arg == nil {
+			return fmt.Errorf("missing arg for %s", e.Op)
+		}
+		if err := arg.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match reports whether the expression is true for a binding, errors like
+// unbound variables or values of the wrong type are false.
+func (e *Expr) Match(b Bindings) bool {
+	val, err := e.Eval(b)
+	return err == nil && val == true
+}
+
+// Eval evaluates the expression for a binding.
+func (e *Expr) Eval(b Bindings) (interface{}, error) {
+	switch {
+	case e.Var != "":
+		val, ok := b[e.Var]
+		if !ok {
+			return nil, errUnbound
+		}
+		return val, nil
+	case e.Op == "":
+		return e.Val, nil
+	case e.Op == "bound":
+		_, ok := b[e.Args[0].Var]
+		return ok, nil
+	case e.Op == "and" || e.Op == "or":
+		// an error only matters if no other arg decides the result
+		var err error
+		for _, arg := range e.Args {
+			val, argErr := arg.bool(b)
+			switch {
+			case argErr != nil:
+				err = argErr
+			case val == (e.Op == "or"):
+				return val, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return e.Op == "and", nil
+	case e.Op == "not":
+		val, err := e.Args[0].bool(b)
+		return !val, err
+	}
+
+	args := make([]interface{}, len(e.Args))
+	for i, arg := range e.Args {
+		val, err := arg.Eval(b)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+
+	switch e.Op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		c, ok := compareObjects(args[0], args[1])
+		if !ok {
+			// different types are never equal
+			switch e.Op {
+			case "==":
+				return false, nil
+			case "!=":
+				return true, nil
+			}
+			return nil, fmt.Errorf("can't compare %v %s %v", args[0], e.Op, args[1])
+		}
+		switch e.Op {
+		case "==":
+			return c == 0, nil
+		case "!=":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "+", "-", "*", "/":
+		return arithmetic(e.Op, args)
+	case "in":
+		for _, val := range args[1:] {
+			if c, ok := compareObjects(args[0], val); ok && c == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s needs strings got %v", e.Op, arg)
+		}
+		strs[i] = s
+	}
+	switch e.Op {
+	case "contains":
+		return strings.Contains(strs[0], strs[1]), nil
+	case "strstarts":
+		return strings.HasPrefix(strs[0], strs[1]), nil
+	case "strends":
+		return strings.HasSuffix(strs[0], strs[1]), nil
+	}
+	flags := ""
+	if len(strs) == 3 {
+		flags = strs[2]
+	}
+	re, err := compileRegex(strs[1], flags)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(strs[0]), nil
+}
+
+// bool evaluates an expression which has to be a boolean.
+func (e *Expr) bool(b Bindings) (bool, error) {
+	val, err := e.Eval(b)
+	if err != nil {
+		return false, err
+	}
+	v, ok := val.(bool)
+	if !ok {
+		return false, fmt.Errorf("not a boolean %v", val)
+	}
+	return v, nil
+}
+
+// arithmetic applies an arithmetic op to numbers, the result is a float64.
+func arithmetic(op string, args []interface{}) (interface{}, error) {
+	nums := make([]float64, len(args))
+	for i, arg := range args {
+		f, ok := toFloat(arg)
+		if !ok {
+			return nil, fmt.Errorf("%s needs numbers got %v", op, arg)
+		}
+		nums[i] = f
+	}
+	if len(nums) == 1 {
+		return -nums[0], nil
+	}
+	switch op {
+	case "+":
+		return nums[0] + nums[1], nil
+	case "-":
+		return nums[0] - nums[1], nil
+	case "*":
+		return nums[0] * nums[1], nil
+	}
+	if nums[1] == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return nums[0] / nums[1], nil
+}
+
+// regexCacheSize is the number of compiled regexes kept.
+const regexCacheSize = 1000
+
+// regexCache holds compiled regexes by flags and pattern.
+var regexCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+// compileRegex compiles a pattern with the SPARQL flags i, m and s.
+func compileRegex(pattern, flags string) (*regexp.Regexp, error) {
+	key := flags + "/" + pattern
+	regexCache.Lock()
+	defer regexCache.Unlock()
+	if re, ok := regexCache.m[key]; ok {
+		return re, nil
+	}
+	if strings.Trim(flags, "ims") != "" {
+		return nil, fmt.Errorf("unsupported regex flags %q", flags)
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexCache.m) >= regexCacheSize {
+		regexCache.m = map[string]*regexp.Regexp{}
+	}
+	regexCache.m[key] = re
+	return re, nil
+}
+
+// And returns the conjunction of expressions, nil ones are left out.
+func And(exprs ...*Expr) *Expr {
+	args := []*Expr{}
+	for _, e := range exprs {
+		switch {
+		case e == nil:
+		case e.Op == "and":
+			args = append(args, e.Args...)
+		default:
+			args = append(args, e)
+		}
+	}
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		return args[0]
+	}
+	return &Expr{Op: "and", Args: args}
+}
+
+// conjuncts splits an expression into the parts anded together.
+func (e *Expr) conjuncts() []*Expr {
+	if e == nil {
+		return nil
+	}
+	if e.Op == "and" {
+		return e.Args
+	}
+	return []*Expr{e}
+}
+
+// UnmarshalJSON decodes an expression tree or parses a string with
+// ParseExpr, literal values become their go value.
+func (e *Expr) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := ParseExpr(s)
+		if err != nil {
+			return err
+		}
+		*e = *parsed
+		return nil
+	}
+
+	type expr Expr
+	tmp := expr{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	tmp.Val, err = typedValue(tmp.Val)
+	if err != nil {
+		return err
+	}
+	*e = Expr(tmp)
+	return e.check()
+}
+
+// ParseExpr parses a SPARQL FILTER expression like
+// ?age >= 21 && (regex(?name, "^al", "i") || !bound(?email)). Operators
+// are ||, &&, !, =, !=, <, <=, >, >=, IN (...), NOT IN (...), +, -, * and
+// /, functions are the ones of Expr. Operators need spaces around them if
+// they could be part of a variable name, like ?a - 1.
+func ParseExpr(s string) (*Expr, error) {
+	p := &sparqlParser{
+		lex:   &sparqlLexer{in: []rune(s)},
+		query: &SPARQLQuery{Prefix: map[string]string{}, Options: &Options{}},
+		seen:  map[string]bool{},
+	}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q", p.tok.val)
+	}
+	return e, nil
+}
+
+// expr parses an or expression, the lowest precedence.
+func (p *sparqlParser) expr() (*Expr, error) {
+	return p.binary([]string{"||"}, p.andExpr)
+}
+
+func (p *sparqlParser) andExpr() (*Expr, error) {
+	return p.binary([]string{"&&"}, p.relExpr)
+}
+
+func (p *sparqlParser) addExpr() (*Expr, error) {
+	return p.binary([]string{"+", "-"}, p.mulExpr)
+}
+
+func (p *sparqlParser) mulExpr() (*Expr, error) {
+	return p.binary([]string{"*", "/"}, p.unaryExpr)
+}
+
+// exprOps maps operator tokens to ops.
+var exprOps = map[string]string{"||": "or", "&&": "and", "=": "=="}
+
+// binary parses operands separated by any of ops, left associative.
+func (p *sparqlParser) binary(ops []string, operand func() (*Expr, error)) (*Expr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range ops {
+			if p.isPunct(o) {
+				op = o
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := exprOps[op]; ok {
+			op = name
+		}
+		left = &Expr{Op: op, Args: []*Expr{left, right}}
+	}
+}
+
+// relExpr parses a comparison or IN.
+func (p *sparqlParser) relExpr() (*Expr, error) {
+	left, err := p.addExpr()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "!=", "<", "<=", ">", ">="} {
+		if !p.isPunct(op) {
+			continue
+		}
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+		right, err := p.addExpr()
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := exprOps[op]; ok {
+			op = name
+		}
+		return &Expr{Op: op, Args: []*Expr{left, right}}, nil
+	}
+
+	not := p.isKeyword("NOT")
+	if not {
+		err = p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !p.isKeyword("IN") {
+		if not {
+			return nil, fmt.Errorf("expected IN got %q", p.tok.val)
+		}
+		return left, nil
+	}
+	err = p.advance()
+	if err != nil {
+		return nil, err
+	}
+	args, err := p.exprArgs()
+	if err != nil {
+		return nil, err
+	}
+	e := &Expr{Op: "in", Args: append([]*Expr{left}, args...)}
+	if not {
+		e = &Expr{Op: "not", Args: []*Expr{e}}
+	}
+	return e, nil
+}
+
+// unaryExpr parses ! and - in front of a primary expression.
+func (p *sparqlParser) unaryExpr() (*Expr, error) {
+	op := ""
+	switch {
+	case p.isPunct("!"):
+		op = "not"
+	case p.isPunct("-"):
+		op = "-"
+	case p.isPunct("+"):
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		return p.unaryExpr()
+	}
+	if op == "" {
+		return p.primaryExpr()
+	}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	arg, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{Op: op, Args: []*Expr{arg}}, nil
+}
+
+// primaryExpr parses a bracketed expression, function call, variable or
+// constant.
+func (p *sparqlParser) primaryExpr() (*Expr, error) {
+	switch {
+	case p.isPunct("("):
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectPunct(")")
+	case p.tok.kind == tokVar:
+		e := &Expr{Var: p.tok.val}
+		return e, p.advance()
+	case p.tok.kind == tokKeyword && p.tok.val != "TRUE" && p.tok.val != "FALSE":
+		op := strings.ToLower(p.tok.val)
+		if p.having && aggregateOps[op] {
+			agg, err := p.aggregate()
+			if err != nil {
+				return nil, err
+			}
+			return &Expr{Var: p.havingVar(agg)}, nil
+		}
+		if _, ok := exprArity[op]; !ok || op == "in" {
+			return nil, fmt.Errorf("unknown function %q", p.tok.val)
+		}
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.exprArgs()
+		if err != nil {
+			return nil, err
+		}
+		e := &Expr{Op: op, Args: args}
+		return e, e.check()
+	}
+	pname := p.tok.kind == tokPName
+	val, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	if pname {
+		_, _, val = PrefixMapTriple(p.query.Prefix, "", "", val)
+	}
+	return &Expr{Val: val}, nil
+}
+
+// exprArgs parses a bracketed comma separated list of expressions.
+func (p *sparqlParser) exprArgs() ([]*Expr, error) {
+	err := p.expectPunct("(")
+	if err != nil {
+		return nil, err
+	}
+	args := []*Expr{}
+	for !p.isPunct(")") {
+		if len(args) > 0 {
+			err = p.expectPunct(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, p.advance()
+}
+
+// queryFilter is a condition Query checks as soon as its variables are
+// bound.
+type queryFilter struct {
+	vars  []string
+	match func(Bindings) bool
+}
+
+// queryFilters returns the filters and the conditions of the where
+// expression of options, all of them have to match.
+func queryFilters(options *Options) []*queryFilter {
+	filters := []*queryFilter{}
+	for _, f := range options.Filter {
+		f := f
+		filters = append(filters, &queryFilter{
+			vars:  []string{f.Key},
+			match: func(b Bindings) bool { return f.Match(b[f.Key]) },
+		})
+	}
+	for _, e := range options.Where.conjuncts() {
+		filters = append(filters, &queryFilter{vars: e.Vars(), match: e.Match})
+	}
+	return filters
+}
+
+// applyFilters removes bindings not matching the filters whose variables
+// are bound and returns the filters left.
+func applyFilters(bindings []Bindings, filters []*queryFilter, bound map[string]bool) ([]Bindings, []*queryFilter) {
+	left := []*queryFilter{}
+	ready := []*queryFilter{}
+	for _, f := range filters {
+		if sharesAll(f.vars, bound) {
+			ready = append(ready, f)
+		} else {
+			left = append(left, f)
+		}
+	}
+	if len(ready) == 0 {
+		return bindings, left
+	}
+	filtered := bindings[:0]
+	for _, b := range bindings {
+		if matchFilters(b, ready) {
+			filtered = append(filtered, b)
+		}
+	}
+	return filtered, left
+}
+
+// matchFilters reports whether a binding matches every filter.
+func matchFilters(b Bindings, filters []*queryFilter) bool {
+	for _, f := range filters {
+		if !f.match(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// sharesAll reports whether all vars are bound.
+func sharesAll(vars []string, bound map[string]bool) bool {
+	for _, v := range vars {
+		if !bound[v] {
+			return false
+		}
+	}
+	return true
+}
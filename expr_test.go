@@ -0,0 +1,136 @@
+package pfftdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	e, err := ParseExpr(`?age >= 21 && (regex(?name, "^al", "i") || !bound(?email))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Expr{Op: "and", Args: []*Expr{
+		&Expr{Op: ">=", Args: []*Expr{&Expr{Var: "age"}, &Expr{Val: 21.0}}},
+		&Expr{Op: "or", Args: []*Expr{
+			&Expr{Op: "regex", Args: []*Expr{&Expr{Var: "name"}, &Expr{Val: "^al"}, &Expr{Val: "i"}}},
+			&Expr{Op: "not", Args: []*Expr{&Expr{Op: "bound", Args: []*Expr{&Expr{Var: "email"}}}}},
+		}},
+	}}
+	if !reflect.DeepEqual(e, expected) {
+		t.Errorf("%+v", e)
+	}
+	if !reflect.DeepEqual(e.Vars(), []string{"age", "email", "name"}) {
+		t.Error(e.Vars())
+	}
+
+	var bad = []string{
+		`?a >`,
+		`?a = 1 )`,
+		`nope(?a)`,
+		`bound("a")`,
+		`contains(?a)`,
+		`?a NOT 3`,
+	}
+	for _, b := range bad {
+		if _, err := ParseExpr(b); err == nil {
+			t.Error("should have gotten error for ", b)
+		}
+	}
+}
+
+func TestExprMatch(t *testing.T) {
+	date, _ := NewLiteral("2014-01-02T10:00:00Z", "xsd:dateTime", "")
+	b := Bindings{"a": 4, "b": 6.0, "name": "Albert", "born": date}
+	var tests = []struct {
+		in  string
+		out bool
+	}{
+		{`?a < ?b`, true},
+		{`?a + 2 = ?b`, true},
+		{`?b / 2 * -1 = -3`, true},
+		{`?a / 0 = 1`, false},
+		{`?a IN (1, 2, 4)`, true},
+		{`?a NOT IN (1, 2, 4)`, false},
+		{`contains(?name, "ber")`, true},
+		{`strstarts(?name, "al")`, false},
+		{`regex(?name, "^al", "i")`, true},
+		{`strends(?name, "rt") && ?a != "4"`, true},
+		{`?missing = 1 || ?a = 4`, true},
+		{`?missing = 1 && ?a = 4`, false},
+		{`!(?missing = 1)`, false},
+		{`!bound(?missing)`, true},
+		{`?name > 3`, false},
+		{`?born > "2014-01-01T00:00:00Z"^^xsd:dateTime`, true},
+		{`?born < "2014-01-01T00:00:00Z"^^xsd:dateTime`, false},
+	}
+	for i, tt := range tests {
+		e, err := ParseExpr(tt.in)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if e.Match(b) != tt.out {
+			t.Errorf("%d %s should be %v", i, tt.in, tt.out)
+		}
+	}
+}
+
+func TestExprUnmarshalJSON(t *testing.T) {
+	e := &Expr{}
+	err := json.Unmarshal([]byte(`{"op": "and", "args": [
+		{"op": ">", "args": [{"var": "born"}, {"val": {"value": "2014-01-01T00:00:00Z", "datatype": "xsd:dateTime"}}]},
+		"?age > 20"
+	]}`), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Args[0].Args[1].Val.(Literal); !ok {
+		t.Errorf("should be a literal %+v", e.Args[0].Args[1])
+	}
+	if e.Args[1].Op != ">" {
+		t.Errorf("should have parsed the string %+v", e.Args[1])
+	}
+	if err := json.Unmarshal([]byte(`{"op": "x"}`), e); err == nil {
+		t.Error("should have gotten error for unknown op")
+	}
+}
+
+func TestQueryWhere(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	GRPH.Add("_:1", "name", "Albert")
+	GRPH.Add("_:1", "age", 30)
+	GRPH.Add("_:2", "name", "Barry")
+	GRPH.Add("_:2", "age", 12)
+	GRPH.Add("_:3", "name", "Alice")
+	GRPH.Add("_:3", "age", 40)
+
+	clauses := []*Triple{
+		&Triple{"?id", "name", "?name"},
+		&Triple{"?id", "age", "?age"},
+		&Triple{"?id", "email", "?email"},
+	}
+	where, err := ParseExpr(`?age > 18 && !bound(?email) && regex(?name, "^ali", "i")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := GRPH.Query(clauses, &Options{Optional: []uint{2}, Where: where})
+	if len(res) != 1 || res[0]["name"] != "Alice" {
+		t.Error(res)
+	}
+
+	// filters are anded
+	res = GRPH.Query(clauses[:2], &Options{Filter: []*Filter{&Filter{"age", ">", 18}, &Filter{"name", "LIKE", "ali"}}})
+	if len(res) != 1 || res[0]["name"] != "Alice" {
+		t.Error(res)
+	}
+
+	bindings := []Bindings{{"a": 1}, {"a": 2}, {"a": 3}}
+	filters := queryFilters(&Options{Where: And(&Expr{Op: ">", Args: []*Expr{&Expr{Var: "a"}, &Expr{Val: 1}}}, where)})
+	bindings, filters = applyFilters(bindings, filters, map[string]bool{"a": true})
+	if len(bindings) != 2 || len(filters) != 2 {
+		t.Error("should have applied the filter on a", bindings, filters)
+	}
+}
@@ -0,0 +1,322 @@
+package pfftdb
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// NominatimURL is the search url of the public Nominatim server.
+const NominatimURL = "https://nominatim.openstreetmap.org/search"
+
+// NominatimInterval is the least time between the requests of the
+// Nominatim geocoders of NewGeocoder, once a second as the usage policy of
+// the public server asks.
+var NominatimInterval = time.Second
+
+// GeocodeTimeout is the timeout of the requests of the geocoders without
+// their own http client.
+var GeocodeTimeout = 10 * time.Second
+
+// geocodeClient is the http client of geocoders without their own.
+var geocodeClient = &http.Client{Timeout: GeocodeTimeout}
+
+var (
+	// ErrNoLocation is returned by a Geocoder which can't resolve an
+	// address.
+	ErrNoLocation = fmt.Errorf("no location")
+
+	// ErrOverQueryLimit is returned by a Geocoder which is rate limited,
+	// the address can be retried later.
+	ErrOverQueryLimit = fmt.Errorf("over query limit")
+)
+
+// DefaultGeocoder is used by a GeoRule without one, it queries the public
+// Nominatim server once a second as its usage policy asks.
+var DefaultGeocoder Geocoder = &NominatimGeocoder{URL: NominatimURL, Interval: NominatimInterval}
+
+// Geocoder resolves an address to its latitude and longitude, it stops
+// when the context is done.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (lat, lng float64, err error)
+}
+
+// NewGeocoder returns the geocoder of a source, a Nominatim compatible
+// search url, a csv file of address,lat,lng rows or a tab separated
+// GeoNames gazetteer file. An empty source is the DefaultGeocoder.
+func NewGeocoder(source string) (Geocoder, error) {
+	switch {
+	case source == "":
+		return DefaultGeocoder, nil
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		return &NominatimGeocoder{URL: source, Interval: NominatimInterval}, nil
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(source), ".csv") {
+		return ReadCSVGeocoder(f)
+	}
+	return ReadGazetteer(f)
+}
+
+// NominatimGeocoder queries a Nominatim compatible search url.
+type NominatimGeocoder struct {
+	URL       string
+	UserAgent string        // pfftdb if empty
+	Interval  time.Duration // the least time between requests
+	Client    *http.Client  // one with GeocodeTimeout if nil
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Geocode returns the location of the first search result of an address,
+// ErrOverQueryLimit if the server throttles requests.
+func (n *NominatimGeocoder) Geocode(ctx context.Context, address string) (float64, float64, error) {
+	n.mu.Lock()
+	if wait := n.Interval - time.Since(n.last); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			n.mu.Unlock()
+			return 0, 0, ctx.Err()
+		}
+	}
+	n.last = time.Now()
+	n.mu.Unlock()
+
+	v := url.Values{}
+	v.Set("q", address)
+	v.Set("format", "json")
+	v.Set("limit", "1")
+	req, err := http.NewRequest("GET", n.URL+"?"+v.Encode(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req = req.WithContext(ctx)
+	agent := n.UserAgent
+	if agent == "" {
+		agent = "pfftdb"
+	}
+	req.Header.Set("User-Agent", agent)
+
+	client := n.Client
+	if client == nil {
+		client = geocodeClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return 0, 0, ErrOverQueryLimit
+	default:
+		return 0, 0, fmt.Errorf("geocoder status %d: %s", resp.StatusCode, body)
+	}
+
+	places := []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}{}
+	if err := json.Unmarshal(body, &places); err != nil {
+		return 0, 0, err
+	}
+	if len(places) == 0 {
+		return 0, 0, ErrNoLocation
+	}
+	lat, err := strconv.ParseFloat(places[0].Lat, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	lng, err := strconv.ParseFloat(places[0].Lon, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lat, lng, nil
+}
+
+// GoogleGeoResp from the google maps api.
+type GoogleGeoResp struct {
+	Results []struct {
+		AddrComponents []struct {
+			LongName  string   `json:"long_name"`
+			ShortName string   `json:"short_name"`
+			Types     []string `json:"types"`
+		} `json:"address_components"`
+		FormattedAddress string `json:"formatted_address"`
+		Geometry         struct {
+			Location struct {
+				Lat float64 `json:"lat"`
+				Lng float64 `json:"lng"`
+			} `json:"location"`
+			LocationType string `json:"location_type"`
+			ViewPort     interface{}
+		} `json:"geometry"`
+	} `json:"results"`
+	Status string
+}
+
+// GoogleGeocoder queries the google maps geocoding api with an api key.
+type GoogleGeocoder struct {
+	Key string
+}
+
+// googleCall performs a remote request to google.
+var googleCall = func(ctx context.Context, address, key string) ([]byte, error) {
+	v := url.Values{}
+	v.Set("address", address)
+	v.Set("key", key)
+	req, err := http.NewRequest("GET", "https://maps.googleapis.com/maps/api/geocode/json?"+v.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := geocodeClient.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return body, err
+}
+
+// Geocode returns the location of the first result of an address.
+func (gg GoogleGeocoder) Geocode(ctx context.Context, address string) (float64, float64, error) {
+	body, err := googleCall(ctx, address, gg.Key)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ggr := GoogleGeoResp{}
+	if err := json.Unmarshal(body, &ggr); err != nil {
+		return 0, 0, err
+	}
+	switch ggr.Status {
+	case "OK":
+	case "OVER_QUERY_LIMIT":
+		return 0, 0, ErrOverQueryLimit
+	case "ZERO_RESULTS":
+		return 0, 0, ErrNoLocation
+	default:
+		return 0, 0, fmt.Errorf("geocoder status %s", ggr.Status)
+	}
+	if len(ggr.Results) == 0 {
+		return 0, 0, ErrNoLocation
+	}
+	loc := ggr.Results[0].Geometry.Location
+	return loc.Lat, loc.Lng, nil
+}
+
+// FileGeocoder resolves addresses from a table of locations by their
+// normalized address, see ReadCSVGeocoder and ReadGazetteer.
+type FileGeocoder map[string][2]float64
+
+// Geocode returns the location of an address in the table.
+func (fg FileGeocoder) Geocode(ctx context.Context, address string) (float64, float64, error) {
+	loc, ok := fg[normalizeAddress(address)]
+	if !ok {
+		return 0, 0, ErrNoLocation
+	}
+	return loc[0], loc[1], nil
+}
+
+// add adds the location of an address unless it has one.
+func (fg FileGeocoder) add(address, lat, lng string) error {
+	key := normalizeAddress(address)
+	if _, ok := fg[key]; ok || key == "" {
+		return nil
+	}
+	la, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil {
+		return err
+	}
+	ln, err := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+	if err != nil {
+		return err
+	}
+	fg[key] = [2]float64{la, ln}
+	return nil
+}
+
+// ReadCSVGeocoder reads address,lat,lng rows, a first row which isn't a
+// location is a header.
+func ReadCSVGeocoder(r io.Reader) (FileGeocoder, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	fg := FileGeocoder{}
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return fg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := fg.add(row[0], row[1], row[2]); err != nil && line > 1 {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+}
+
+// ReadGazetteer reads the tab separated rows of a GeoNames gazetteer,
+// a place resolves by its name, ascii name and alternate names. The first
+// of several places with a name wins.
+func ReadGazetteer(r io.Reader) (FileGeocoder, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	fg := FileGeocoder{}
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return fg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(row) < 6 {
+			return nil, fmt.Errorf("line %d: expected at least 6 fields", line)
+		}
+		names := append([]string{row[1], row[2]}, strings.Split(row[3], ",")...)
+		for _, name := range names {
+			if err := fg.add(name, row[4], row[5]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+	}
+}
+
+// normalizeAddress lowercases an address and collapses its spaces.
+func normalizeAddress(address string) string {
+	return strings.Join(strings.Fields(strings.ToLower(address)), " ")
+}
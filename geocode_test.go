@@ -0,0 +1,168 @@
+package pfftdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGazetteer = "4887398\tChicago\tChicago\tChi-town,Windy City\t41.85003\t-87.65005\tP\tPPLA2\tUS\n" +
+	"5391959\tSan Francisco\tSan Francisco\tSF,Frisco\t37.77493\t-122.41942\tP\tPPLA2\tUS\n"
+
+func TestFileGeocoder(t *testing.T) {
+	csvGeocoder, err := ReadCSVGeocoder(strings.NewReader("address,lat,lng\n\"666 7th Ave, San Francisco\",37.7758944,-122.4649686\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gazetteer, err := ReadGazetteer(strings.NewReader(testGazetteer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		geocoder Geocoder
+		address  string
+		lat, lng float64
+	}{
+		{csvGeocoder, "666 7th Ave, San Francisco", 37.7758944, -122.4649686},
+		{csvGeocoder, "  666 7TH AVE,  san francisco ", 37.7758944, -122.4649686},
+		{gazetteer, "chicago", 41.85003, -87.65005},
+		{gazetteer, "Windy City", 41.85003, -87.65005},
+		{gazetteer, "SF", 37.77493, -122.41942},
+	}
+	for _, tt := range tests {
+		lat, lng, err := tt.geocoder.Geocode(context.Background(), tt.address)
+		if err != nil || lat != tt.lat || lng != tt.lng {
+			t.Errorf("%s should be %v %v got %v %v %v", tt.address, tt.lat, tt.lng, lat, lng, err)
+		}
+	}
+	if _, _, err := gazetteer.Geocode(context.Background(), "Springfield"); err != ErrNoLocation {
+		t.Error(err)
+	}
+	if _, err := ReadCSVGeocoder(strings.NewReader("a,1,2\nb,x,2\n")); err == nil {
+		t.Error("should have gotten error for a bad latitude")
+	}
+	if _, err := NewGeocoder("/does/not/exist.csv"); err == nil {
+		t.Error("should have gotten error for a missing file")
+	}
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+	throttled := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Header.Get("User-Agent") != "pfftdb":
+			w.WriteHeader(http.StatusForbidden)
+		case req.FormValue("q") == "busy" && throttled:
+			throttled = false
+			w.WriteHeader(http.StatusTooManyRequests)
+		case req.FormValue("q") == "nowhere":
+			fmt.Fprint(w, `[]`)
+		default:
+			fmt.Fprint(w, `[{"lat": "41.9289", "lon": "-87.6526", "display_name": "Wrightwood"}]`)
+		}
+	}))
+	defer server.Close()
+
+	geocoder, err := NewGeocoder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interval := geocoder.(*NominatimGeocoder).Interval; interval != NominatimInterval {
+		t.Error("a custom url should be rate limited", interval)
+	}
+	geocoder.(*NominatimGeocoder).Interval = time.Millisecond
+	lat, lng, err := geocoder.Geocode(context.Background(), "950 W Wrightwood Ave")
+	if err != nil || lat != 41.9289 || lng != -87.6526 {
+		t.Error(lat, lng, err)
+	}
+	if _, _, err := geocoder.Geocode(context.Background(), "nowhere"); err != ErrNoLocation {
+		t.Error(err)
+	}
+	if _, _, err := geocoder.Geocode(context.Background(), "busy"); err != ErrOverQueryLimit {
+		t.Error(err)
+	}
+
+	// a hung server stops with the context
+	hung := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-hung
+	}))
+	defer slow.Close()
+	defer close(hung)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := (&NominatimGeocoder{URL: slow.URL}).Geocode(ctx, "anywhere"); err == nil {
+		t.Error("should have gotten error from a hung server")
+	}
+}
+
+// countingGeocoder resolves every address but the ones in failing and is
+// over the query limit while limited is above 0.
+type countingGeocoder struct {
+	calls   map[string]int
+	limited int
+	failing map[string]bool
+}
+
+func (cg *countingGeocoder) Geocode(ctx context.Context, address string) (float64, float64, error) {
+	cg.calls[address]++
+	if cg.limited > 0 {
+		cg.limited--
+		return 0, 0, ErrOverQueryLimit
+	}
+	if cg.failing[address] {
+		return 0, 0, ErrNoLocation
+	}
+	return 1, 2, nil
+}
+
+func TestGeoRule(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	defer STORE.Driver.RemoveAll(TESTGRAPH + GeocacheGraphSuffix)
+
+	GRPH.Add("a", "location:address", "1 a street")
+	GRPH.Add("b", "location:address", "nowhere")
+	GRPH.Add("b", "location:address", "2 b street")
+	GRPH.Add("c", "location:address", "nowhere")
+	GRPH.Add("d", "location:address", "1 a street")
+
+	geocoder := &countingGeocoder{calls: map[string]int{}, limited: 3, failing: map[string]bool{"nowhere": true}}
+	rule := GeoRule{Geocoder: geocoder, Retries: 2, Backoff: time.Millisecond}
+
+	// over the limit after the retries, everything is pending
+	report, err := GRPH.ApplyInference(rule)
+	if err != nil || !reflect.DeepEqual(report.Pending, []string{"a", "b", "c", "d"}) || len(report.Succeeded) != 0 {
+		t.Fatalf("%+v %v", report, err)
+	}
+
+	// resumes after a retry, d is at the address of a in the cache
+	report, err = GRPH.ApplyInference(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Succeeded, []string{"a", "b", "d"}) || report.Added != 6 || len(report.Pending) != 0 {
+		t.Errorf("%+v", report)
+	}
+	if _, ok := report.Failed["c"]; !ok || len(report.Failed) != 1 {
+		t.Errorf("%+v", report)
+	}
+	if geocoder.calls["1 a street"] != 4 {
+		t.Error("1 a street should be cached", geocoder.calls)
+	}
+	if lat, _ := GRPH.Value("b", "location:lat", ""); lat != 1.0 {
+		t.Error(lat)
+	}
+
+	// the located places are skipped
+	report, err = GRPH.ApplyInference(rule)
+	if err != nil || report.Skipped != 3 || report.Added != 0 || len(report.Failed) != 1 {
+		t.Errorf("%+v %v", report, err)
+	}
+}
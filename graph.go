@@ -1,10 +1,10 @@
 package pfftdb
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,47 +25,11 @@ type Triple [3]interface{}
 
 // Graph [...]
 type Graph struct {
-	GraphID string
-	Driver  Driver
-	mu      *sync.Mutex
-}
-
-// Adjacent is used to build a graph traversal path
-type Adjacent struct {
-	ID   string
-	Next *Adjacent
-}
-
-// bindingChunks are for query and split up
-// large slices of bindings into chunks to be processed in
-// goroutines.
-func bindingChunks(b []Bindings, n int) [][]Bindings {
-	l := len(b)
-	if l == 0 {
-		return nil
-	}
-	if l <= n {
-		return [][]Bindings{b[:l]}
-	}
-
-	total := (l / n)
-	if l%n != 0 {
-		total++
-	}
-	chunks := make([][]Bindings, total)
-	for i, _ := range chunks {
-		start := i*n + i
-		end := i*n + i + n
-		if start >= end || end >= total {
-			break
-		}
-		if end > l {
-			end = l
-		}
-		chunks[i] = b[start:end]
-	}
-
-	return chunks
+	GraphID  string
+	Driver   Driver
+	mu       *sync.Mutex
+	entail   *entailState
+	triggers *triggerQueue
 }
 
 // SubPred converts interface subject and predictate to string
@@ -85,9 +49,11 @@ func NewGraph(id string, driver Driver) (*Graph, error) {
 		return nil, fmt.Errorf("graph id not given")
 	}
 	g := &Graph{
-		GraphID: id,
-		Driver:  driver,
-		mu:      &sync.Mutex{},
+		GraphID:  id,
+		Driver:   driver,
+		mu:       &sync.Mutex{},
+		entail:   &entailState{},
+		triggers: newTriggerQueue(),
 	}
 	return g, nil
 }
@@ -106,7 +72,29 @@ func (g *Graph) AddBulk(graph string, triples []*Triple) (int, error) {
 	start := time.Now()
 	defer func() { log.Info("Graph.AddBulk ", time.Since(start)) }()
 
-	return g.Driver.AddBulk(graph, triples)
+	// the triggers only get the valid triples which aren't in the graph
+	var added []*Triple
+	if graph == g.GraphID && g.triggered() {
+		var err error
+		added, err = g.absent(triples)
+		if err != nil {
+			return 0, err
+		}
+	}
+	g.changed()
+	n, err := g.Driver.AddBulk(graph, triples)
+	if err != nil {
+		return n, err
+	}
+	if graph == g.GraphID {
+		if err := g.unmark(triples); err != nil {
+			return n, err
+		}
+	}
+	if n > 0 && len(added) > 0 {
+		g.fire(added, nil)
+	}
+	return n, nil
 }
 
 // RemoveBulk
@@ -114,7 +102,86 @@ func (g *Graph) RemoveBulk(graph string, triples []*Triple) error {
 	start := time.Now()
 	defer func() { log.Info("Graph.RemoveBulk ", time.Since(start)) }()
 
-	return g.Driver.RemoveBulk(graph, triples)
+	// the triggers need the triples the patterns remove
+	var removed []*Triple
+	if graph == g.GraphID && g.triggered() {
+		var err error
+		removed, err = g.matching(triples)
+		if err != nil {
+			return err
+		}
+	}
+	g.changed()
+	err := g.Driver.RemoveBulk(graph, triples)
+	if err == nil && len(removed) > 0 {
+		g.fire(nil, removed)
+	}
+	return err
+}
+
+// absent returns the valid triples which aren't in the graph, once each.
+func (g *Graph) absent(triples []*Triple) ([]*Triple, error) {
+	absent := []*Triple{}
+	seen := map[string]bool{}
+	for _, tr := range triples {
+		if checkTriple(tr, false) != nil {
+			continue
+		}
+		sub, pred, _ := SubPred(tr[0], tr[1])
+		key := tripleKey(sub, pred, tr[2])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		n, err := g.Driver.Count(g.GraphID, sub, pred, tr[2])
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			absent = append(absent, tr)
+		}
+	}
+	return absent, nil
+}
+
+// matching returns the triples of the graph matching the valid patterns,
+// once each.
+func (g *Graph) matching(patterns []*Triple) ([]*Triple, error) {
+	matching := []*Triple{}
+	seen := map[string]bool{}
+	for _, tr := range patterns {
+		if checkTriple(tr, true) != nil {
+			continue
+		}
+		sub, pred, _ := SubPred(tr[0], tr[1])
+		triples, err := ReadTriples(g.Driver.Triples(g.GraphID, sub, pred, tr[2], nil))
+		if err != nil {
+			return nil, err
+		}
+		for _, triple := range triples {
+			s, p, err := SubPred(triple[0], triple[1])
+			if err != nil || seen[tripleKey(s, p, triple[2])] {
+				continue
+			}
+			seen[tripleKey(s, p, triple[2])] = true
+			matching = append(matching, triple)
+		}
+	}
+	return matching, nil
+}
+
+// addBulk adds triples to the graph without firing its triggers, for
+// what inferences add.
+func (g *Graph) addBulk(triples []*Triple) (int, error) {
+	g.changed()
+	return g.Driver.AddBulk(g.GraphID, triples)
+}
+
+// removeBulk removes triples from the graph without firing its
+// triggers.
+func (g *Graph) removeBulk(triples []*Triple) error {
+	g.changed()
+	return g.Driver.RemoveBulk(g.GraphID, triples)
 }
 
 // Add adds a single triple
@@ -132,11 +199,16 @@ func (g *Graph) Add(sub, pred string, obj interface{}) error {
 		return fmt.Errorf("missing OBJ sub:%s - pred:%s - obj:%v", sub, pred, obj)
 	}
 
+	g.changed()
 	err := g.Driver.Add(g.GraphID, sub, pred, obj)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	if err := g.unmark([]*Triple{&Triple{sub, pred, obj}}); err != nil {
+		return err
+	}
+	g.fire([]*Triple{&Triple{sub, pred, obj}}, nil)
 	return nil
 }
 
@@ -145,10 +217,23 @@ func (g *Graph) Remove(sub, pred string, obj interface{}) error {
 	start := time.Now()
 	defer func() { log.Info("Graph.Remove ", time.Since(start)) }()
 
+	// the triggers need the triples a pattern removes
+	var removed []*Triple
+	if g.triggered() {
+		var err error
+		removed, err = ReadTriples(g.Driver.Triples(g.GraphID, sub, pred, obj, nil))
+		if err != nil {
+			return err
+		}
+	}
+	g.changed()
 	err := g.Driver.Remove(g.GraphID, sub, pred, obj)
 	if err != nil {
 		//log.Error(err)
 	}
+	if err == nil && len(removed) > 0 {
+		g.fire(nil, removed)
+	}
 	return err
 }
 
@@ -157,7 +242,14 @@ func (g *Graph) Drop(gid string) error {
 	start := time.Now()
 	defer func() { log.Info("Graph.Drop ", time.Since(start)) }()
 
+	g.changed()
 	err := g.Driver.Drop(gid)
+	if err == nil && gid == g.GraphID {
+		// the materialized consequences follow the dropped triples
+		if _, ok := g.Driver.Graph(gid + EntailedGraphSuffix); ok {
+			err = g.Driver.Drop(gid + EntailedGraphSuffix)
+		}
+	}
 	if err != nil {
 		log.Error(err)
 	}
@@ -176,13 +268,19 @@ func (g *Graph) Index(gid string, background bool) error {
 	return err
 }
 
-// Triples get triples for a query from the driver.
+// Triples get triples for a query from the driver, with the consequences
+// of the entailment mode, see Options.Entailment.
 func (g *Graph) Triples(sub, pred string, obj interface{}, options *Options) ([]*Triple, error) {
 	start := time.Now()
 	defer func() { log.Info("Graph.Triples ", time.Since(start)) }()
 
-	triples := g.Driver.Triples(g.GraphID, sub, pred, obj, options)
-	return triples, nil
+	return ReadTriples(g.TriplesIter(sub, pred, obj, options))
+}
+
+// TriplesIter iterates over the triples for a query from the driver, it
+// has to be closed.
+func (g *Graph) TriplesIter(sub, pred string, obj interface{}, options *Options) TripleIter {
+	return g.entailedTriples(sub, pred, obj, options)
 }
 
 // Count get the number of triples for a query from the driver.
@@ -225,7 +323,7 @@ func (g *Graph) Merge(g2 *Graph) error {
 	start := time.Now()
 	defer func() { log.Info("Graph.Merge ", time.Since(start)) }()
 
-	triples, err := g2.Triples(SPEMPTY, SPEMPTY, nil, nil)
+	triples, err := g2.Triples(SPEMPTY, SPEMPTY, nil, &Options{Entailment: EntailNone})
 	if err != nil {
 		log.Error(err)
 		return err
@@ -239,24 +337,53 @@ func (g *Graph) Merge(g2 *Graph) error {
 	return nil
 }
 
-// queryBinding creates a new binding if the given triple is a match, otherwise
-// it returns nil.
-func queryBinding(binding Bindings, triple *Triple, bindingPositions map[string]uint) *Bindings {
+// graphPosition is the binding position of a clause's graph variable.
+const graphPosition = 3
+
+// clauseItem returns the item at a binding position of a triple from graph.
+func clauseItem(triple *Triple, graph string, position uint) interface{} {
+	if position == graphPosition {
+		return graph
+	}
+	return triple[position]
+}
+
+// clauseGraphs returns the graphs a clause matches in and the variable
+// bound to the graph, if any.
+func (g *Graph) clauseGraphs(clauseIndex uint, options *Options) ([]string, string) {
+	graphs := options.Graphs
+	if len(graphs) == 0 {
+		graphs = []string{g.GraphID}
+	}
+	scope := options.ClauseGraphs[clauseIndex]
+	switch {
+	case scope == "":
+		return graphs, ""
+	case strings.HasPrefix(scope, "?"):
+		return graphs, scope[1:]
+	}
+	return []string{scope}, ""
+}
+
+// queryBinding creates a new binding if the given triple from graph is a
+// match, otherwise it returns nil.
+func queryBinding(binding Bindings, triple *Triple, graph string, bindingPositions map[string]uint) *Bindings {
 	var tmp Bindings
 	for variable, position := range bindingPositions {
+		item := clauseItem(triple, graph, position)
 		// if variable isn't in binding, add it to new tmp binding.
 		if _, ok := binding[variable]; !ok {
 			if tmp == nil {
-				tmp = Bindings{variable: triple[position]}
+				tmp = Bindings{variable: item}
 			} else {
-				tmp[variable] = triple[position]
+				tmp[variable] = item
 			}
 			continue
 		}
 
 		// variable is in binding already, check if it matches the triples
 		// position, if not don't add this binding
-		if binding[variable] != triple[position] {
+		if binding[variable] != item {
 			tmp = nil
 			return nil
 		}
@@ -270,12 +397,133 @@ func queryBinding(binding Bindings, triple *Triple, bindingPositions map[string]
 	return &tmp
 }
 
+// boundGraphs narrows graphs to the ones a graph variable is already bound
+// to, when every binding has it.
+func boundGraphs(bindings []Bindings, graphVar string, graphs []string) []string {
+	if len(bindings) == 0 {
+		return graphs
+	}
+	bound := map[string]bool{}
+	for _, b := range bindings {
+		v, ok := b[graphVar].(string)
+		if !ok {
+			return graphs
+		}
+		bound[v] = true
+	}
+	narrowed := []string{}
+	for _, graph := range graphs {
+		if bound[graph] {
+			narrowed = append(narrowed, graph)
+		}
+	}
+	return narrowed
+}
+
+// Match reports whether a bound value passes the filter. Values compare
+// with compareObjects so 4 and 4.0 are equal and dates compare as times,
+// strings compare case insensitively and LIKE is a prefix match. Values
+// that aren't comparable with the filter value never match.
+func (f *Filter) Match(val interface{}) bool {
+	fv := f.Val
+	if s, ok := val.(string); ok {
+		if fs, ok := fv.(string); ok {
+			val, fv = strings.ToLower(s), strings.ToLower(fs)
+		}
+	}
+	if f.Op == "LIKE" {
+		s, ok := val.(string)
+		fs, fok := fv.(string)
+		return ok && fok && strings.HasPrefix(s, fs)
+	}
+
+	c, ok := compareObjects(val, fv)
+	if !ok {
+		return false
+	}
+	switch f.Op {
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	}
+	return false
+}
+
 // Query takes an array of triple bindings, ie [[?id, "something", "?var2"],...]
-// and returns an array of the given variables with ?
-func (g *Graph) Query(clauses []*Triple, options *Options) (bindings []Bindings) {
+// and returns an array of the given variables with ?. Options.Filter and
+// Options.Where are checked after the first clause binding their variables.
+func (g *Graph) Query(clauses []*Triple, options *Options) []Bindings {
 	start := time.Now()
 	defer func() { log.Info("Graph.Query ", time.Since(start)) }()
 
+	bindings, err := ReadBindings(g.QueryIter(clauses, options))
+	if err != nil {
+		log.Error(err)
+	}
+	return bindings
+}
+
+// QueryCount returns the number of results of a query. Results are
+// counted with a count aggregate so a single clause is counted by the
+// driver.
+func (g *Graph) QueryCount(clauses []*Triple, options *Options) (uint, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	if options.grouped() || options.Distinct && len(options.Select) > 0 {
+		iter := g.QueryIter(clauses, options)
+		defer iter.Close()
+		var count uint
+		for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+			count++
+		}
+		return count, iter.Err()
+	}
+
+	counted := *options
+	counted.Select = nil
+	counted.Distinct = false
+	counted.OrderBy = ""
+	counted.Limit = 0
+	counted.Offset = 0
+	counted.Aggregates = []*Aggregate{&Aggregate{Op: "count", Distinct: options.Distinct, As: "count"}}
+	bindings, err := ReadBindings(g.QueryIter(clauses, &counted))
+	if err != nil || len(bindings) == 0 {
+		return 0, err
+	}
+	count, _ := bindings[0]["count"].(uint)
+
+	// limit and offset apply to the results counted
+	if count < options.Offset {
+		return 0, nil
+	}
+	count -= options.Offset
+	if options.Limit != 0 && count > options.Limit {
+		count = options.Limit
+	}
+	return count, nil
+}
+
+// QueryIter is Query returning an iterator. Every clause but the last one
+// in plan order is joined in memory, the triples of the last one are
+// joined while they are read from the driver. Filter, select, distinct,
+// limit and offset are applied while iterating, only groupby and orderby
+// read all results first. A count of a single clause is done by the
+// driver. The iterator has to be closed.
+func (g *Graph) QueryIter(clauses []*Triple, options *Options) BindingIter {
+	options, err := g.entailedOptions(options)
+	if err != nil {
+		return &bindingSliceIter{err: err}
+	}
 	if options == nil {
 		options = &Options{}
 	}
@@ -284,9 +532,45 @@ func (g *Graph) Query(clauses []*Triple, options *Options) (bindings []Bindings)
 		optionalMap[key] = true
 	}
 
+	// evaluate the most selective clauses first
+	order := make([]uint, len(clauses))
+	for i := range clauses {
+		order[i] = uint(i)
+	}
+	if len(clauses) > 1 {
+		order = g.Plan(clauses, options).Order()
+	}
+
+	if options.Where != nil {
+		if err := options.Where.check(); err != nil {
+			return &bindingSliceIter{err: err}
+		}
+	}
+	if err := checkGrouping(options); err != nil {
+		return &bindingSliceIter{err: err}
+	}
+
+	// a single clause count is left to the driver
+	if countable(clauses, options) {
+		count, err := g.clauseCount(clauses[0], options)
+		if err != nil {
+			return &bindingSliceIter{err: err}
+		}
+		counted := *options
+		counted.Aggregates = nil
+		binding := Bindings{options.Aggregates[0].name(): count}
+		return newQueryIter(&bindingSliceIter{bindings: []Bindings{binding}}, &counted, nil)
+	}
+
+	// filters are checked as soon as their variables are bound
+	filters := queryFilters(options)
+	bound := map[string]bool{}
+
 	// iterate each clause noting the position of ?variables
 	// replace each ?variable with EMPTY to use the Triples method
-	for clauseIndex, clause := range clauses {
+	var bindings []Bindings
+	for step, clauseIndex := range order {
+		clause := clauses[clauseIndex]
 		bindingPositions := map[string]uint{}
 		query := &Triple{}
 
@@ -306,6 +590,18 @@ func (g *Graph) Query(clauses []*Triple, options *Options) (bindings []Bindings)
 		if err != nil {
 			continue
 		}
+		var path *Path
+		if isPath(pred) {
+			path, err = ParsePath(pred)
+			if err != nil {
+				return &bindingSliceIter{err: err}
+			}
+		}
+		graphs, graphVar := g.clauseGraphs(clauseIndex, options)
+		if graphVar != "" {
+			bindingPositions[graphVar] = graphPosition
+			graphs = boundGraphs(bindings, graphVar, graphs)
+		}
 		opts := &Options{}
 		// add overiddes for query optimizations.
 		if len(bindings) > 0 && len(bindingPositions) > 0 {
@@ -329,16 +625,49 @@ func (g *Graph) Query(clauses []*Triple, options *Options) (bindings []Bindings)
 				}
 			}
 		}
-		triples, err := g.Triples(sub, pred, query[2], opts)
-		if err != nil {
-			log.Error(err)
-			bindings = nil
-			return
+
+		// the last clause streams its triples, an optional one has to
+		// know if any matched so it is read like the others as are the
+		// pairs of a property path.
+		if step == len(order)-1 && !optionalMap[clauseIndex] && path == nil {
+			it := &clauseIter{
+				driver:    g.Driver,
+				sub:       sub,
+				pred:      pred,
+				obj:       query[2],
+				opts:      opts,
+				graphs:    graphs,
+				positions: bindingPositions,
+				bindings:  bindings,
+			}
+			if len(bindings) > 0 {
+				if vars := joinVars(bindings, bindingPositions); len(vars) > 0 {
+					it.table, _ = newJoinTable(bindings, vars, bindingPositions)
+				}
+			}
+			return newQueryIter(it, options, filters)
+		}
+
+		var triples []*Triple
+		var tripleGraphs []string
+		for _, graph := range graphs {
+			var graphTriples []*Triple
+			if path != nil {
+				graphTriples, err = g.pathTriples(graph, sub, pred, path, query[2], opts.TripleOverrides)
+			} else {
+				graphTriples, err = ReadTriples(g.Driver.Triples(graph, sub, pred, query[2], opts))
+			}
+			if err != nil {
+				return &bindingSliceIter{err: err}
+			}
+			triples = append(triples, graphTriples...)
+			for _ = range graphTriples {
+				tripleGraphs = append(tripleGraphs, graph)
+			}
 		}
 		if len(triples) == 0 {
-			if _, ok := optionalMap[uint(clauseIndex)]; !ok {
-				bindings = nil
-				return
+			if _, ok := optionalMap[clauseIndex]; !ok {
+				return newQueryIter(&bindingSliceIter{}, options, filters)
 			}
 			continue
 		}
@@ -351,216 +680,24 @@ func (g *Graph) Query(clauses []*Triple, options *Options) (bindings []Bindings)
 			for i, triple := range triples {
 				binding := make(Bindings, len(bindingPositions))
 				for variable, position := range bindingPositions {
-					binding[variable] = triple[position]
+					binding[variable] = clauseItem(triple, tripleGraphs[i], position)
 				}
 				bindings[i] = binding
 			}
-			continue
-		}
-
-		// each triple is compared to existing bindings
-		// if it matches its added to the bindings
-		// or if not it is removed
-		newBindings := []Bindings{}
-
-		//t := time.Now()
-		for _, binding := range bindings {
-			for _, triple := range triples {
-				tmp := queryBinding(binding, triple, bindingPositions)
-				if tmp != nil {
-					newBindings = append(newBindings, *tmp)
-				}
-			}
-		}
-		//log.Error(time.Since(t))
-		bindings = newBindings
-
-		/*
-			tmpBindings := make([]Bindings, len(bindings)*len(triples))
-			wg := &sync.WaitGroup{}
-			i := 0
-			for _, binding := range bindings {
-				wg.Add(1)
-				go func(binding_ Bindings, i_ int) {
-					for _, triple := range triples {
-						defer wg.Done()
-						tmp := queryBinding(binding_, triple, bindingPositions)
-						if tmp != nil && len(*tmp) > 0 {
-							tmpBindings[i_] = *tmp
-						}
-						i++
-					}
-				}(binding, i)
-			}
-			wg.Wait()
-
-			bindings = nil
-			for _, b := range tmpBindings {
-				if b != nil {
-					bindings = append(bindings, b)
-				}
-			}
-			tmpBindings = nil
-		*/
-	}
-
-	// filter results TODO refactor hell
-	if len(options.Filter) > 0 {
-		filterSlice := []Bindings{}
-		for _, filter := range options.Filter {
-			for _, b := range bindings {
-				switch filter.Val.(type) {
-				case int:
-					var val int
-					var ok bool
-					if val, ok = b[filter.Key].(int); !ok {
-						continue
-					}
-					switch filter.Op {
-					case ">":
-						if val < filter.Val.(int) {
-							continue
-						}
-					case "<":
-						if val > filter.Val.(int) {
-							continue
-						}
-					case "==":
-						if val != filter.Val.(int) {
-							continue
-						}
-					case "!=":
-						if val == filter.Val.(int) {
-							continue
-						}
-					case "<=":
-						if val >= filter.Val.(int) {
-							continue
-						}
-					case ">=":
-						if val <= filter.Val.(int) {
-							continue
-						}
-					}
-				case float64:
-					var val float64
-					var ok bool
-					if val, ok = b[filter.Key].(float64); !ok {
-						continue
-					}
-					switch filter.Op {
-					case ">":
-						if val < filter.Val.(float64) {
-							continue
-						}
-					case "<":
-						if val > filter.Val.(float64) {
-							continue
-						}
-					case "==":
-						if val != filter.Val.(float64) {
-							continue
-						}
-					case "!=":
-						if val == filter.Val.(float64) {
-							continue
-						}
-					case "<=":
-						if val >= filter.Val.(float64) {
-							continue
-						}
-					case ">=":
-						if val <= filter.Val.(float64) {
-							continue
-						}
-					}
-				case string:
-					var val string
-					var ok bool
-					if val, ok = b[filter.Key].(string); !ok {
-						continue
-					}
-					switch filter.Op {
-					case ">":
-						if strings.ToLower(val) < strings.ToLower(filter.Val.(string)) {
-							continue
-						}
-					case "<":
-						if strings.ToLower(val) > strings.ToLower(filter.Val.(string)) {
-							continue
-						}
-					case "==":
-						if strings.ToLower(val) != strings.ToLower(filter.Val.(string)) {
-							continue
-						}
-					case "!=":
-						if strings.ToLower(val) == strings.ToLower(filter.Val.(string)) {
-							continue
-						}
-					case "LIKE":
-						if !strings.HasPrefix(strings.ToLower(val), strings.ToLower(filter.Val.(string))) {
-							continue
-						}
-					}
-				}
-				filterSlice = append(filterSlice, b)
-			}
-		}
-		bindings = filterSlice
-	}
-
-	// if Select is present in options, remove any variables not selected.
-	if len(options.Select) > 0 && options.Select[0] != "?COUNT" {
-		selectMap := map[string]bool{}
-		for _, key := range options.Select {
-			selectMap[key] = true
-		}
-
-		for _, b := range bindings {
-			for key, _ := range b {
-				if _, ok := selectMap[key]; !ok {
-					delete(b, key)
-				}
-			}
-		}
-	}
-
-	// return only distinct items.
-	if options.Distinct {
-		distinctMap := map[string]bool{}
-		distinctSlice := []Bindings{}
-		for _, b := range bindings {
-			hash := fmt.Sprintf("%s", b)
-			if _, ok := distinctMap[hash]; !ok {
-				distinctMap[hash] = true
-				distinctSlice = append(distinctSlice, b)
-			}
-		}
-		bindings = distinctSlice
-	}
-
-	// sort
-	if options.OrderBy != "" {
-		if options.OrderBy[:1] == "-" {
-			sort.Sort(bindingSlice{Key: options.OrderBy[1:], Asc: false, Bindings: bindings})
 		} else {
-			sort.Sort(bindingSlice{Key: options.OrderBy, Asc: true, Bindings: bindings})
+			// join the triples with the existing bindings, bindings
+			// without a matching triple are removed
+			bindings = joinBindings(bindings, triples, tripleGraphs, bindingPositions)
 		}
-	}
-
-	// limit and offset
-	total := len(bindings)
-	if options.Limit != 0 || options.Offset != 0 {
-		if total > int(options.Limit)+int(options.Offset) {
-			if options.Limit > 0 {
-				bindings = bindings[options.Offset : options.Offset+options.Limit]
-			} else {
-				bindings = bindings[options.Offset:]
-			}
+		for variable := range bindingPositions {
+			bound[variable] = true
+		}
+		bindings, filters = applyFilters(bindings, filters, bound)
+		if len(bindings) == 0 {
+			return newQueryIter(&bindingSliceIter{}, options, filters)
 		}
 	}
-
-	return
+	return newQueryIter(&bindingSliceIter{bindings: bindings}, options, filters)
 }
 
 // bindingSlice implements the sort interface
@@ -582,133 +719,71 @@ func (s bindingSlice) Swap(i, j int) {
 
 // Less is part of sort.Interface.
 func (s bindingSlice) Less(i, j int) bool {
-	if l, ok := s.Bindings[i][s.Key].(string); ok {
-		if r, ok := s.Bindings[j][s.Key].(string); ok {
-			if s.Asc {
-				return strings.ToLower(l) < strings.ToLower(r)
-			}
-			return strings.ToLower(l) > strings.ToLower(r)
+	l, r := s.Bindings[i][s.Key], s.Bindings[j][s.Key]
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			l, r = strings.ToLower(ls), strings.ToLower(rs)
 		}
 	}
-	return false
+	c, ok := compareObjects(l, r)
+	if !ok {
+		return false
+	}
+	if s.Asc {
+		return c < 0
+	}
+	return c > 0
 }
 
-// ApplyInference [...]
-func (g *Graph) ApplyInference(inf Inference) {
-	start := time.Now()
-	defer func() { log.Info("Graph.ApplyInference ", time.Since(start)) }()
-
-	inf.Apply(g)
+// ApplyInference applies an inference and returns its report.
+func (g *Graph) ApplyInference(inf Inference) (*InferenceReport, error) {
+	return g.ApplyInferenceContext(context.Background(), inf)
 }
 
-// bfs breadth first search a start and end point
-func (g *Graph) bfs(startID, endID, predAdj string) (int, []*Adjacent) {
-	itemIDs := []*Adjacent{&Adjacent{ID: startID}}
-
-	// Keep track of items found
-	visitedIDs := map[string]struct{}{startID: struct{}{}}
-	iterations := 0
-	for len(itemIDs) > 0 {
-		iterations++
-		// Get adjacent items for item
-		adjIDs := []*Adjacent{}
-		for _, parent := range itemIDs {
-			triples, err := g.Triples(SPEMPTY, predAdj, parent.ID, nil)
-			if err != nil {
-				log.Error(err)
-				continue
-			}
-			for _, triple := range triples {
-				sub, _, err := SubPred(triple[0], triple[1])
-				if err == nil {
-					if _, ok := visitedIDs[sub]; !ok {
-						visitedIDs[sub] = struct{}{}
-
-						adjIDs = append(adjIDs, &Adjacent{sub, &Adjacent{parent.ID, parent.Next}})
-						if sub == endID {
-							return iterations, adjIDs
-						}
-					}
-				}
-			}
-		}
+// ApplyInferenceContext is ApplyInference which stops when the context is
+// done.
+func (g *Graph) ApplyInferenceContext(ctx context.Context, inf Inference) (*InferenceReport, error) {
+	start := time.Now()
+	defer func() { log.Info("Graph.ApplyInference ", time.Since(start)) }()
 
-		// Get adjacent items
-		nextItemIDs := []*Adjacent{}
-		for _, adj := range adjIDs {
-			triples, err := g.Triples(adj.ID, predAdj, SPEMPTY, nil)
-			if err != nil {
-				log.Error(err)
-				continue
-			}
-			for _, triple := range triples {
-				itemID, ok := triple[2].(string)
-				if !ok {
-					continue
-				}
-				// If not visited mark and check if found or get next items
-				if _, ok := visitedIDs[itemID]; !ok {
-					visitedIDs[itemID] = struct{}{}
-					if itemID == endID {
-						return iterations, []*Adjacent{&Adjacent{itemID, &Adjacent{adj.ID, adj.Next}}}
-					}
-					nextItemIDs = append(nextItemIDs, &Adjacent{itemID, &Adjacent{adj.ID, adj.Next}})
-				}
-			}
-		}
-		itemIDs = nextItemIDs
-	}
-	return iterations, itemIDs
+	return inf.Apply(ctx, g)
 }
 
 // Path finds the shortest path between two points.(ALPHA)
 // predName is the identifier, like name
-// predAdj is the predicate used, like starring or friends_with
+// predAdj is the predicate used in both directions, like starring or
+// friends_with. It returns the names from end to start, see ShortestPaths
+// for weights, more predicates and more paths.
 func (g *Graph) Path(start, end, predName, predAdj string) ([]string, error) {
 	startT := time.Now()
 	defer func() { log.Info("Graph.Path ", time.Since(startT)) }()
 
 	names := []string{}
-	s, err := g.Value(SPEMPTY, predName, start)
+	startID, err := g.Node(predName, start)
 	if err != nil {
 		log.Error(err)
 		return names, err
 	}
-	startID, ok := s.(string)
-	if !ok {
-		return names, err
-	}
-	e, err := g.Value(SPEMPTY, predName, end)
+	endID, err := g.Node(predName, end)
 	if err != nil {
 		log.Error(err)
 		return names, err
 	}
-	endID, ok := e.(string)
-	if !ok {
+	paths, err := g.ShortestPaths(startID, endID, &PathOptions{Edges: []*PathEdge{&PathEdge{Pred: predAdj, Dir: "both"}}})
+	if err != nil || len(paths) == 0 {
 		return names, err
 	}
-	if startID == SPEMPTY || endID == SPEMPTY {
-		return names, fmt.Errorf("start or end empty")
-	}
-	_, result := g.bfs(startID, endID, predAdj)
-	for len(result) > 0 {
-		next := result[0].Next
-		val, err := g.Value(result[0].ID, predName, SPEMPTY)
+	nodes := paths[0].Nodes
+	for i := len(nodes) - 1; i >= 0; i-- {
+		val, err := g.Value(nodes[i], predName, SPEMPTY)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
-		v, ok := val.(string)
-		if !ok {
-			continue
-		}
-		names = append(names, v)
-		if next == nil {
-			break
+		if v, ok := val.(string); ok {
+			names = append(names, v)
 		}
-		result = []*Adjacent{next}
 	}
-
 	return names, nil
 }
 
@@ -736,35 +811,140 @@ func (g *Graph) Load(csvFile io.Reader) error {
 			log.Error("Invalid line ", fields)
 			continue
 		}
-		g.Add(fields[0], fields[1], fields[2])
+		g.Add(fields[0], fields[1], csvObject(fields[2]))
 	}
 	return nil
 }
 
-// Save [...]
+// Save [...] Objects other than strings are written as N-Triples literals
+// which Load reads back.
 func (g *Graph) Save(csvFile io.Writer) error {
 	startT := time.Now()
 	defer func() { log.Info("Graph.Save", time.Since(startT)) }()
 
 	csvWriter := csv.NewWriter(csvFile)
-	triples, err := g.Triples(SPEMPTY, SPEMPTY, nil, nil)
+	triples, err := g.Triples(SPEMPTY, SPEMPTY, nil, &Options{Entailment: EntailNone})
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 	for _, triple := range triples {
 		sub, pred, err := SubPred(triple[0], triple[1])
+		if err != nil {
+			continue
+		}
+		obj, err := csvField(triple[2])
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		csvWriter.Write([]string{sub, pred, obj})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// tripleReader is implemented by the csv, N-Triples and Turtle readers.
+type tripleReader interface {
+	Read() (*Triple, error)
+}
+
+// tripleWriter is implemented by the N-Triples and Turtle writers.
+type tripleWriter interface {
+	Write(*Triple) error
+	Flush() error
+}
+
+// importBatchSize is the number of triples added at once on import.
+const importBatchSize = 1000
+
+// Import reads triples in csv, ntriples or turtle format and adds them
+// in batches. It returns the number of triples added, on a parse error
+// the triples before it are kept.
+func (g *Graph) Import(r io.Reader, format string) (int, error) {
+	return g.ImportContext(context.Background(), r, format)
+}
+
+// ImportContext is Import which stops between batches when the context is
+// done, the batches before are kept.
+func (g *Graph) ImportContext(ctx context.Context, r io.Reader, format string) (int, error) {
+	startT := time.Now()
+	defer func() { log.Info("Graph.Import ", time.Since(startT)) }()
+
+	var reader tripleReader
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.TrailingComma = true
+		reader = &csvReader{r: cr}
+	case FormatNTriples:
+		reader = NewNTriplesReader(r)
+	case FormatTurtle:
+		reader = NewTurtleReader(r)
+	default:
+		return 0, fmt.Errorf("unknown format %s", format)
+	}
+
+	total := 0
+	batch := make([]*Triple, 0, importBatchSize)
+	for {
+		triple, err := reader.Read()
 		if err == nil {
-			switch triple[2].(type) {
-			case string:
-				csvWriter.Write([]string{sub, pred, fmt.Sprintf("%s", triple[2])})
-			case float64, float32:
-				csvWriter.Write([]string{sub, pred, fmt.Sprintf("%f", triple[2])})
-			case int, uint, uint32, uint64:
-				csvWriter.Write([]string{sub, pred, fmt.Sprintf("%d", triple[2])})
+			batch = append(batch, triple)
+		}
+		if len(batch) == importBatchSize || (err != nil && len(batch) > 0) {
+			n, addErr := g.AddBulk(g.GraphID, batch)
+			total += n
+			if addErr != nil {
+				return total, addErr
+			}
+			batch = batch[:0]
+			progress(ctx, total, 0)
+			if ctx.Err() != nil {
+				return total, ctx.Err()
 			}
 		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
 	}
-	csvWriter.Flush()
-	return nil
+}
+
+// Export writes all triples in csv, ntriples or turtle format, prefixes
+// are only used for turtle. As graphml, gexf or dot the triples between
+// nodes are edges and the others attrs of their subject, see SubgraphOf.
+func (g *Graph) Export(w io.Writer, format string, prefixes map[string]string) error {
+	startT := time.Now()
+	defer func() { log.Info("Graph.Export ", time.Since(startT)) }()
+
+	var writer tripleWriter
+	switch format {
+	case FormatCSV:
+		return g.Save(w)
+	case FormatGraphML, FormatGEXF, FormatDOT:
+		return g.exportGraph(w, format)
+	case FormatNTriples:
+		writer = NewNTriplesWriter(w)
+	case FormatTurtle:
+		writer = NewTurtleWriter(w, prefixes)
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+
+	triples, err := g.Triples(SPEMPTY, SPEMPTY, nil, &Options{OrderBy: "s", Entailment: EntailNone})
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	for _, triple := range triples {
+		err := writer.Write(triple)
+		if err != nil {
+			log.Error(err, triple)
+			continue
+		}
+	}
+	return writer.Flush()
 }
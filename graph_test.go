@@ -1,8 +1,11 @@
 package pfftdb
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -175,39 +178,6 @@ func cleanupGraph() {
 	STORE.Driver.RemoveAll(TESTGRAPH)
 }
 
-func TestBindingChunks(t *testing.T) {
-	b := []Bindings{}
-	for _, _ = range make([]struct{}, 1000) {
-		b = append(b, Bindings{})
-	}
-
-	var btests = []struct {
-		inb []Bindings
-		inn int
-		out int
-	}{
-		{nil, 10, 0},
-		{nil, 1, 0},
-		{b[0:1], 10, 1},
-		{b[0:2], 10, 1},
-		{b[0:3], 10, 1},
-		{b[0:8], 10, 1},
-		{b[0:9], 10, 1},
-		{b[0:11], 10, 2},
-		{b[0:13], 10, 2},
-		{b[0:13], 5, 3},
-		{b[0:900], 100, 9},
-		{b[0:907], 100, 10},
-		{b, 100, 10},
-	}
-	for i, tt := range btests {
-		out := bindingChunks(tt.inb, tt.inn)
-		if len(out) != tt.out {
-			t.Error(fmt.Sprintf("%d didn't create %d chunks got:", i, tt.out), len(out))
-		}
-	}
-}
-
 func TestNewGraph(t *testing.T) {
 	_, err := NewGraph(TESTGRAPH, STORE.Driver)
 	if err != nil {
@@ -454,24 +424,24 @@ func TestQuery(t *testing.T) {
 	res = GRPH.Query([]*Triple{
 		&Triple{"?id", "testfilter", "?val"},
 	}, &Options{Filter: []*Filter{&Filter{"val", ">", 4}}})
-	if len(res) != 2 {
-		t.Error("Should be 2 got ", len(res))
+	if len(res) != 4 {
+		t.Error("Should be 4 got ", len(res))
 	}
 	res = GRPH.Query([]*Triple{
 		&Triple{"?id", "testfilter", "?val"},
-	}, &Options{Filter: []*Filter{&Filter{"val", ">", 5}}})
-	if len(res) != 1 {
-		t.Error("Should be 1 got ", len(res))
+	}, &Options{Filter: []*Filter{&Filter{"val", ">=", 5}}})
+	if len(res) != 4 {
+		t.Error("Should be 4 got ", len(res))
 	}
 	res = GRPH.Query([]*Triple{
 		&Triple{"?id", "testfilter", "?val"},
 	}, &Options{Filter: []*Filter{&Filter{"val", ">", 7.0}}})
-	if len(res) != 2 {
-		t.Error("Should be 2 got ", len(res))
+	if len(res) != 1 {
+		t.Error("Should be 1 got ", len(res))
 	}
 	res = GRPH.Query([]*Triple{
 		&Triple{"?id", "testfilter", "?val"},
-	}, &Options{Filter: []*Filter{&Filter{"val", ">", 8.0}}})
+	}, &Options{Filter: []*Filter{&Filter{"val", "==", 6}}})
 	if len(res) != 1 {
 		t.Error("Should be 1 got ", len(res))
 	}
@@ -576,6 +546,43 @@ func TestQueryLarge(t *testing.T) {
 	*/
 }
 
+func TestQueryIter(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	for i := 0; i < 10; i++ {
+		GRPH.Add(fmt.Sprintf("p%d", i), "likes", "turtles")
+		GRPH.Add(fmt.Sprintf("p%d", i), "age", i)
+	}
+	clauses := []*Triple{
+		&Triple{"?person", "likes", "turtles"},
+		&Triple{"?person", "age", "?age"},
+	}
+
+	iter := GRPH.QueryIter(clauses, &Options{Limit: 3, Offset: 8, OrderBy: "age"})
+	res, err := ReadBindings(iter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0]["age"] != 8 || res[1]["age"] != 9 {
+		t.Error("offset past the last page failed", res)
+	}
+
+	iter = GRPH.QueryIter(clauses, &Options{Select: []string{"age"}, Filter: []*Filter{&Filter{"age", ">", 4}}})
+	defer iter.Close()
+	binding, ok := iter.Next()
+	if !ok || len(binding) != 1 {
+		t.Fatal("should have selected age", binding)
+	}
+	n := 1
+	for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+		n++
+	}
+	if n != 5 || iter.Err() != nil {
+		t.Error("should have 5 bindings got:", n, iter.Err())
+	}
+}
+
 func TestQueryRace(t *testing.T) {
 	cleanupGraph()
 	defer cleanupGraph()
@@ -654,21 +661,22 @@ func TestQueryRace(t *testing.T) {
 
 func TestApplyInference(t *testing.T) {
 	defer cleanupGraph()
+	defer STORE.Driver.RemoveAll(TESTGRAPH + GeocacheGraphSuffix)
 
 	GRPH.Add("winona", "location:address", "1234 x street")
 
-	//csvFile := strings.NewReader(testCSV)
-	//g.Load(csvFile)
-
-	googleCall = func(add string) ([]byte, error) {
+	googleCall = func(ctx context.Context, add, key string) ([]byte, error) {
 		return []byte(testGoogleGeo), nil
 	}
 
-	geo := GeoRule{}
-	GRPH.ApplyInference(geo)
+	geo := GeoRule{Geocoder: GoogleGeocoder{Key: "key"}}
+	report, err := GRPH.ApplyInference(geo)
+	if err != nil || len(report.Succeeded) != 1 {
+		t.Fatal(report, err)
+	}
 
-	triplesLatitude, _ := GRPH.Triples("1234 x street", "location:lat", "", nil)
-	triplesLongitude, _ := GRPH.Triples("1234 x street", "location:lng", "", nil)
+	triplesLatitude, _ := GRPH.Triples("winona", "location:lat", "", nil)
+	triplesLongitude, _ := GRPH.Triples("winona", "location:lng", "", nil)
 	if len(triplesLatitude) == 0 {
 		t.Error(triplesLatitude)
 	}
@@ -706,6 +714,66 @@ func TestPath(t *testing.T) {
 	}
 }
 
+func TestQueryGraphs(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	defer STORE.Driver.RemoveAll(TESTGRAPH2)
+
+	GRPH.Add("_:1", "name", "Albert")
+	GRPH.Add("_:1", "livesAt", "_:loc1")
+	GRPH.Add("_:2", "name", "Barry")
+	GRPH.Add("_:2", "livesAt", "_:loc2")
+	GRPH2.Add("_:loc1", "city", "Chicago")
+	GRPH2.Add("_:2", "name", "Barry")
+
+	// join a clause scoped to another graph
+	res := GRPH.Query([]*Triple{
+		&Triple{"?id", "name", "?name"},
+		&Triple{"?id", "livesAt", "?loc"},
+		&Triple{"?loc", "city", "?city"},
+	}, &Options{ClauseGraphs: map[uint]string{2: TESTGRAPH2}})
+	if len(res) != 1 || res[0]["name"] != "Albert" || res[0]["city"] != "Chicago" {
+		t.Error(res)
+	}
+
+	// without a graph variable results don't report their graph
+	res = GRPH.Query([]*Triple{
+		&Triple{"?id", "name", "?name"},
+	}, &Options{Graphs: []string{TESTGRAPH, TESTGRAPH2}})
+	if len(res) != 3 {
+		t.Fatal(res)
+	}
+	for _, b := range res {
+		if len(b) != 2 {
+			t.Error("should only bind id and name", b)
+		}
+	}
+
+	// every clause in both graphs, reporting where the name came from
+	res = GRPH.Query([]*Triple{
+		&Triple{"?id", "name", "?name"},
+	}, &Options{Graphs: []string{TESTGRAPH, TESTGRAPH2}, ClauseGraphs: map[uint]string{0: "?g"}, OrderBy: "name"})
+	if len(res) != 3 {
+		t.Fatal(res)
+	}
+	graphs := map[string]int{}
+	for _, b := range res {
+		graphs[b["g"].(string)]++
+	}
+	if graphs[TESTGRAPH] != 2 || graphs[TESTGRAPH2] != 1 {
+		t.Error(res)
+	}
+
+	// a graph variable joins clauses within the same graph
+	res = GRPH.Query([]*Triple{
+		&Triple{"?id", "name", "Barry"},
+		&Triple{"?id", "livesAt", "?loc"},
+	}, &Options{Graphs: []string{TESTGRAPH, TESTGRAPH2}, ClauseGraphs: map[uint]string{0: "?g", 1: "?g"}})
+	if len(res) != 1 || res[0]["g"] != TESTGRAPH {
+		t.Error(res)
+	}
+}
+
 func TestSave(t *testing.T) {
 	defer cleanupGraph()
 
@@ -739,6 +807,41 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestSaveLoad(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	objs := []interface{}{
+		"human",
+		`"quoted" string`,
+		2,
+		1.5,
+		true,
+		Literal{Value: "chat", Lang: "fr"},
+		Literal{Value: "2014-01-02T10:00:00Z", Datatype: XSDDateTime},
+		map[string]interface{}{"a": "b"},
+	}
+	for i, obj := range objs {
+		if err := GRPH.Add("paul", fmt.Sprint("p", i), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := GRPH.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	cleanupGraph()
+	if err := GRPH.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for i, obj := range objs {
+		triples, _ := GRPH.Triples("paul", fmt.Sprint("p", i), nil, nil)
+		if len(triples) != 1 || !reflect.DeepEqual(triples[0][2], obj) {
+			t.Errorf("%v should round trip got %v", obj, triples)
+		}
+	}
+}
+
 func BenchmarkAdd(b *testing.B) {
 	cleanupGraph()
 	defer cleanupGraph()
@@ -1,159 +1,265 @@
 package pfftdb
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
+	"sort"
 	"time"
 
 	log "github.com/golang/glog"
 )
 
+// GeocacheGraphSuffix names the graph the addresses a GeoRule resolved
+// are cached in.
+const GeocacheGraphSuffix = ".geocache"
+
 // Inferences is initialized on load
 var Inferences map[string]Inference
 
 // Inference [...]
 type Inference interface {
-	Apply(*Graph)
+	Apply(context.Context, *Graph) (*InferenceReport, error)
 	Triples(map[string]interface{}) ([]*Triple, error)
 	//Remove()
 }
 
-// GoogleGeoResp from the google maps api.
-type GoogleGeoResp struct {
-	Results []struct {
-		AddrComponents []struct {
-			LongName  string   `json:"long_name"`
-			ShortName string   `json:"short_name"`
-			Types     []string `json:"types"`
-		} `json:"address_components"`
-		FormattedAddress string `json:"formatted_address"`
-		Geometry         struct {
-			Location struct {
-				Lat float64 `json:"lat"`
-				Lng float64 `json:"lng"`
-			} `json:"location"`
-			LocationType string `json:"location_type"`
-			ViewPort     interface{}
-		} `json:"geometry"`
-	} `json:"results"`
-	Status string
+// InferenceReport is what a run of an inference did, the items are the
+// subjects it inferred for, like the places of a GeoRule.
+type InferenceReport struct {
+	Added     int               `json:"added"`
+	Retracted int               `json:"retracted"`
+	Skipped   int               `json:"skipped"`   // items done by an earlier run
+	Succeeded []string          `json:"succeeded"` // items done by this run
+	Failed    map[string]string `json:"failed"`    // the error of an item
+	Pending   []string          `json:"pending"`   // items left for the next run
+}
+
+func newInferenceReport() *InferenceReport {
+	return &InferenceReport{Succeeded: []string{}, Failed: map[string]string{}, Pending: []string{}}
 }
 
-// GeoRule provides latitude and logitude triples
-// for a given address. It searches for location:address within triples
-// and applies lat and lng triples to that address.
+// GeoRule provides latitude and logitude triples for places. It searches
+// for location:address within triples and adds location:lat and
+// location:lng to the place of the address. As a trigger it geocodes the
+// addresses added, see Graph.SetTrigger.
+//
+// Resolved addresses are cached in the graph named graph.geocache. When
+// the geocoder is over its query limit an address is retried after
+// Backoff, doubled every time, and the run stops after Retries, the
+// places left are pending and a later run resumes with them.
 type GeoRule struct {
+	Geocoder Geocoder      // DefaultGeocoder if nil
+	Retries  int           // 3 if 0
+	Backoff  time.Duration // a second if 0
 }
 
 func init() {
 	Inferences = map[string]Inference{
-		"geo": GeoRule{},
+		"geo":   GeoRule{},
+		"rules": RuleInference{},
 	}
 }
 
-// googleCall performs a remote request to google.
-var googleCall = func(address string) ([]byte, error) {
-	resp, err := http.Get(fmt.Sprintf(`http://maps.googleapis.com/maps/api/geocode/json?address=%s&sensor=false`, url.QueryEscape(address)))
-	if err != nil {
-		log.Error(err)
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Error(err)
-		return nil, err
+// geocoder returns the geocoder of the rule.
+func (gr GeoRule) geocoder() Geocoder {
+	if gr.Geocoder == nil {
+		return DefaultGeocoder
 	}
-
-	return body, err
+	return gr.Geocoder
 }
 
-// Queries
-func (gr GeoRule) Apply(g *Graph) {
-	type Key struct {
-		Place   string
-		Address string
-	}
-	seen := map[Key]struct{}{}
-	bindings := []Bindings{}
-
+// Apply geocodes the addresses of the places without a location, when
+// the context is done the places left are pending.
+func (gr GeoRule) Apply(ctx context.Context, g *Graph) (*InferenceReport, error) {
+	addresses := map[string][]string{}
 	triples := []*Triple{
 		&Triple{"?placeid", "location:address", "?address"},
 	}
-	for _, loc := range g.Query(triples, nil) {
-		placeID := fmt.Sprintf("%v", loc["placeid"])
-		addr := fmt.Sprintf("%v", loc["address"])
-		if _, ok := seen[Key{placeID, addr}]; ok {
+	for _, loc := range g.Query(triples, &Options{Entailment: EntailNone}) {
+		placeID, ok := loc["placeid"].(string)
+		if !ok {
 			continue
 		}
-		bindings = append(bindings, loc)
-		seen[Key{placeID, addr}] = struct{}{}
+		addresses[placeID] = append(addresses[placeID], fmt.Sprintf("%v", loc["address"]))
 	}
+	return gr.locate(ctx, g, addresses, newInferenceReport())
+}
 
-	for _, bind := range bindings {
-		trps, err := gr.Triples(bind)
-		if err != nil {
-			log.Error(err)
-			if err.Error() == "OVER_QUERY_LIMIT" {
-				return
-			}
+// ApplyDelta geocodes the places of the addresses added and removes the
+// location of the places with no address left.
+func (gr GeoRule) ApplyDelta(ctx context.Context, g *Graph, added, removed []*Triple) (*InferenceReport, error) {
+	report := newInferenceReport()
+	for _, triple := range removed {
+		if triple == nil {
+			continue
+		}
+		placeID, ok := triple[0].(string)
+		if !ok || triple[1] != "location:address" {
+			continue
 		}
-		for _, triple := range trps {
-			sub, pred, err := SubPred(triple[0], triple[1])
+		if count, err := g.Count(placeID, "location:address", SPEMPTY); err != nil || count > 0 {
 			if err != nil {
-				log.Error(err)
-				continue
+				return report, err
 			}
-			err = g.Add(sub, pred, triple[2])
+			continue
+		}
+		located := []*Triple{}
+		for _, pred := range []string{"location:lat", "location:lng"} {
+			triples, err := ReadTriples(g.Driver.Triples(g.GraphID, placeID, pred, SPEMPTY, nil))
 			if err != nil {
-				log.Error(err)
-				if err.Error() == "OVER_QUERY_LIMIT" {
-				}
+				return report, err
 			}
+			located = append(located, triples...)
+		}
+		if len(located) == 0 {
+			continue
+		}
+		if err := g.removeBulk(located); err != nil {
+			return report, err
+		}
+		report.Retracted += len(located)
+	}
+
+	addresses := map[string][]string{}
+	for _, triple := range added {
+		if triple == nil {
+			continue
+		}
+		placeID, ok := triple[0].(string)
+		if !ok || triple[1] != "location:address" {
+			continue
 		}
+		addresses[placeID] = append(addresses[placeID], fmt.Sprintf("%v", triple[2]))
 	}
+	return gr.locate(ctx, g, addresses, report)
 }
 
-// Triples
-func (m GeoRule) Triples(args map[string]interface{}) ([]*Triple, error) {
-	triples := []*Triple{}
+// locate geocodes the addresses of places without a location into a
+// report.
+func (gr GeoRule) locate(ctx context.Context, g *Graph, addresses map[string][]string, report *InferenceReport) (*InferenceReport, error) {
+	cache, err := g.sideGraph(GeocacheGraphSuffix)
+	if err != nil {
+		return report, err
+	}
+	places := []string{}
+	for placeID := range addresses {
+		places = append(places, placeID)
+	}
+	sort.Strings(places)
 
-	if _, ok := args["placeid"].(string); ok {
-		addr, ok := args["address"].(string)
-		if !ok {
-			return nil, fmt.Errorf("missing address")
+	for i, placeID := range places {
+		progress(ctx, i, len(places))
+		if ctx.Err() != nil {
+			report.Pending = append(report.Pending, places[i:]...)
+			return report, ctx.Err()
+		}
+		if count, err := g.Count(placeID, "location:lat", SPEMPTY); err != nil {
+			return report, err
+		} else if count > 0 {
+			report.Skipped++
+			continue
+		}
+
+		var lat, lng float64
+		errs := []string{}
+		for _, addr := range addresses[placeID] {
+			lat, lng, err = gr.geocode(ctx, cache, addr)
+			if err == nil {
+				break
+			}
+			if err == ErrOverQueryLimit {
+				report.Pending = append(report.Pending, places[i:]...)
+				return report, nil
+			}
+			if err == ctx.Err() {
+				report.Pending = append(report.Pending, places[i:]...)
+				return report, err
+			}
+			errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
 		}
-		time.Sleep(500 * time.Millisecond)
-		body, err := googleCall(addr)
 		if err != nil {
-			log.Error(err, body)
-			return nil, err
+			log.Error(placeID, errs)
+			report.Failed[placeID] = fmt.Sprint(errs)
+			continue
 		}
 
-		ggr := GoogleGeoResp{}
-		err = json.Unmarshal(body, &ggr)
+		located := []*Triple{
+			&Triple{placeID, "location:lat", lat},
+			&Triple{placeID, "location:lng", lng},
+		}
+		added, err := g.addBulk(located)
 		if err != nil {
-			log.Error(err)
-			return nil, err
+			return report, err
+		}
+		report.Added += added
+		report.Succeeded = append(report.Succeeded, placeID)
+	}
+	return report, nil
+}
+
+// geocode returns the location of an address from the cache or the
+// geocoder, retrying with backoff over the query limit until the context
+// is done.
+func (gr GeoRule) geocode(ctx context.Context, cache *Graph, address string) (float64, float64, error) {
+	lat, errLat := cache.Value(address, "location:lat", "")
+	lng, errLng := cache.Value(address, "location:lng", "")
+	if errLat == nil && errLng == nil {
+		la, okLat := lat.(float64)
+		ln, okLng := lng.(float64)
+		if okLat && okLng {
+			return la, ln, nil
+		}
+	}
+
+	retries, backoff := gr.Retries, gr.Backoff
+	if retries == 0 {
+		retries = 3
+	}
+	if backoff == 0 {
+		backoff = time.Second
+	}
+	for try := 0; ; try++ {
+		la, ln, err := gr.geocoder().Geocode(ctx, address)
+		if err == ErrOverQueryLimit && try < retries {
+			log.Error(err, " retrying in ", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return 0, 0, ctx.Err()
+			}
+			backoff *= 2
+			continue
 		}
-		if ggr.Status == "OVER_QUERY_LIMIT" {
-			log.Errorf("%#v", ggr)
-			return nil, fmt.Errorf(ggr.Status)
+		if err != nil {
+			return 0, 0, err
 		}
+		cached := []*Triple{
+			&Triple{address, "location:lat", la},
+			&Triple{address, "location:lng", ln},
+		}
+		if _, err := cache.AddBulk(cache.GraphID, cached); err != nil {
+			log.Error(err)
+		}
+		return la, ln, nil
+	}
+}
+
+// Triples returns the location triples of a place and its address.
+func (gr GeoRule) Triples(args map[string]interface{}) ([]*Triple, error) {
+	triples := []*Triple{}
 
-		if len(ggr.Results) == 0 {
-			log.Errorf("%#v", ggr)
-			return nil, fmt.Errorf("no results")
+	if placeID, ok := args["placeid"].(string); ok {
+		addr, ok := args["address"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing address")
+		}
+		lat, lng, err := gr.geocoder().Geocode(context.Background(), addr)
+		if err != nil {
+			return nil, err
 		}
-		lat := ggr.Results[0].Geometry.Location.Lat
-		lng := ggr.Results[0].Geometry.Location.Lng
 
-		triples = append(triples, &Triple{addr, "location:lat", lat})
-		triples = append(triples, &Triple{addr, "location:lng", lng})
+		triples = append(triples, &Triple{placeID, "location:lat", lat})
+		triples = append(triples, &Triple{placeID, "location:lng", lng})
 	}
 	return triples, nil
 }
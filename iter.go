@@ -0,0 +1,339 @@
+package pfftdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TripleIter iterates over the triples a driver matched. Next returns false
+// when there are no more triples or on an error, which Err returns. Close
+// releases the underlying cursor and has to be called.
+type TripleIter interface {
+	Next() (*Triple, bool)
+	Err() error
+	Close() error
+}
+
+// BindingIter iterates over query results like TripleIter.
+type BindingIter interface {
+	Next() (Bindings, bool)
+	Err() error
+	Close() error
+}
+
+// sliceIter iterates over triples already in memory.
+type sliceIter struct {
+	triples []*Triple
+	err     error
+}
+
+// newSliceIter returns an iterator over triples.
+func newSliceIter(triples []*Triple) *sliceIter {
+	return &sliceIter{triples: triples}
+}
+
+// errIter returns an iterator without triples that fails with err.
+func errIter(err error) *sliceIter {
+	return &sliceIter{err: err}
+}
+
+// Next returns the next triple.
+func (it *sliceIter) Next() (*Triple, bool) {
+	if len(it.triples) == 0 {
+		return nil, false
+	}
+	triple := it.triples[0]
+	it.triples = it.triples[1:]
+	return triple, true
+}
+
+// Err returns the error the iterator was created with.
+func (it *sliceIter) Err() error {
+	return it.err
+}
+
+// Close drops the remaining triples.
+func (it *sliceIter) Close() error {
+	it.triples = nil
+	return nil
+}
+
+// bindingSliceIter iterates over bindings already in memory.
+type bindingSliceIter struct {
+	bindings []Bindings
+	err      error
+}
+
+// Next returns the next binding.
+func (it *bindingSliceIter) Next() (Bindings, bool) {
+	if len(it.bindings) == 0 {
+		return nil, false
+	}
+	binding := it.bindings[0]
+	it.bindings = it.bindings[1:]
+	return binding, true
+}
+
+// Err returns the error the iterator was created with.
+func (it *bindingSliceIter) Err() error {
+	return it.err
+}
+
+// Close drops the remaining bindings.
+func (it *bindingSliceIter) Close() error {
+	it.bindings = nil
+	return nil
+}
+
+// clauseIter joins the triples of a clause with bindings while they are
+// read from the driver, one graph after the other. Without bindings each
+// triple is a new binding.
+type clauseIter struct {
+	driver    Driver
+	sub       string
+	pred      string
+	obj       interface{}
+	opts      *Options
+	graphs    []string
+	positions map[string]uint
+	bindings  []Bindings
+	table     *joinTable // nil if bindings can't be hashed
+	iter      TripleIter
+	graph     string
+	pending   []Bindings
+	err       error
+}
+
+// Next returns the next joined binding.
+func (it *clauseIter) Next() (Bindings, bool) {
+	for len(it.pending) == 0 {
+		if it.err != nil {
+			return nil, false
+		}
+		if it.iter == nil {
+			if len(it.graphs) == 0 {
+				return nil, false
+			}
+			it.graph, it.graphs = it.graphs[0], it.graphs[1:]
+			it.iter = it.driver.Triples(it.graph, it.sub, it.pred, it.obj, it.opts)
+		}
+		triple, ok := it.iter.Next()
+		if !ok {
+			it.err = it.iter.Err()
+			it.iter.Close()
+			it.iter = nil
+			continue
+		}
+		it.pending = it.join(triple)
+	}
+	binding := it.pending[0]
+	it.pending = it.pending[1:]
+	return binding, true
+}
+
+// join returns the bindings for a triple.
+func (it *clauseIter) join(triple *Triple) []Bindings {
+	if len(it.bindings) == 0 {
+		binding := make(Bindings, len(it.positions))
+		for variable, position := range it.positions {
+			binding[variable] = clauseItem(triple, it.graph, position)
+		}
+		return []Bindings{binding}
+	}
+	if it.table != nil {
+		return it.table.probe(nil, triple, it.graph)
+	}
+	return loopJoin(it.bindings, []*Triple{triple}, []string{it.graph}, it.positions)
+}
+
+// Err returns the first driver error.
+func (it *clauseIter) Err() error {
+	return it.err
+}
+
+// Close closes the driver iterator.
+func (it *clauseIter) Close() error {
+	var err error
+	if it.iter != nil {
+		err = it.iter.Close()
+		it.iter = nil
+	}
+	it.graphs = nil
+	it.pending = nil
+	return err
+}
+
+// queryIter applies the filters left, groupby, select, distinct, orderby,
+// limit and offset options to bindings while iterating.
+type queryIter struct {
+	src      BindingIter
+	options  *Options
+	filters  []*queryFilter
+	selected map[string]bool
+	seen     map[string]bool
+	groups   BindingIter
+	sorted   BindingIter
+	skipped  uint
+	returned uint
+}
+
+// newQueryIter returns an iterator applying filters and options to src.
+func newQueryIter(src BindingIter, options *Options, filters []*queryFilter) *queryIter {
+	it := &queryIter{src: src, options: options, filters: filters}
+	if len(options.Select) > 0 && options.Select[0] != "?COUNT" {
+		it.selected = map[string]bool{}
+		for _, key := range options.Select {
+			it.selected[key] = true
+		}
+	}
+	if options.Distinct {
+		it.seen = map[string]bool{}
+	}
+	return it
+}
+
+// Next returns the next binding after offset and up to limit.
+func (it *queryIter) Next() (Bindings, bool) {
+	for it.skipped < it.options.Offset {
+		if _, ok := it.next(); !ok {
+			return nil, false
+		}
+		it.skipped++
+	}
+	if it.options.Limit != 0 && it.returned >= it.options.Limit {
+		return nil, false
+	}
+	binding, ok := it.next()
+	if ok {
+		it.returned++
+	}
+	return binding, ok
+}
+
+// next returns the next binding in order, orderby reads and sorts all of
+// them on the first call.
+func (it *queryIter) next() (Bindings, bool) {
+	orderBy := it.options.OrderBy
+	if orderBy == "" {
+		return it.filtered()
+	}
+	if it.sorted == nil {
+		bindings := []Bindings{}
+		for {
+			binding, ok := it.filtered()
+			if !ok {
+				break
+			}
+			bindings = append(bindings, binding)
+		}
+		if orderBy[:1] == "-" {
+			sort.Sort(bindingSlice{Key: orderBy[1:], Asc: false, Bindings: bindings})
+		} else {
+			sort.Sort(bindingSlice{Key: orderBy, Asc: true, Bindings: bindings})
+		}
+		it.sorted = &bindingSliceIter{bindings: bindings}
+	}
+	return it.sorted.Next()
+}
+
+// filtered returns the next binding or group, selected and distinct.
+func (it *queryIter) filtered() (Bindings, bool) {
+	for {
+		binding, ok := it.row()
+		if !ok {
+			return nil, false
+		}
+
+		// bindings can be shared between results so selected ones are copies
+		if it.selected != nil {
+			selected := make(Bindings, len(it.selected))
+			for key, val := range binding {
+				if it.selected[key] {
+					selected[key] = val
+				}
+			}
+			binding = selected
+		}
+		if it.seen != nil {
+			hash := fmt.Sprintf("%s", binding)
+			if it.seen[hash] {
+				continue
+			}
+			it.seen[hash] = true
+		}
+		return binding, true
+	}
+}
+
+// row returns the next binding matching the filters, grouping reads all of
+// them on the first call and returns the groups.
+func (it *queryIter) row() (Bindings, bool) {
+	if !it.options.grouped() {
+		return it.matched()
+	}
+	if it.groups == nil {
+		bindings := groupBindings(it.matched, it.options.GroupBy, it.options.Aggregates, it.options.Having)
+		it.groups = &bindingSliceIter{bindings: bindings}
+	}
+	return it.groups.Next()
+}
+
+// matched returns the next binding matching the filters.
+func (it *queryIter) matched() (Bindings, bool) {
+	for {
+		binding, ok := it.src.Next()
+		if !ok {
+			return nil, false
+		}
+		if matchFilters(binding, it.filters) {
+			return binding, true
+		}
+	}
+}
+
+// Err returns the error of the bindings.
+func (it *queryIter) Err() error {
+	return it.src.Err()
+}
+
+// Close closes the bindings.
+func (it *queryIter) Close() error {
+	it.groups = nil
+	it.sorted = nil
+	return it.src.Close()
+}
+
+// ReadTriples reads the remaining triples and closes iter.
+func ReadTriples(iter TripleIter) ([]*Triple, error) {
+	defer iter.Close()
+	triples := []*Triple{}
+	for {
+		triple, ok := iter.Next()
+		if !ok {
+			break
+		}
+		triples = append(triples, triple)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return triples, nil
+}
+
+// ReadBindings reads the remaining bindings and closes iter, it returns
+// nil without results.
+func ReadBindings(iter BindingIter) ([]Bindings, error) {
+	defer iter.Close()
+	var bindings []Bindings
+	for {
+		binding, ok := iter.Next()
+		if !ok {
+			break
+		}
+		bindings = append(bindings, binding)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
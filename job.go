@@ -0,0 +1,189 @@
+package pfftdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobTimeout is how long a finished job is kept for its result.
+var JobTimeout = time.Hour
+
+// job statuses.
+const (
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a long running task on a graph, like an inference, an import,
+// an index or analytics. Done out of Total is its progress, Total is 0
+// if it isn't known. Result is what the task returned once it is done.
+type Job struct {
+	ID       string      `json:"id"`
+	Kind     string      `json:"kind"`
+	Graph    string      `json:"graph"`
+	Status   string      `json:"status"`
+	Done     int         `json:"done"`
+	Total    int         `json:"total"`
+	Error    string      `json:"error,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+	Started  time.Time   `json:"started"`
+	Finished *time.Time  `json:"finished,omitempty"`
+}
+
+// jobKey is the context key of the running job.
+type jobKey struct{}
+
+// runningJob is a job with its context, the status is guarded by mu.
+type runningJob struct {
+	mu     sync.Mutex
+	status Job
+	cancel context.CancelFunc
+}
+
+// snapshot returns a copy of the status.
+func (rj *runningJob) snapshot() *Job {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	status := rj.status
+	return &status
+}
+
+// progress reports the progress of the job running with a context, it
+// does nothing outside of a job.
+func progress(ctx context.Context, done, total int) {
+	rj, ok := ctx.Value(jobKey{}).(*runningJob)
+	if !ok {
+		return
+	}
+	rj.mu.Lock()
+	rj.status.Done, rj.status.Total = done, total
+	rj.mu.Unlock()
+}
+
+// jobs holds the jobs by id, finished ones are removed after JobTimeout.
+type jobs struct {
+	mu  sync.Mutex
+	all map[string]*runningJob
+}
+
+// start runs a task in the background as a job of kind on a graph and
+// returns its id. The task is cancelled through its context.
+func (js *jobs) start(kind, graph string, task func(ctx context.Context) (interface{}, error)) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rj := &runningJob{
+		status: Job{ID: id, Kind: kind, Graph: graph, Status: JobRunning, Started: time.Now()},
+		cancel: cancel,
+	}
+	ctx = context.WithValue(ctx, jobKey{}, rj)
+
+	js.mu.Lock()
+	js.expire()
+	if js.all == nil {
+		js.all = map[string]*runningJob{}
+	}
+	js.all[id] = rj
+	js.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		result, err := task(ctx)
+
+		rj.mu.Lock()
+		defer rj.mu.Unlock()
+		now := time.Now()
+		rj.status.Finished = &now
+		rj.status.Result = result
+		switch {
+		case err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()):
+			rj.status.Status = JobCancelled
+			rj.status.Error = err.Error()
+		case err != nil:
+			rj.status.Status = JobFailed
+			rj.status.Error = err.Error()
+		default:
+			rj.status.Status = JobDone
+		}
+	}()
+	return id, nil
+}
+
+// get returns the status of the job with id.
+func (js *jobs) get(id string) (*Job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.expire()
+	rj, ok := js.all[id]
+	if !ok {
+		return nil, false
+	}
+	return rj.snapshot(), true
+}
+
+// list returns the status of every job by start time.
+func (js *jobs) list() []*Job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.expire()
+	list := []*Job{}
+	for _, rj := range js.all {
+		list = append(list, rj.snapshot())
+	}
+	sort.Sort(jobsByStart(list))
+	return list
+}
+
+// jobsByStart sorts jobs by start time.
+type jobsByStart []*Job
+
+func (js jobsByStart) Len() int           { return len(js) }
+func (js jobsByStart) Swap(i, j int)      { js[i], js[j] = js[j], js[i] }
+func (js jobsByStart) Less(i, j int) bool { return js[i].Started.Before(js[j].Started) }
+
+// cancel cancels the job with id without waiting for it to stop, it is
+// cancelled once its task returns the error of its context. A task which
+// doesn't stop on its context finishes as usual.
+func (js *jobs) cancel(id string) (*Job, bool) {
+	js.mu.Lock()
+	rj, ok := js.all[id]
+	js.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	rj.cancel()
+	return rj.snapshot(), true
+}
+
+// expire removes jobs finished more than JobTimeout ago, the caller must
+// hold the lock.
+func (js *jobs) expire() {
+	now := time.Now()
+	for id, rj := range js.all {
+		status := rj.snapshot()
+		if status.Finished != nil && now.Sub(*status.Finished) > JobTimeout {
+			delete(js.all, id)
+		}
+	}
+}
+
+// cancelAll cancels every running job.
+func (js *jobs) cancelAll() {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	for _, rj := range js.all {
+		rj.cancel()
+	}
+}
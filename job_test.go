@@ -0,0 +1,95 @@
+package pfftdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// waitJob polls a job until it isn't running.
+func waitJob(t *testing.T, js *jobs, id string) *Job {
+	for i := 0; i < 500; i++ {
+		job, ok := js.get(id)
+		if !ok {
+			t.Fatal("job not found", id)
+		}
+		if job.Status != JobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job still running", id)
+	return nil
+}
+
+func TestJobs(t *testing.T) {
+	js := &jobs{}
+
+	id, err := js.start("count", TESTGRAPH, func(ctx context.Context) (interface{}, error) {
+		progress(ctx, 1, 2)
+		return 2, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := waitJob(t, js, id); job.Status != JobDone || job.Result != 2 || job.Done != 1 || job.Total != 2 || job.Finished == nil {
+		t.Errorf("%+v", job)
+	}
+
+	id, err = js.start("fail", TESTGRAPH, func(ctx context.Context) (interface{}, error) {
+		return nil, fmt.Errorf("failed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := waitJob(t, js, id); job.Status != JobFailed || job.Error != "failed" {
+		t.Errorf("%+v", job)
+	}
+
+	started := make(chan struct{})
+	id, err = js.start("wait", TESTGRAPH, func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if job, ok := js.get(id); !ok || job.Status != JobRunning {
+		t.Errorf("%+v", job)
+	}
+	if _, ok := js.cancel(id); !ok {
+		t.Error("wait should be found")
+	}
+	if job := waitJob(t, js, id); job.Status != JobCancelled {
+		t.Errorf("%+v", job)
+	}
+
+	// a task which ignores its context isn't cancelled
+	release := make(chan struct{})
+	ignoring, err := js.start("ignore", TESTGRAPH, func(ctx context.Context) (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, ok := js.cancel(ignoring); !ok || job.Status != JobRunning {
+		t.Errorf("cancel shouldn't wait for the task %+v", job)
+	}
+	close(release)
+	if job := waitJob(t, js, ignoring); job.Status != JobDone || job.Result != 1 {
+		t.Errorf("%+v", job)
+	}
+	if _, ok := js.cancel("missing"); ok {
+		t.Error("missing job should not be found")
+	}
+	if list := js.list(); len(list) != 4 || list[0].Kind != "count" || list[2].Kind != "wait" {
+		t.Error(list)
+	}
+
+	// progress outside of a job is ignored
+	progress(context.Background(), 1, 1)
+}
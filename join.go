@@ -0,0 +1,226 @@
+package pfftdb
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// joinChunkSize is the number of triples a goroutine probes the hash
+// table with.
+const joinChunkSize = 1000
+
+// joinKey holds the values of the shared variables of a binding or triple,
+// one per triple position and the graph.
+type joinKey [4]interface{}
+
+// joinVars returns the clause variables bound in every binding, these are
+// the ones to join on.
+func joinVars(bindings []Bindings, bindingPositions map[string]uint) []string {
+	vars := []string{}
+	for variable := range bindingPositions {
+		shared := true
+		for _, binding := range bindings {
+			if _, ok := binding[variable]; !ok {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			vars = append(vars, variable)
+		}
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// hashable reports whether a value can be used in a map key.
+func hashable(val interface{}) bool {
+	return val == nil || reflect.TypeOf(val).Comparable()
+}
+
+// joinBindings joins bindings with the triples of a clause on the
+// variables they share. A merge join is used when both are sorted on the
+// first shared variable, otherwise a hash join. Without shared variables
+// every binding is compared with every triple.
+func joinBindings(bindings []Bindings, triples []*Triple, tripleGraphs []string, bindingPositions map[string]uint) []Bindings {
+	vars := joinVars(bindings, bindingPositions)
+	if len(vars) == 0 {
+		return loopJoin(bindings, triples, tripleGraphs, bindingPositions)
+	}
+
+	variable := vars[0]
+	position := bindingPositions[variable]
+	bindingsSorted := sortedOn(len(bindings), func(i int) interface{} {
+		return bindings[i][variable]
+	})
+	if bindingsSorted && sortedOn(len(triples), func(i int) interface{} {
+		return clauseItem(triples[i], tripleGraphs[i], position)
+	}) {
+		return mergeJoin(bindings, triples, tripleGraphs, bindingPositions, variable)
+	}
+	return hashJoin(bindings, triples, tripleGraphs, bindingPositions, vars)
+}
+
+// joinTable holds bindings hashed on the variables they share with a
+// clause.
+type joinTable struct {
+	vars      []string
+	positions map[string]uint
+	bindings  map[joinKey][]Bindings
+}
+
+// newJoinTable hashes bindings on vars, it returns false if a value can't
+// be hashed.
+func newJoinTable(bindings []Bindings, vars []string, bindingPositions map[string]uint) (*joinTable, bool) {
+	table := &joinTable{
+		vars:      vars,
+		positions: bindingPositions,
+		bindings:  make(map[joinKey][]Bindings, len(bindings)),
+	}
+	for _, binding := range bindings {
+		var key joinKey
+		for i, variable := range vars {
+			if !hashable(binding[variable]) {
+				return nil, false
+			}
+			key[i] = binding[variable]
+		}
+		table.bindings[key] = append(table.bindings[key], binding)
+	}
+	return table, true
+}
+
+// probe appends the bindings joined with a triple from graph to out.
+func (t *joinTable) probe(out []Bindings, triple *Triple, graph string) []Bindings {
+	var key joinKey
+	for i, variable := range t.vars {
+		item := clauseItem(triple, graph, t.positions[variable])
+		if !hashable(item) {
+			return out
+		}
+		key[i] = item
+	}
+	for _, binding := range t.bindings[key] {
+		tmp := queryBinding(binding, triple, graph, t.positions)
+		if tmp != nil {
+			out = append(out, *tmp)
+		}
+	}
+	return out
+}
+
+// hashJoin hashes bindings on vars and probes the table with the triples
+// in parallel chunks. Values that can't be hashed fall back to comparing
+// every binding with every triple.
+func hashJoin(bindings []Bindings, triples []*Triple, tripleGraphs []string, bindingPositions map[string]uint, vars []string) []Bindings {
+	table, ok := newJoinTable(bindings, vars, bindingPositions)
+	if !ok {
+		return loopJoin(bindings, triples, tripleGraphs, bindingPositions)
+	}
+
+	// each chunk writes its own results so no locking is needed and the
+	// results keep the order of the triples.
+	chunks := (len(triples) + joinChunkSize - 1) / joinChunkSize
+	results := make([][]Bindings, chunks)
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	wg := &sync.WaitGroup{}
+	for c := 0; c < chunks; c++ {
+		start := c * joinChunkSize
+		end := start + joinChunkSize
+		if end > len(triples) {
+			end = len(triples)
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c, start, end int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			newBindings := []Bindings{}
+			for i := start; i < end; i++ {
+				newBindings = table.probe(newBindings, triples[i], tripleGraphs[i])
+			}
+			results[c] = newBindings
+		}(c, start, end)
+	}
+	wg.Wait()
+
+	newBindings := []Bindings{}
+	for _, result := range results {
+		newBindings = append(newBindings, result...)
+	}
+	return newBindings
+}
+
+// loopJoin compares every binding with every triple.
+func loopJoin(bindings []Bindings, triples []*Triple, tripleGraphs []string, bindingPositions map[string]uint) []Bindings {
+	newBindings := []Bindings{}
+	for _, binding := range bindings {
+		for i, triple := range triples {
+			tmp := queryBinding(binding, triple, tripleGraphs[i], bindingPositions)
+			if tmp != nil {
+				newBindings = append(newBindings, *tmp)
+			}
+		}
+	}
+	return newBindings
+}
+
+// sortedOn reports whether n items are in ascending order, items that
+// can't be compared aren't sorted.
+func sortedOn(n int, item func(int) interface{}) bool {
+	for i := 1; i < n; i++ {
+		c, ok := compareObjects(item(i-1), item(i))
+		if !ok || c > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeJoin joins bindings and triples both sorted on variable. Runs of
+// equal values are joined with each other, the results stay sorted.
+func mergeJoin(bindings []Bindings, triples []*Triple, tripleGraphs []string, bindingPositions map[string]uint, variable string) []Bindings {
+	position := bindingPositions[variable]
+	item := func(i int) interface{} {
+		return clauseItem(triples[i], tripleGraphs[i], position)
+	}
+
+	newBindings := []Bindings{}
+	i, j := 0, 0
+	for i < len(bindings) && j < len(triples) {
+		c, _ := compareObjects(bindings[i][variable], item(j))
+		switch {
+		case c < 0:
+			i++
+			continue
+		case c > 0:
+			j++
+			continue
+		}
+		end := j
+		for end < len(triples) {
+			if c, _ := compareObjects(bindings[i][variable], item(end)); c != 0 {
+				break
+			}
+			end++
+		}
+		val := bindings[i][variable]
+		for ; i < len(bindings); i++ {
+			if c, _ := compareObjects(bindings[i][variable], val); c != 0 {
+				break
+			}
+			for k := j; k < end; k++ {
+				tmp := queryBinding(bindings[i], triples[k], tripleGraphs[k], bindingPositions)
+				if tmp != nil {
+					newBindings = append(newBindings, *tmp)
+				}
+			}
+		}
+		j = end
+	}
+	return newBindings
+}
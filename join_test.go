@@ -0,0 +1,72 @@
+package pfftdb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func joinTestData(n int) ([]Bindings, []*Triple, []string) {
+	bindings := []Bindings{}
+	triples := []*Triple{}
+	graphs := []string{}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("_:%04d", i)
+		bindings = append(bindings, Bindings{"id": id, "name": fmt.Sprintf("name%d", i%7)})
+		triples = append(triples, &Triple{id, "age", i % 50})
+		triples = append(triples, &Triple{id, "age", i%50 + 1})
+		graphs = append(graphs, TESTGRAPH, TESTGRAPH)
+	}
+	// no match
+	triples = append(triples, &Triple{"_:x", "age", 1})
+	graphs = append(graphs, TESTGRAPH)
+	return bindings, triples, graphs
+}
+
+func bindingStrings(bindings []Bindings) []string {
+	out := []string{}
+	for _, b := range bindings {
+		out = append(out, fmt.Sprint(b["id"], b["name"], b["age"]))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestJoinBindings(t *testing.T) {
+	bindings, triples, graphs := joinTestData(1200)
+	positions := map[string]uint{"id": 0, "age": 2}
+
+	expected := loopJoin(bindings, triples, graphs, positions)
+	if len(expected) != 2400 {
+		t.Fatal("should have 2400 bindings got:", len(expected))
+	}
+	hashed := hashJoin(bindings, triples, graphs, positions, []string{"id"})
+	if !reflect.DeepEqual(bindingStrings(hashed), bindingStrings(expected)) {
+		t.Error("hash join doesn't match nested loop join", len(hashed))
+	}
+	// sorted on id so this is a merge join
+	merged := joinBindings(bindings, triples, graphs, positions)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Error("merge join doesn't match nested loop join", len(merged))
+	}
+	bindings[0], bindings[1] = bindings[1], bindings[0]
+	hashed = joinBindings(bindings, triples, graphs, positions)
+	if !reflect.DeepEqual(bindingStrings(hashed), bindingStrings(expected)) {
+		t.Error("unsorted join doesn't match nested loop join", len(hashed))
+	}
+
+	// unhashable values fall back to comparing every pair
+	positions = map[string]uint{"id": 0, "name": 2}
+	bindings = []Bindings{{"id": "a", "name": map[string]interface{}{"x": 1}}}
+	if out := joinBindings(bindings, []*Triple{&Triple{"a", "name", "b"}}, []string{TESTGRAPH}, positions); len(out) != 0 {
+		t.Error(out)
+	}
+
+	if !sortedOn(3, func(i int) interface{} { return []interface{}{1, 2.5, 3}[i] }) {
+		t.Error("numbers should be sorted")
+	}
+	if sortedOn(2, func(i int) interface{} { return []interface{}{"a", 1}[i] }) {
+		t.Error("mixed types shouldn't be sorted")
+	}
+}
@@ -0,0 +1,243 @@
+package pfftdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xsd datatypes with a go representation.
+const (
+	XSDString   = xsdNS + "string"
+	XSDBoolean  = xsdNS + "boolean"
+	XSDInteger  = xsdNS + "integer"
+	XSDDecimal  = xsdNS + "decimal"
+	XSDDouble   = xsdNS + "double"
+	XSDDateTime = xsdNS + "dateTime"
+)
+
+// Literal is an object without a native go type. Objects are stored as
+// string for xsd:string, bool for xsd:boolean, int for xsd:integer and
+// float64 for xsd:decimal and xsd:double. Language tagged strings,
+// xsd:dateTime and any other datatype are a Literal, in json
+// {"value": "2014-01-02T10:00:00Z", "datatype": "xsd:dateTime"} or
+// {"value": "chat", "lang": "fr"}.
+type Literal struct {
+	Value    string `json:"value"`
+	Lang     string `json:"lang,omitempty"`
+	Datatype string `json:"datatype,omitempty"`
+}
+
+// xsdIntegers are the xsd datatypes stored as ints.
+var xsdIntegers = map[string]bool{
+	"integer": true, "long": true, "int": true, "short": true, "byte": true,
+	"nonNegativeInteger": true, "positiveInteger": true, "negativeInteger": true, "nonPositiveInteger": true,
+	"unsignedLong": true, "unsignedInt": true, "unsignedShort": true, "unsignedByte": true,
+}
+
+// expandXSD expands the xsd: prefix of a datatype.
+func expandXSD(datatype string) string {
+	if strings.HasPrefix(datatype, "xsd:") {
+		return xsdNS + datatype[4:]
+	}
+	return datatype
+}
+
+// parseDateTime parses an xsd:dateTime, times without a timezone are UTC.
+func parseDateTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02T15:04:05", value)
+	}
+	return t.UTC(), err
+}
+
+// NewLiteral returns the object for a value of a datatype or with a
+// language tag. Datatypes can use the xsd: prefix, dates are normalized
+// to UTC so equal times are equal objects. Values that aren't valid for
+// their datatype are an error.
+func NewLiteral(value, datatype, lang string) (interface{}, error) {
+	datatype = expandXSD(datatype)
+	if lang != "" {
+		if datatype != "" && datatype != rdfNS+"langString" {
+			return nil, fmt.Errorf("literal %q has a language and datatype %s", value, datatype)
+		}
+		return Literal{Value: value, Lang: strings.ToLower(lang)}, nil
+	}
+
+	switch datatype {
+	case "", XSDString:
+		return value, nil
+	case XSDBoolean:
+		switch value {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	case XSDDecimal, XSDDouble, xsdNS + "float":
+		switch value {
+		case "INF":
+			return math.Inf(1), nil
+		case "-INF":
+			return math.Inf(-1), nil
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, nil
+		}
+	case XSDDateTime:
+		if t, err := parseDateTime(value); err == nil {
+			return Literal{Value: t.Format(time.RFC3339Nano), Datatype: XSDDateTime}, nil
+		}
+	default:
+		if !strings.HasPrefix(datatype, xsdNS) || !xsdIntegers[datatype[len(xsdNS):]] {
+			return Literal{Value: value, Datatype: datatype}, nil
+		}
+		if i, err := strconv.Atoi(value); err == nil {
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s %q", datatype, value)
+}
+
+// literalValue is NewLiteral for parsers, invalid values are kept as a
+// Literal and rdf:JSON is decoded.
+func literalValue(value, lang, datatype string) interface{} {
+	if datatype == rdfJSON {
+		var obj interface{}
+		if err := json.Unmarshal([]byte(value), &obj); err == nil {
+			return obj
+		}
+	}
+	obj, err := NewLiteral(value, datatype, lang)
+	if err != nil {
+		return Literal{Value: value, Lang: lang, Datatype: datatype}
+	}
+	return obj
+}
+
+// Time returns the time of an xsd:dateTime literal.
+func (l Literal) Time() (time.Time, bool) {
+	if l.Datatype != XSDDateTime {
+		return time.Time{}, false
+	}
+	t, err := parseDateTime(l.Value)
+	return t, err == nil
+}
+
+// typedValue converts a json decoded literal object to its go value,
+// anything else is returned as is.
+func typedValue(val interface{}) (interface{}, error) {
+	m, ok := val.(map[string]interface{})
+	if !ok {
+		return val, nil
+	}
+	value, ok := m["value"].(string)
+	if !ok {
+		return val, nil
+	}
+	var datatype, lang string
+	for k, v := range m {
+		switch k {
+		case "value":
+		case "datatype":
+			datatype, ok = v.(string)
+		case "lang":
+			lang, ok = v.(string)
+		default:
+			ok = false
+		}
+		if !ok {
+			return val, nil
+		}
+	}
+	return NewLiteral(value, datatype, lang)
+}
+
+// UnmarshalJSON decodes a triple, literal objects become their go value.
+func (t *Triple) UnmarshalJSON(data []byte) error {
+	var items [3]interface{}
+	err := json.Unmarshal(data, &items)
+	if err != nil {
+		return err
+	}
+	items[2], err = typedValue(items[2])
+	if err != nil {
+		return err
+	}
+	*t = Triple(items)
+	return nil
+}
+
+// UnmarshalJSON decodes a filter, a literal value becomes its go value.
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	type filter Filter
+	tmp := filter{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	tmp.Val, err = typedValue(tmp.Val)
+	if err != nil {
+		return err
+	}
+	*f = Filter(tmp)
+	return nil
+}
+
+// compareObjects orders two objects. Numbers compare by value whatever
+// their go type, dates by time and strings, booleans and literals of the
+// same datatype and language by value. ok is false when the objects
+// aren't comparable.
+func compareObjects(l, r interface{}) (c int, ok bool) {
+	if lf, lok := toFloat(l); lok {
+		rf, rok := toFloat(r)
+		switch {
+		case !rok:
+			return 0, false
+		case lf < rf:
+			return -1, true
+		case lf > rf:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch lv := l.(type) {
+	case string:
+		if rv, ok := r.(string); ok {
+			return strings.Compare(lv, rv), true
+		}
+	case bool:
+		if rv, ok := r.(bool); ok {
+			switch {
+			case lv == rv:
+				return 0, true
+			case rv:
+				return -1, true
+			}
+			return 1, true
+		}
+	case Literal:
+		rv, ok := r.(Literal)
+		if !ok || lv.Datatype != rv.Datatype || lv.Lang != rv.Lang {
+			return 0, false
+		}
+		if lt, ok := lv.Time(); ok {
+			if rt, ok := rv.Time(); ok {
+				switch {
+				case lt.Before(rt):
+					return -1, true
+				case lt.After(rt):
+					return 1, true
+				}
+				return 0, true
+			}
+		}
+		return strings.Compare(lv.Value, rv.Value), true
+	}
+	return 0, false
+}
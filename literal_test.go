@@ -0,0 +1,158 @@
+package pfftdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNewLiteral(t *testing.T) {
+	var tests = []struct {
+		value, datatype, lang string
+		out                   interface{}
+	}{
+		{"abc", "", "", "abc"},
+		{"abc", "xsd:string", "", "abc"},
+		{"42", "xsd:integer", "", 42},
+		{"-7", xsdNS + "long", "", -7},
+		{"4.5", "xsd:decimal", "", 4.5},
+		{"1e3", "xsd:double", "", 1000.0},
+		{"true", "xsd:boolean", "", true},
+		{"0", "xsd:boolean", "", false},
+		{"2014-01-02T10:00:00+02:00", "xsd:dateTime", "", Literal{Value: "2014-01-02T08:00:00Z", Datatype: XSDDateTime}},
+		{"2014-01-02T10:00:00.5", "xsd:dateTime", "", Literal{Value: "2014-01-02T10:00:00.5Z", Datatype: XSDDateTime}},
+		{"chat", "", "FR", Literal{Value: "chat", Lang: "fr"}},
+		{"P1D", "xsd:duration", "", Literal{Value: "P1D", Datatype: xsdNS + "duration"}},
+	}
+	for i, tt := range tests {
+		out, err := NewLiteral(tt.value, tt.datatype, tt.lang)
+		if err != nil {
+			t.Error(i, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("%d %s should be %#v got %#v", i, tt.value, tt.out, out)
+		}
+	}
+
+	var bad = []struct{ value, datatype, lang string }{
+		{"4.5", "xsd:integer", ""},
+		{"abc", "xsd:decimal", ""},
+		{"yes", "xsd:boolean", ""},
+		{"2014-13-02", "xsd:dateTime", ""},
+		{"chat", "xsd:string", "fr"},
+	}
+	for _, b := range bad {
+		if _, err := NewLiteral(b.value, b.datatype, b.lang); err == nil {
+			t.Error("should have gotten error for", b)
+		}
+	}
+}
+
+func TestTypedJSON(t *testing.T) {
+	data := DataRequest{}
+	err := json.Unmarshal([]byte(`{"graph": "test", "data": [
+		["a", "age", {"value": "42", "datatype": "xsd:integer"}],
+		["a", "born", {"value": "2014-01-02T10:00:00Z", "datatype": "xsd:dateTime"}],
+		["a", "name", {"value": "chat", "lang": "fr"}],
+		["a", "geo", {"value": "x", "lat": 1}],
+		["a", "n", 42]
+	]}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Triple{
+		&Triple{"a", "age", 42},
+		&Triple{"a", "born", Literal{Value: "2014-01-02T10:00:00Z", Datatype: XSDDateTime}},
+		&Triple{"a", "name", Literal{Value: "chat", Lang: "fr"}},
+		&Triple{"a", "geo", map[string]interface{}{"value": "x", "lat": 1.0}},
+		&Triple{"a", "n", 42.0},
+	}
+	if !reflect.DeepEqual(data.Data, expected) {
+		for _, tr := range data.Data {
+			t.Errorf("%#v", *tr)
+		}
+	}
+
+	// literals encode to the same form
+	b, _ := json.Marshal(data.Data[1])
+	if string(b) != `["a","born",{"value":"2014-01-02T10:00:00Z","datatype":"http://www.w3.org/2001/XMLSchema#dateTime"}]` {
+		t.Error(string(b))
+	}
+
+	err = json.Unmarshal([]byte(`["a", "age", {"value": "x", "datatype": "xsd:integer"}]`), &Triple{})
+	if err == nil {
+		t.Error("invalid integer should be an error")
+	}
+
+	filter := Filter{}
+	err = json.Unmarshal([]byte(`{"key": "born", "op": ">", "val": {"value": "2014-01-01T00:00:00Z", "datatype": "xsd:dateTime"}}`), &filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Key != "born" || filter.Val != (Literal{Value: "2014-01-01T00:00:00Z", Datatype: XSDDateTime}) {
+		t.Errorf("%+v", filter)
+	}
+}
+
+func TestCompareObjects(t *testing.T) {
+	day1 := Literal{Value: "2014-01-02T10:00:00Z", Datatype: XSDDateTime}
+	day2 := Literal{Value: "2014-01-10T00:00:00Z", Datatype: XSDDateTime}
+	var tests = []struct {
+		l, r interface{}
+		c    int
+		ok   bool
+	}{
+		{4, 4.0, 0, true},
+		{3, 4.5, -1, true},
+		{uint8(9), 4.5, 1, true},
+		{"42", 42, 0, false},
+		{"a", "b", -1, true},
+		{true, false, 1, true},
+		{day1, day2, -1, true},
+		{day2, day1, 1, true},
+		{day1, "2014-01-02T10:00:00Z", 0, false},
+		{Literal{Value: "a", Lang: "en"}, Literal{Value: "a", Lang: "fr"}, 0, false},
+	}
+	for i, tt := range tests {
+		c, ok := compareObjects(tt.l, tt.r)
+		if c != tt.c || ok != tt.ok {
+			t.Errorf("%d %v %v should be %d %v got %d %v", i, tt.l, tt.r, tt.c, tt.ok, c, ok)
+		}
+	}
+}
+
+func TestTypedQuery(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	born := func(s string) interface{} {
+		l, _ := NewLiteral(s, "xsd:dateTime", "")
+		return l
+	}
+	GRPH.Add("paul", "born", born("1984-06-01T00:00:00Z"))
+	GRPH.Add("kevin", "born", born("1958-07-08T00:00:00-05:00"))
+	GRPH.Add("albert", "born", born("1879-03-14T00:00:00Z"))
+	GRPH.Add("paul", "age", 30)
+	GRPH.Add("kevin", "age", 56.0)
+	GRPH.Add("albert", "age", "135")
+
+	res := GRPH.Query([]*Triple{
+		&Triple{"?id", "born", "?born"},
+	}, &Options{Filter: []*Filter{&Filter{"born", ">", born("1900-01-01T00:00:00Z")}}, OrderBy: "born"})
+	if len(res) != 2 || res[0]["id"] != "kevin" || res[1]["id"] != "paul" {
+		t.Error(res)
+	}
+
+	// the string "135" is not a number
+	res = GRPH.Query([]*Triple{
+		&Triple{"?id", "age", "?age"},
+	}, &Options{Filter: []*Filter{&Filter{"age", ">", 18}}, OrderBy: "-age"})
+	if len(res) != 2 || res[0]["id"] != "kevin" || res[1]["id"] != "paul" {
+		t.Error(res)
+	}
+
+	if c, _ := GRPH.Count("", "born", born("1958-07-08T05:00:00Z")); c != 1 {
+		t.Error("equal times should match got:", c)
+	}
+}
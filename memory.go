@@ -0,0 +1,629 @@
+package pfftdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryGraph holds the triples and indexes for a single graph.
+// Triples are keyed by tripleKey and each index maps a sub, pred, obj
+// or pair of them to the set of triple keys containing it. These are the
+// same s, p, o, sp, so, po indexes mongo creates.
+type MemoryGraph struct {
+	Graph    *Graph
+	mu       sync.RWMutex
+	seq      uint64
+	triples  map[string]*memTriple
+	subs     map[string]map[string]struct{}
+	preds    map[string]map[string]struct{}
+	objs     map[string]map[string]struct{}
+	subPreds map[string]map[string]struct{}
+	subObjs  map[string]map[string]struct{}
+	predObjs map[string]map[string]struct{}
+}
+
+// memTriple is a stored triple, seq keeps insertion order so results
+// are returned in a stable order like a collection scan.
+type memTriple struct {
+	seq    uint64
+	triple *Triple
+}
+
+// Memory is a pure go Driver that keeps every graph in memory. It is meant
+// for embedding and for running tests without a database.
+type Memory struct {
+	Graphs  map[string]*MemoryGraph
+	muGraph sync.Mutex
+}
+
+// NewMemory creates a memory driver and each of the given graphs.
+func NewMemory(graphs []string) (*Memory, error) {
+	m := &Memory{
+		Graphs:  map[string]*MemoryGraph{},
+		muGraph: sync.Mutex{},
+	}
+	for _, graphName := range graphs {
+		if graphName == "" {
+			continue
+		}
+		_, err := m.Create(graphName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// objKey returns a comparable key for an object. Numbers are normalized
+// so 2 and 2.0 are the same object, like they are in mongo.
+func objKey(obj interface{}) string {
+	switch o := obj.(type) {
+	case nil:
+		return ""
+	case string:
+		return "s:" + o
+	case bool:
+		return "b:" + strconv.FormatBool(o)
+	}
+	if f, ok := toFloat(obj); ok {
+		return "n:" + strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%T:%v", obj, obj)
+}
+
+// toFloat converts any numeric type to a float64.
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// tripleKey is the unique key of a triple within a graph.
+func tripleKey(sub, pred string, obj interface{}) string {
+	return strconv.Quote(sub) + strconv.Quote(pred) + objKey(obj)
+}
+
+// compareValues orders values, numbers sort before strings and
+// strings before anything else.
+func compareValues(l, r interface{}) int {
+	if c, ok := compareObjects(l, r); ok {
+		return c
+	}
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(r)
+	switch {
+	case lok && rok:
+		switch {
+		case lf < rf:
+			return -1
+		case lf > rf:
+			return 1
+		}
+		return 0
+	case lok:
+		return -1
+	case rok:
+		return 1
+	}
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	switch {
+	case lok && rok:
+		return strings.Compare(ls, rs)
+	case lok:
+		return -1
+	case rok:
+		return 1
+	}
+	return strings.Compare(fmt.Sprintf("%v", l), fmt.Sprintf("%v", r))
+}
+
+// sortTriples sorts triples by orderBy which is one of s, p, o and
+// may be prefixed with - for descending.
+func sortTriples(triples []*Triple, orderBy string) {
+	if orderBy == "" {
+		return
+	}
+	asc := true
+	if strings.HasPrefix(orderBy, "-") {
+		asc = false
+		orderBy = orderBy[1:]
+	}
+	pos := 0
+	switch orderBy {
+	case "s":
+		pos = 0
+	case "p":
+		pos = 1
+	case "o":
+		pos = 2
+	default:
+		return
+	}
+	sort.SliceStable(triples, func(i, j int) bool {
+		c := compareValues(triples[i][pos], triples[j][pos])
+		if asc {
+			return c < 0
+		}
+		return c > 0
+	})
+}
+
+// limitTriples applies options offset and limit to a set of triples.
+// Like mongo, an offset without an orderby sorts by subject.
+func limitTriples(triples []*Triple, options *Options) []*Triple {
+	if options == nil {
+		return triples
+	}
+	orderBy := options.OrderBy
+	if orderBy == "" && options.Offset != 0 {
+		orderBy = "s"
+	}
+	sortTriples(triples, orderBy)
+	if options.Offset != 0 {
+		if int(options.Offset) >= len(triples) {
+			return []*Triple{}
+		}
+		triples = triples[options.Offset:]
+	}
+	if options.Limit != 0 && int(options.Limit) < len(triples) {
+		triples = triples[:options.Limit]
+	}
+	return triples
+}
+
+// matchOverrides checks a triple against query overrides.
+func matchOverrides(triple *Triple, overrides *Overrides) bool {
+	if overrides == nil {
+		return true
+	}
+	if len(overrides.Subs) > 0 {
+		found := false
+		for _, s := range overrides.Subs {
+			if triple[0] == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(overrides.Preds) > 0 {
+		found := false
+		for _, p := range overrides.Preds {
+			if triple[1] == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(overrides.Objs) > 0 {
+		found := false
+		key := objKey(triple[2])
+		for _, o := range overrides.Objs {
+			if objKey(o) == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GraphsList returns a list of created graphs.
+func (m *Memory) GraphsList() []string {
+	m.muGraph.Lock()
+	defer m.muGraph.Unlock()
+
+	graphs := []string{}
+	for k, _ := range m.Graphs {
+		graphs = append(graphs, k)
+	}
+	return graphs
+}
+
+// Graph returns the internal graph given a name.
+func (m *Memory) Graph(name string) (*Graph, bool) {
+	m.muGraph.Lock()
+	defer m.muGraph.Unlock()
+	g, ok := m.Graphs[name]
+	if ok {
+		return g.Graph, true
+	}
+	return nil, false
+}
+
+// memGraph returns the memory graph given a name.
+func (m *Memory) memGraph(name string) (*MemoryGraph, bool) {
+	m.muGraph.Lock()
+	defer m.muGraph.Unlock()
+	g, ok := m.Graphs[name]
+	return g, ok
+}
+
+// Create adds a graph
+func (m *Memory) Create(name string) (*Graph, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	m.muGraph.Lock()
+	defer m.muGraph.Unlock()
+
+	// Check if graph already exists
+	g, ok := m.Graphs[name]
+	if ok {
+		return g.Graph, nil
+	}
+
+	graph, err := NewGraph(name, m)
+	if err != nil {
+		return nil, err
+	}
+	mg := &MemoryGraph{Graph: graph}
+	mg.reset()
+	m.Graphs[name] = mg
+	return graph, nil
+}
+
+// Connect noop
+func (m *Memory) Connect(hosts string) {
+}
+
+// Drop removes all triples and indexes of a graph. Like mongo the graph
+// itself stays loaded and can be written to again.
+func (m *Memory) Drop(gid string) error {
+	g, ok := m.memGraph(gid)
+	if !ok {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reset()
+	return nil
+}
+
+// Index noop, indexes are kept up to date on write.
+func (m *Memory) Index(gid string, background bool) error {
+	return nil
+}
+
+// AddBulk inserts triples skipping invalid ones and returns the number inserted.
+func (m *Memory) AddBulk(graph string, triples []*Triple) (int, error) {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return 0, fmt.Errorf("graph not found %s", graph)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	total := 0
+	for _, tr := range triples {
+		if tr == nil {
+			continue
+		}
+		sub, ok := tr[0].(string)
+		if !ok || sub == "" {
+			continue
+		}
+		pred, ok := tr[1].(string)
+		if !ok || pred == "" {
+			continue
+		}
+		if isEmpty(tr[2]) {
+			continue
+		}
+		if g.add(sub, pred, tr[2]) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// Add inserts a single triple, duplicates are ignored.
+func (m *Memory) Add(graph, sub, pred string, obj interface{}) error {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	if graph == "" || sub == "" || pred == "" || isEmpty(obj) {
+		return fmt.Errorf("missing components graph:%s sub:%s pred:%s obj:%s", graph, sub, pred, obj)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.add(sub, pred, obj)
+	return nil
+}
+
+// RemoveBulk removes each triple, empty items match everything.
+func (m *Memory) RemoveBulk(graph string, triples []*Triple) error {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, tr := range triples {
+		if tr == nil {
+			continue
+		}
+		if sub, ok := tr[0].(string); ok {
+			if pred, ok := tr[1].(string); ok {
+				for _, key := range g.match(sub, pred, tr[2]) {
+					g.remove(key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Transact applies the operations of a transaction under the lock of the
+// graph, see TxDriver.
+func (m *Memory) Transact(graph string, ops []*TxOp) ([]*Triple, []*Triple, error) {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return nil, nil, fmt.Errorf("graph not found %s", graph)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	added, removed, err := planTx(ops, func(sub, pred string, obj interface{}) ([]*Triple, error) {
+		return g.find(sub, pred, obj, nil), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, tr := range removed {
+		sub, pred, _ := SubPred(tr[0], tr[1])
+		g.remove(tripleKey(sub, pred, tr[2]))
+	}
+	for _, tr := range added {
+		sub, pred, _ := SubPred(tr[0], tr[1])
+		g.add(sub, pred, tr[2])
+	}
+	return added, removed, nil
+}
+
+// RemoveAll clears out all triples in a graph.
+func (m *Memory) RemoveAll(graph string) error {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reset()
+	return nil
+}
+
+// Remove removes set of triples from a graph depending on the given sub, pred, obj.
+func (m *Memory) Remove(graph, sub, pred string, obj interface{}) error {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range g.match(sub, pred, obj) {
+		g.remove(key)
+	}
+	return nil
+}
+
+// Count returns the number of triples matching sub, pred, obj.
+func (m *Memory) Count(graph, sub, pred string, obj interface{}) (uint, error) {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return 0, fmt.Errorf("missing graph %s", graph)
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return uint(len(g.match(sub, pred, obj))), nil
+}
+
+// Triples returns triples matching sub, pred, obj and the given options.
+func (m *Memory) Triples(graph, sub, pred string, obj interface{}, options *Options) TripleIter {
+	g, ok := m.memGraph(graph)
+	if !ok {
+		return errIter(fmt.Errorf("missing graph %s", graph))
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return newSliceIter(g.find(sub, pred, obj, options))
+}
+
+// Pinger noop
+func (m *Memory) Pinger() {
+}
+
+// Close noop
+func (m *Memory) Close() {
+}
+
+// reset clears all triples and indexes, the caller must hold the lock.
+func (g *MemoryGraph) reset() {
+	g.triples = map[string]*memTriple{}
+	g.subs = map[string]map[string]struct{}{}
+	g.preds = map[string]map[string]struct{}{}
+	g.objs = map[string]map[string]struct{}{}
+	g.subPreds = map[string]map[string]struct{}{}
+	g.subObjs = map[string]map[string]struct{}{}
+	g.predObjs = map[string]map[string]struct{}{}
+}
+
+// pairKey is the key for the two item indexes sp, so and po.
+func pairKey(a, b string) string {
+	return strconv.Quote(a) + b
+}
+
+// add stores a triple and returns false if it already existed.
+func (g *MemoryGraph) add(sub, pred string, obj interface{}) bool {
+	key := tripleKey(sub, pred, obj)
+	if _, ok := g.triples[key]; ok {
+		return false
+	}
+	g.seq++
+	g.triples[key] = &memTriple{seq: g.seq, triple: &Triple{sub, pred, obj}}
+	oKey := objKey(obj)
+	indexAdd(g.subs, sub, key)
+	indexAdd(g.preds, pred, key)
+	indexAdd(g.objs, oKey, key)
+	indexAdd(g.subPreds, pairKey(sub, pred), key)
+	indexAdd(g.subObjs, pairKey(sub, oKey), key)
+	indexAdd(g.predObjs, pairKey(pred, oKey), key)
+	return true
+}
+
+// remove deletes a triple by key.
+func (g *MemoryGraph) remove(key string) {
+	mt, ok := g.triples[key]
+	if !ok {
+		return
+	}
+	delete(g.triples, key)
+	sub, pred, _ := SubPred(mt.triple[0], mt.triple[1])
+	oKey := objKey(mt.triple[2])
+	indexRemove(g.subs, sub, key)
+	indexRemove(g.preds, pred, key)
+	indexRemove(g.objs, oKey, key)
+	indexRemove(g.subPreds, pairKey(sub, pred), key)
+	indexRemove(g.subObjs, pairKey(sub, oKey), key)
+	indexRemove(g.predObjs, pairKey(pred, oKey), key)
+}
+
+// match returns the keys of every triple matching sub, pred, obj, empty
+// values match everything. The most specific index is used.
+func (g *MemoryGraph) match(sub, pred string, obj interface{}) []string {
+	sEmpty := isEmpty(sub)
+	pEmpty := isEmpty(pred)
+	oEmpty := isEmpty(obj)
+	oKey := objKey(obj)
+
+	if sEmpty && pEmpty && oEmpty {
+		// nil nil nil
+		keys := make([]string, 0, len(g.triples))
+		for key, _ := range g.triples {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	var candidates map[string]struct{}
+	switch {
+	case !sEmpty && !pEmpty && !oEmpty:
+		// sub pred obj
+		keys := []string{}
+		key := tripleKey(sub, pred, obj)
+		if _, ok := g.triples[key]; ok {
+			keys = append(keys, key)
+		}
+		return keys
+	case !sEmpty && !pEmpty:
+		// sub pred nil
+		candidates = g.subPreds[pairKey(sub, pred)]
+	case !sEmpty && !oEmpty:
+		// sub nil obj
+		candidates = g.subObjs[pairKey(sub, oKey)]
+	case !pEmpty && !oEmpty:
+		// nil pred obj
+		candidates = g.predObjs[pairKey(pred, oKey)]
+	case !sEmpty:
+		// sub nil nil
+		candidates = g.subs[sub]
+	case !pEmpty:
+		// nil pred nil
+		candidates = g.preds[pred]
+	case !oEmpty:
+		// nil nil obj
+		candidates = g.objs[oKey]
+	}
+	keys := make([]string, 0, len(candidates))
+	for key, _ := range candidates {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// find returns copies of the triples matching sub, pred, obj and options
+// in insertion order, the caller must hold the read lock.
+func (g *MemoryGraph) find(sub, pred string, obj interface{}, options *Options) []*Triple {
+	keys := g.match(sub, pred, obj)
+	var overrides *Overrides
+	if options != nil {
+		overrides = options.TripleOverrides
+	}
+	stored := make([]*memTriple, 0, len(keys))
+	for _, key := range keys {
+		mt := g.triples[key]
+		if !matchOverrides(mt.triple, overrides) {
+			continue
+		}
+		stored = append(stored, mt)
+	}
+
+	sort.Slice(stored, func(i, j int) bool { return stored[i].seq < stored[j].seq })
+	results := make([]*Triple, len(stored))
+	for i, mt := range stored {
+		tr := *mt.triple
+		results[i] = &tr
+	}
+	return limitTriples(results, options)
+}
+
+// indexAdd adds a triple key to an index.
+func indexAdd(index map[string]map[string]struct{}, item, key string) {
+	set, ok := index[item]
+	if !ok {
+		set = map[string]struct{}{}
+		index[item] = set
+	}
+	set[key] = struct{}{}
+}
+
+// indexRemove removes a triple key from an index.
+func indexRemove(index map[string]map[string]struct{}, item, key string) {
+	set, ok := index[item]
+	if !ok {
+		return
+	}
+	delete(set, key)
+	if len(set) == 0 {
+		delete(index, item)
+	}
+}
@@ -0,0 +1,209 @@
+package pfftdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestMemory(t *testing.T) *Memory {
+	m, err := NewMemory([]string{TESTGRAPH, TESTGRAPH2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMemoryGraph(t *testing.T) {
+	m := newTestMemory(t)
+	_, ok := m.Graph(TESTGRAPH)
+	if !ok {
+		t.Fatal("failed to get graph")
+	}
+	if len(m.GraphsList()) != 2 {
+		t.Error("should have 2 graphs got ", m.GraphsList())
+	}
+}
+
+func TestObjKey(t *testing.T) {
+	if objKey(2) != objKey(2.0) {
+		t.Error("2 and 2.0 should be the same object")
+	}
+	if objKey("2") == objKey(2) {
+		t.Error("\"2\" and 2 should not be the same object")
+	}
+}
+
+func TestMemoryAddBulk(t *testing.T) {
+	m := newTestMemory(t)
+
+	data := []*Triple{
+		&Triple{"a", "b", "c"},
+		&Triple{"a", "b", "d"},
+		&Triple{"a", "c", "d"},
+		&Triple{"a", "c", "d"},
+		&Triple{"a", "", "d"},
+		nil,
+	}
+	total, err := m.AddBulk(TESTGRAPH, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Error("should have inserted 3 got:", total)
+	}
+
+	triples, _ := ReadTriples(m.Triples(TESTGRAPH, "", "", nil, nil))
+	if len(triples) != 3 {
+		t.Error("didn't get 3 triples, got:", len(triples))
+	}
+
+	_, err = m.AddBulk("missing", data)
+	if err == nil {
+		t.Error("should have gotten error, missing graph")
+	}
+}
+
+func TestMemoryAdd(t *testing.T) {
+	m := newTestMemory(t)
+
+	m.Add(TESTGRAPH, "a", "b", "c")
+	m.Add(TESTGRAPH, "a", "b", 2)
+	m.Add(TESTGRAPH, "a", "b", 2.0)
+	m.Add(TESTGRAPH, "m", "n", "p")
+
+	err := m.Add(TESTGRAPH, "m", "n", "") // should fail
+	if err == nil {
+		t.Fatal("should have gotten error")
+	}
+
+	count, _ := m.Count(TESTGRAPH, "", "", nil)
+	if count != 3 {
+		t.Error("add failed should have 3 triples but got ", count)
+	}
+
+	err = m.Add("", "m", "n", "o") // should fail
+	if err == nil {
+		t.Fatal("should have gotten error, missing graph")
+	}
+}
+
+func TestMemoryRemove(t *testing.T) {
+	m := newTestMemory(t)
+
+	m.Add(TESTGRAPH, "a", "b", "c")
+	m.Add(TESTGRAPH, "a", "b", 2)
+	m.Add(TESTGRAPH, "a", "b", 9.0)
+	m.Add(TESTGRAPH, "m", "n", "p")
+	m.Add(TESTGRAPH, "m", "n", 2)
+	m.Add(TESTGRAPH, "x", "y", "z")
+	m.Add(TESTGRAPH, "xx", "yy", "zz")
+	m.Add(TESTGRAPH2, "xx", "yy", "zz")
+
+	m.Remove(TESTGRAPH, "a", "", 2)
+	if c, _ := m.Count(TESTGRAPH, "", "", nil); c != 6 {
+		t.Error("remove failed should be 6 got ", c)
+	}
+
+	m.Remove(TESTGRAPH, "a", "", nil)
+	if c, _ := m.Count(TESTGRAPH, "", "", nil); c != 4 {
+		t.Error("remove failed should be 4 got ", c)
+	}
+
+	m.RemoveBulk(TESTGRAPH, []*Triple{&Triple{"", "n", nil}})
+	if c, _ := m.Count(TESTGRAPH, "", "", nil); c != 2 {
+		t.Error("remove bulk failed should be 2 got ", c)
+	}
+
+	m.Remove(TESTGRAPH, "", "", nil)
+	if c, _ := m.Count(TESTGRAPH, "", "", nil); c != 0 {
+		t.Error("remove failed should be 0 got ", c)
+	}
+	if c, _ := m.Count(TESTGRAPH2, "", "", nil); c != 1 {
+		t.Error("other graph should be untouched got ", c)
+	}
+
+	err := m.Remove("", "m", "n", "")
+	if err == nil {
+		t.Fatal("should have gotten error, missing graph")
+	}
+}
+
+func TestMemoryTriples(t *testing.T) {
+	m := newTestMemory(t)
+
+	m.Add(TESTGRAPH, "m", "n", "p")
+	m.Add(TESTGRAPH, "a", "b", "c")
+	m.Add(TESTGRAPH, "m", "n", 2)
+	m.Add(TESTGRAPH, "m", "n", 3)
+	m.Add(TESTGRAPH, "m", "y", 3)
+
+	var tests = []struct {
+		s, p string
+		o    interface{}
+		out  int
+	}{
+		{"", "", nil, 5},
+		{"m", "", nil, 4},
+		{"m", "n", nil, 3},
+		{"m", "", 2, 1},
+		{"m", "n", 2, 1},
+		{"", "n", 2, 1},
+		{"", "", 3, 2},
+		{"", "", 3.0, 2},
+		{"", "", "3", 0},
+	}
+	for i, tt := range tests {
+		triples, _ := ReadTriples(m.Triples(TESTGRAPH, tt.s, tt.p, tt.o, nil))
+		if len(triples) != tt.out {
+			t.Errorf("%d %s-%s-%v should be %d got %d", i, tt.s, tt.p, tt.o, tt.out, len(triples))
+		}
+	}
+
+	triples, _ := ReadTriples(m.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "s"}))
+	if triples[0][0] != "a" {
+		t.Error("sort failed", triples[0])
+	}
+	triples, _ = ReadTriples(m.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "-s"}))
+	if triples[0][0] != "m" {
+		t.Error("sort failed", triples[0])
+	}
+
+	triples, _ = ReadTriples(m.Triples(TESTGRAPH, "", "", nil, &Options{Limit: 1}))
+	if len(triples) != 1 {
+		t.Fatal("didn't get 1 triples with limit, got:", len(triples))
+	}
+	triplesSkip, _ := ReadTriples(m.Triples(TESTGRAPH, "", "", nil, &Options{Limit: 1, Offset: 2}))
+	if len(triplesSkip) != 1 {
+		t.Error("didn't get 1 triples with limit and skip, got:", len(triplesSkip))
+	}
+	if reflect.DeepEqual(triples, triplesSkip) {
+		t.Error("skip failed", triples, triplesSkip)
+	}
+
+	opts := &Options{TripleOverrides: &Overrides{Objs: []interface{}{2, "p"}}}
+	triples, _ = ReadTriples(m.Triples(TESTGRAPH, "m", "", nil, opts))
+	if len(triples) != 2 {
+		t.Error("overrides failed should be 2 got ", len(triples))
+	}
+
+	if _, err := ReadTriples(m.Triples("", "", "", nil, nil)); err == nil {
+		t.Error("should have gotten an error, missing graph")
+	}
+}
+
+func TestMemoryDrop(t *testing.T) {
+	m := newTestMemory(t)
+
+	m.Add(TESTGRAPH, "a", "b", "c")
+	err := m.Drop(TESTGRAPH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := m.Count(TESTGRAPH, "", "", nil); c != 0 {
+		t.Error("drop failed should be 0 got ", c)
+	}
+	err = m.Add(TESTGRAPH, "a", "b", "c")
+	if err != nil {
+		t.Error("graph should still be writable after drop", err)
+	}
+}
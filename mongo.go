@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"strings"
 	//lg "log"
 	//"os"
 	"sync"
@@ -22,6 +23,32 @@ func isEmpty(val interface{}) bool {
 	return false
 }
 
+// mongoObject converts an object to its stored form. Literals are sub
+// documents with a fixed field order so equal literals match.
+func mongoObject(obj interface{}) interface{} {
+	if l, ok := obj.(Literal); ok {
+		return bson.D{
+			bson.DocElem{Name: "v", Value: l.Value},
+			bson.DocElem{Name: "l", Value: l.Lang},
+			bson.DocElem{Name: "d", Value: l.Datatype},
+		}
+	}
+	return obj
+}
+
+// mongoValue converts a stored object back to an object.
+func mongoValue(obj interface{}) interface{} {
+	if m, ok := obj.(bson.M); ok && len(m) == 3 {
+		v, vok := m["v"].(string)
+		l, lok := m["l"].(string)
+		d, dok := m["d"].(string)
+		if vok && lok && dok {
+			return Literal{Value: v, Lang: l, Datatype: d}
+		}
+	}
+	return obj
+}
+
 // MongoGraph
 type MongoGraph struct {
 	Graph   *Graph
@@ -216,10 +243,36 @@ func (m *Mongo) Index(gid string, background bool) error {
 	return nil
 }
 
-// Create adds a graph
+// Create adds a graph. A graph with a journal is recovered once it is
+// added, see Graph.recoverTx.
 func (m *Mongo) Create(name string) (*Graph, error) {
+	g, created, err := m.create(name)
+	if err != nil {
+		return nil, err
+	}
+	if !created || strings.HasSuffix(name, JournalGraphSuffix) {
+		return g, nil
+	}
+	sessionCopy := m.Session.Copy()
+	defer sessionCopy.Close()
+	n, err := sessionCopy.DB(m.DBName).C(name + JournalGraphSuffix).Count()
+	if err != nil || n == 0 {
+		return g, err
+	}
+	if _, _, err := m.create(name + JournalGraphSuffix); err != nil {
+		return nil, err
+	}
+	if err := g.recoverTx(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return g, nil
+}
+
+// create adds a graph unless it exists and reports whether it added it.
+func (m *Mongo) create(name string) (*Graph, bool, error) {
 	if name == "" {
-		return nil, fmt.Errorf("missing name")
+		return nil, false, fmt.Errorf("missing name")
 	}
 	m.muGraph.Lock()
 	defer m.muGraph.Unlock()
@@ -227,13 +280,13 @@ func (m *Mongo) Create(name string) (*Graph, error) {
 	// Check if graph already exists
 	g, ok := m.Graphs[name]
 	if ok {
-		return g.Graph, nil
+		return g.Graph, false, nil
 	}
 
 	err := m.Index(name, true)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, false, err
 	}
 
 	m.Graphs[name] = &MongoGraph{}
@@ -241,10 +294,10 @@ func (m *Mongo) Create(name string) (*Graph, error) {
 	if err != nil {
 		log.Error(err)
 		delete(m.Graphs, name)
-		return nil, err
+		return nil, false, err
 	}
 	m.Graphs[name].ColName = name
-	return m.Graphs[name].Graph, nil
+	return m.Graphs[name].Graph, true, nil
 }
 
 // Connect establishes a database connection.
@@ -271,10 +324,11 @@ func (m *Mongo) Connect(hosts string) {
 }
 
 // AddBulk bulk inserts documents. It removes invalid ones and returns the number inserted.
-// This has inconsistency issues with inserting bulk and error handling because of mongo.
-// If a bulk insert fails mongo stops, the driver doesnt currently support continue on error.
-// if the err is EOF there is no way to know the number of documents inserted, so the total
-// returned may be zero, but there may have still been inserts......
+// If a bulk insert fails mongo stops, the driver doesnt currently support continue on error,
+// so the documents are upserted one by one and the new ones counted, with the ones the bulk
+// insert wrote before it failed. If the err is EOF there
+// is no way to know the number of documents inserted, so the total returned may be zero,
+// but there may have still been inserts......
 func (m *Mongo) AddBulk(graph string, triples []*Triple) (int, error) {
 	g, ok := m.Graphs[graph]
 	if !ok {
@@ -300,72 +354,49 @@ func (m *Mongo) AddBulk(graph string, triples []*Triple) (int, error) {
 		if isEmpty(tr[2]) {
 			continue
 		}
-		tripleDocs = append(tripleDocs, bson.M{"g": graph, "s": tr[0], "p": tr[1], "o": tr[2]})
+		tripleDocs = append(tripleDocs, bson.M{"g": graph, "s": tr[0], "p": tr[1], "o": mongoObject(tr[2])})
 	}
-
-	// TODO go back to bulk insert when continueOnError added to Insert in mgo driver
-	total := len(tripleDocs)
-	if total == 0 {
+	if len(tripleDocs) == 0 {
 		return 0, nil
 	}
-	var err error
 
+	// TODO go back to bulk insert when continueOnError added to Insert in mgo driver
 	// mongo has a maxMessageSizeBytes, so split up if docs too large.
 	// tries bulk insert, then if err occurs does individual inserts.
-	if total > 10000 {
-		start := 0
-		const inc = 10000
-		for start < total {
-			if start+inc > total {
-				// finish off remainder
-				err = col.Insert(tripleDocs[start:]...)
-				if err == io.EOF {
-					return 0, err
-				}
-
-				if err != nil {
-					for _, t := range tripleDocs[start:] {
-						err = col.Insert(t)
-						if err != nil {
-							total--
-						}
-					}
-				}
-				break
-			}
-			err = col.Insert(tripleDocs[start : start+inc]...)
-			if err == io.EOF {
-				return 0, err
-			}
-
-			if err != nil {
-				for _, t := range tripleDocs[start : start+inc] {
-					err = col.Insert(t)
-					if err != nil {
-						total--
-					}
-				}
-			}
-			start += inc
+	const inc = 10000
+	total := 0
+	var lastErr error
+	for start := 0; start < len(tripleDocs); start += inc {
+		end := start + inc
+		if end > len(tripleDocs) {
+			end = len(tripleDocs)
 		}
-	} else if total > 0 {
-		err = col.Insert(tripleDocs...)
-		if err != nil {
-			for _, t := range tripleDocs {
-				err = col.Insert(t)
-				total--
-			}
+		err := col.Insert(tripleDocs[start:end]...)
+		if err == nil {
+			total += end - start
+			continue
 		}
-	}
-	if err != nil {
-		errStr := err.Error()
-		// ignore duplicate key error
-		if len(errStr) > 6 && errStr[:6] == "E11000" {
-			return total, nil
+		if err == io.EOF {
+			return total, err
+		}
+		// the ordered insert stored the documents before the duplicate,
+		// upsert them all and count the new ones
+		for _, t := range tripleDocs[start:end] {
+			info, err := col.Upsert(t, t)
+			switch {
+			case err == nil:
+				if info.UpsertedId != nil {
+					total++
+				}
+			case err == io.EOF:
+				return total, err
+			default:
+				log.Error(err)
+				lastErr = err
+			}
 		}
-		log.Error(err)
 	}
-	return total, err
+	return total, lastErr
 }
 
 // Add upserts a triple with the given graph ID. Currently not in use, AddBulk instead.
@@ -382,7 +413,7 @@ func (m *Mongo) Add(graph, sub, pred string, obj interface{}) error {
 		return fmt.Errorf("missing components graph:%s sub:%s pred:%s obj:%s", graph, sub, pred, obj)
 	}
 
-	trDoc := bson.M{"g": graph, "s": sub, "p": pred, "o": obj}
+	trDoc := bson.M{"g": graph, "s": sub, "p": pred, "o": mongoObject(obj)}
 	_, err := col.Upsert(trDoc, trDoc)
 	if err != nil {
 		log.Error(err)
@@ -454,6 +485,7 @@ func (m *Mongo) Remove(graph, sub, pred string, obj interface{}) error {
 	sEmpty := isEmpty(sub)
 	pEmpty := isEmpty(pred)
 	oEmpty := isEmpty(obj)
+	obj = mongoObject(obj)
 
 	// TODO move switches to most likely order.
 	switch {
@@ -506,6 +538,7 @@ func (m *Mongo) BuildQuery(graph, sub, pred string, obj interface{}, overrides *
 	sEmpty := isEmpty(sub)
 	pEmpty := isEmpty(pred)
 	oEmpty := isEmpty(obj)
+	obj = mongoObject(obj)
 
 	switch {
 	case graph == "":
@@ -547,21 +580,54 @@ func (m *Mongo) BuildQuery(graph, sub, pred string, obj interface{}, overrides *
 			query["p"] = bson.M{"$in": overrides.Preds}
 		}
 		if len(overrides.Objs) > 0 {
-			query["o"] = bson.M{"$in": overrides.Objs}
+			objs := make([]interface{}, len(overrides.Objs))
+			for i, o := range overrides.Objs {
+				objs[i] = mongoObject(o)
+			}
+			query["o"] = bson.M{"$in": objs}
 		}
 	}
 	return query
 }
 
-// Triples
-func (m *Mongo) Triples(graph, sub, pred string, obj interface{}, options *Options) []*Triple {
+// mongoIter reads triple docs from a mongo cursor, the session copy is
+// closed with it.
+type mongoIter struct {
+	iter    *mgo.Iter
+	session *mgo.Session
+}
+
+// Next decodes the next triple doc.
+func (it *mongoIter) Next() (*Triple, bool) {
+	doc := TripleDoc{}
+	if !it.iter.Next(&doc) {
+		return nil, false
+	}
+	return &Triple{doc.Sub, doc.Pred, mongoValue(doc.Obj)}, true
+}
+
+// Err returns the cursor error.
+func (it *mongoIter) Err() error {
+	return it.iter.Err()
+}
+
+// Close closes the cursor and the session copy.
+func (it *mongoIter) Close() error {
+	err := it.iter.Close()
+	if it.session != nil {
+		it.session.Close()
+		it.session = nil
+	}
+	return err
+}
+
+// Triples iterates over the matching triple docs without loading them all.
+func (m *Mongo) Triples(graph, sub, pred string, obj interface{}, options *Options) TripleIter {
 	g, ok := m.Graphs[graph]
 	if !ok {
-		log.Error("missing graph ", graph)
-		return nil
+		return errIter(fmt.Errorf("missing graph %s", graph))
 	}
 	sessionCopy := m.Session.Copy()
-	defer sessionCopy.Close()
 	col := sessionCopy.DB(m.DBName).C(g.ColName)
 
 	var query bson.M
@@ -606,18 +672,7 @@ func (m *Mongo) Triples(graph, sub, pred string, obj interface{}, options *Optio
 		iter = col.Find(query).Sort(options.OrderBy).Iter()
 	}
 
-	tripleDocs := []*TripleDoc{}
-	err := iter.All(&tripleDocs)
-	if err != nil {
-		log.Error(err)
-		return nil
-	}
-	results := []*Triple{}
-	for _, res := range tripleDocs {
-		results = append(results, &Triple{res.Sub, res.Pred, res.Obj})
-	}
-
-	return results
+	return &mongoIter{iter: iter, session: sessionCopy}
 }
 
 // Pinger checks for connection loss. It starts at a random
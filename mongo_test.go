@@ -7,7 +7,7 @@ import (
 	"testing"
 
 	"labix.org/v2/mgo"
-	//"labix.org/v2/mgo/bson"
+	"labix.org/v2/mgo/bson"
 )
 
 var (
@@ -19,6 +19,9 @@ var (
 )
 
 func init() {
+	if dbType != "mongo" {
+		return
+	}
 	var err error
 	dbpath := os.Getenv("DBPATH")
 	if dbpath != "" {
@@ -37,7 +40,15 @@ func init() {
 	cleanupMongo()
 }
 
+// skipMongo skips tests that need a live mongod.
+func skipMongo(t *testing.T) {
+	if dbType != "mongo" {
+		t.Skip("DBTYPE is not mongo")
+	}
+}
+
 func TestGraph(t *testing.T) {
+	skipMongo(t)
 	_, ok := MONGO.Graph(TESTGRAPH)
 	if !ok {
 		t.Fatal("failed to get graph")
@@ -78,6 +89,7 @@ func TestMongoIndex(t *testing.T) {
 }
 
 func TestMongoRemoveAll(t *testing.T) {
+	skipMongo(t)
 	//cleanupGraph()
 	//defer cleanupGraph()
 
@@ -113,6 +125,7 @@ func TestMongoRemoveAll(t *testing.T) {
 }
 
 func TestMongoAddBulkLarge(t *testing.T) {
+	skipMongo(t)
 	cleanupGraph()
 	defer cleanupGraph()
 
@@ -138,6 +151,7 @@ func TestMongoAddBulkLarge(t *testing.T) {
 }
 
 func TestMongoRemoveBulkLarge(t *testing.T) {
+	skipMongo(t)
 	cleanupGraph()
 	defer cleanupGraph()
 
@@ -159,6 +173,7 @@ func TestMongoRemoveBulkLarge(t *testing.T) {
 }
 
 func TestMongoAddBulk(t *testing.T) {
+	skipMongo(t)
 	cleanupMongo()
 	defer cleanupMongo()
 
@@ -170,7 +185,7 @@ func TestMongoAddBulk(t *testing.T) {
 	}
 	MONGO.AddBulk(TESTGRAPH, data)
 
-	triples := MONGO.Triples(TESTGRAPH, "", "", nil, nil)
+	triples, _ := ReadTriples(MONGO.Triples(TESTGRAPH, "", "", nil, nil))
 	if len(triples) != 3 {
 		t.Error("didn't get 3 triples, got:", len(triples))
 		for _, tr := range triples {
@@ -186,7 +201,7 @@ func TestMongoAddBulk(t *testing.T) {
 		&Triple{"a", "c", "d"},
 	}
 	MONGO.AddBulk(TESTGRAPH, data)
-	triples = MONGO.Triples(TESTGRAPH, "", "", nil, nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", nil, nil))
 	if len(triples) != 4 {
 		t.Error("didn't get 4 triples, got:", len(triples))
 		for _, tr := range triples {
@@ -195,7 +210,32 @@ func TestMongoAddBulk(t *testing.T) {
 	}
 }
 
+func TestMongoAddBulkExisting(t *testing.T) {
+	skipMongo(t)
+	cleanupMongo()
+	defer cleanupMongo()
+
+	MONGO.Add(TESTGRAPH, "a", "b", "c")
+	// the existing triple fails the batch after the first new one
+	data := []*Triple{
+		&Triple{"x", "y", "z"},
+		&Triple{"a", "b", "c"},
+		&Triple{"x", "y", "w"},
+	}
+	total, err := MONGO.AddBulk(TESTGRAPH, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Error("should have inserted 2 got:", total)
+	}
+	if c, _ := MONGO.Count(TESTGRAPH, "", "", nil); c != 3 {
+		t.Error("should have 3 triples got:", c)
+	}
+}
+
 func TestMongoAdd(t *testing.T) {
+	skipMongo(t)
 	cleanupMongo()
 	defer cleanupMongo()
 
@@ -225,6 +265,7 @@ func TestMongoAdd(t *testing.T) {
 }
 
 func TestMongoRemoveBulk(t *testing.T) {
+	skipMongo(t)
 	cleanupMongo()
 	defer cleanupMongo()
 
@@ -245,10 +286,11 @@ func TestMongoRemoveBulk(t *testing.T) {
 }
 
 func TestMongoRemove(t *testing.T) {
+	skipMongo(t)
 	cleanupMongo()
 	defer cleanupMongo()
 
-	triples := MONGO.Triples(TESTGRAPH, "", "", "", nil)
+	triples, _ := ReadTriples(MONGO.Triples(TESTGRAPH, "", "", "", nil))
 	if len(triples) != 0 {
 		t.Error("should start with zero items, got: ", len(triples))
 	}
@@ -266,21 +308,21 @@ func TestMongoRemove(t *testing.T) {
 
 	// remove single item
 	MONGO.Remove(TESTGRAPH, "a", "", 2)
-	triples = MONGO.Triples(TESTGRAPH, "", "", "", nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", "", nil))
 	if len(triples) != 6 {
 		t.Error("remove failed should be 6 got ", len(triples))
 	}
 
 	// remove all sub
 	MONGO.Remove(TESTGRAPH, "a", "", nil)
-	triples = MONGO.Triples(TESTGRAPH, "", "", "", nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", "", nil))
 	if len(triples) != 4 {
 		t.Error("remove failed should be 4 got ", len(triples))
 	}
 
 	// remove all items from graph
 	MONGO.Remove(TESTGRAPH, "", "", nil)
-	triples = MONGO.Triples(TESTGRAPH, "", "", "", nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", "", nil))
 	if len(triples) != 0 {
 		t.Error("remove failed should be 0 got ", len(triples))
 	}
@@ -293,6 +335,7 @@ func TestMongoRemove(t *testing.T) {
 }
 
 func TestMongoTriples(t *testing.T) {
+	skipMongo(t)
 	cleanupMongo()
 	defer cleanupMongo()
 
@@ -304,29 +347,29 @@ func TestMongoTriples(t *testing.T) {
 
 	// all graph triples
 	// nil nil nil
-	triples := MONGO.Triples(TESTGRAPH, "", "", nil, nil)
+	triples, _ := ReadTriples(MONGO.Triples(TESTGRAPH, "", "", nil, nil))
 	if len(triples) != 5 {
 		t.Fatal("didn't get 5 triples, got:", len(triples))
 	}
 
 	// Test sort
-	triples = MONGO.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "s"})
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "s"}))
 	if triples[0][0] != "a" {
 		t.Error("sort failed")
 	}
 
-	triples = MONGO.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "-s"})
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", nil, &Options{OrderBy: "-s"}))
 	if triples[0][0] != "m" {
 		t.Error("sort failed")
 	}
 
 	// Test limit
-	triples = MONGO.Triples(TESTGRAPH, "", "", nil, &Options{Limit: 1})
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", nil, &Options{Limit: 1}))
 	if len(triples) != 1 {
 		t.Fatal("didn't get 1 triples with limit, got:", len(triples))
 	}
 
-	triplesSkip := MONGO.Triples(TESTGRAPH, "", "", nil, &Options{Limit: 1, Offset: 2})
+	triplesSkip, _ := ReadTriples(MONGO.Triples(TESTGRAPH, "", "", nil, &Options{Limit: 1, Offset: 2}))
 	if len(triplesSkip) != 1 {
 		t.Error("didn't get 1 triples with limit and skip of 1, got:", len(triplesSkip))
 	}
@@ -337,43 +380,43 @@ func TestMongoTriples(t *testing.T) {
 	}
 
 	// sub nil nil
-	triples = MONGO.Triples(TESTGRAPH, "m", "", nil, nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "m", "", nil, nil))
 	if len(triples) != 4 {
 		t.Error("didn't get 4 triples, got:", len(triples))
 	}
 
 	// sub pred nil
-	triples = MONGO.Triples(TESTGRAPH, "m", "n", nil, nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "m", "n", nil, nil))
 	if len(triples) != 3 {
 		t.Error("didn't get 3 triples, got:", len(triples))
 	}
 
 	// sub nil obj
-	triples = MONGO.Triples(TESTGRAPH, "m", "", 2, nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "m", "", 2, nil))
 	if len(triples) != 1 {
 		t.Error("didn't get 1 triples, got:", len(triples))
 	}
 
 	// sub pred obj
-	triples = MONGO.Triples(TESTGRAPH, "m", "n", 2, nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "m", "n", 2, nil))
 	if len(triples) != 1 {
 		t.Error("didn't get 1 triples, got:", len(triples))
 	}
 
 	// nil pred obj
-	triples = MONGO.Triples(TESTGRAPH, "", "n", 2, nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "n", 2, nil))
 	if len(triples) != 1 {
 		t.Error("didn't get 1 triples, got:", len(triples))
 	}
 
 	// nil nil obj
-	triples = MONGO.Triples(TESTGRAPH, "", "", 2, nil)
+	triples, _ = ReadTriples(MONGO.Triples(TESTGRAPH, "", "", 2, nil))
 	if len(triples) != 1 {
 		t.Error("didn't get 1 triples, got:", len(triples))
 	}
 
 	// test missing graph
-	triples = MONGO.Triples("", "", "", "", nil)
+	triples, _ = ReadTriples(MONGO.Triples("", "", "", "", nil))
 	if triples != nil {
 		t.Error("should have gotten no triples, missing graph")
 	}
@@ -382,3 +425,25 @@ func TestMongoTriples(t *testing.T) {
 func TestClose(t *testing.T) {
 	//MONGO.Close()
 }
+
+func TestMongoObject(t *testing.T) {
+	l := Literal{Value: "chat", Lang: "fr"}
+	doc, err := bson.Marshal(bson.M{"o": mongoObject(l)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bson.M{}
+	err = bson.Unmarshal(doc, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj := mongoValue(out["o"]); obj != l {
+		t.Errorf("should be %v got %#v", l, obj)
+	}
+	if obj := mongoValue(bson.M{"v": "x"}); !reflect.DeepEqual(obj, bson.M{"v": "x"}) {
+		t.Error("should be unchanged got", obj)
+	}
+	if mongoObject(2) != 2 {
+		t.Error("only literals are converted")
+	}
+}
@@ -0,0 +1,600 @@
+package pfftdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Path is a property path in the predicate of a query clause. A link
+// follows the predicate Pred, from object to subject if Inverse. seq
+// follows Args one after the other, alt any of them and repeat follows
+// Args[0] between Min and Max times, Max -1 is unbounded.
+type Path struct {
+	Op      string  `json:"op,omitempty"`
+	Pred    string  `json:"pred,omitempty"`
+	Inverse bool    `json:"inverse,omitempty"`
+	Args    []*Path `json:"args,omitempty"`
+	Min     int     `json:"min,omitempty"`
+	Max     int     `json:"max,omitempty"`
+}
+
+// pathChars can't be part of a predicate in a path unless it is in <>.
+const pathChars = "/|^*+?(){}<>"
+
+// isPath reports whether a predicate is a property path, a predicate with
+// any of / | ^ * + ? ( ) { }. Absolute iris like http://a/b are
+// predicates, in a path they are written <http://a/b>.
+func isPath(pred string) bool {
+	if pred == "" || strings.HasPrefix(pred, "?") {
+		return false
+	}
+	rest := []rune{}
+	inIRI := false
+	for _, c := range pred {
+		switch {
+		case c == '<':
+			inIRI = true
+		case c == '>':
+			inIRI = false
+		case !inIRI:
+			rest = append(rest, c)
+		}
+	}
+	s := string(rest)
+	return !strings.Contains(s, "://") && strings.ContainsAny(s, "/|^*+?(){}")
+}
+
+// ParsePath parses a SPARQL property path like foaf:knows+,
+// ^foaf:knows/foaf:name, (a|b){1,3} or <http://a/b>*. Operators by
+// precedence are | alternatives, / sequences, ^ inverse and the
+// modifiers *, +, ?, {n}, {n,} and {n,m} for repeats.
+func ParsePath(s string) (*Path, error) {
+	p := &pathParser{in: []rune(s)}
+	path, err := p.alt()
+	if err != nil {
+		return nil, err
+	}
+	p.skip()
+	if p.pos < len(p.in) {
+		return nil, fmt.Errorf("unexpected %q in path", string(p.in[p.pos:]))
+	}
+	return path, nil
+}
+
+// pathParser is a recursive descent parser over the runes of a path.
+type pathParser struct {
+	in  []rune
+	pos int
+}
+
+func (p *pathParser) skip() {
+	for p.pos < len(p.in) && unicode.IsSpace(p.in[p.pos]) {
+		p.pos++
+	}
+}
+
+// accept skips c if it is next.
+func (p *pathParser) accept(c rune) bool {
+	p.skip()
+	if p.pos < len(p.in) && p.in[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) alt() (*Path, error) {
+	return p.list('|', "alt", p.seq)
+}
+
+func (p *pathParser) seq() (*Path, error) {
+	return p.list('/', "seq", p.unary)
+}
+
+// list parses operands separated by sep.
+func (p *pathParser) list(sep rune, op string, operand func() (*Path, error)) (*Path, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	args := []*Path{first}
+	for p.accept(sep) {
+		arg, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 1 {
+		return first, nil
+	}
+	return &Path{Op: op, Args: args}, nil
+}
+
+// unary parses ^ and the modifiers of a primary.
+func (p *pathParser) unary() (*Path, error) {
+	if p.accept('^') {
+		path, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return path.inverse(), nil
+	}
+	path, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		min, max := 0, 0
+		switch {
+		case p.accept('*'):
+			min, max = 0, -1
+		case p.accept('+'):
+			min, max = 1, -1
+		case p.accept('?'):
+			min, max = 0, 1
+		case p.accept('{'):
+			min, max, err = p.bounds()
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return path, nil
+		}
+		path = &Path{Op: "repeat", Args: []*Path{path}, Min: min, Max: max}
+	}
+}
+
+// bounds parses n}, n,} or n,m} after {.
+func (p *pathParser) bounds() (int, int, error) {
+	min, err := p.number()
+	if err != nil {
+		return 0, 0, err
+	}
+	max := min
+	if p.accept(',') {
+		max = -1
+		p.skip()
+		if p.pos < len(p.in) && p.in[p.pos] != '}' {
+			max, err = p.number()
+			if err != nil {
+				return 0, 0, err
+			}
+			if max < min {
+				return 0, 0, fmt.Errorf("path repeat max %d less than min %d", max, min)
+			}
+		}
+	}
+	if !p.accept('}') {
+		return 0, 0, fmt.Errorf("expected } in path")
+	}
+	return min, max, nil
+}
+
+func (p *pathParser) number() (int, error) {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.in) && unicode.IsDigit(p.in[p.pos]) {
+		p.pos++
+	}
+	return strconv.Atoi(string(p.in[start:p.pos]))
+}
+
+// primary parses a bracketed path, an <iri> or a predicate.
+func (p *pathParser) primary() (*Path, error) {
+	if p.accept('(') {
+		path, err := p.alt()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(')') {
+			return nil, fmt.Errorf("expected ) in path")
+		}
+		return path, nil
+	}
+	if p.accept('<') {
+		start := p.pos
+		for p.pos < len(p.in) && p.in[p.pos] != '>' {
+			p.pos++
+		}
+		if p.pos == len(p.in) || p.pos == start {
+			return nil, fmt.Errorf("expected iri in path")
+		}
+		p.pos++
+		return &Path{Pred: string(p.in[start : p.pos-1])}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.in) && !unicode.IsSpace(p.in[p.pos]) && !strings.ContainsRune(pathChars, p.in[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, fmt.Errorf("expected predicate in path at %d", p.pos)
+	}
+	return &Path{Pred: string(p.in[start:p.pos])}, nil
+}
+
+// inverse returns the path followed backwards, inverse links are only
+// on predicates.
+func (p *Path) inverse() *Path {
+	inv := *p
+	switch p.Op {
+	case "":
+		inv.Inverse = !p.Inverse
+		return &inv
+	}
+	inv.Args = make([]*Path, len(p.Args))
+	for i, arg := range p.Args {
+		inv.Args[i] = arg.inverse()
+	}
+	if p.Op == "seq" {
+		for i, j := 0, len(inv.Args)-1; i < j; i, j = i+1, j-1 {
+			inv.Args[i], inv.Args[j] = inv.Args[j], inv.Args[i]
+		}
+	}
+	return &inv
+}
+
+// String returns the path in the syntax of ParsePath, predicates with
+// path operators or spaces are written in <>.
+func (p *Path) String() string {
+	switch p.Op {
+	case "":
+		pred := p.Pred
+		if strings.ContainsAny(pred, pathChars+" \t\n") {
+			pred = "<" + pred + ">"
+		}
+		if p.Inverse {
+			return "^" + pred
+		}
+		return pred
+	case "repeat":
+		mod := ""
+		switch {
+		case p.Min == 0 && p.Max == -1:
+			mod = "*"
+		case p.Min == 1 && p.Max == -1:
+			mod = "+"
+		case p.Min == 0 && p.Max == 1:
+			mod = "?"
+		case p.Max == -1:
+			mod = fmt.Sprintf("{%d,}", p.Min)
+		case p.Min == p.Max:
+			mod = fmt.Sprintf("{%d}", p.Min)
+		default:
+			mod = fmt.Sprintf("{%d,%d}", p.Min, p.Max)
+		}
+		arg := p.Args[0]
+		if arg.Op != "" || arg.Inverse {
+			return "(" + arg.String() + ")" + mod
+		}
+		return arg.String() + mod
+	}
+	sep := "/"
+	if p.Op == "alt" {
+		sep = "|"
+	}
+	strs := make([]string, len(p.Args))
+	for i, arg := range p.Args {
+		strs[i] = arg.String()
+		if p.Op == "seq" && arg.Op == "alt" {
+			strs[i] = "(" + strs[i] + ")"
+		}
+	}
+	return strings.Join(strs, sep)
+}
+
+// pred returns the clause predicate of a path, a single link is the
+// predicate itself.
+func (p *Path) pred() string {
+	if p.Op == "" && !p.Inverse {
+		return p.Pred
+	}
+	return p.String()
+}
+
+// links calls f with every link of the path.
+func (p *Path) links(f func(link *Path)) {
+	if p.Op == "" {
+		f(p)
+		return
+	}
+	for _, arg := range p.Args {
+		arg.links(f)
+	}
+}
+
+// PrefixMapPaths replaces defined prefixes in the predicates of property
+// paths in clause predicates, PrefixMap only replaces a prefix at the
+// start of an item.
+func PrefixMapPaths(prefixes map[string]string, clauses []*Triple) error {
+	for _, clause := range clauses {
+		if clause == nil {
+			continue
+		}
+		pred, ok := clause[1].(string)
+		if !ok || !isPath(pred) {
+			continue
+		}
+		path, err := ParsePath(pred)
+		if err != nil {
+			return err
+		}
+		path.links(func(link *Path) {
+			_, link.Pred, _ = PrefixMapTriple(prefixes, "", link.Pred, nil)
+		})
+		clause[1] = path.pred()
+	}
+	return nil
+}
+
+// pathEval evaluates a path in a graph. Nodes are kept by their objKey,
+// values maps them back.
+type pathEval struct {
+	driver Driver
+	graph  string
+	values map[string]interface{}
+}
+
+// reach holds the distinct nodes reached from each start node.
+type reach map[string]map[string]bool
+
+// add adds a node reached from start.
+func (r reach) add(start, node string) {
+	nodes, ok := r[start]
+	if !ok {
+		nodes = map[string]bool{}
+		r[start] = nodes
+	}
+	nodes[node] = true
+}
+
+// node registers a value and returns its key.
+func (e *pathEval) node(val interface{}) string {
+	key := objKey(val)
+	e.values[key] = val
+	return key
+}
+
+// from returns the nodes the path reaches from each of starts, from every
+// node it links if starts is nil.
+func (e *pathEval) from(p *Path, starts []string) (reach, error) {
+	if starts != nil && len(starts) == 0 {
+		return reach{}, nil
+	}
+	switch p.Op {
+	case "":
+		return e.link(p, starts)
+	case "alt":
+		r := reach{}
+		for _, arg := range p.Args {
+			ar, err := e.from(arg, starts)
+			if err != nil {
+				return nil, err
+			}
+			for start, nodes := range ar {
+				for node := range nodes {
+					r.add(start, node)
+				}
+			}
+		}
+		return r, nil
+	case "seq":
+		r, err := e.from(p.Args[0], starts)
+		if err != nil {
+			return nil, err
+		}
+		for _, arg := range p.Args[1:] {
+			next, err := e.from(arg, reached(r))
+			if err != nil {
+				return nil, err
+			}
+			composed := reach{}
+			for start, mids := range r {
+				for mid := range mids {
+					for node := range next[mid] {
+						composed.add(start, node)
+					}
+				}
+			}
+			r = composed
+		}
+		return r, nil
+	}
+	return e.repeat(p, starts)
+}
+
+// reached returns every node reached.
+func reached(r reach) []string {
+	seen := map[string]bool{}
+	nodes := []string{}
+	for _, reachedNodes := range r {
+		for node := range reachedNodes {
+			if !seen[node] {
+				seen[node] = true
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes
+}
+
+// link follows a predicate with a single driver query for all starts.
+func (e *pathEval) link(p *Path, starts []string) (reach, error) {
+	opts := &Options{}
+	if starts != nil {
+		opts.TripleOverrides = &Overrides{}
+		for _, start := range starts {
+			val := e.values[start]
+			if !p.Inverse {
+				if s, ok := val.(string); ok {
+					opts.TripleOverrides.Subs = append(opts.TripleOverrides.Subs, s)
+				}
+				continue
+			}
+			opts.TripleOverrides.Objs = append(opts.TripleOverrides.Objs, val)
+		}
+		if len(opts.TripleOverrides.Subs) == 0 && len(opts.TripleOverrides.Objs) == 0 {
+			return reach{}, nil
+		}
+	}
+	triples, err := ReadTriples(e.driver.Triples(e.graph, SPEMPTY, p.Pred, SPEMPTY, opts))
+	if err != nil {
+		return nil, err
+	}
+	r := reach{}
+	for _, triple := range triples {
+		sub, obj := e.node(triple[0]), e.node(triple[2])
+		if p.Inverse {
+			r.add(obj, sub)
+		} else {
+			r.add(sub, obj)
+		}
+	}
+	return r, nil
+}
+
+// repeat follows a path Min to Max times breadth first from all starts at
+// once. Without starts it starts from the nodes the path links, a path
+// which can be followed 0 times links these to themselves.
+func (e *pathEval) repeat(p *Path, starts []string) (reach, error) {
+	arg := p.Args[0]
+	if starts == nil {
+		first, err := e.from(arg, nil)
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for start := range first {
+			seen[start] = true
+			starts = append(starts, start)
+		}
+		if p.Min == 0 {
+			for _, node := range reached(first) {
+				if !seen[node] {
+					starts = append(starts, node)
+				}
+			}
+		}
+	}
+
+	r := reach{}
+	frontier := reach{}
+	// visited holds nodes by start and whether min was reached, an
+	// unbounded repeat only follows each of them once
+	visited := map[string]map[string]bool{}
+	for _, start := range starts {
+		frontier.add(start, start)
+		if p.Min == 0 {
+			r.add(start, start)
+		}
+		visited[start] = map[string]bool{}
+	}
+	for depth := 1; len(frontier) > 0 && (p.Max == -1 || depth <= p.Max); depth++ {
+		step, err := e.from(arg, reached(frontier))
+		if err != nil {
+			return nil, err
+		}
+		next := reach{}
+		for start, nodes := range frontier {
+			for node := range nodes {
+				for to := range step[node] {
+					if p.Max == -1 {
+						state := fmt.Sprintf("%s\x00%v", to, depth >= p.Min)
+						if visited[start][state] {
+							continue
+						}
+						visited[start][state] = true
+					}
+					next.add(start, to)
+					if depth >= p.Min {
+						r.add(start, to)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return r, nil
+}
+
+// pathTriples returns a triple sub, pred, obj for each pair of nodes a
+// path links in graph. sub and obj are SPEMPTY if not given, overrides
+// restrict them to values bound before. The path is followed from the
+// subjects if they are known, backwards from the objects otherwise.
+func (g *Graph) pathTriples(graph, sub, pred string, path *Path, obj interface{}, overrides *Overrides) ([]*Triple, error) {
+	e := &pathEval{driver: g.Driver, graph: graph, values: map[string]interface{}{}}
+	hasObj := obj != nil && obj != SPEMPTY
+	var starts []string
+	backwards := false
+	switch {
+	case sub != SPEMPTY:
+		starts = []string{e.node(sub)}
+	case overrides != nil && len(overrides.Subs) > 0:
+		for _, s := range overrides.Subs {
+			starts = append(starts, e.node(s))
+		}
+	case hasObj:
+		starts = []string{e.node(obj)}
+		backwards = true
+	case overrides != nil && len(overrides.Objs) > 0:
+		for _, o := range overrides.Objs {
+			starts = append(starts, e.node(o))
+		}
+		backwards = true
+	}
+	if backwards {
+		path = path.inverse()
+	}
+	r, err := e.from(path, starts)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := [][2]string{}
+	for start, nodes := range r {
+		for node := range nodes {
+			s, o := start, node
+			if backwards {
+				s, o = node, start
+			}
+			if sub != SPEMPTY && s != objKey(sub) || hasObj && o != objKey(obj) {
+				continue
+			}
+			pairs = append(pairs, [2]string{s, o})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	triples := make([]*Triple, 0, len(pairs))
+	for _, pair := range pairs {
+		// only strings can be subjects
+		subject, ok := e.values[pair[0]].(string)
+		if !ok {
+			continue
+		}
+		triples = append(triples, &Triple{subject, pred, e.values[pair[1]]})
+	}
+	return triples, nil
+}
+
+// pathEstimate is the number of triples of the predicates of a path.
+func (g *Graph) pathEstimate(path *Path, graphs []string) uint {
+	var total uint
+	path.links(func(link *Path) {
+		for _, graph := range graphs {
+			count, err := g.Driver.Count(graph, SPEMPTY, link.Pred, nil)
+			if err == nil {
+				total += count
+			}
+		}
+	})
+	return total
+}
@@ -0,0 +1,149 @@
+package pfftdb
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"foaf:knows+", "foaf:knows+"},
+		{"foaf:knows*", "foaf:knows*"},
+		{"a / b | c", "a/b|c"},
+		{"a/(b|c)", "a/(b|c)"},
+		{"^a/b", "^a/b"},
+		{"^(a/b)", "^b/^a"},
+		{"^a+", "(^a)+"},
+		{"(a|b){1,3}", "(a|b){1,3}"},
+		{"a{2}", "a{2}"},
+		{"a{2,}", "a{2,}"},
+		{"a?", "a?"},
+		{"<http://a/b>*", "<http://a/b>*"},
+	}
+	for i, tt := range tests {
+		path, err := ParsePath(tt.in)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if path.String() != tt.out {
+			t.Errorf("%d %s should be %s got %s", i, tt.in, tt.out, path.String())
+		}
+	}
+
+	path, _ := ParsePath("^a/b{1,3}")
+	expected := &Path{Op: "seq", Args: []*Path{
+		&Path{Pred: "a", Inverse: true},
+		&Path{Op: "repeat", Args: []*Path{&Path{Pred: "b"}}, Min: 1, Max: 3},
+	}}
+	if !reflect.DeepEqual(path, expected) {
+		t.Errorf("%+v", path)
+	}
+
+	var bad = []string{"a/", "(a", "a{3,1}", "a{x}", "<a", "a)", "|a"}
+	for _, b := range bad {
+		if _, err := ParsePath(b); err == nil {
+			t.Error("should have gotten error for ", b)
+		}
+	}
+
+	var paths = map[string]bool{
+		"foaf:knows":           false,
+		"http://a.com/b/knows": false,
+		"?p":                   false,
+		"foaf:knows+":          true,
+		"a/b":                  true,
+		"<http://a.com/b>+":    true,
+		"^a":                   true,
+	}
+	for pred, ok := range paths {
+		if isPath(pred) != ok {
+			t.Errorf("isPath %s should be %v", pred, ok)
+		}
+	}
+
+	clauses := []*Triple{&Triple{"?a", "foaf:knows/foaf:name", "?b"}, &Triple{"?a", "(foaf:knows)", "?b"}}
+	err := PrefixMapPaths(map[string]string{"foaf": "http://xmlns.com/foaf/0.1/"}, clauses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clauses[0][1] != "<http://xmlns.com/foaf/0.1/knows>/<http://xmlns.com/foaf/0.1/name>" || clauses[1][1] != "http://xmlns.com/foaf/0.1/knows" {
+		t.Error(clauses[0][1], clauses[1][1])
+	}
+}
+
+// pathValues returns the sorted values of a variable.
+func pathValues(bindings []Bindings, key string) []string {
+	vals := []string{}
+	for _, b := range bindings {
+		vals = append(vals, b[key].(string))
+	}
+	sort.Strings(vals)
+	return vals
+}
+
+func TestQueryPath(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	// a -> b -> c -> d -> b
+	GRPH.Add("a", "knows", "b")
+	GRPH.Add("b", "knows", "c")
+	GRPH.Add("c", "knows", "d")
+	GRPH.Add("d", "knows", "b")
+	GRPH.Add("a", "likes", "e")
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		GRPH.Add(id, "name", "name_"+id)
+	}
+
+	var tests = []struct {
+		clause   *Triple
+		key      string
+		expected []string
+	}{
+		{&Triple{"a", "knows+", "?x"}, "x", []string{"b", "c", "d"}},
+		{&Triple{"a", "knows*", "?x"}, "x", []string{"a", "b", "c", "d"}},
+		{&Triple{"a", "knows{2,3}", "?x"}, "x", []string{"c", "d"}},
+		{&Triple{"a", "knows{2}", "?x"}, "x", []string{"c"}},
+		{&Triple{"?x", "knows+", "d"}, "x", []string{"a", "b", "c", "d"}},
+		{&Triple{"a", "knows|likes", "?x"}, "x", []string{"b", "e"}},
+		{&Triple{"a", "knows/knows/name", "?x"}, "x", []string{"name_c"}},
+		{&Triple{"?x", "^knows", "a"}, "x", []string{"b"}},
+		{&Triple{"name_c", "^name/^knows", "?x"}, "x", []string{"b"}},
+		{&Triple{"?x", "(knows|likes)", "e"}, "x", []string{"a"}},
+	}
+	for i, tt := range tests {
+		res := GRPH.Query([]*Triple{tt.clause}, nil)
+		if vals := pathValues(res, tt.key); !reflect.DeepEqual(vals, tt.expected) {
+			t.Errorf("%d %v should be %v got %v", i, tt.clause, tt.expected, vals)
+		}
+	}
+
+	// both ends unbound
+	res := GRPH.Query([]*Triple{&Triple{"?x", "knows{3}", "?y"}}, nil)
+	if len(res) != 4 {
+		t.Error(res)
+	}
+	res = GRPH.Query([]*Triple{&Triple{"?x", "likes?", "?y"}}, &Options{Where: &Expr{Op: "==", Args: []*Expr{&Expr{Var: "x"}, &Expr{Var: "y"}}}})
+	if vals := pathValues(res, "x"); !reflect.DeepEqual(vals, []string{"a", "e"}) {
+		t.Error(vals)
+	}
+
+	// friends of friends joined with their names
+	res = GRPH.Query([]*Triple{
+		&Triple{"?p", "name", "name_a"},
+		&Triple{"?p", "knows/knows", "?fof"},
+		&Triple{"?fof", "name", "?name"},
+	}, nil)
+	if len(res) != 1 || res[0]["name"] != "name_c" {
+		t.Error(res)
+	}
+
+	res = GRPH.Query([]*Triple{&Triple{"a", "knows/(", "?x"}}, nil)
+	if len(res) != 0 {
+		t.Error(res)
+	}
+}
@@ -43,11 +43,32 @@ type Options struct {
 	Limit           uint       `json:"limit"`
 	Offset          uint       `json:"offset"`
 	OrderBy         string     `json:"orderby"`
-	Filter          []*Filter  `json:"filter"`   //query only
+	Filter          []*Filter  `json:"filter"`   //query only, all have to match
+	Where           *Expr      `json:"where"`    // query only
 	Distinct        bool       `json:"distinct"` // query only
 	Select          []string   `json:"select"`   // query only
 	Optional        []uint     `json:"optional"` // query only
 	TripleOverrides *Overrides // used by Query to get triples.
+
+	// GroupBy groups the results by variables and binds Aggregates for each
+	// group, Having removes groups. Select, distinct, orderby, limit and
+	// offset apply to the groups. query only
+	GroupBy    []string     `json:"groupby"`
+	Aggregates []*Aggregate `json:"aggregates"`
+	Having     *Expr        `json:"having"`
+
+	// Graphs are matched by every clause instead of the queried graph and
+	// ClauseGraphs scopes a clause by index to a single graph, or to a
+	// ?variable which is bound to the graph each match came from. A result
+	// only reports its graphs through such variables, without one it
+	// doesn't say which graph it matched in. query only
+	Graphs       []string        `json:"graphs"`
+	ClauseGraphs map[uint]string `json:"clausegraphs"`
+
+	// Entailment is none, rdfs or owl to also match the consequences of
+	// the triples, the default of the graph if empty, see
+	// Graph.SetEntailment.
+	Entailment string `json:"entailment"`
 }
 
 // Driver defines the functionality for a datastore driver.
@@ -64,7 +85,7 @@ type Driver interface {
 	Remove(string, string, string, interface{}) error
 	RemoveAll(string) error
 	Count(string, string, string, interface{}) (uint, error)
-	Triples(string, string, string, interface{}, *Options) []*Triple
+	Triples(string, string, string, interface{}, *Options) TripleIter
 	Pinger()
 	Close()
 }
@@ -78,8 +99,24 @@ func NewDriver(driverType string, dbConf *DBConf) (Driver, error) {
 			return nil, err
 		}
 		return m, nil
+	case "memory":
+		m, err := NewMemory(dbConf.Graphs)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	case "disk":
+		d, err := NewDisk(dbConf.Hosts, dbConf.Graphs)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
 	case "postgres":
-		return nil, fmt.Errorf("not yet implemented: %s", driverType)
+		p, err := NewPostgres(dbConf.Hosts, dbConf.Name, dbConf.User, dbConf.Pass, dbConf.Graphs)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
 	}
 	return nil, fmt.Errorf("driver not defined: %s", driverType)
 }
@@ -116,7 +153,9 @@ func New(httpAPIPort, env, dbType, dbHosts, dbName, dbUser, dbPass, graphs, webD
 	return s, nil
 }
 
-// Close [...]
+// Close closes the driver.
 func (s *Store) Close() {
-
+	if s.Driver != nil {
+		s.Driver.Close()
+	}
 }
@@ -21,7 +21,7 @@ var (
 	APIPORT = "9998"
 
 	goPath = fmt.Sprintf("%s", os.Getenv("GOPATH"))
-	dbType = "mongo"
+	dbType = envDefault("DBTYPE", "mongo")
 	webDir = ""
 	//webDir = goPath + "/src/pfftdb/web"
 	STORE   *Store
@@ -30,6 +30,14 @@ var (
 	TESTAPI *API
 )
 
+// envDefault returns the environment variable key or def if not set.
+func envDefault(key, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
+
 func init() {
 	var err error
 	dbpath := os.Getenv("DBPATH")
@@ -61,7 +69,11 @@ func init() {
 
 func TestNewDriver(t *testing.T) {
 	dbConf := &DBConf{Hosts: DBPATH}
-	_, err := NewDriver("mongo", dbConf)
+	_, err := NewDriver(dbType, dbConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewDriver("memory", dbConf)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,147 @@
+package pfftdb
+
+import (
+	"sort"
+	"strings"
+
+	log "github.com/golang/glog"
+)
+
+// QueryPlan is the order Query evaluates clauses in.
+type QueryPlan struct {
+	Steps []*PlanStep `json:"steps"`
+}
+
+// PlanStep is a clause with its estimated number of matches.
+type PlanStep struct {
+	Clause   uint    `json:"clause"` // index in the given clauses
+	Triple   *Triple `json:"triple"`
+	Estimate uint    `json:"estimate"`
+	Optional bool    `json:"optional"`
+}
+
+// Order returns the clause indexes in evaluation order.
+func (p *QueryPlan) Order() []uint {
+	order := make([]uint, len(p.Steps))
+	for i, step := range p.Steps {
+		order[i] = step.Clause
+	}
+	return order
+}
+
+// clauseVars returns the variables of a clause, including its graph
+// variable.
+func clauseVars(clause *Triple, graphVar string) []string {
+	vars := []string{}
+	for _, item := range clause {
+		if s, ok := item.(string); ok && strings.HasPrefix(s, "?") {
+			vars = append(vars, s[1:])
+		}
+	}
+	if graphVar != "" {
+		vars = append(vars, graphVar)
+	}
+	return vars
+}
+
+// estimate counts the triples matching the constant parts of a clause in
+// each of its graphs.
+func (g *Graph) estimate(clause *Triple, graphs []string) uint {
+	query := Triple{SPEMPTY, SPEMPTY, nil}
+	for i, item := range clause {
+		if s, ok := item.(string); ok && strings.HasPrefix(s, "?") {
+			continue
+		}
+		query[i] = item
+	}
+	sub, pred, err := SubPred(query[0], query[1])
+	if err != nil {
+		return 0
+	}
+	if isPath(pred) {
+		path, err := ParsePath(pred)
+		if err != nil {
+			return 0
+		}
+		return g.pathEstimate(path, graphs)
+	}
+	var total uint
+	for _, graph := range graphs {
+		count, err := g.Driver.Count(graph, sub, pred, query[2])
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		total += count
+	}
+	return total
+}
+
+// Plan orders clauses by their estimated number of matches from
+// Driver.Count. Required clauses go first, starting with the most
+// selective one and then always the most selective clause sharing a
+// variable with the ones before it, so each step can use the bindings so
+// far. Optional clauses keep their order after all required ones, they
+// only extend bindings and never remove them.
+func (g *Graph) Plan(clauses []*Triple, options *Options) *QueryPlan {
+	if options == nil {
+		options = &Options{}
+	}
+	optionalMap := map[uint]bool{}
+	for _, key := range options.Optional {
+		optionalMap[key] = true
+	}
+
+	required := []*PlanStep{}
+	optional := []*PlanStep{}
+	vars := map[uint][]string{}
+	for i, clause := range clauses {
+		graphs, graphVar := g.clauseGraphs(uint(i), options)
+		step := &PlanStep{
+			Clause:   uint(i),
+			Triple:   clause,
+			Estimate: g.estimate(clause, graphs),
+			Optional: optionalMap[uint(i)],
+		}
+		vars[step.Clause] = clauseVars(clause, graphVar)
+		if step.Optional {
+			optional = append(optional, step)
+		} else {
+			required = append(required, step)
+		}
+	}
+	// stable so equal estimates keep the given order
+	sort.SliceStable(required, func(i, j int) bool {
+		return required[i].Estimate < required[j].Estimate
+	})
+
+	plan := &QueryPlan{Steps: make([]*PlanStep, 0, len(clauses))}
+	bound := map[string]bool{}
+	for len(required) > 0 {
+		next := 0
+		for i, step := range required {
+			if len(plan.Steps) > 0 && sharesVar(vars[step.Clause], bound) {
+				next = i
+				break
+			}
+		}
+		step := required[next]
+		required = append(required[:next], required[next+1:]...)
+		plan.Steps = append(plan.Steps, step)
+		for _, v := range vars[step.Clause] {
+			bound[v] = true
+		}
+	}
+	plan.Steps = append(plan.Steps, optional...)
+	return plan
+}
+
+// sharesVar reports whether any of vars is bound.
+func sharesVar(vars []string, bound map[string]bool) bool {
+	for _, v := range vars {
+		if bound[v] {
+			return true
+		}
+	}
+	return false
+}
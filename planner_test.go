@@ -0,0 +1,52 @@
+package pfftdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	for _, name := range []string{"Albert", "Barry", "Charles", "Dave"} {
+		GRPH.Add("_:"+name, "foaf:name", name)
+		GRPH.Add("_:"+name, "foaf:knows", "_:Albert")
+		GRPH.Add("_:"+name, "eu:age", 30)
+	}
+	GRPH.Add("_:Albert", "eu:username", "athug")
+
+	clauses := []*Triple{
+		&Triple{"?id", "foaf:knows", "?knows"},
+		&Triple{"?knows", "foaf:name", "?name"},
+		&Triple{"?id", "eu:username", "athug"},
+		&Triple{"?id", "eu:age", "?age"},
+	}
+	plan := GRPH.Plan(clauses, &Options{Optional: []uint{3}})
+	if !reflect.DeepEqual(plan.Order(), []uint{2, 0, 1, 3}) {
+		t.Error(plan.Order())
+	}
+	var estimates []uint
+	for _, step := range plan.Steps {
+		estimates = append(estimates, step.Estimate)
+	}
+	if !reflect.DeepEqual(estimates, []uint{1, 4, 4, 4}) || !plan.Steps[3].Optional {
+		t.Error(estimates, *plan.Steps[3])
+	}
+
+	// the plan doesn't change the results
+	bindings := GRPH.Query(clauses, &Options{Optional: []uint{3}})
+	if len(bindings) != 1 || bindings[0]["name"] != "Albert" || bindings[0]["age"] != 30 {
+		t.Error(bindings)
+	}
+
+	// a clause without a shared variable waits for one that has
+	plan = GRPH.Plan([]*Triple{
+		&Triple{"?a", "eu:username", "athug"},
+		&Triple{"?b", "foaf:knows", "?c"},
+		&Triple{"?a", "foaf:name", "?name"},
+	}, nil)
+	if !reflect.DeepEqual(plan.Order(), []uint{0, 2, 1}) {
+		t.Error(plan.Order())
+	}
+}
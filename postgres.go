@@ -0,0 +1,715 @@
+package pfftdb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/lib/pq"
+)
+
+// number of rows per insert statement, postgres allows 65535 parameters.
+const pgInsertChunk = 1000
+
+// pgSchema creates the graphs and triples tables. o is the text form of the
+// object, k its kind (s string, n number, b bool, j json) which is part of
+// the unique key, t the go type used to decode it and n the numeric value
+// used for sorting numbers.
+var pgSchema = []string{
+	`CREATE TABLE IF NOT EXISTS graphs (
+		name text PRIMARY KEY
+	)`,
+	`CREATE TABLE IF NOT EXISTS triples (
+		g text NOT NULL,
+		s text NOT NULL,
+		p text NOT NULL,
+		o text NOT NULL,
+		k char(1) NOT NULL,
+		t char(1) NOT NULL,
+		n double precision
+	)`,
+}
+
+// pgIndexes are the same permutation indexes Mongo.Index creates, objects
+// are indexed by the md5 of o so long ones fit.
+var pgIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS triples_g_s ON triples (g, s)`,
+	`CREATE INDEX IF NOT EXISTS triples_g_md5o ON triples (g, k, md5(o))`,
+	`CREATE INDEX IF NOT EXISTS triples_g_p ON triples (g, p)`,
+	`CREATE INDEX IF NOT EXISTS triples_g_s_p ON triples (g, s, p)`,
+	`CREATE INDEX IF NOT EXISTS triples_g_s_md5o ON triples (g, s, k, md5(o))`,
+	`CREATE INDEX IF NOT EXISTS triples_g_p_md5o ON triples (g, p, k, md5(o))`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS triples_g_s_p_md5o ON triples (g, s, p, k, md5(o))`,
+}
+
+// PostgresGraph
+type PostgresGraph struct {
+	Graph *Graph
+}
+
+// Postgres is a Driver storing every graph in a single triples table.
+type Postgres struct {
+	DB      *sql.DB
+	Hosts   string
+	DBName  string // db name
+	User    string
+	Pass    string
+	Graphs  map[string]*PostgresGraph
+	muGraph sync.Mutex
+}
+
+// pgObject is the column form of an object.
+type pgObject struct {
+	O string
+	K string
+	T string
+	N sql.NullFloat64
+}
+
+// NewPostgres connects and creates each of the given graphs.
+func NewPostgres(hosts, dbName, user, pass string, graphs []string) (*Postgres, error) {
+	p := &Postgres{
+		Hosts:   hosts,
+		DBName:  dbName,
+		User:    user,
+		Pass:    pass,
+		Graphs:  map[string]*PostgresGraph{},
+		muGraph: sync.Mutex{},
+	}
+	p.Connect(hosts)
+	for _, stmt := range pgSchema {
+		_, err := p.DB.Exec(stmt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, graphName := range graphs {
+		if graphName == "" {
+			continue
+		}
+		_, err := p.Create(graphName)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+	}
+
+	return p, nil
+}
+
+// DataSource builds the connection string from hosts, db name, user and
+// pass. hosts may also be a full postgres:// url, user and pass override it.
+func (p *Postgres) DataSource() string {
+	u := &url.URL{Scheme: "postgres"}
+	if strings.HasPrefix(p.Hosts, "postgres://") || strings.HasPrefix(p.Hosts, "postgresql://") {
+		parsed, err := url.Parse(p.Hosts)
+		if err == nil {
+			u = parsed
+		}
+	} else {
+		// only a single host is supported
+		u.Host = strings.Split(p.Hosts, ",")[0]
+		u.Path = "/" + p.DBName
+		u.RawQuery = "sslmode=disable"
+	}
+	if p.User != "" {
+		if p.Pass != "" {
+			u.User = url.UserPassword(p.User, p.Pass)
+		} else {
+			u.User = url.User(p.User)
+		}
+	}
+	return u.String()
+}
+
+// encodePGObject converts an object to its column form.
+func encodePGObject(obj interface{}) (*pgObject, error) {
+	switch o := obj.(type) {
+	case string:
+		return &pgObject{O: o, K: "s", T: "s"}, nil
+	case bool:
+		return &pgObject{O: strconv.FormatBool(o), K: "b", T: "b"}, nil
+	}
+	// integers keep their exact text, uints past an int64 decode as uint64
+	switch v := reflect.ValueOf(obj); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := sql.NullFloat64{Float64: float64(v.Int()), Valid: true}
+		return &pgObject{O: strconv.FormatInt(v.Int(), 10), K: "n", T: "i", N: n}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := sql.NullFloat64{Float64: float64(v.Uint()), Valid: true}
+		po := &pgObject{O: strconv.FormatUint(v.Uint(), 10), K: "n", T: "i", N: n}
+		if v.Uint() > math.MaxInt64 {
+			po.T = "u"
+		}
+		return po, nil
+	}
+	if f, ok := toFloat(obj); ok {
+		po := &pgObject{K: "n", T: "f", N: sql.NullFloat64{Float64: f, Valid: true}}
+		// integral numbers have the same text so 2 and 2.0 are one object
+		if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+			po.O = strconv.FormatInt(int64(f), 10)
+		} else {
+			po.O = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return po, nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := obj.(Literal); ok {
+		return &pgObject{O: string(b), K: "j", T: "l"}, nil
+	}
+	return &pgObject{O: string(b), K: "j", T: "j"}, nil
+}
+
+// decode converts the column form back to an object.
+func (po *pgObject) decode() (interface{}, error) {
+	switch po.T {
+	case "s":
+		return po.O, nil
+	case "b":
+		return strconv.ParseBool(po.O)
+	case "i":
+		i, err := strconv.ParseInt(po.O, 10, 64)
+		return int(i), err
+	case "u":
+		return strconv.ParseUint(po.O, 10, 64)
+	case "f":
+		return strconv.ParseFloat(po.O, 64)
+	case "l":
+		var l Literal
+		err := json.Unmarshal([]byte(po.O), &l)
+		return l, err
+	}
+	var obj interface{}
+	err := json.Unmarshal([]byte(po.O), &obj)
+	return obj, err
+}
+
+// GraphsList returns a list of created graphs.
+func (p *Postgres) GraphsList() []string {
+	graphs := []string{}
+	rows, err := p.DB.Query(`SELECT name FROM graphs UNION SELECT DISTINCT g FROM triples`)
+	if err != nil {
+		log.Error(err)
+		return graphs
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		graphs = append(graphs, name)
+	}
+	return graphs
+}
+
+// Graph returns the internal graph given a name.
+func (p *Postgres) Graph(name string) (*Graph, bool) {
+	p.muGraph.Lock()
+	defer p.muGraph.Unlock()
+	g, ok := p.Graphs[name]
+	if ok {
+		return g.Graph, true
+	}
+	return nil, false
+}
+
+// Create adds a graph
+func (p *Postgres) Create(name string) (*Graph, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	p.muGraph.Lock()
+	defer p.muGraph.Unlock()
+
+	// Check if graph already exists
+	g, ok := p.Graphs[name]
+	if ok {
+		return g.Graph, nil
+	}
+
+	_, err := p.DB.Exec(`INSERT INTO graphs (name) VALUES ($1) ON CONFLICT DO NOTHING`, name)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	err = p.Index(name, true)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	graph, err := NewGraph(name, p)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	p.Graphs[name] = &PostgresGraph{Graph: graph}
+	return graph, nil
+}
+
+// Connect establishes a database connection.
+func (p *Postgres) Connect(hosts string) {
+	log.Infof("connecting to hosts:%s", hosts)
+
+	for {
+		db, err := sql.Open("postgres", p.DataSource())
+		if err == nil {
+			err = db.Ping()
+		}
+		if err != nil {
+			log.Error(err)
+			if db != nil {
+				db.Close()
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		p.DB = db
+
+		go p.Pinger()
+		return
+	}
+}
+
+// Drop removes every triple of a graph. Like mongo the graph itself stays
+// loaded and can be written to again.
+func (p *Postgres) Drop(gid string) error {
+	_, err := p.DB.Exec(`DELETE FROM triples WHERE g = $1`, gid)
+	if err != nil {
+		log.Error(err, " graph:", gid)
+		return err
+	}
+	return nil
+}
+
+// Index creates the default indexes. They are shared by every graph.
+func (p *Postgres) Index(gid string, background bool) error {
+	for _, stmt := range pgIndexes {
+		_, err := p.DB.Exec(stmt)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		log.V(2).Info(stmt)
+	}
+	return nil
+}
+
+// AddBulk inserts triples in a single transaction skipping invalid ones and
+// duplicates. It returns the number inserted.
+func (p *Postgres) AddBulk(graph string, triples []*Triple) (int, error) {
+	if _, ok := p.Graph(graph); !ok {
+		return 0, fmt.Errorf("graph not found %s", graph)
+	}
+
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	total, err := pgInsert(tx, graph, triples)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// pgInsert inserts triples in a transaction in chunks skipping invalid ones
+// and duplicates. It returns the number inserted.
+func pgInsert(tx *sql.Tx, graph string, triples []*Triple) (int, error) {
+	args := []interface{}{}
+	rows := 0
+	total := 0
+	flush := func() error {
+		if rows == 0 {
+			return nil
+		}
+		values := make([]string, rows)
+		for i := range values {
+			n := i * 7
+			values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+		}
+		res, err := tx.Exec(`INSERT INTO triples (g, s, p, o, k, t, n) VALUES `+strings.Join(values, ", ")+` ON CONFLICT DO NOTHING`, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		total += int(affected)
+		args = args[:0]
+		rows = 0
+		return nil
+	}
+
+	for _, tr := range triples {
+		if tr == nil {
+			continue
+		}
+		sub, ok := tr[0].(string)
+		if !ok || sub == "" {
+			continue
+		}
+		pred, ok := tr[1].(string)
+		if !ok || pred == "" {
+			continue
+		}
+		if isEmpty(tr[2]) {
+			continue
+		}
+		po, err := encodePGObject(tr[2])
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		args = append(args, graph, sub, pred, po.O, po.K, po.T, po.N)
+		rows++
+		if rows == pgInsertChunk {
+			err = flush()
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	err := flush()
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// Add inserts a single triple, duplicates are ignored.
+func (p *Postgres) Add(graph, sub, pred string, obj interface{}) error {
+	if _, ok := p.Graph(graph); !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	if graph == "" || sub == "" || pred == "" || isEmpty(obj) {
+		return fmt.Errorf("missing components graph:%s sub:%s pred:%s obj:%s", graph, sub, pred, obj)
+	}
+	po, err := encodePGObject(obj)
+	if err != nil {
+		return err
+	}
+	_, err = p.DB.Exec(`INSERT INTO triples (g, s, p, o, k, t, n) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`,
+		graph, sub, pred, po.O, po.K, po.T, po.N)
+	if err != nil {
+		log.Error(err)
+	}
+	return err
+}
+
+// RemoveBulk removes each triple in a single transaction, empty items match everything.
+func (p *Postgres) RemoveBulk(graph string, triples []*Triple) error {
+	if _, ok := p.Graph(graph); !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	err = p.delete(tx, graph, triples)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Transact applies the operations of a transaction in a single sql
+// transaction, see TxDriver.
+func (p *Postgres) Transact(graph string, ops []*TxOp) ([]*Triple, []*Triple, error) {
+	if _, ok := p.Graph(graph); !ok {
+		return nil, nil, fmt.Errorf("graph not found %s", graph)
+	}
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	added, removed, err := planTx(ops, func(sub, pred string, obj interface{}) ([]*Triple, error) {
+		where, args, err := p.BuildQuery(graph, sub, pred, obj, nil)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := tx.Query(`SELECT s, p, o, t FROM triples WHERE `+where, args...)
+		if err != nil {
+			return nil, err
+		}
+		return ReadTriples(&pgIter{rows: rows})
+	})
+	if err == nil {
+		err = p.delete(tx, graph, removed)
+	}
+	if err == nil {
+		_, err = pgInsert(tx, graph, added)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
+
+// delete removes each triple in a transaction, empty items match
+// everything.
+func (p *Postgres) delete(tx *sql.Tx, graph string, triples []*Triple) error {
+	for _, tr := range triples {
+		if tr == nil {
+			continue
+		}
+		if sub, ok := tr[0].(string); ok {
+			if pred, ok := tr[1].(string); ok {
+				where, args, err := p.BuildQuery(graph, sub, pred, tr[2], nil)
+				if err != nil {
+					return err
+				}
+				_, err = tx.Exec(`DELETE FROM triples WHERE `+where, args...)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveAll clears out all triples of a graph.
+func (p *Postgres) RemoveAll(graph string) error {
+	if _, ok := p.Graph(graph); !ok {
+		return nil
+	}
+	_, err := p.DB.Exec(`DELETE FROM triples WHERE g = $1`, graph)
+	if err != nil {
+		log.Error(err)
+	}
+	return err
+}
+
+// Remove removes set of triples from a graph depending on the given sub, pred, obj.
+func (p *Postgres) Remove(graph, sub, pred string, obj interface{}) error {
+	if _, ok := p.Graph(graph); !ok {
+		return fmt.Errorf("graph not found %s", graph)
+	}
+	where, args, err := p.BuildQuery(graph, sub, pred, obj, nil)
+	if err != nil {
+		return err
+	}
+	_, err = p.DB.Exec(`DELETE FROM triples WHERE `+where, args...)
+	return err
+}
+
+// Count
+func (p *Postgres) Count(graph, sub, pred string, obj interface{}) (uint, error) {
+	if _, ok := p.Graph(graph); !ok {
+		log.Error("missing graph ", graph)
+		return 0, fmt.Errorf("missing graph %s", graph)
+	}
+	where, args, err := p.BuildQuery(graph, sub, pred, obj, nil)
+	if err != nil {
+		return 0, err
+	}
+	var count uint
+	err = p.DB.QueryRow(`SELECT count(*) FROM triples WHERE `+where, args...).Scan(&count)
+	return count, err
+}
+
+// BuildQuery creates a where clause and its arguments from the given sub,
+// pred, obj. Overrides replace sub, pred or obj with arrays of their
+// distinct values, so a join of any size binds a few parameters.
+func (p *Postgres) BuildQuery(graph, sub, pred string, obj interface{}, overrides *Overrides) (string, []interface{}, error) {
+	conds := []string{"g = $1"}
+	args := []interface{}{graph}
+	arg := func(val interface{}) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if overrides != nil && len(overrides.Subs) > 0 {
+		conds = append(conds, "s = ANY("+arg(pq.Array(distinctStrings(overrides.Subs)))+")")
+	} else if !isEmpty(sub) {
+		conds = append(conds, "s = "+arg(sub))
+	}
+
+	if overrides != nil && len(overrides.Preds) > 0 {
+		conds = append(conds, "p = ANY("+arg(pq.Array(distinctStrings(overrides.Preds)))+")")
+	} else if !isEmpty(pred) {
+		conds = append(conds, "p = "+arg(pred))
+	}
+
+	if overrides != nil && len(overrides.Objs) > 0 {
+		kinds, objs := []string{}, []string{}
+		seen := map[[2]string]bool{}
+		for _, o := range overrides.Objs {
+			po, err := encodePGObject(o)
+			if err != nil {
+				return "", nil, err
+			}
+			if key := [2]string{po.K, po.O}; !seen[key] {
+				seen[key] = true
+				kinds, objs = append(kinds, po.K), append(objs, po.O)
+			}
+		}
+		k, o := arg(pq.Array(kinds)), arg(pq.Array(objs))
+		conds = append(conds, "(k, md5(o), o) IN (SELECT vk, md5(vo), vo FROM unnest("+k+"::text[], "+o+"::text[]) AS v(vk, vo))")
+	} else if !isEmpty(obj) {
+		po, err := encodePGObject(obj)
+		if err != nil {
+			return "", nil, err
+		}
+		k, o := arg(po.K), arg(po.O)
+		conds = append(conds, "k = "+k+" AND md5(o) = md5("+o+") AND o = "+o)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// distinctStrings returns vals without duplicates, in order.
+func distinctStrings(vals []string) []string {
+	distinct := []string{}
+	seen := map[string]bool{}
+	for _, val := range vals {
+		if !seen[val] {
+			seen[val] = true
+			distinct = append(distinct, val)
+		}
+	}
+	return distinct
+}
+
+// orderClause converts an orderby of s, p or o with an optional - prefix
+// to sql. Numbers sort before other objects like they do in mongo.
+func orderClause(orderBy string) string {
+	dir := "ASC"
+	if strings.HasPrefix(orderBy, "-") {
+		dir = "DESC"
+		orderBy = orderBy[1:]
+	}
+	switch orderBy {
+	case "s", "p":
+		return orderBy + " " + dir
+	case "o":
+		return "(k <> 'n') " + dir + ", n " + dir + ", o " + dir
+	}
+	return ""
+}
+
+// pgIter reads triples from result rows.
+type pgIter struct {
+	rows *sql.Rows
+	err  error
+}
+
+// Next scans the next row, objects that can't be decoded are skipped.
+func (it *pgIter) Next() (*Triple, bool) {
+	for it.err == nil && it.rows.Next() {
+		var s, pr string
+		po := &pgObject{}
+		err := it.rows.Scan(&s, &pr, &po.O, &po.T)
+		if err != nil {
+			it.err = err
+			return nil, false
+		}
+		o, err := po.decode()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		return &Triple{s, pr, o}, true
+	}
+	return nil, false
+}
+
+// Err returns the scan or rows error.
+func (it *pgIter) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+// Close closes the rows.
+func (it *pgIter) Close() error {
+	return it.rows.Close()
+}
+
+// Triples iterates over the matching rows without loading them all.
+func (p *Postgres) Triples(graph, sub, pred string, obj interface{}, options *Options) TripleIter {
+	if _, ok := p.Graph(graph); !ok {
+		return errIter(fmt.Errorf("missing graph %s", graph))
+	}
+
+	var overrides *Overrides
+	if options != nil {
+		overrides = options.TripleOverrides
+	}
+	where, args, err := p.BuildQuery(graph, sub, pred, obj, overrides)
+	if err != nil {
+		return errIter(err)
+	}
+	query := `SELECT s, p, o, t FROM triples WHERE ` + where
+	if options != nil {
+		// skip only makes sense with sorted results, like mongo sort by subject.
+		orderBy := options.OrderBy
+		if orderBy == "" && options.Offset != 0 {
+			orderBy = "s"
+		}
+		if order := orderClause(orderBy); order != "" {
+			query += " ORDER BY " + order
+		}
+		if options.Limit != 0 {
+			query += fmt.Sprintf(" LIMIT %d", options.Limit)
+		}
+		if options.Offset != 0 {
+			query += fmt.Sprintf(" OFFSET %d", options.Offset)
+		}
+	}
+
+	rows, err := p.DB.Query(query, args...)
+	if err != nil {
+		return errIter(err)
+	}
+	return &pgIter{rows: rows}
+}
+
+// Pinger checks the connection on a random schedule like Mongo.Pinger.
+// database/sql reconnects on its own so errors are only logged.
+func (p *Postgres) Pinger() {
+	rand.Seed(time.Now().UTC().UnixNano())
+	time.Sleep(time.Duration(rand.Intn(5)) * time.Second)
+
+	for {
+		log.Infof("ping hosts:%s", p.Hosts)
+		err := p.DB.Ping()
+		if err != nil {
+			log.Error(err)
+		}
+		time.Sleep(40 * time.Second)
+	}
+}
+
+// Close closes the database connections.
+func (p *Postgres) Close() {
+	p.DB.Close()
+}
@@ -0,0 +1,990 @@
+package pfftdb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// import and export formats
+	FormatCSV      = "csv"
+	FormatNTriples = "ntriples"
+	FormatTurtle   = "turtle"
+
+	rdfJSON = rdfNS + "JSON"
+)
+
+// RDFReader reads triples from N-Triples or Turtle. N-Triples is a subset
+// of Turtle so both are handled by the same parser, the N-Triples reader
+// only rejects directives and prefixed names.
+type RDFReader struct {
+	// Base is used to resolve relative iris, relative iris are kept as
+	// is when empty.
+	Base     string
+	Prefixes map[string]string
+
+	r      *bufio.Reader
+	line   int
+	strict bool
+	back   []rune
+	tok    *rdfToken
+	queue  []*Triple
+	anon   string
+	bnodes int
+	err    error
+}
+
+// NewNTriplesReader returns a reader for N-Triples.
+func NewNTriplesReader(r io.Reader) *RDFReader {
+	rr := NewTurtleReader(r)
+	rr.strict = true
+	return rr
+}
+
+// NewTurtleReader returns a reader for Turtle.
+func NewTurtleReader(r io.Reader) *RDFReader {
+	return &RDFReader{
+		Prefixes: map[string]string{},
+		r:        bufio.NewReader(r),
+		line:     1,
+		anon:     "_:anon" + strconv.FormatInt(time.Now().UnixNano(), 36) + "x",
+	}
+}
+
+// Read returns the next triple or io.EOF after the last one.
+func (rr *RDFReader) Read() (*Triple, error) {
+	for len(rr.queue) == 0 {
+		if rr.err != nil {
+			return nil, rr.err
+		}
+		err := rr.statement()
+		if err == io.EOF {
+			rr.err = err
+		} else if err != nil {
+			rr.queue = nil
+			rr.err = fmt.Errorf("line %d: %v", rr.line, err)
+		}
+	}
+	triple := rr.queue[0]
+	rr.queue = rr.queue[1:]
+	return triple, nil
+}
+
+// turtle token kinds
+const (
+	ttlEOF = iota
+	ttlIRI
+	ttlPName
+	ttlBNode
+	ttlString
+	ttlLang
+	ttlDatatype
+	ttlInteger
+	ttlDecimal
+	ttlDouble
+	ttlWord
+	ttlPunct
+)
+
+// rdfToken is a lexical token, text holds the unescaped value.
+type rdfToken struct {
+	kind int
+	text string
+}
+
+func (rr *RDFReader) readRune() (rune, error) {
+	if n := len(rr.back); n > 0 {
+		c := rr.back[n-1]
+		rr.back = rr.back[:n-1]
+		if c == '\n' {
+			rr.line++
+		}
+		return c, nil
+	}
+	c, _, err := rr.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\n' {
+		rr.line++
+	}
+	return c, nil
+}
+
+func (rr *RDFReader) unreadRune(c rune) {
+	if c == '\n' {
+		rr.line--
+	}
+	rr.back = append(rr.back, c)
+}
+
+// peekRune returns the next rune without consuming it, 0 at the end.
+func (rr *RDFReader) peekRune() rune {
+	c, err := rr.readRune()
+	if err != nil {
+		return 0
+	}
+	rr.unreadRune(c)
+	return c
+}
+
+// unread pushes back a single token.
+func (rr *RDFReader) unread(tok *rdfToken) {
+	rr.tok = tok
+}
+
+// next returns the next token.
+func (rr *RDFReader) next() (*rdfToken, error) {
+	if rr.tok != nil {
+		tok := rr.tok
+		rr.tok = nil
+		return tok, nil
+	}
+
+	var c rune
+	var err error
+	for {
+		c, err = rr.readRune()
+		if err == io.EOF {
+			return &rdfToken{kind: ttlEOF}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c == '#' {
+			for c != '\n' {
+				if c, err = rr.readRune(); err != nil {
+					return &rdfToken{kind: ttlEOF}, nil
+				}
+			}
+			continue
+		}
+		if !unicode.IsSpace(c) {
+			break
+		}
+	}
+
+	switch {
+	case c == '<':
+		return rr.iri()
+	case c == '"' || c == '\'':
+		return rr.str(c)
+	case c == '@':
+		word := rr.word(func(c rune) bool { return isLetterDigit(c) || c == '-' })
+		switch word {
+		case "":
+			return nil, fmt.Errorf("invalid language tag")
+		case "prefix", "base":
+			return &rdfToken{kind: ttlWord, text: "@" + word}, nil
+		}
+		return &rdfToken{kind: ttlLang, text: word}, nil
+	case c == '^':
+		if c, _ = rr.readRune(); c != '^' {
+			return nil, fmt.Errorf("expected ^^")
+		}
+		return &rdfToken{kind: ttlDatatype, text: "^^"}, nil
+	case c == '_' && rr.peekRune() == ':':
+		rr.readRune()
+		label := rr.name()
+		if label == "" {
+			return nil, fmt.Errorf("invalid blank node label")
+		}
+		return &rdfToken{kind: ttlBNode, text: "_:" + label}, nil
+	case c == '.' && unicode.IsDigit(rr.peekRune()), c >= '0' && c <= '9', c == '+', c == '-':
+		return rr.number(c)
+	case strings.ContainsRune(".;,[]()", c):
+		return &rdfToken{kind: ttlPunct, text: string(c)}, nil
+	}
+
+	rr.unreadRune(c)
+	word := rr.name()
+	if word == "" {
+		return nil, fmt.Errorf("unexpected %q", c)
+	}
+	if strings.Contains(word, ":") {
+		return &rdfToken{kind: ttlPName, text: word}, nil
+	}
+	return &rdfToken{kind: ttlWord, text: word}, nil
+}
+
+func isLetterDigit(c rune) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c))
+}
+
+// word reads runes while ok.
+func (rr *RDFReader) word(ok func(rune) bool) string {
+	var b strings.Builder
+	for {
+		c, err := rr.readRune()
+		if err != nil {
+			break
+		}
+		if !ok(c) {
+			rr.unreadRune(c)
+			break
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// name reads a prefixed name, keyword or blank node label. Names can't
+// end with a dot so a trailing one is left for the statement.
+func (rr *RDFReader) name() string {
+	var b strings.Builder
+	for {
+		c, err := rr.readRune()
+		if err != nil {
+			break
+		}
+		if c == '\\' {
+			if c, err = rr.readRune(); err != nil {
+				break
+			}
+		} else if !isLetterDigit(c) && c <= unicode.MaxASCII && !strings.ContainsRune("_-.:%", c) {
+			rr.unreadRune(c)
+			break
+		}
+		b.WriteRune(c)
+	}
+	s := b.String()
+	for strings.HasSuffix(s, ".") {
+		s = s[:len(s)-1]
+		rr.unreadRune('.')
+	}
+	return s
+}
+
+// iri reads an iri after the opening <.
+func (rr *RDFReader) iri() (*rdfToken, error) {
+	var b strings.Builder
+	for {
+		c, err := rr.readRune()
+		if err != nil {
+			return nil, fmt.Errorf("unterminated iri")
+		}
+		switch {
+		case c == '>':
+			return &rdfToken{kind: ttlIRI, text: b.String()}, nil
+		case c == '\\':
+			c, err = rr.escape(false)
+			if err != nil {
+				return nil, err
+			}
+		case c <= ' ' || strings.ContainsRune(`<"{}|^`+"`", c):
+			return nil, fmt.Errorf("invalid character %q in iri", c)
+		}
+		b.WriteRune(c)
+	}
+}
+
+// escape reads an escape sequence after the backslash, string escapes
+// are only allowed in literals.
+func (rr *RDFReader) escape(str bool) (rune, error) {
+	c, err := rr.readRune()
+	if err != nil {
+		return 0, fmt.Errorf("invalid escape")
+	}
+	n := 0
+	switch c {
+	case 'u':
+		n = 4
+	case 'U':
+		n = 8
+	default:
+		if !str {
+			return 0, fmt.Errorf("invalid escape \\%c", c)
+		}
+		switch c {
+		case 't':
+			return '\t', nil
+		case 'b':
+			return '\b', nil
+		case 'n':
+			return '\n', nil
+		case 'r':
+			return '\r', nil
+		case 'f':
+			return '\f', nil
+		case '"', '\'', '\\':
+			return c, nil
+		}
+		return 0, fmt.Errorf("invalid escape \\%c", c)
+	}
+	hex := make([]rune, n)
+	for i := range hex {
+		if hex[i], err = rr.readRune(); err != nil {
+			return 0, fmt.Errorf("invalid escape")
+		}
+	}
+	code, err := strconv.ParseUint(string(hex), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid escape \\%c%s", c, string(hex))
+	}
+	return rune(code), nil
+}
+
+// str reads a short or long quoted string after the opening quote.
+func (rr *RDFReader) str(quote rune) (*rdfToken, error) {
+	long := false
+	if rr.peekRune() == quote {
+		rr.readRune()
+		if rr.peekRune() != quote {
+			return &rdfToken{kind: ttlString}, nil
+		}
+		rr.readRune()
+		long = true
+	}
+
+	var b strings.Builder
+	quotes := 0
+	for {
+		c, err := rr.readRune()
+		if err != nil {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		if c == quote {
+			if !long {
+				return &rdfToken{kind: ttlString, text: b.String()}, nil
+			}
+			// quotes right before the closing ones are part of the string
+			b.WriteRune(c)
+			quotes++
+			if quotes >= 3 && rr.peekRune() != quote {
+				s := b.String()
+				return &rdfToken{kind: ttlString, text: s[:len(s)-3]}, nil
+			}
+			continue
+		}
+		quotes = 0
+		switch {
+		case c == '\\':
+			c, err = rr.escape(true)
+			if err != nil {
+				return nil, err
+			}
+		case !long && (c == '\n' || c == '\r'):
+			return nil, fmt.Errorf("newline in string")
+		}
+		b.WriteRune(c)
+	}
+}
+
+// number reads an integer, decimal or double.
+func (rr *RDFReader) number(c rune) (*rdfToken, error) {
+	digits := func(c rune) bool { return c >= '0' && c <= '9' }
+	kind := ttlInteger
+	text := string(c)
+	if c != '.' {
+		text += rr.word(digits)
+		if c, _ := rr.readRune(); c == '.' {
+			if digits(rr.peekRune()) {
+				text += "."
+			} else {
+				rr.unreadRune(c)
+			}
+		} else if c != 0 {
+			rr.unreadRune(c)
+		}
+	}
+	if strings.HasSuffix(text, ".") {
+		kind = ttlDecimal
+		text += rr.word(digits)
+	}
+	if c := rr.peekRune(); c == 'e' || c == 'E' {
+		rr.readRune()
+		kind = ttlDouble
+		text += "e"
+		if c := rr.peekRune(); c == '+' || c == '-' {
+			rr.readRune()
+			text += string(c)
+		}
+		exp := rr.word(digits)
+		if exp == "" {
+			return nil, fmt.Errorf("invalid double %s", text)
+		}
+		text += exp
+	}
+	if strings.Trim(text, "+-.") == "" {
+		return nil, fmt.Errorf("invalid number %s", text)
+	}
+	return &rdfToken{kind: kind, text: text}, nil
+}
+
+// expect reads a punctuation token.
+func (rr *RDFReader) expect(punct string) error {
+	tok, err := rr.next()
+	if err != nil {
+		return err
+	}
+	if tok.kind != ttlPunct || tok.text != punct {
+		return fmt.Errorf("expected %s got %q", punct, tok.text)
+	}
+	return nil
+}
+
+// statement parses a directive or a set of triples into the queue.
+func (rr *RDFReader) statement() error {
+	tok, err := rr.next()
+	if err != nil {
+		return err
+	}
+	if tok.kind == ttlEOF {
+		return io.EOF
+	}
+
+	if tok.kind == ttlWord {
+		directive := strings.ToLower(tok.text)
+		switch directive {
+		case "@prefix", "prefix", "@base", "base":
+			if rr.strict {
+				return fmt.Errorf("directive %s not allowed in n-triples", tok.text)
+			}
+			return rr.directive(directive)
+		}
+	}
+
+	sub, err := rr.node(tok)
+	if err != nil {
+		return err
+	}
+	tok, err = rr.next()
+	if err != nil {
+		return err
+	}
+	rr.unread(tok)
+	// a blank node property list can be a statement on its own
+	if !(tok.kind == ttlPunct && tok.text == "." && strings.HasPrefix(sub, rr.anon)) {
+		if err := rr.predicateObjects(sub); err != nil {
+			return err
+		}
+	}
+	return rr.expect(".")
+}
+
+// directive parses prefix and base directives, the sparql forms have no
+// trailing dot.
+func (rr *RDFReader) directive(directive string) error {
+	var prefix string
+	if strings.HasSuffix(directive, "prefix") {
+		tok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		if tok.kind != ttlPName || !strings.HasSuffix(tok.text, ":") {
+			return fmt.Errorf("invalid prefix %q", tok.text)
+		}
+		prefix = strings.TrimSuffix(tok.text, ":")
+	}
+	tok, err := rr.next()
+	if err != nil {
+		return err
+	}
+	if tok.kind != ttlIRI {
+		return fmt.Errorf("expected iri got %q", tok.text)
+	}
+	iri := rr.resolve(tok.text)
+	if strings.HasSuffix(directive, "prefix") {
+		rr.Prefixes[prefix] = iri
+	} else {
+		rr.Base = iri
+	}
+	if strings.HasPrefix(directive, "@") {
+		return rr.expect(".")
+	}
+	return nil
+}
+
+// resolve resolves a relative iri against the base.
+func (rr *RDFReader) resolve(iri string) string {
+	if rr.Base == "" {
+		return iri
+	}
+	base, err := url.Parse(rr.Base)
+	if err != nil {
+		return iri
+	}
+	ref, err := url.Parse(iri)
+	if err != nil || ref.IsAbs() {
+		return iri
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// newBlank returns a fresh blank node label.
+func (rr *RDFReader) newBlank() string {
+	rr.bnodes++
+	return rr.anon + strconv.Itoa(rr.bnodes)
+}
+
+// iriOrName converts an iri or prefixed name token.
+func (rr *RDFReader) iriOrName(tok *rdfToken) (string, bool, error) {
+	switch tok.kind {
+	case ttlIRI:
+		return rr.resolve(tok.text), true, nil
+	case ttlPName:
+		if rr.strict {
+			return "", true, fmt.Errorf("prefixed name %s not allowed in n-triples", tok.text)
+		}
+		i := strings.Index(tok.text, ":")
+		ns, ok := rr.Prefixes[tok.text[:i]]
+		if !ok {
+			return "", true, fmt.Errorf("undefined prefix %s", tok.text[:i+1])
+		}
+		return ns + tok.text[i+1:], true, nil
+	}
+	return "", false, nil
+}
+
+// node parses a subject, an iri, blank node, blank node property list
+// or collection.
+func (rr *RDFReader) node(tok *rdfToken) (string, error) {
+	if iri, ok, err := rr.iriOrName(tok); ok {
+		return iri, err
+	}
+	switch {
+	case tok.kind == ttlBNode:
+		return tok.text, nil
+	case tok.kind == ttlPunct && tok.text == "[":
+		sub := rr.newBlank()
+		next, err := rr.next()
+		if err != nil {
+			return "", err
+		}
+		if next.kind == ttlPunct && next.text == "]" {
+			return sub, nil
+		}
+		rr.unread(next)
+		if err := rr.predicateObjects(sub); err != nil {
+			return "", err
+		}
+		return sub, rr.expect("]")
+	case tok.kind == ttlPunct && tok.text == "(":
+		return rr.collection()
+	}
+	return "", fmt.Errorf("unexpected %q", tok.text)
+}
+
+// collection parses the items of a list into rdf:first and rdf:rest
+// triples.
+func (rr *RDFReader) collection() (string, error) {
+	head := rdfNS + "nil"
+	var last string
+	for {
+		tok, err := rr.next()
+		if err != nil {
+			return "", err
+		}
+		if tok.kind == ttlPunct && tok.text == ")" {
+			if last != "" {
+				rr.queue = append(rr.queue, &Triple{last, rdfNS + "rest", rdfNS + "nil"})
+			}
+			return head, nil
+		}
+		if tok.kind == ttlEOF {
+			return "", fmt.Errorf("unterminated collection")
+		}
+		item, err := rr.object(tok)
+		if err != nil {
+			return "", err
+		}
+		node := rr.newBlank()
+		if last == "" {
+			head = node
+		} else {
+			rr.queue = append(rr.queue, &Triple{last, rdfNS + "rest", node})
+		}
+		rr.queue = append(rr.queue, &Triple{node, rdfNS + "first", item})
+		last = node
+	}
+}
+
+// object parses an object, a node or a literal.
+func (rr *RDFReader) object(tok *rdfToken) (interface{}, error) {
+	switch tok.kind {
+	case ttlString:
+		next, err := rr.next()
+		if err != nil {
+			return nil, err
+		}
+		switch next.kind {
+		case ttlLang:
+			return literalValue(tok.text, next.text, ""), nil
+		case ttlDatatype:
+			dt, err := rr.next()
+			if err != nil {
+				return nil, err
+			}
+			datatype, ok, err := rr.iriOrName(dt)
+			if !ok {
+				return nil, fmt.Errorf("expected datatype got %q", dt.text)
+			}
+			return literalValue(tok.text, "", datatype), err
+		}
+		rr.unread(next)
+		return tok.text, nil
+	case ttlInteger:
+		return literalValue(strings.TrimPrefix(tok.text, "+"), "", xsdNS+"integer"), nil
+	case ttlDecimal:
+		return literalValue(tok.text, "", xsdNS+"decimal"), nil
+	case ttlDouble:
+		return literalValue(tok.text, "", xsdNS+"double"), nil
+	case ttlWord:
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return rr.node(tok)
+}
+
+// predicateObjects parses a predicate object list for a subject.
+func (rr *RDFReader) predicateObjects(sub string) error {
+	for {
+		tok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		pred, ok, err := rr.iriOrName(tok)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if tok.kind != ttlWord || tok.text != "a" {
+				return fmt.Errorf("expected predicate got %q", tok.text)
+			}
+			pred = rdfNS + "type"
+		}
+
+		for {
+			tok, err = rr.next()
+			if err != nil {
+				return err
+			}
+			obj, err := rr.object(tok)
+			if err != nil {
+				return err
+			}
+			rr.queue = append(rr.queue, &Triple{sub, pred, obj})
+			if tok, err = rr.next(); err != nil {
+				return err
+			}
+			if tok.kind != ttlPunct || tok.text != "," {
+				break
+			}
+		}
+
+		if tok.kind != ttlPunct || tok.text != ";" {
+			rr.unread(tok)
+			return nil
+		}
+		for tok.kind == ttlPunct && tok.text == ";" {
+			if tok, err = rr.next(); err != nil {
+				return err
+			}
+		}
+		rr.unread(tok)
+		if tok.kind == ttlPunct && (tok.text == "." || tok.text == "]") {
+			return nil
+		}
+	}
+}
+
+// ntEscaper escapes literals for N-Triples and Turtle.
+var ntEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// ntIRI formats an iri escaping characters not allowed in iris.
+func ntIRI(iri string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, c := range iri {
+		if c <= ' ' || strings.ContainsRune(`<>"{}|^\`+"`", c) {
+			fmt.Fprintf(&b, `\u%04X`, c)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// validBlank reports whether a string is a blank node with a label that
+// can be written as is.
+func validBlank(s string) bool {
+	if !strings.HasPrefix(s, "_:") || len(s) == 2 || strings.HasSuffix(s, ".") {
+		return false
+	}
+	for _, c := range s[2:] {
+		if !isLetterDigit(c) && c <= unicode.MaxASCII && !strings.ContainsRune("_-.", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ntLiteral formats a literal with a language tag or datatype.
+func ntLiteral(value, lang, datatype string, iri func(string) string) string {
+	s := `"` + ntEscaper.Replace(value) + `"`
+	if lang != "" {
+		return s + "@" + lang
+	}
+	if datatype != "" && datatype != xsdNS+"string" {
+		return s + "^^" + iri(datatype)
+	}
+	return s
+}
+
+// ntNode formats a subject or predicate, they are always iris or blank
+// nodes.
+func ntNode(val interface{}, iri func(string) string) (string, error) {
+	s, ok := val.(string)
+	if !ok || s == SPEMPTY {
+		return "", fmt.Errorf("invalid node %v", val)
+	}
+	if validBlank(s) {
+		return s, nil
+	}
+	return iri(s), nil
+}
+
+// ntObject formats an object. Strings are iris if they look like one,
+// numbers and booleans become xsd typed literals and anything else is
+// kept as json.
+func ntObject(val interface{}, iri func(string) string) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "", fmt.Errorf("invalid object %v", val)
+	case string:
+		if validBlank(v) {
+			return v, nil
+		}
+		if isIRI(v, nil) {
+			return iri(v), nil
+		}
+		return ntLiteral(v, "", "", iri), nil
+	case Literal:
+		return ntLiteral(v.Value, v.Lang, v.Datatype, iri), nil
+	case *Literal:
+		return ntLiteral(v.Value, v.Lang, v.Datatype, iri), nil
+	case bool:
+		return ntLiteral(strconv.FormatBool(v), "", xsdNS+"boolean", iri), nil
+	case float32, float64:
+		f, _ := toFloat(v)
+		var s string
+		switch {
+		case math.IsInf(f, 1):
+			s = "INF"
+		case math.IsInf(f, -1):
+			s = "-INF"
+		default:
+			s = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return ntLiteral(s, "", xsdNS+"double", iri), nil
+	}
+	if _, ok := toFloat(val); ok {
+		return ntLiteral(fmt.Sprint(val), "", xsdNS+"integer", iri), nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return ntLiteral(string(b), "", rdfJSON, iri), nil
+}
+
+// NTriplesWriter writes triples as N-Triples.
+type NTriplesWriter struct {
+	w *bufio.Writer
+}
+
+// NewNTriplesWriter returns a writer for N-Triples.
+func NewNTriplesWriter(w io.Writer) *NTriplesWriter {
+	return &NTriplesWriter{w: bufio.NewWriter(w)}
+}
+
+// Write writes a single triple.
+func (nw *NTriplesWriter) Write(triple *Triple) error {
+	sub, err := ntNode(triple[0], ntIRI)
+	if err != nil {
+		return err
+	}
+	pred, err := ntNode(triple[1], ntIRI)
+	if err != nil {
+		return err
+	}
+	obj, err := ntObject(triple[2], ntIRI)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(nw.w, "%s %s %s .\n", sub, pred, obj)
+	return err
+}
+
+// Flush writes any buffered data.
+func (nw *NTriplesWriter) Flush() error {
+	return nw.w.Flush()
+}
+
+// TurtleWriter writes triples as Turtle, consecutive triples with the
+// same subject are grouped.
+type TurtleWriter struct {
+	Prefixes map[string]string
+
+	w         *bufio.Writer
+	header    bool
+	sub, pred string
+}
+
+// NewTurtleWriter returns a writer for Turtle, iris starting with one of
+// the prefixes are written as prefixed names.
+func NewTurtleWriter(w io.Writer, prefixes map[string]string) *TurtleWriter {
+	return &TurtleWriter{Prefixes: prefixes, w: bufio.NewWriter(w)}
+}
+
+// iri formats an iri as a prefixed name if possible.
+func (tw *TurtleWriter) iri(iri string) string {
+	prefix, ns := "", ""
+	for p, n := range tw.Prefixes {
+		if strings.HasPrefix(iri, n) && len(n) > len(ns) {
+			prefix, ns = p, n
+		}
+	}
+	if ns == "" {
+		return ntIRI(iri)
+	}
+	local := iri[len(ns):]
+	for i, c := range local {
+		if !isLetterDigit(c) && c != '_' && (i == 0 || c != '-') {
+			return ntIRI(iri)
+		}
+	}
+	return prefix + ":" + local
+}
+
+// Write writes a single triple.
+func (tw *TurtleWriter) Write(triple *Triple) error {
+	if !tw.header {
+		tw.header = true
+		prefixes := make([]string, 0, len(tw.Prefixes))
+		for p := range tw.Prefixes {
+			prefixes = append(prefixes, p)
+		}
+		sort.Strings(prefixes)
+		for _, p := range prefixes {
+			fmt.Fprintf(tw.w, "@prefix %s: %s .\n", p, ntIRI(tw.Prefixes[p]))
+		}
+		if len(prefixes) > 0 {
+			tw.w.WriteString("\n")
+		}
+	}
+
+	sub, err := ntNode(triple[0], tw.iri)
+	if err != nil {
+		return err
+	}
+	pred, err := ntNode(triple[1], tw.iri)
+	if err != nil {
+		return err
+	}
+	if triple[1] == rdfNS+"type" {
+		pred = "a"
+	}
+	var obj string
+	switch v := triple[2].(type) {
+	case bool:
+		obj = strconv.FormatBool(v)
+	case float32, float64:
+		obj, err = ntObject(v, tw.iri)
+		if f, _ := toFloat(v); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			obj = strconv.FormatFloat(f, 'E', -1, 64)
+		}
+	default:
+		if _, ok := toFloat(v); ok {
+			obj = fmt.Sprint(v)
+		} else {
+			obj, err = ntObject(v, tw.iri)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case sub == tw.sub && pred == tw.pred:
+		_, err = fmt.Fprintf(tw.w, " ,\n\t\t%s", obj)
+	case sub == tw.sub:
+		_, err = fmt.Fprintf(tw.w, " ;\n\t%s %s", pred, obj)
+	default:
+		if tw.sub != "" {
+			tw.w.WriteString(" .\n")
+		}
+		_, err = fmt.Fprintf(tw.w, "%s %s %s", sub, pred, obj)
+	}
+	tw.sub, tw.pred = sub, pred
+	return err
+}
+
+// Flush ends the last statement and writes any buffered data.
+func (tw *TurtleWriter) Flush() error {
+	if tw.sub != "" {
+		tw.w.WriteString(" .\n")
+		tw.sub, tw.pred = "", ""
+	}
+	return tw.w.Flush()
+}
+
+// csvReader reads triples from 3 column csv skipping invalid lines
+// like Graph.Load.
+type csvReader struct {
+	r *csv.Reader
+}
+
+// Read returns the next triple or io.EOF after the last one.
+func (cr *csvReader) Read() (*Triple, error) {
+	for {
+		fields, err := cr.r.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil || len(fields) != 3 || fields[0] == SPEMPTY || fields[1] == SPEMPTY {
+			continue
+		}
+		return &Triple{fields[0], fields[1], csvObject(fields[2])}, nil
+	}
+}
+
+// csvField formats an object for csv. Strings are written as is and other
+// objects, or strings which would read as one, as N-Triples literals.
+func csvField(val interface{}) (string, error) {
+	if s, ok := val.(string); ok {
+		if strings.HasPrefix(s, `"`) {
+			return ntLiteral(s, "", "", ntIRI), nil
+		}
+		return s, nil
+	}
+	return ntObject(val, ntIRI)
+}
+
+// csvObject reads an object written by csvField, fields which aren't an
+// N-Triples literal are strings.
+func csvObject(field string) interface{} {
+	if !strings.HasPrefix(field, `"`) {
+		return field
+	}
+	triple, err := NewNTriplesReader(strings.NewReader("_:s <p> " + field + " .")).Read()
+	if err != nil {
+		return field
+	}
+	return triple[2]
+}
@@ -0,0 +1,234 @@
+package pfftdb
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, r tripleReader) []*Triple {
+	triples := []*Triple{}
+	for {
+		triple, err := r.Read()
+		if err == io.EOF {
+			return triples
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		triples = append(triples, triple)
+	}
+}
+
+func TestNTriplesReader(t *testing.T) {
+	nt := `# comment
+<http://eurisko.io/paul> <http://xmlns.com/foaf/0.1/name> "Paul \"P\"\n" .
+_:b1 <http://xmlns.com/foaf/0.1/knows> <http://eurisko.io/paul> . # trailing
+_:b1 <http://eurisko.io/age> "30"^^<http://www.w3.org/2001/XMLSchema#integer> .
+_:b1 <http://eurisko.io/height> "1.8"^^<http://www.w3.org/2001/XMLSchema#decimal> .
+_:b1 <http://eurisko.io/active> "true"^^<http://www.w3.org/2001/XMLSchema#boolean> .
+
+_:b1 <http://xmlns.com/foaf/0.1/name> "chat"@fr .
+_:b1 <http://eurisko.io/born> "1984-01-02T00:00:00Z"^^<http://www.w3.org/2001/XMLSchema#dateTime> .
+<paul\u0020s> <has> "é" .
+`
+	triples := readAll(t, NewNTriplesReader(strings.NewReader(nt)))
+	expected := []*Triple{
+		&Triple{"http://eurisko.io/paul", "http://xmlns.com/foaf/0.1/name", "Paul \"P\"\n"},
+		&Triple{"_:b1", "http://xmlns.com/foaf/0.1/knows", "http://eurisko.io/paul"},
+		&Triple{"_:b1", "http://eurisko.io/age", 30},
+		&Triple{"_:b1", "http://eurisko.io/height", 1.8},
+		&Triple{"_:b1", "http://eurisko.io/active", true},
+		&Triple{"_:b1", "http://xmlns.com/foaf/0.1/name", Literal{Value: "chat", Lang: "fr"}},
+		&Triple{"_:b1", "http://eurisko.io/born", Literal{Value: "1984-01-02T00:00:00Z", Datatype: xsdNS + "dateTime"}},
+		&Triple{"paul s", "has", "é"},
+	}
+	if !reflect.DeepEqual(triples, expected) {
+		for _, tr := range triples {
+			t.Error(*tr)
+		}
+	}
+
+	var bad = []string{
+		`<a> <b> "c"`,
+		`<a> <b> "c .`,
+		`@prefix foaf: <http://xmlns.com/foaf/0.1/> .`,
+		`<a> foaf:name "c" .`,
+		`<a b> <b> "c" .`,
+	}
+	for _, b := range bad {
+		r := NewNTriplesReader(strings.NewReader("<x> <y> <z> .\n" + b))
+		if _, err := r.Read(); err != nil {
+			t.Error("first line should be read for", b, err)
+		}
+		if _, err := r.Read(); err == nil || !strings.HasPrefix(err.Error(), "line 2") {
+			t.Error("should have gotten error on line 2 for", b, err)
+		}
+	}
+}
+
+func TestTurtleReader(t *testing.T) {
+	ttl := `@base <http://eurisko.io/> .
+@prefix foaf: <http://xmlns.com/foaf/0.1/> .
+PREFIX : <http://eurisko.io/ns#>
+
+<paul> a foaf:Person ;
+	foaf:name "Paul", 'P'@en ;
+	:age 30 ; :height 1.8 ; :weight 7.5e1 ;
+	:active false ;
+	foaf:knows [ foaf:name "Kevin" ] ;
+	:tags ( "a" 2 ) ;
+	:bio """line
+"quoted"""" ;
+	:born "1984-01-02"^^<http://www.w3.org/2001/XMLSchema#date> .
+_:x foaf:knows <paul>.
+`
+	r := NewTurtleReader(strings.NewReader(ttl))
+	triples := readAll(t, r)
+	if len(triples) != 17 {
+		for _, tr := range triples {
+			t.Log(*tr)
+		}
+		t.Fatal("should have 17 triples got:", len(triples))
+	}
+	paul := "http://eurisko.io/paul"
+	var tests = []struct {
+		i   int
+		out Triple
+	}{
+		{0, Triple{paul, rdfNS + "type", "http://xmlns.com/foaf/0.1/Person"}},
+		{1, Triple{paul, "http://xmlns.com/foaf/0.1/name", "Paul"}},
+		{2, Triple{paul, "http://xmlns.com/foaf/0.1/name", Literal{Value: "P", Lang: "en"}}},
+		{3, Triple{paul, "http://eurisko.io/ns#age", 30}},
+		{4, Triple{paul, "http://eurisko.io/ns#height", 1.8}},
+		{5, Triple{paul, "http://eurisko.io/ns#weight", 75.0}},
+		{6, Triple{paul, "http://eurisko.io/ns#active", false}},
+		{15, Triple{paul, "http://eurisko.io/ns#born", Literal{Value: "1984-01-02", Datatype: xsdNS + "date"}}},
+		{16, Triple{"_:x", "http://xmlns.com/foaf/0.1/knows", paul}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(*triples[tt.i], tt.out) {
+			t.Errorf("%d should be %v got %v", tt.i, tt.out, *triples[tt.i])
+		}
+	}
+
+	// nested blank node comes before the triple using it
+	kevin := triples[7][0]
+	if triples[7][2] != "Kevin" || *triples[8] != (Triple{paul, "http://xmlns.com/foaf/0.1/knows", kevin}) {
+		t.Error("blank node property list", *triples[7], *triples[8])
+	}
+	// collection
+	if triples[9][1] != rdfNS+"first" || triples[9][2] != "a" || triples[11][2] != 2 || triples[12][2] != rdfNS+"nil" {
+		t.Error("collection", *triples[9], *triples[11], *triples[12])
+	}
+	if triples[14][2] != "line\n\"quoted\"" {
+		t.Errorf("long string %q", triples[14][2])
+	}
+	if r.Prefixes["foaf"] != "http://xmlns.com/foaf/0.1/" {
+		t.Error("prefixes", r.Prefixes)
+	}
+
+	_, err := NewTurtleReader(strings.NewReader(`<a> x:b <c> .`)).Read()
+	if err == nil {
+		t.Error("undefined prefix should be an error")
+	}
+}
+
+func TestRDFWriters(t *testing.T) {
+	triples := []*Triple{
+		&Triple{"http://eurisko.io/paul", rdfNS + "type", "http://xmlns.com/foaf/0.1/Person"},
+		&Triple{"http://eurisko.io/paul", "http://xmlns.com/foaf/0.1/name", "Paul \"P\"\n"},
+		&Triple{"http://eurisko.io/paul", "http://xmlns.com/foaf/0.1/name", Literal{Value: "P", Lang: "en"}},
+		&Triple{"http://eurisko.io/paul", "http://eurisko.io/age", 30},
+		&Triple{"http://eurisko.io/paul", "http://eurisko.io/height", 1.8},
+		&Triple{"http://eurisko.io/paul", "http://eurisko.io/weight", 75.0},
+		&Triple{"http://eurisko.io/paul", "http://eurisko.io/active", true},
+		&Triple{"_:b1", "foaf:knows", "_:b2"},
+		&Triple{"_:b1", "foaf:name", "foaf:name"},
+		&Triple{"_:b1", "location:address", map[string]interface{}{"lat": 1.5}},
+		&Triple{"paul", "born", Literal{Value: "1984-01-02", Datatype: xsdNS + "date"}},
+	}
+
+	buf := &bytes.Buffer{}
+	nw := NewNTriplesWriter(buf)
+	for _, triple := range triples {
+		if err := nw.Write(triple); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nw.Flush()
+	if !strings.Contains(buf.String(), `<http://eurisko.io/paul> <http://eurisko.io/age> "30"^^<http://www.w3.org/2001/XMLSchema#integer> .`) {
+		t.Error(buf.String())
+	}
+	if out := readAll(t, NewNTriplesReader(buf)); !reflect.DeepEqual(out, triples) {
+		for _, tr := range out {
+			t.Error("ntriples", *tr)
+		}
+	}
+
+	buf.Reset()
+	tw := NewTurtleWriter(buf, map[string]string{"foaf": "http://xmlns.com/foaf/0.1/", "eu": "http://eurisko.io/"})
+	for _, triple := range triples {
+		if err := tw.Write(triple); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Flush()
+	ttl := buf.String()
+	if !strings.Contains(ttl, "eu:paul a foaf:Person ;\n\tfoaf:name ") || !strings.Contains(ttl, "eu:age 30 ;") {
+		t.Error(ttl)
+	}
+	if out := readAll(t, NewTurtleReader(buf)); !reflect.DeepEqual(out, triples) {
+		for _, tr := range out {
+			t.Error("turtle", *tr)
+		}
+	}
+
+	if err := nw.Write(&Triple{"", "b", "c"}); err == nil {
+		t.Error("empty subject should be an error")
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	ttl := `@prefix foaf: <http://xmlns.com/foaf/0.1/> .
+_:paul foaf:name "Paul" ; foaf:age 30 ; foaf:nick "P"@en ; foaf:knows _:kevin .
+`
+	total, err := GRPH.Import(strings.NewReader(ttl), FormatTurtle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 {
+		t.Error("should have imported 4 got:", total)
+	}
+
+	buf := &bytes.Buffer{}
+	err = GRPH.Export(buf, FormatNTriples, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanupGraph()
+	total, err = GRPH.Import(buf, FormatNTriples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 {
+		t.Error("should have imported 4 got:", total)
+	}
+	if v, _ := GRPH.Value("_:paul", "http://xmlns.com/foaf/0.1/nick", nil); v != (Literal{Value: "P", Lang: "en"}) {
+		t.Error("language literal not preserved", v)
+	}
+
+	total, err = GRPH.Import(strings.NewReader("<a> <b> <c> .\n<a> <b>"), FormatNTriples)
+	if err == nil || total != 1 {
+		t.Error("should have imported 1 before the error got:", total, err)
+	}
+
+	if _, err := GRPH.Import(strings.NewReader(""), "xml"); err == nil {
+		t.Error("unknown format should be an error")
+	}
+}
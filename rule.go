@@ -0,0 +1,806 @@
+package pfftdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	// RulesGraphSuffix names the graph the rules of a graph are kept in.
+	RulesGraphSuffix = ".rules"
+	// InferredGraphSuffix names the graph which marks the triples of a
+	// graph that were inferred by its rules.
+	InferredGraphSuffix = ".inferred"
+
+	// rulePred is the predicate of a rule in the rules graph, the subject
+	// is the name and the object the text.
+	rulePred = "rule"
+)
+
+// Rule infers the Head triples for every binding of the Body clauses,
+// written as [?a foaf:knows ?b] => [?b foaf:knows ?a] with every clause
+// in brackets. Items are ?variables, names or iris, "quoted strings" and
+// numbers. Body predicates can be property paths, the head has to be
+// plain triples using variables of the body.
+type Rule struct {
+	Name string    `json:"name"`
+	Body []*Triple `json:"body"`
+	Head []*Triple `json:"head"`
+}
+
+// ParseRule parses the text of a rule.
+func ParseRule(name, text string) (*Rule, error) {
+	p := &ruleParser{text: text}
+	rule := &Rule{Name: name}
+	var err error
+	if rule.Body, err = p.clauses(); err != nil {
+		return nil, err
+	}
+	if !p.consume("=>") {
+		return nil, p.errorf("expected =>")
+	}
+	if rule.Head, err = p.clauses(); err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.text) {
+		return nil, p.errorf("unexpected %q", p.text[p.pos:])
+	}
+	return rule, rule.check()
+}
+
+// ruleParser reads the clauses of a rule.
+type ruleParser struct {
+	text string
+	pos  int
+}
+
+func (p *ruleParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("rule at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *ruleParser) skipSpace() {
+	for p.pos < len(p.text) && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume skips s if it is next.
+func (p *ruleParser) consume(s string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.text[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// clauses reads bracketed clauses until there are none.
+func (p *ruleParser) clauses() ([]*Triple, error) {
+	clauses := []*Triple{}
+	for p.consume("[") {
+		clause := &Triple{}
+		for i := range clause {
+			item, err := p.item()
+			if err != nil {
+				return nil, err
+			}
+			clause[i] = item
+		}
+		if !p.consume("]") {
+			return nil, p.errorf("expected ]")
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// item reads a quoted string, a number or a name.
+func (p *ruleParser) item() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return nil, p.errorf("unexpected end")
+	}
+	if p.text[p.pos] == '"' {
+		end := p.pos + 1
+		for ; end < len(p.text) && p.text[end] != '"'; end++ {
+			if p.text[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.text) {
+			return nil, p.errorf("unterminated string")
+		}
+		s, err := strconv.Unquote(p.text[p.pos : end+1])
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos = end + 1
+		return s, nil
+	}
+	start := p.pos
+	for p.pos < len(p.text) && !unicode.IsSpace(rune(p.text[p.pos])) && !strings.ContainsRune("[]\"", rune(p.text[p.pos])) {
+		p.pos++
+	}
+	word := p.text[start:p.pos]
+	if word == "" {
+		return nil, p.errorf("expected an item")
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return word, nil
+}
+
+// ruleItem formats an item so ParseRule reads it back.
+func ruleItem(item interface{}) string {
+	s, ok := item.(string)
+	if !ok {
+		if f, ok := toFloat(item); ok {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return strconv.Quote(fmt.Sprintf("%v", item))
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil || s == "" || s == "=>" ||
+		strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || strings.ContainsRune("[]\"", r) }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// String returns the text of the rule.
+func (r *Rule) String() string {
+	parts := []string{}
+	for _, clause := range r.Body {
+		parts = append(parts, "["+ruleItem(clause[0])+" "+ruleItem(clause[1])+" "+ruleItem(clause[2])+"]")
+	}
+	parts = append(parts, "=>")
+	for _, clause := range r.Head {
+		parts = append(parts, "["+ruleItem(clause[0])+" "+ruleItem(clause[1])+" "+ruleItem(clause[2])+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// isVar reports whether an item is a ?variable.
+func isVar(item interface{}) bool {
+	s, ok := item.(string)
+	return ok && strings.HasPrefix(s, "?")
+}
+
+// check validates the rule has a name, body and head and every head
+// variable is bound by the body.
+func (r *Rule) check() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without name")
+	}
+	if len(r.Body) == 0 || len(r.Head) == 0 {
+		return fmt.Errorf("rule %s needs a body and head", r.Name)
+	}
+	vars := map[string]bool{}
+	for _, clause := range r.Body {
+		if clause == nil {
+			return fmt.Errorf("rule %s has an empty clause", r.Name)
+		}
+		for _, item := range clause {
+			if isVar(item) {
+				vars[item.(string)] = true
+			}
+		}
+	}
+	for _, clause := range r.Head {
+		if clause == nil {
+			return fmt.Errorf("rule %s has an empty clause", r.Name)
+		}
+		for i, item := range clause {
+			if isVar(item) && !vars[item.(string)] {
+				return fmt.Errorf("rule %s head variable %s not in body", r.Name, item)
+			}
+			if s, ok := item.(string); i < 2 && (!ok || !isVar(item) && s == SPEMPTY) {
+				return fmt.Errorf("rule %s head subject and predicate have to be names", r.Name)
+			}
+		}
+		if pred, _ := clause[1].(string); isPath(pred) {
+			return fmt.Errorf("rule %s head predicate %s is a path", r.Name, pred)
+		}
+	}
+	return nil
+}
+
+// Triples returns the head triples for the bindings of the body
+// variables, without the ones which have a subject or predicate that
+// isn't a string.
+func (r *Rule) Triples(args map[string]interface{}) ([]*Triple, error) {
+	triples := []*Triple{}
+	for _, clause := range r.Head {
+		triple := substitute(clause, args)
+		if _, _, err := SubPred(triple[0], triple[1]); err != nil || isVar(triple[0]) || isVar(triple[1]) || isVar(triple[2]) {
+			continue
+		}
+		triples = append(triples, triple)
+	}
+	return triples, nil
+}
+
+// Apply infers the triples of the rule in a graph, see Graph.Infer.
+func (r *Rule) Apply(ctx context.Context, g *Graph) (*InferenceReport, error) {
+	report := newInferenceReport()
+	added, err := g.infer(ctx, []*Rule{r})
+	report.Added = len(added)
+	return report, err
+}
+
+// substitute replaces the variables of a clause with their bindings.
+func substitute(clause *Triple, args map[string]interface{}) *Triple {
+	triple := &Triple{}
+	for i, item := range clause {
+		triple[i] = item
+		if isVar(item) {
+			if val, ok := args[item.(string)[1:]]; ok && val != nil {
+				triple[i] = val
+			}
+		}
+	}
+	return triple
+}
+
+// unify binds the variables of a clause to a triple, ok is false if they
+// don't match.
+func unify(clause, triple *Triple) (Bindings, bool) {
+	b := Bindings{}
+	for i, item := range clause {
+		if !isVar(item) {
+			if objKey(item) != objKey(triple[i]) {
+				return nil, false
+			}
+			continue
+		}
+		name := item.(string)[1:]
+		if val, ok := b[name]; ok && objKey(val) != objKey(triple[i]) {
+			return nil, false
+		}
+		b[name] = triple[i]
+	}
+	return b, true
+}
+
+// RuleInference applies the rules registered on a graph, see
+// Graph.Retract.
+type RuleInference struct {
+}
+
+// Apply infers the triples of the rules of the graph and retracts the
+// ones which don't follow anymore.
+func (ri RuleInference) Apply(ctx context.Context, g *Graph) (*InferenceReport, error) {
+	report := newInferenceReport()
+	retracted, err := g.retract(ctx)
+	report.Retracted = retracted
+	return report, err
+}
+
+// Triples is unused, the rules are per graph, see Rule.Triples.
+func (ri RuleInference) Triples(args map[string]interface{}) ([]*Triple, error) {
+	return nil, fmt.Errorf("rules are per graph")
+}
+
+// sideGraph returns the graph named by the graph id with a suffix,
+// creating it if it doesn't exist.
+func (g *Graph) sideGraph(suffix string) (*Graph, error) {
+	if side, ok := g.Driver.Graph(g.GraphID + suffix); ok {
+		return side, nil
+	}
+	return g.Driver.Create(g.GraphID + suffix)
+}
+
+// unmark removes the inferred marks of triples added explicitly, so
+// Retract keeps them.
+func (g *Graph) unmark(triples []*Triple) error {
+	if marked, err := g.marked(); err != nil || !marked {
+		return err
+	}
+	asserted := []*Triple{}
+	for _, tr := range triples {
+		if checkTriple(tr, false) == nil {
+			asserted = append(asserted, tr)
+		}
+	}
+	if len(asserted) == 0 {
+		return nil
+	}
+	return g.Driver.RemoveBulk(g.GraphID+InferredGraphSuffix, asserted)
+}
+
+// marked reports whether the graph may have inferred triples, it has rules
+// or marks left from rules removed since.
+func (g *Graph) marked() (bool, error) {
+	ig, ok := g.Driver.Graph(g.GraphID + InferredGraphSuffix)
+	if !ok {
+		return false, nil
+	}
+	if _, ok := g.Driver.Graph(g.GraphID + RulesGraphSuffix); ok {
+		count, err := g.Driver.Count(g.GraphID+RulesGraphSuffix, SPEMPTY, rulePred, nil)
+		if err != nil || count > 0 {
+			return count > 0, err
+		}
+	}
+	count, err := g.Driver.Count(ig.GraphID, SPEMPTY, SPEMPTY, nil)
+	return count > 0, err
+}
+
+// Rules returns the rules registered on the graph by name.
+func (g *Graph) Rules() ([]*Rule, error) {
+	rg, err := g.sideGraph(RulesGraphSuffix)
+	if err != nil {
+		return nil, err
+	}
+	triples, err := rg.Triples(SPEMPTY, rulePred, SPEMPTY, nil)
+	if err != nil {
+		return nil, err
+	}
+	rules := []*Rule{}
+	for _, triple := range triples {
+		name, _ := triple[0].(string)
+		text, _ := triple[2].(string)
+		rule, err := ParseRule(name, text)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	sort.Sort(rulesByName(rules))
+	return rules, nil
+}
+
+// rulesByName sorts rules by name.
+type rulesByName []*Rule
+
+func (r rulesByName) Len() int           { return len(r) }
+func (r rulesByName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r rulesByName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+
+// AddRule registers a rule on the graph, replacing the one with the same
+// name. Its triples are inferred by the next Infer.
+func (g *Graph) AddRule(rule *Rule) error {
+	if err := rule.check(); err != nil {
+		return err
+	}
+	rg, err := g.sideGraph(RulesGraphSuffix)
+	if err != nil {
+		return err
+	}
+	if err := rg.Remove(rule.Name, rulePred, SPEMPTY); err != nil {
+		log.Error(err)
+	}
+	return rg.Add(rule.Name, rulePred, rule.String())
+}
+
+// RemoveRule removes a rule from the graph, turns off its trigger and
+// retracts the triples which only it inferred.
+func (g *Graph) RemoveRule(name string) error {
+	rg, err := g.sideGraph(RulesGraphSuffix)
+	if err != nil {
+		return err
+	}
+	count, err := rg.Count(name, rulePred, SPEMPTY)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("rule not found %s", name)
+	}
+	if err := rg.Remove(name, rulePred, SPEMPTY); err != nil {
+		return err
+	}
+	if err := g.SetTrigger(name, false); err != nil {
+		return err
+	}
+	_, err = g.Retract()
+	return err
+}
+
+// Infer adds the triples the rules of the graph infer until there are no
+// new ones and returns how many were added. Inferred triples are marked
+// in the inferred graph, a triple added explicitly while it is inferred is
+// unmarked so Retract keeps it.
+func (g *Graph) Infer() (int, error) {
+	rules, err := g.Rules()
+	if err != nil {
+		return 0, err
+	}
+	added, err := g.infer(context.Background(), rules)
+	return len(added), err
+}
+
+// Retract removes the inferred triples, infers them again from the triples
+// left and returns how many don't follow anymore, like after removing
+// the premises they were inferred from.
+func (g *Graph) Retract() (int, error) {
+	return g.retract(context.Background())
+}
+
+// retract is Retract which stops inferring when the context is done.
+func (g *Graph) retract(ctx context.Context) (int, error) {
+	ig, err := g.sideGraph(InferredGraphSuffix)
+	if err != nil {
+		return 0, err
+	}
+	inferred, err := ig.Triples(SPEMPTY, SPEMPTY, SPEMPTY, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(inferred) > 0 {
+		if err := g.removeBulk(inferred); err != nil {
+			return 0, err
+		}
+		if err := ig.removeBulk(inferred); err != nil {
+			return 0, err
+		}
+	}
+	rules, err := g.Rules()
+	if err != nil {
+		return 0, err
+	}
+	added, err := g.infer(ctx, rules)
+	if err != nil {
+		return 0, err
+	}
+	again := map[string]bool{}
+	for _, triple := range added {
+		again[inferredKey(triple)] = true
+	}
+	retracted := 0
+	for _, triple := range inferred {
+		if !again[inferredKey(triple)] {
+			retracted++
+		}
+	}
+	return retracted, nil
+}
+
+// inferFrom runs rules on the triples added to the graph, see
+// reasoner.from, and returns the triples it added.
+func (g *Graph) inferFrom(ctx context.Context, rules []*Rule, added []*Triple) ([]*Triple, error) {
+	ig, err := g.sideGraph(InferredGraphSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return (&reasoner{g: g, out: g, marks: ig, ctx: ctx}).from(rules, added)
+}
+
+// retractFrom removes the triples rules inferred which may have followed
+// from removed triples, infers again the ones which still follow and
+// returns how many don't. The inferred triples matching a head of a rule
+// with a body clause bound to a removed triple may have followed from it,
+// and so on from them.
+func (g *Graph) retractFrom(ctx context.Context, rules []*Rule, removed []*Triple) (int, error) {
+	ig, err := g.sideGraph(InferredGraphSuffix)
+	if err != nil {
+		return 0, err
+	}
+	candidates := map[string]*Triple{}
+	list := []*Triple{}
+	for frontier := removed; len(frontier) > 0; {
+		next := []*Triple{}
+		for _, pattern := range headPatterns(rules, frontier) {
+			items := [3]interface{}{}
+			for i, item := range pattern {
+				if isVar(item) {
+					item = SPEMPTY
+				}
+				items[i] = item
+			}
+			sub, pred, err := SubPred(items[0], items[1])
+			if err != nil {
+				continue
+			}
+			matches, err := ReadTriples(g.Driver.Triples(ig.GraphID, sub, pred, items[2], nil))
+			if err != nil {
+				return 0, err
+			}
+			for _, triple := range matches {
+				key := inferredKey(triple)
+				if _, ok := candidates[key]; !ok {
+					candidates[key] = triple
+					next = append(next, triple)
+				}
+			}
+		}
+		list = append(list, next...)
+		frontier = next
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	if err := g.removeBulk(list); err != nil {
+		return 0, err
+	}
+	if err := ig.removeBulk(list); err != nil {
+		return 0, err
+	}
+
+	// the ones which follow in one step from what is left, and what
+	// follows from them
+	r := &reasoner{g: g, out: g, marks: ig, ctx: ctx}
+	again := []*Triple{}
+	for _, triple := range list {
+		ok, err := r.derives(rules, triple)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			again = append(again, triple)
+		}
+	}
+	if len(again) > 0 {
+		if _, err := g.addBulk(again); err != nil {
+			return 0, err
+		}
+		if _, err := ig.addBulk(again); err != nil {
+			return 0, err
+		}
+		added, err := r.from(rules, again)
+		if err != nil {
+			return 0, err
+		}
+		again = append(again, added...)
+	}
+	for _, triple := range again {
+		delete(candidates, inferredKey(triple))
+	}
+	return len(candidates), nil
+}
+
+// headPatterns returns the heads of rules with the variables of a body
+// clause bound to a triple of triples. A rule with a property path matches
+// any triple.
+func headPatterns(rules []*Rule, triples []*Triple) []*Triple {
+	patterns := []*Triple{}
+	seen := map[string]bool{}
+	add := func(rule *Rule, args Bindings) {
+		for _, head := range rule.Head {
+			pattern := substitute(head, args)
+			key := fmt.Sprintf("%v", *pattern)
+			if !seen[key] {
+				seen[key] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	for _, rule := range rules {
+		if ruleHasPath(rule) {
+			if len(triples) > 0 {
+				add(rule, Bindings{})
+			}
+			continue
+		}
+		for _, clause := range rule.Body {
+			for _, triple := range triples {
+				if args, ok := unify(clause, triple); ok {
+					add(rule, args)
+				}
+			}
+		}
+	}
+	return patterns
+}
+
+// infer runs rules on the graph, see reasoner.run, marking the triples
+// it adds in the inferred graph.
+func (g *Graph) infer(ctx context.Context, rules []*Rule) ([]*Triple, error) {
+	ig, err := g.sideGraph(InferredGraphSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return (&reasoner{g: g, out: g, marks: ig, ctx: ctx}).run(rules)
+}
+
+// reasoner runs rules on a graph and adds what they infer to out, which
+// is the graph or one whose triples its queries match too, see
+// Options.Graphs. Added triples are marked in marks if it is set.
+type reasoner struct {
+	g     *Graph
+	out   *Graph
+	marks *Graph
+	opts  *Options // of the body queries
+	ctx   context.Context
+}
+
+// run runs rules to a fixpoint with semi-naive evaluation and returns the
+// triples it added. The first round queries the bodies on the whole
+// graph, the next ones only join the triples the round before added with
+// the rest of the graph. Rules with a property path in their body are
+// queried whole every round. It stops between rounds when the context is
+// done, keeping what it added.
+func (r *reasoner) run(rules []*Rule) ([]*Triple, error) {
+	return r.from(rules, nil)
+}
+
+// from runs rules like run with the first round joining the triples of
+// delta instead of querying the whole graph, or like run if delta is nil.
+func (r *reasoner) from(rules []*Rule, delta []*Triple) ([]*Triple, error) {
+	var err error
+	full := delta == nil
+	added := []*Triple{}
+	for round := 0; round == 0 || len(delta) > 0; round++ {
+		if r.ctx != nil {
+			if err := r.ctx.Err(); err != nil {
+				return added, err
+			}
+			progress(r.ctx, round, 0)
+		}
+		candidates := []*Triple{}
+		for _, rule := range rules {
+			var triples []*Triple
+			if (round == 0 && full) || ruleHasPath(rule) {
+				triples, err = r.triples(rule, rule.Body, nil)
+			} else {
+				triples, err = r.delta(rule, delta)
+			}
+			if err != nil {
+				return added, err
+			}
+			candidates = append(candidates, triples...)
+		}
+
+		delta = []*Triple{}
+		seen := map[string]bool{}
+		for _, triple := range candidates {
+			key := inferredKey(triple)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			exists, err := r.exists(triple)
+			if err != nil {
+				return added, err
+			}
+			if !exists {
+				delta = append(delta, triple)
+			}
+		}
+		if len(delta) == 0 {
+			break
+		}
+		if _, err := r.out.addBulk(delta); err != nil {
+			return added, err
+		}
+		if r.marks != nil {
+			if _, err := r.marks.addBulk(delta); err != nil {
+				return added, err
+			}
+		}
+		added = append(added, delta...)
+	}
+	return added, nil
+}
+
+// derives reports whether a rule infers a triple in one step from the
+// graph.
+func (r *reasoner) derives(rules []*Rule, triple *Triple) (bool, error) {
+	key := inferredKey(triple)
+	for _, rule := range rules {
+		for _, head := range rule.Head {
+			args, ok := unify(head, triple)
+			if !ok {
+				continue
+			}
+			body := make([]*Triple, 0, len(rule.Body))
+			for _, clause := range rule.Body {
+				clause = substitute(clause, args)
+				if _, _, err := SubPred(clause[0], clause[1]); err != nil {
+					body = nil
+					break
+				}
+				body = append(body, clause)
+			}
+			if body == nil {
+				continue
+			}
+			heads, err := r.triples(rule, body, args)
+			if err != nil {
+				return false, err
+			}
+			for _, h := range heads {
+				if inferredKey(h) == key {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// exists reports whether the graph or out has a triple.
+func (r *reasoner) exists(triple *Triple) (bool, error) {
+	sub, pred, _ := SubPred(triple[0], triple[1])
+	graphs := []string{r.g.GraphID}
+	if r.out.GraphID != r.g.GraphID {
+		graphs = append(graphs, r.out.GraphID)
+	}
+	for _, graph := range graphs {
+		count, err := r.g.Driver.Count(graph, sub, pred, triple[2])
+		if err != nil || count > 0 {
+			return count > 0, err
+		}
+	}
+	return false, nil
+}
+
+// inferredKey identifies an inferred triple.
+func inferredKey(triple *Triple) string {
+	sub, pred, _ := SubPred(triple[0], triple[1])
+	return tripleKey(sub, pred, triple[2])
+}
+
+// ruleHasPath reports whether a body predicate is a property path.
+func ruleHasPath(rule *Rule) bool {
+	for _, clause := range rule.Body {
+		if pred, ok := clause[1].(string); ok && isPath(pred) {
+			return true
+		}
+	}
+	return false
+}
+
+// triples returns the head triples for the bindings of clauses, which
+// are the body with some variables bound by args.
+func (r *reasoner) triples(rule *Rule, clauses []*Triple, args Bindings) ([]*Triple, error) {
+	var bindings []Bindings
+	if len(clauses) == 0 {
+		bindings = []Bindings{args}
+	} else {
+		bindings = r.g.Query(clauses, r.opts)
+	}
+	triples := []*Triple{}
+	for _, b := range bindings {
+		for name, val := range args {
+			b[name] = val
+		}
+		heads, err := rule.Triples(b)
+		if err != nil {
+			return nil, err
+		}
+		triples = append(triples, heads...)
+	}
+	return triples, nil
+}
+
+// delta returns the head triples for the bindings of the body with one
+// clause matching a triple of delta.
+func (r *reasoner) delta(rule *Rule, delta []*Triple) ([]*Triple, error) {
+	triples := []*Triple{}
+	for i, clause := range rule.Body {
+		for _, triple := range delta {
+			args, ok := unify(clause, triple)
+			if !ok {
+				continue
+			}
+			rest := make([]*Triple, 0, len(rule.Body)-1)
+			for j, other := range rule.Body {
+				if j == i {
+					continue
+				}
+				// a literal bound to a subject matches nothing
+				clause := substitute(other, args)
+				if _, _, err := SubPred(clause[0], clause[1]); err != nil {
+					rest = nil
+					break
+				}
+				rest = append(rest, clause)
+			}
+			if rest == nil {
+				continue
+			}
+			heads, err := r.triples(rule, rest, args)
+			if err != nil {
+				return nil, err
+			}
+			triples = append(triples, heads...)
+		}
+	}
+	return triples, nil
+}
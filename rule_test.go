@@ -0,0 +1,204 @@
+package pfftdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+// cleanupRules removes the rules and inferred triples of the test graph.
+func cleanupRules() {
+	STORE.Driver.RemoveAll(TESTGRAPH + RulesGraphSuffix)
+	STORE.Driver.RemoveAll(TESTGRAPH + InferredGraphSuffix)
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("fof", `[?a knows ?b] [?b knows ?c] => [?a fof ?c] [?a note "two steps"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Rule{
+		Name: "fof",
+		Body: []*Triple{&Triple{"?a", "knows", "?b"}, &Triple{"?b", "knows", "?c"}},
+		Head: []*Triple{&Triple{"?a", "fof", "?c"}, &Triple{"?a", "note", "two steps"}},
+	}
+	if !reflect.DeepEqual(rule, expected) {
+		t.Errorf("%+v", rule)
+	}
+
+	var texts = []string{
+		`[?a <http://a/knows>+ ?b] => [?a reaches ?b]`,
+		`[?a age 18] => [?a label "18"]`,
+		`[?a "has space" ?b] => [?b "x]" "a\"b"]`,
+	}
+	for _, text := range texts {
+		rule, err := ParseRule("r", text)
+		if err != nil {
+			t.Fatal(text, err)
+		}
+		if rule.String() != text {
+			t.Errorf("%s should be %s", rule.String(), text)
+		}
+	}
+	if rule, _ := ParseRule("r", texts[1]); rule.Body[0][2] != 18.0 || rule.Head[0][2] != "18" {
+		t.Errorf("%+v", rule)
+	}
+
+	var bad = []string{
+		`[?a knows ?b]`,
+		`[?a knows ?b] =>`,
+		`=> [?a knows ?b]`,
+		`[?a knows] => [?a knows ?a]`,
+		`[?a knows ?b] => [?a knows ?c]`,
+		`[?a knows ?b] => [?a knows+ ?b]`,
+		`[?a knows ?b] => [?a 1 ?b]`,
+		`[?a knows "b] => [?a knows ?b]`,
+		`[?a knows ?b] => [?b knows ?a] x`,
+	}
+	for _, b := range bad {
+		if _, err := ParseRule("r", b); err == nil {
+			t.Error("should have gotten error for ", b)
+		}
+	}
+	if _, err := ParseRule("", `[?a knows ?b] => [?b knows ?a]`); err == nil {
+		t.Error("should have gotten error without name")
+	}
+}
+
+func TestInfer(t *testing.T) {
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+
+	GRPH.Add("a", "parent", "b")
+	GRPH.Add("b", "parent", "c")
+	GRPH.Add("c", "parent", "d")
+	GRPH.Add("a", "knows", "b")
+
+	for name, text := range map[string]string{
+		"ancestor":   `[?x parent ?y] => [?x ancestor ?y]`,
+		"transitive": `[?x ancestor ?y] [?y ancestor ?z] => [?x ancestor ?z]`,
+		"symmetric":  `[?a knows ?b] => [?b knows ?a]`,
+	} {
+		rule, err := ParseRule(name, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := GRPH.AddRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rules, err := GRPH.Rules()
+	if err != nil || len(rules) != 3 || rules[0].Name != "ancestor" {
+		t.Fatal(rules, err)
+	}
+
+	added, err := GRPH.Infer()
+	if err != nil || added != 7 {
+		t.Fatal(added, err)
+	}
+	res := GRPH.Query([]*Triple{&Triple{"a", "ancestor", "?y"}}, nil)
+	if vals := pathValues(res, "y"); !reflect.DeepEqual(vals, []string{"b", "c", "d"}) {
+		t.Error(vals)
+	}
+	if v, _ := GRPH.Value("b", "knows", ""); v != "a" {
+		t.Error(v)
+	}
+	if added, err := GRPH.Infer(); err != nil || added != 0 {
+		t.Error("a fixpoint should add nothing", added, err)
+	}
+
+	// the ancestors through c go with the premise
+	GRPH.Remove("b", "parent", "c")
+	retracted, err := GRPH.Retract()
+	if err != nil || retracted != 4 {
+		t.Fatal(retracted, err)
+	}
+	res = GRPH.Query([]*Triple{&Triple{"?x", "ancestor", "?y"}}, nil)
+	if len(res) != 2 {
+		t.Error(res)
+	}
+
+	// and the ones only a removed rule inferred
+	if err := GRPH.RemoveRule("symmetric"); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := GRPH.Count("b", "knows", "a"); count != 0 {
+		t.Error("b knows a should be retracted")
+	}
+	if count, _ := GRPH.Count("a", "knows", "b"); count != 1 {
+		t.Error("a knows b is no inference")
+	}
+	if err := GRPH.RemoveRule("symmetric"); err == nil {
+		t.Error("should have gotten error removing a missing rule")
+	}
+}
+
+func TestInferAsserted(t *testing.T) {
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+
+	rule, err := ParseRule("symmetric", `[?a knows ?b] => [?b knows ?a]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := GRPH.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	GRPH.Add("a", "knows", "b")
+	GRPH.Add("c", "knows", "d")
+	if added, err := GRPH.Infer(); err != nil || added != 2 {
+		t.Fatal(added, err)
+	}
+
+	// added explicitly once inferred, they stay without their premise
+	GRPH.Add("b", "knows", "a")
+	if _, err := GRPH.AddBulk(GRPH.GraphID, []*Triple{&Triple{"d", "knows", "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	GRPH.Remove("a", "knows", "b")
+	GRPH.Remove("c", "knows", "d")
+	if retracted, err := GRPH.Retract(); err != nil || retracted != 0 {
+		t.Error(retracted, err)
+	}
+	for _, triple := range []*Triple{{"b", "knows", "a"}, {"d", "knows", "c"}} {
+		if count, _ := GRPH.Count(triple[0].(string), "knows", triple[2]); count != 1 {
+			t.Error(triple, "should stay")
+		}
+	}
+}
+
+func TestMarked(t *testing.T) {
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+
+	// adds to a graph without rules or inferred triples skip unmarking
+	if _, err := GRPH.sideGraph(InferredGraphSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if marked, err := GRPH.marked(); err != nil || marked {
+		t.Error("should not be marked", marked, err)
+	}
+
+	rule, err := ParseRule("symmetric", `[?a knows ?b] => [?b knows ?a]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := GRPH.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	if marked, _ := GRPH.marked(); !marked {
+		t.Error("a graph with rules should be marked")
+	}
+	GRPH.Add("a", "knows", "b")
+	GRPH.Infer()
+	// clearing the rules graph keeps the inferred triples
+	STORE.Driver.RemoveAll(TESTGRAPH + RulesGraphSuffix)
+	if marked, _ := GRPH.marked(); !marked {
+		t.Error("inferred triples left should be marked")
+	}
+}
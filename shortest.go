@@ -0,0 +1,417 @@
+package pfftdb
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+)
+
+// PathEdge is an adjacency predicate paths follow. Dir is out to follow it
+// from subject to object, in from object to subject and both for either,
+// out if empty. Without Weight a step costs 1, otherwise the number of the
+// Weight triple of the node it reaches, 0 if it has none. With edges as
+// nodes, like a movie between actors or a road between cities, the weight
+// is on the edge node.
+type PathEdge struct {
+	Pred   string `json:"pred"`
+	Dir    string `json:"dir"`
+	Weight string `json:"weight"`
+}
+
+// PathHeuristic makes the search A*, the remaining cost of a node is the
+// great circle distance in km from its Lat and Lng triples to the ones of
+// the end times Scale, 1 if 0. Nodes without them have no remaining cost.
+// Paths are only the shortest if the estimate is never more than the cost.
+type PathHeuristic struct {
+	Lat   string  `json:"lat"`
+	Lng   string  `json:"lng"`
+	Scale float64 `json:"scale"`
+}
+
+// PathOptions are the options of ShortestPaths. K is the number of paths,
+// 1 if 0.
+type PathOptions struct {
+	Edges     []*PathEdge    `json:"edges"`
+	Heuristic *PathHeuristic `json:"heuristic"`
+	K         int            `json:"k"`
+}
+
+// PathResult is a path with its nodes from start to end, the triple of
+// each step and the total cost.
+type PathResult struct {
+	Nodes []string  `json:"nodes"`
+	Edges []*Triple `json:"edges"`
+	Cost  float64   `json:"cost"`
+	costs []float64 // of each step
+}
+
+// check validates the edges.
+func (o *PathOptions) check() error {
+	if len(o.Edges) == 0 {
+		return fmt.Errorf("no edges")
+	}
+	for _, edge := range o.Edges {
+		if edge == nil || edge.Pred == "" {
+			return fmt.Errorf("edge without pred")
+		}
+		switch edge.Dir {
+		case "", "out", "in", "both":
+		default:
+			return fmt.Errorf("unknown edge dir %q", edge.Dir)
+		}
+	}
+	return nil
+}
+
+// pathStep is a step from a node to a neighbour.
+type pathStep struct {
+	to   string
+	edge *Triple
+	cost float64
+}
+
+// pathFinder searches paths, the steps from a node and the numbers of
+// nodes are cached.
+type pathFinder struct {
+	g       *Graph
+	options *PathOptions
+	steps   map[string][]pathStep
+	numbers map[string]map[string]float64 // by pred and node
+}
+
+// number returns the number of a triple of node, ok is false if it has
+// none.
+func (f *pathFinder) number(node, pred string) (float64, bool, error) {
+	numbers, ok := f.numbers[pred]
+	if !ok {
+		numbers = map[string]float64{}
+		f.numbers[pred] = numbers
+	}
+	if n, ok := numbers[node]; ok {
+		return n, !math.IsNaN(n), nil
+	}
+	triples, err := f.g.Triples(node, pred, SPEMPTY, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	n := math.NaN()
+	for _, triple := range triples {
+		if v, ok := toFloat(triple[2]); ok {
+			n = v
+			break
+		}
+	}
+	numbers[node] = n
+	return n, !math.IsNaN(n), nil
+}
+
+// neighbours returns the steps from a node along the edges.
+func (f *pathFinder) neighbours(node string) ([]pathStep, error) {
+	if steps, ok := f.steps[node]; ok {
+		return steps, nil
+	}
+	steps := []pathStep{}
+	for _, edge := range f.options.Edges {
+		var triples []*Triple
+		if edge.Dir != "in" {
+			out, err := f.g.Triples(node, edge.Pred, SPEMPTY, nil)
+			if err != nil {
+				return nil, err
+			}
+			triples = append(triples, out...)
+		}
+		if edge.Dir == "in" || edge.Dir == "both" {
+			in, err := f.g.Triples(SPEMPTY, edge.Pred, node, nil)
+			if err != nil {
+				return nil, err
+			}
+			triples = append(triples, in...)
+		}
+		for _, triple := range triples {
+			to, ok := triple[2].(string)
+			if !ok {
+				continue
+			}
+			if to == node {
+				to, _ = triple[0].(string)
+			}
+			cost := 1.0
+			if edge.Weight != "" {
+				w, ok, err := f.number(to, edge.Weight)
+				if err != nil {
+					return nil, err
+				}
+				if w < 0 {
+					return nil, fmt.Errorf("negative weight %v of %s", w, to)
+				}
+				cost = 0
+				if ok {
+					cost = w
+				}
+			}
+			steps = append(steps, pathStep{to: to, edge: triple, cost: cost})
+		}
+	}
+	f.steps[node] = steps
+	return steps, nil
+}
+
+// estimate is the heuristic cost from a node to end.
+func (f *pathFinder) estimate(node, end string) (float64, error) {
+	h := f.options.Heuristic
+	if h == nil {
+		return 0, nil
+	}
+	coords := [4]float64{}
+	for i, pos := range []struct{ node, pred string }{{node, h.Lat}, {node, h.Lng}, {end, h.Lat}, {end, h.Lng}} {
+		n, ok, err := f.number(pos.node, pos.pred)
+		if err != nil || !ok {
+			return 0, err
+		}
+		coords[i] = n
+	}
+	scale := h.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return greatCircle(coords[0], coords[1], coords[2], coords[3]) * scale, nil
+}
+
+// greatCircle returns the distance in km between two coordinates.
+func greatCircle(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// stepKey identifies a step for removing it from a search.
+func stepKey(from string, edge *Triple) string {
+	return fmt.Sprintf("%s\x00%v\x00%v\x00%s", from, edge[0], edge[1], objKey(edge[2]))
+}
+
+// searchNode is a node on the frontier of a search.
+type searchNode struct {
+	node     string
+	cost     float64 // from the start
+	priority float64 // cost plus estimate
+	prev     *searchNode
+	step     pathStep
+	index    int
+}
+
+// searchQueue is a min heap of search nodes by priority.
+type searchQueue []*searchNode
+
+func (q searchQueue) Len() int           { return len(q) }
+func (q searchQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q searchQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *searchQueue) Push(x interface{}) {
+	n := x.(*searchNode)
+	n.index = len(*q)
+	*q = append(*q, n)
+}
+func (q *searchQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// search returns the cheapest path from start to end without the removed
+// nodes and steps, nil if there is none. It is Dijkstra or A* with a
+// heuristic.
+func (f *pathFinder) search(start, end string, removedNodes, removedSteps map[string]bool) (*PathResult, error) {
+	h, err := f.estimate(start, end)
+	if err != nil {
+		return nil, err
+	}
+	queue := &searchQueue{}
+	heap.Push(queue, &searchNode{node: start, priority: h})
+	best := map[string]*searchNode{start: (*queue)[0]}
+	done := map[string]bool{}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(*searchNode)
+		if current.node == end {
+			return current.result(), nil
+		}
+		done[current.node] = true
+
+		steps, err := f.neighbours(current.node)
+		if err != nil {
+			return nil, err
+		}
+		for _, step := range steps {
+			if done[step.to] || removedNodes[step.to] || removedSteps[stepKey(current.node, step.edge)] {
+				continue
+			}
+			cost := current.cost + step.cost
+			if n, ok := best[step.to]; ok {
+				if cost >= n.cost {
+					continue
+				}
+				n.priority += cost - n.cost
+				n.cost, n.prev, n.step = cost, current, step
+				heap.Fix(queue, n.index)
+				continue
+			}
+			h, err := f.estimate(step.to, end)
+			if err != nil {
+				return nil, err
+			}
+			n := &searchNode{node: step.to, cost: cost, priority: cost + h, prev: current, step: step}
+			best[step.to] = n
+			heap.Push(queue, n)
+		}
+	}
+	return nil, nil
+}
+
+// result returns the path to a search node.
+func (n *searchNode) result() *PathResult {
+	r := &PathResult{Cost: n.cost}
+	for ; n != nil; n = n.prev {
+		r.Nodes = append([]string{n.node}, r.Nodes...)
+		if n.prev != nil {
+			r.Edges = append([]*Triple{n.step.edge}, r.Edges...)
+			r.costs = append([]float64{n.step.cost}, r.costs...)
+		}
+	}
+	return r
+}
+
+// samePrefix reports whether a path starts with nodes.
+func samePrefix(path *PathResult, nodes []string) bool {
+	if len(path.Nodes) < len(nodes) {
+		return false
+	}
+	for i, node := range nodes {
+		if path.Nodes[i] != node {
+			return false
+		}
+	}
+	return true
+}
+
+// samePath reports whether two paths take the same steps.
+func samePath(a, b *PathResult) bool {
+	if len(a.Edges) != len(b.Edges) || !samePrefix(a, b.Nodes) {
+		return false
+	}
+	for i, edge := range a.Edges {
+		if stepKey(a.Nodes[i], edge) != stepKey(b.Nodes[i], b.Edges[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ShortestPaths returns up to options.K paths from start to end node ids
+// by increasing cost, none if end can't be reached. The first is found
+// with Dijkstra or A* with a heuristic, the others with Yen's algorithm
+// which searches deviations from the paths found so far.
+func (g *Graph) ShortestPaths(start, end string, options *PathOptions) ([]*PathResult, error) {
+	if options == nil {
+		return nil, fmt.Errorf("no edges")
+	}
+	if err := options.check(); err != nil {
+		return nil, err
+	}
+	if start == SPEMPTY || end == SPEMPTY {
+		return nil, fmt.Errorf("start or end empty")
+	}
+	k := options.K
+	if k < 1 {
+		k = 1
+	}
+	f := &pathFinder{g: g, options: options, steps: map[string][]pathStep{}, numbers: map[string]map[string]float64{}}
+
+	first, err := f.search(start, end, nil, nil)
+	if err != nil || first == nil {
+		return []*PathResult{}, err
+	}
+	paths := []*PathResult{first}
+	candidates := []*PathResult{}
+	for len(paths) < k {
+		last := paths[len(paths)-1]
+		for i := 0; i < len(last.Nodes)-1; i++ {
+			spur := last.Nodes[i]
+			root := last.Nodes[:i+1]
+
+			// leave the steps taken after root by the paths found and
+			// the root nodes to find a different loopless path
+			removedSteps := map[string]bool{}
+			for _, path := range paths {
+				if samePrefix(path, root) && len(path.Edges) > i {
+					removedSteps[stepKey(spur, path.Edges[i])] = true
+				}
+			}
+			removedNodes := map[string]bool{}
+			for _, node := range root[:i] {
+				removedNodes[node] = true
+			}
+			spurPath, err := f.search(spur, end, removedNodes, removedSteps)
+			if err != nil {
+				return nil, err
+			}
+			if spurPath == nil {
+				continue
+			}
+
+			path := &PathResult{
+				Nodes: append(append([]string{}, root...), spurPath.Nodes[1:]...),
+				Edges: append(append([]*Triple{}, last.Edges[:i]...), spurPath.Edges...),
+				costs: append(append([]float64{}, last.costs[:i]...), spurPath.costs...),
+			}
+			for _, cost := range path.costs {
+				path.Cost += cost
+			}
+			known := false
+			for _, p := range append(paths, candidates...) {
+				if samePath(p, path) {
+					known = true
+					break
+				}
+			}
+			if !known {
+				candidates = append(candidates, path)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		cheapest := 0
+		for i, c := range candidates {
+			if c.Cost < candidates[cheapest].Cost {
+				cheapest = i
+			}
+		}
+		paths = append(paths, candidates[cheapest])
+		candidates = append(candidates[:cheapest], candidates[cheapest+1:]...)
+	}
+	return paths, nil
+}
+
+// Node returns the id of the only node with a pred triple of val, it
+// fails if there is none or more than one.
+func (g *Graph) Node(pred string, val interface{}) (string, error) {
+	triples, err := g.Triples(SPEMPTY, pred, val, &Options{Limit: 2})
+	if err != nil {
+		return "", err
+	}
+	switch len(triples) {
+	case 0:
+		return "", fmt.Errorf("no node with %s %v", pred, val)
+	case 1:
+		id, _, err := SubPred(triples[0][0], triples[0][1])
+		return id, err
+	}
+	return "", fmt.Errorf("more than one node with %s %v", pred, val)
+}
@@ -0,0 +1,115 @@
+package pfftdb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// addRoads adds cities with coordinates and roads between them as nodes
+// with a distance.
+//
+//	a -1- b -1- d
+//	 \         /
+//	  4       1
+//	   \     /
+//	      c
+func addRoads() {
+	for city, pos := range map[string][2]float64{
+		"a": {0, 0}, "b": {0, 0.01}, "c": {-0.02, 0.01}, "d": {0, 0.02},
+	} {
+		GRPH.Add(city, "lat", pos[0])
+		GRPH.Add(city, "lng", pos[1])
+	}
+	for _, road := range []struct {
+		id, from, to string
+		distance     float64
+	}{
+		{"ab", "a", "b", 1},
+		{"bd", "b", "d", 1},
+		{"ac", "a", "c", 4},
+		{"cd", "c", "d", 1},
+	} {
+		GRPH.Add(road.from, "road", road.id)
+		GRPH.Add(road.id, "to", road.to)
+		GRPH.Add(road.id, "distance", road.distance)
+	}
+}
+
+func TestShortestPaths(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	addRoads()
+
+	edges := []*PathEdge{&PathEdge{Pred: "road", Weight: "distance"}, &PathEdge{Pred: "to"}}
+	paths, err := GRPH.ShortestPaths("a", "d", &PathOptions{Edges: edges})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || !reflect.DeepEqual(paths[0].Nodes, []string{"a", "ab", "b", "bd", "d"}) || paths[0].Cost != 4 {
+		t.Fatalf("%+v", paths)
+	}
+	if len(paths[0].Edges) != 4 || !reflect.DeepEqual(*paths[0].Edges[0], Triple{"a", "road", "ab"}) {
+		t.Errorf("%+v", paths[0].Edges)
+	}
+
+	// the roads only go one way
+	paths, err = GRPH.ShortestPaths("d", "a", &PathOptions{Edges: edges})
+	if err != nil || len(paths) != 0 {
+		t.Error(paths, err)
+	}
+	back := []*PathEdge{&PathEdge{Pred: "road", Dir: "in"}, &PathEdge{Pred: "to", Dir: "in"}}
+	paths, err = GRPH.ShortestPaths("d", "a", &PathOptions{Edges: back})
+	if err != nil || len(paths) != 1 || paths[0].Cost != 4 {
+		t.Error(paths, err)
+	}
+	both := []*PathEdge{&PathEdge{Pred: "road", Dir: "both"}, &PathEdge{Pred: "to", Dir: "both"}}
+	paths, err = GRPH.ShortestPaths("c", "b", &PathOptions{Edges: both})
+	if err != nil || len(paths) != 1 || paths[0].Cost != 4 {
+		t.Error(paths, err)
+	}
+
+	// a* finds the same path
+	heuristic := &PathHeuristic{Lat: "lat", Lng: "lng", Scale: 0.001}
+	paths, err = GRPH.ShortestPaths("a", "d", &PathOptions{Edges: edges, Heuristic: heuristic})
+	if err != nil || len(paths) != 1 || paths[0].Cost != 4 {
+		t.Error(paths, err)
+	}
+	if d := greatCircle(0, 0, 0, 1); math.Abs(d-111.19) > 0.01 {
+		t.Error(d)
+	}
+
+	paths, err = GRPH.ShortestPaths("a", "d", &PathOptions{Edges: edges, K: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0].Cost != 4 || paths[1].Cost != 7 ||
+		!reflect.DeepEqual(paths[1].Nodes, []string{"a", "ac", "c", "cd", "d"}) {
+		t.Errorf("%+v", paths)
+	}
+
+	var bad = []*PathOptions{
+		nil,
+		&PathOptions{},
+		&PathOptions{Edges: []*PathEdge{&PathEdge{}}},
+		&PathOptions{Edges: []*PathEdge{&PathEdge{Pred: "to", Dir: "up"}}},
+	}
+	for i, options := range bad {
+		if _, err := GRPH.ShortestPaths("a", "d", options); err == nil {
+			t.Error(i, "should have gotten error")
+		}
+	}
+
+	GRPH.Add("_:1", "name", "x")
+	GRPH.Add("_:2", "name", "x")
+	GRPH.Add("_:3", "name", "y")
+	if id, err := GRPH.Node("name", "y"); err != nil || id != "_:3" {
+		t.Error(id, err)
+	}
+	if _, err := GRPH.Node("name", "x"); err == nil {
+		t.Error("should have gotten error for more than one node")
+	}
+	if _, err := GRPH.Node("name", "z"); err == nil {
+		t.Error("should have gotten error for no node")
+	}
+}
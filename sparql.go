@@ -0,0 +1,879 @@
+package pfftdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xsdNS = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// SPARQLQuery is a parsed SPARQL SELECT query compiled to Graph.Query
+// clauses and options.
+type SPARQLQuery struct {
+	Prefix  map[string]string
+	Vars    []string // projected variables without ?, all when SELECT *
+	Clauses []*Triple
+	Options *Options
+}
+
+// SPARQLResponse is the W3C SPARQL 1.1 query results JSON format.
+type SPARQLResponse struct {
+	Head struct {
+		Vars []string `json:"vars"`
+	} `json:"head"`
+	Results struct {
+		Bindings []map[string]*SPARQLTerm `json:"bindings"`
+	} `json:"results"`
+}
+
+// SPARQLTerm is a single bound value in a SPARQL result.
+type SPARQLTerm struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Lang     string `json:"xml:lang,omitempty"`
+	Datatype string `json:"datatype,omitempty"`
+}
+
+// sparqlToken kinds
+const (
+	tokEOF = iota
+	tokIRI
+	tokPName
+	tokVar
+	tokString
+	tokNumber
+	tokBlank
+	tokKeyword
+	tokPunct
+)
+
+type sparqlToken struct {
+	kind int
+	val  string
+	lang string // language tag for strings
+	dt   string // datatype for strings
+}
+
+// sparqlLexer splits a query into tokens.
+type sparqlLexer struct {
+	in  []rune
+	pos int
+}
+
+func (l *sparqlLexer) skip() {
+	for l.pos < len(l.in) {
+		c := l.in[l.pos]
+		if c == '#' {
+			for l.pos < len(l.in) && l.in[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if !unicode.IsSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+func isNameRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-' || c == '.'
+}
+
+// name reads a name, a trailing . ends a triple so it is not included.
+func (l *sparqlLexer) name() string {
+	start := l.pos
+	for l.pos < len(l.in) && (isNameRune(l.in[l.pos]) || l.in[l.pos] == ':' || l.in[l.pos] == '/' || l.in[l.pos] == '#') {
+		l.pos++
+	}
+	for l.pos > start && l.in[l.pos-1] == '.' {
+		l.pos--
+	}
+	return string(l.in[start:l.pos])
+}
+
+func (l *sparqlLexer) next() (*sparqlToken, error) {
+	l.skip()
+	if l.pos >= len(l.in) {
+		return &sparqlToken{kind: tokEOF}, nil
+	}
+	c := l.in[l.pos]
+	switch {
+	case c == '<':
+		// an iri has no whitespace before the closing >, otherwise it's an operator
+		end := l.pos + 1
+		for end < len(l.in) && l.in[end] != '>' && !unicode.IsSpace(l.in[end]) {
+			end++
+		}
+		if end < len(l.in) && l.in[end] == '>' && end > l.pos+1 && l.in[l.pos+1] != '=' {
+			iri := string(l.in[l.pos+1 : end])
+			l.pos = end + 1
+			return &sparqlToken{kind: tokIRI, val: iri}, nil
+		}
+		if l.pos+1 < len(l.in) && l.in[l.pos+1] == '=' {
+			l.pos += 2
+			return &sparqlToken{kind: tokPunct, val: "<="}, nil
+		}
+		l.pos++
+		return &sparqlToken{kind: tokPunct, val: "<"}, nil
+	case c == '?' || c == '$':
+		l.pos++
+		n := l.name()
+		if n == "" {
+			return nil, fmt.Errorf("empty variable name at %d", l.pos)
+		}
+		return &sparqlToken{kind: tokVar, val: n}, nil
+	case c == '"' || c == '\'':
+		return l.str(c)
+	case c == '_' && l.pos+1 < len(l.in) && l.in[l.pos+1] == ':':
+		return &sparqlToken{kind: tokBlank, val: l.name()}, nil
+	case unicode.IsDigit(c) || ((c == '-' || c == '+') && l.pos+1 < len(l.in) && unicode.IsDigit(l.in[l.pos+1])):
+		start := l.pos
+		l.pos++
+		for l.pos < len(l.in) && (unicode.IsDigit(l.in[l.pos]) || l.in[l.pos] == '.' || l.in[l.pos] == 'e' || l.in[l.pos] == 'E') {
+			l.pos++
+		}
+		for l.pos > start && l.in[l.pos-1] == '.' {
+			l.pos--
+		}
+		return &sparqlToken{kind: tokNumber, val: string(l.in[start:l.pos])}, nil
+	case unicode.IsLetter(c) || c == ':':
+		n := l.name()
+		if strings.Contains(n, ":") {
+			return &sparqlToken{kind: tokPName, val: n}, nil
+		}
+		return &sparqlToken{kind: tokKeyword, val: strings.ToUpper(n)}, nil
+	}
+	for _, op := range []string{"!=", ">=", "&&", "||", "^^"} {
+		if strings.HasPrefix(string(l.in[l.pos:]), op) {
+			l.pos += len(op)
+			return &sparqlToken{kind: tokPunct, val: op}, nil
+		}
+	}
+	l.pos++
+	return &sparqlToken{kind: tokPunct, val: string(c)}, nil
+}
+
+// str reads a quoted string with an optional language tag or datatype.
+func (l *sparqlLexer) str(quote rune) (*sparqlToken, error) {
+	l.pos++
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.in) {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		c := l.in[l.pos]
+		l.pos++
+		if c == quote {
+			break
+		}
+		if c == '\\' && l.pos < len(l.in) {
+			e := l.in[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'r':
+				c = '\r'
+			default:
+				c = e
+			}
+		}
+		b.WriteRune(c)
+	}
+	tok := &sparqlToken{kind: tokString, val: b.String()}
+	if l.pos < len(l.in) && l.in[l.pos] == '@' {
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.in) && (unicode.IsLetter(l.in[l.pos]) || unicode.IsDigit(l.in[l.pos]) || l.in[l.pos] == '-') {
+			l.pos++
+		}
+		tok.lang = string(l.in[start:l.pos])
+	} else if strings.HasPrefix(string(l.in[l.pos:]), "^^") {
+		l.pos += 2
+		dt, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if dt.kind != tokIRI && dt.kind != tokPName {
+			return nil, fmt.Errorf("expected datatype got %s", dt.val)
+		}
+		tok.dt = dt.val
+	}
+	return tok, nil
+}
+
+// sparqlParser is a recursive descent parser over the lexer tokens.
+type sparqlParser struct {
+	lex    *sparqlLexer
+	tok    *sparqlToken
+	query  *SPARQLQuery
+	seen   map[string]bool // variables in order of appearance for SELECT *
+	order  []string
+	graph  string // GRAPH scope of the clauses being parsed
+	having bool   // aggregates are allowed in expressions
+	start  int    // input position before the current token
+}
+
+func (p *sparqlParser) advance() error {
+	p.start = p.lex.pos
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *sparqlParser) isKeyword(kw string) bool {
+	return p.tok.kind == tokKeyword && p.tok.val == kw
+}
+
+func (p *sparqlParser) isPunct(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.val == punct
+}
+
+func (p *sparqlParser) expectKeyword(kw string) error {
+	if !p.isKeyword(kw) {
+		return fmt.Errorf("expected %s got %q", kw, p.tok.val)
+	}
+	return p.advance()
+}
+
+func (p *sparqlParser) expectPunct(punct string) error {
+	if !p.isPunct(punct) {
+		return fmt.Errorf("expected %s got %q", punct, p.tok.val)
+	}
+	return p.advance()
+}
+
+// ParseSPARQL parses a SPARQL 1.1 SELECT query. Supported are PREFIX, SELECT
+// [DISTINCT] with variables, (aggregate AS ?var) or *, FROM [NAMED], basic
+// graph patterns with ; and , property paths without ?, see ParsePath,
+// OPTIONAL, GRAPH, FILTER expressions, see ParseExpr, GROUP BY variables,
+// HAVING, ORDER BY, LIMIT and OFFSET.
+// Graph iris are graph names, FROM and FROM NAMED both add to the graphs
+// queried.
+func ParseSPARQL(query string) (*SPARQLQuery, error) {
+	p := &sparqlParser{
+		lex:   &sparqlLexer{in: []rune(query)},
+		query: &SPARQLQuery{Prefix: map[string]string{}, Options: &Options{}},
+		seen:  map[string]bool{},
+	}
+	err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	err = p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.query.Vars == nil {
+		p.query.Vars = p.order
+	} else {
+		p.query.Options.Select = p.query.Vars
+	}
+	PrefixMap(p.query.Prefix, p.query.Clauses)
+	return p.query, nil
+}
+
+func (p *sparqlParser) parse() error {
+	for p.isKeyword("PREFIX") || p.isKeyword("BASE") {
+		if p.isKeyword("BASE") {
+			return fmt.Errorf("BASE not supported")
+		}
+		err := p.advance()
+		if err != nil {
+			return err
+		}
+		if p.tok.kind != tokPName || !strings.HasSuffix(p.tok.val, ":") {
+			return fmt.Errorf("expected prefix name got %q", p.tok.val)
+		}
+		name := strings.TrimSuffix(p.tok.val, ":")
+		err = p.advance()
+		if err != nil {
+			return err
+		}
+		if p.tok.kind != tokIRI {
+			return fmt.Errorf("expected prefix iri got %q", p.tok.val)
+		}
+		p.query.Prefix[name] = p.tok.val
+		err = p.advance()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := p.expectKeyword("SELECT")
+	if err != nil {
+		return err
+	}
+	if p.isKeyword("DISTINCT") || p.isKeyword("REDUCED") {
+		p.query.Options.Distinct = true
+		err = p.advance()
+		if err != nil {
+			return err
+		}
+	}
+	if p.isPunct("*") {
+		err = p.advance()
+		if err != nil {
+			return err
+		}
+	} else {
+		p.query.Vars = []string{}
+		for p.tok.kind == tokVar || p.isPunct("(") {
+			if p.tok.kind == tokVar {
+				p.query.Vars = append(p.query.Vars, p.tok.val)
+				err = p.advance()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			agg, err := p.selectAggregate()
+			if err != nil {
+				return err
+			}
+			p.query.Options.Aggregates = append(p.query.Options.Aggregates, agg)
+			p.query.Vars = append(p.query.Vars, agg.As)
+		}
+		if len(p.query.Vars) == 0 {
+			return fmt.Errorf("expected variables or * got %q", p.tok.val)
+		}
+	}
+
+	for p.isKeyword("FROM") {
+		err = p.advance()
+		if err == nil && p.isKeyword("NAMED") {
+			err = p.advance()
+		}
+		if err != nil {
+			return err
+		}
+		name, err := p.graphName()
+		if err != nil {
+			return err
+		}
+		p.query.Options.Graphs = append(p.query.Options.Graphs, name)
+	}
+
+	if p.isKeyword("WHERE") {
+		err = p.advance()
+		if err != nil {
+			return err
+		}
+	}
+	err = p.group(false)
+	if err != nil {
+		return err
+	}
+	return p.modifiers()
+}
+
+// group parses a { } group graph pattern, optional marks every clause in it.
+func (p *sparqlParser) group(optional bool) error {
+	err := p.expectPunct("{")
+	if err != nil {
+		return err
+	}
+	for !p.isPunct("}") {
+		switch {
+		case p.tok.kind == tokEOF:
+			return fmt.Errorf("unterminated group")
+		case p.isPunct("."):
+			err = p.advance()
+		case p.isKeyword("OPTIONAL"):
+			if optional {
+				return fmt.Errorf("nested OPTIONAL not supported")
+			}
+			err = p.advance()
+			if err == nil {
+				err = p.group(true)
+			}
+		case p.isKeyword("GRAPH"):
+			err = p.advance()
+			if err != nil {
+				return err
+			}
+			scope := p.graph
+			if p.tok.kind == tokVar {
+				var v interface{}
+				v, err = p.term()
+				p.graph, _ = v.(string)
+			} else {
+				p.graph, err = p.graphName()
+			}
+			if err == nil {
+				err = p.group(optional)
+			}
+			p.graph = scope
+		case p.isKeyword("FILTER"):
+			err = p.filter()
+		default:
+			err = p.triples(optional)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return p.advance()
+}
+
+// graphName reads a graph iri or prefixed name.
+func (p *sparqlParser) graphName() (string, error) {
+	if p.tok.kind != tokIRI && p.tok.kind != tokPName {
+		return "", fmt.Errorf("expected graph got %q", p.tok.val)
+	}
+	name := p.tok.val
+	return name, p.advance()
+}
+
+// term converts the current token to a clause item.
+func (p *sparqlParser) term() (interface{}, error) {
+	tok := p.tok
+	var item interface{}
+	switch tok.kind {
+	case tokVar:
+		if !p.seen[tok.val] {
+			p.seen[tok.val] = true
+			p.order = append(p.order, tok.val)
+		}
+		item = "?" + tok.val
+	case tokIRI, tokPName, tokBlank:
+		item = tok.val
+	case tokKeyword:
+		switch tok.val {
+		case "A":
+			item = rdfNS + "type"
+		case "TRUE":
+			item = true
+		case "FALSE":
+			item = false
+		default:
+			return nil, fmt.Errorf("unexpected %q", tok.val)
+		}
+	case tokString:
+		item = sparqlLiteral(tok, p.query.Prefix)
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, err
+		}
+		item = f
+	default:
+		return nil, fmt.Errorf("unexpected %q", tok.val)
+	}
+	return item, p.advance()
+}
+
+// sparqlLiteral converts a literal to its go value, see NewLiteral.
+func sparqlLiteral(tok *sparqlToken, prefixes map[string]string) interface{} {
+	dt := tok.dt
+	for prefix, replace := range prefixes {
+		if strings.HasPrefix(dt, prefix+":") {
+			dt = replace + dt[len(prefix)+1:]
+		}
+	}
+	return literalValue(tok.val, tok.lang, expandXSD(dt))
+}
+
+// verb parses a predicate or a property path. The tokens of a path are
+// only checked to find where it ends, its text is parsed with ParsePath.
+func (p *sparqlParser) verb() (interface{}, error) {
+	if p.tok.kind == tokVar {
+		return p.term()
+	}
+	first := p.tok
+	start := p.start
+	tokens := 0
+	depth := 0
+	element := true
+	for {
+		switch {
+		case element && (p.isPunct("^") || p.isPunct("(")):
+			if p.isPunct("(") {
+				depth++
+			}
+		case element && (p.tok.kind == tokIRI || p.tok.kind == tokPName || p.isKeyword("A")):
+			element = false
+		case element:
+			return nil, fmt.Errorf("expected predicate got %q", p.tok.val)
+		case p.isPunct(")") && depth > 0:
+			depth--
+		case p.isPunct("/") || p.isPunct("|"):
+			element = true
+		case p.isPunct("*") || p.isPunct("+"):
+		case p.isPunct("{"):
+			for !p.isPunct("}") {
+				if p.tok.kind == tokEOF {
+					return nil, fmt.Errorf("expected } in path")
+				}
+				err := p.advance()
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if tokens == 1 && !(first.kind == tokPName && isPath(first.val)) {
+				if first.kind == tokKeyword {
+					return rdfNS + "type", nil
+				}
+				return first.val, nil
+			}
+			return p.path(string(p.lex.in[start:p.start]))
+		}
+		tokens++
+		err := p.advance()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// path parses the text of a property path, a is rdf:type and prefixes are
+// replaced in its predicates.
+func (p *sparqlParser) path(text string) (string, error) {
+	path, err := ParsePath(text)
+	if err != nil {
+		return "", err
+	}
+	path.links(func(link *Path) {
+		if link.Pred == "a" {
+			link.Pred = rdfNS + "type"
+		}
+		_, link.Pred, _ = PrefixMapTriple(p.query.Prefix, "", link.Pred, nil)
+	})
+	return path.pred(), nil
+}
+
+// triples parses a subject with its predicate object lists.
+func (p *sparqlParser) triples(optional bool) error {
+	sub, err := p.term()
+	if err != nil {
+		return err
+	}
+	for {
+		pred, err := p.verb()
+		if err != nil {
+			return err
+		}
+		for {
+			obj, err := p.term()
+			if err != nil {
+				return err
+			}
+			if optional {
+				p.query.Options.Optional = append(p.query.Options.Optional, uint(len(p.query.Clauses)))
+			}
+			if p.graph != "" {
+				if p.query.Options.ClauseGraphs == nil {
+					p.query.Options.ClauseGraphs = map[uint]string{}
+				}
+				p.query.Options.ClauseGraphs[uint(len(p.query.Clauses))] = p.graph
+			}
+			p.query.Clauses = append(p.query.Clauses, &Triple{sub, pred, obj})
+			if !p.isPunct(",") {
+				break
+			}
+			err = p.advance()
+			if err != nil {
+				return err
+			}
+		}
+		if !p.isPunct(";") {
+			return nil
+		}
+		err = p.advance()
+		if err != nil {
+			return err
+		}
+		// a trailing ; before . or }
+		if p.isPunct(".") || p.isPunct("}") {
+			return nil
+		}
+	}
+}
+
+// filter parses FILTER(expression) or FILTER function(args), every FILTER
+// has to match.
+func (p *sparqlParser) filter() error {
+	err := p.advance()
+	if err != nil {
+		return err
+	}
+	e, err := p.primaryExpr()
+	if err != nil {
+		return err
+	}
+	p.query.Options.Where = And(p.query.Options.Where, e)
+	return nil
+}
+
+// selectAggregate parses (aggregate AS ?var).
+func (p *sparqlParser) selectAggregate() (*Aggregate, error) {
+	err := p.expectPunct("(")
+	if err != nil {
+		return nil, err
+	}
+	agg, err := p.aggregate()
+	if err == nil {
+		err = p.expectKeyword("AS")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokVar {
+		return nil, fmt.Errorf("expected AS variable got %q", p.tok.val)
+	}
+	agg.As = p.tok.val
+	err = p.advance()
+	if err != nil {
+		return nil, err
+	}
+	return agg, p.expectPunct(")")
+}
+
+// aggregate parses COUNT([DISTINCT] * or ?var), SUM, AVG, MIN, MAX and
+// GROUP_CONCAT([DISTINCT] ?var [; SEPARATOR="sep"]).
+func (p *sparqlParser) aggregate() (*Aggregate, error) {
+	op := strings.ToLower(p.tok.val)
+	if p.tok.kind != tokKeyword || !aggregateOps[op] {
+		return nil, fmt.Errorf("expected aggregate got %q", p.tok.val)
+	}
+	agg := &Aggregate{Op: op}
+	err := p.advance()
+	if err == nil {
+		err = p.expectPunct("(")
+	}
+	if err == nil && p.isKeyword("DISTINCT") {
+		agg.Distinct = true
+		err = p.advance()
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case op == "count" && p.isPunct("*"):
+	case p.tok.kind == tokVar:
+		agg.Var = p.tok.val
+	default:
+		return nil, fmt.Errorf("expected %s variable got %q", agg.Op, p.tok.val)
+	}
+	err = p.advance()
+	if err == nil && op == "group_concat" && p.isPunct(";") {
+		err = p.advance()
+		if err == nil {
+			err = p.expectKeyword("SEPARATOR")
+		}
+		if err == nil {
+			err = p.expectPunct("=")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokString {
+			return nil, fmt.Errorf("expected SEPARATOR string got %q", p.tok.val)
+		}
+		agg.Separator = p.tok.val
+		err = p.advance()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return agg, p.expectPunct(")")
+}
+
+// havingVar returns the variable an aggregate in HAVING is bound to, one
+// selected or a hidden one.
+func (p *sparqlParser) havingVar(agg *Aggregate) string {
+	for _, a := range p.query.Options.Aggregates {
+		if a.Op == agg.Op && a.Var == agg.Var && a.Distinct == agg.Distinct && a.Separator == agg.Separator {
+			return a.As
+		}
+	}
+	agg.As = fmt.Sprintf("_having%d", len(p.query.Options.Aggregates))
+	p.query.Options.Aggregates = append(p.query.Options.Aggregates, agg)
+	return agg.As
+}
+
+// modifiers parses GROUP BY, HAVING, ORDER BY, LIMIT and OFFSET.
+func (p *sparqlParser) modifiers() error {
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.isKeyword("GROUP"):
+			err := p.advance()
+			if err == nil {
+				err = p.expectKeyword("BY")
+			}
+			if err != nil {
+				return err
+			}
+			if p.tok.kind != tokVar {
+				return fmt.Errorf("expected GROUP BY variable got %q", p.tok.val)
+			}
+			for p.tok.kind == tokVar {
+				p.query.Options.GroupBy = append(p.query.Options.GroupBy, p.tok.val)
+				err = p.advance()
+				if err != nil {
+					return err
+				}
+			}
+		case p.isKeyword("HAVING"):
+			err := p.advance()
+			if err != nil {
+				return err
+			}
+			if !p.isPunct("(") {
+				return fmt.Errorf("expected HAVING ( got %q", p.tok.val)
+			}
+			p.having = true
+			for p.isPunct("(") {
+				e, err := p.primaryExpr()
+				if err != nil {
+					return err
+				}
+				p.query.Options.Having = And(p.query.Options.Having, e)
+			}
+			p.having = false
+		case p.isKeyword("ORDER"):
+			err := p.advance()
+			if err == nil {
+				err = p.expectKeyword("BY")
+			}
+			if err != nil {
+				return err
+			}
+			desc := false
+			paren := false
+			if p.isKeyword("ASC") || p.isKeyword("DESC") {
+				desc = p.isKeyword("DESC")
+				paren = true
+				err = p.advance()
+				if err == nil {
+					err = p.expectPunct("(")
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if p.tok.kind != tokVar {
+				return fmt.Errorf("expected ORDER BY variable got %q", p.tok.val)
+			}
+			p.query.Options.OrderBy = p.tok.val
+			if desc {
+				p.query.Options.OrderBy = "-" + p.tok.val
+			}
+			err = p.advance()
+			if err == nil && paren {
+				err = p.expectPunct(")")
+			}
+			if err != nil {
+				return err
+			}
+			if p.tok.kind == tokVar || p.isKeyword("ASC") || p.isKeyword("DESC") {
+				return fmt.Errorf("only a single ORDER BY variable is supported")
+			}
+		case p.isKeyword("LIMIT"), p.isKeyword("OFFSET"):
+			kw := p.tok.val
+			err := p.advance()
+			if err != nil {
+				return err
+			}
+			n, err := strconv.ParseUint(p.tok.val, 10, 32)
+			if p.tok.kind != tokNumber || err != nil {
+				return fmt.Errorf("expected %s number got %q", kw, p.tok.val)
+			}
+			if kw == "LIMIT" {
+				p.query.Options.Limit = uint(n)
+			} else {
+				p.query.Options.Offset = uint(n)
+			}
+			err = p.advance()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected %q", p.tok.val)
+		}
+	}
+	return nil
+}
+
+// Run executes the query against a graph.
+func (q *SPARQLQuery) Run(g *Graph) []Bindings {
+	return g.Query(q.Clauses, q.Options)
+}
+
+// sparqlTerm converts a bound value to a SPARQL result term. Strings are
+// iris if they look like one, _: strings are blank nodes.
+func sparqlTerm(val interface{}, prefixes map[string]string) *SPARQLTerm {
+	switch v := val.(type) {
+	case string:
+		if strings.HasPrefix(v, "_:") {
+			return &SPARQLTerm{Type: "bnode", Value: v[2:]}
+		}
+		if isIRI(v, prefixes) {
+			return &SPARQLTerm{Type: "uri", Value: v}
+		}
+		return &SPARQLTerm{Type: "literal", Value: v}
+	case Literal:
+		return &SPARQLTerm{Type: "literal", Value: v.Value, Lang: v.Lang, Datatype: v.Datatype}
+	case bool:
+		return &SPARQLTerm{Type: "literal", Value: strconv.FormatBool(v), Datatype: xsdNS + "boolean"}
+	case float32, float64:
+		f, _ := toFloat(v)
+		if f == float64(int64(f)) {
+			return &SPARQLTerm{Type: "literal", Value: strconv.FormatInt(int64(f), 10), Datatype: xsdNS + "integer"}
+		}
+		return &SPARQLTerm{Type: "literal", Value: strconv.FormatFloat(f, 'g', -1, 64), Datatype: xsdNS + "decimal"}
+	}
+	if f, ok := toFloat(val); ok {
+		return &SPARQLTerm{Type: "literal", Value: strconv.FormatFloat(f, 'f', -1, 64), Datatype: xsdNS + "integer"}
+	}
+	return &SPARQLTerm{Type: "literal", Value: fmt.Sprintf("%v", val)}
+}
+
+// isIRI reports whether a string is an absolute iri or starts with one
+// of the query prefixes.
+func isIRI(s string, prefixes map[string]string) bool {
+	for _, iri := range prefixes {
+		if strings.HasPrefix(s, iri) {
+			return true
+		}
+	}
+	if i := strings.Index(s, ":"); i > 0 && !strings.ContainsAny(s, " \t\n<>\"{}|\\^`") {
+		scheme := s[:i]
+		for _, c := range scheme {
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '+' && c != '-' && c != '.' {
+				return false
+			}
+		}
+		return strings.HasPrefix(s[i:], "://") || scheme == "urn" || scheme == "mailto"
+	}
+	return false
+}
+
+// Results converts bindings to the W3C SPARQL JSON results format.
+func (q *SPARQLQuery) Results(bindings []Bindings) *SPARQLResponse {
+	resp := &SPARQLResponse{}
+	resp.Head.Vars = q.Vars
+	resp.Results.Bindings = make([]map[string]*SPARQLTerm, 0, len(bindings))
+	for _, b := range bindings {
+		row := map[string]*SPARQLTerm{}
+		for _, v := range q.Vars {
+			if val, ok := b[v]; ok && val != nil {
+				row[v] = sparqlTerm(val, q.Prefix)
+			}
+		}
+		resp.Results.Bindings = append(resp.Results.Bindings, row)
+	}
+	return resp
+}
@@ -0,0 +1,236 @@
+package pfftdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSPARQL(t *testing.T) {
+	q, err := ParseSPARQL(`
+		PREFIX foaf: <http://xmlns.com/foaf/0.1/>
+		# comment
+		SELECT DISTINCT ?name ?email
+		WHERE {
+			?id a foaf:Person ;
+				foaf:name ?name , ?nick .
+			OPTIONAL { ?id foaf:mbox ?email }
+			?id <http://eurisko.io/age> ?age .
+			FILTER (?age >= 21)
+		}
+		ORDER BY DESC(?name)
+		LIMIT 10 OFFSET 5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clauses := []*Triple{
+		&Triple{"?id", rdfNS + "type", "http://xmlns.com/foaf/0.1/Person"},
+		&Triple{"?id", "http://xmlns.com/foaf/0.1/name", "?name"},
+		&Triple{"?id", "http://xmlns.com/foaf/0.1/name", "?nick"},
+		&Triple{"?id", "http://xmlns.com/foaf/0.1/mbox", "?email"},
+		&Triple{"?id", "http://eurisko.io/age", "?age"},
+	}
+	if !reflect.DeepEqual(q.Clauses, clauses) {
+		for _, c := range q.Clauses {
+			t.Error(c)
+		}
+	}
+	if !reflect.DeepEqual(q.Vars, []string{"name", "email"}) {
+		t.Error(q.Vars)
+	}
+	opts := q.Options
+	if !opts.Distinct || opts.Limit != 10 || opts.Offset != 5 || opts.OrderBy != "-name" {
+		t.Errorf("%+v", opts)
+	}
+	if !reflect.DeepEqual(opts.Optional, []uint{3}) {
+		t.Error(opts.Optional)
+	}
+	where := &Expr{Op: ">=", Args: []*Expr{&Expr{Var: "age"}, &Expr{Val: 21.0}}}
+	if !reflect.DeepEqual(opts.Where, where) {
+		t.Errorf("%+v", opts.Where)
+	}
+
+	var bad = []string{
+		`SELECT ?x WHERE { ?x ?y }`,
+		`SELECT WHERE { ?x ?y ?z }`,
+		`SELECT * WHERE { ?x ?y ?z } LIMIT x`,
+		`DESCRIBE ?x`,
+		`SELECT * WHERE { ?x ?y "abc }`,
+	}
+	for _, b := range bad {
+		if _, err := ParseSPARQL(b); err == nil {
+			t.Error("should have gotten error for ", b)
+		}
+	}
+}
+
+func TestParseSPARQLGraph(t *testing.T) {
+	q, err := ParseSPARQL(`
+		SELECT * FROM <user> FROM NAMED <location>
+		WHERE {
+			?id <livesAt> ?loc .
+			GRAPH ?g { ?loc <city> ?city }
+			OPTIONAL { GRAPH <location> { ?loc <zip> ?zip } }
+		}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := q.Options
+	if !reflect.DeepEqual(opts.Graphs, []string{"user", "location"}) {
+		t.Error(opts.Graphs)
+	}
+	if !reflect.DeepEqual(opts.ClauseGraphs, map[uint]string{1: "?g", 2: "location"}) {
+		t.Error(opts.ClauseGraphs)
+	}
+	if !reflect.DeepEqual(opts.Optional, []uint{2}) {
+		t.Error(opts.Optional)
+	}
+	if !reflect.DeepEqual(q.Vars, []string{"id", "loc", "g", "city", "zip"}) {
+		t.Error(q.Vars)
+	}
+
+	if _, err := ParseSPARQL(`SELECT * WHERE { GRAPH "x" { ?a ?b ?c } }`); err == nil {
+		t.Error("literal graph should be an error")
+	}
+}
+
+func TestParseSPARQLAggregates(t *testing.T) {
+	q, err := ParseSPARQL(`
+		SELECT ?dept (COUNT(*) AS ?n) (GROUP_CONCAT(DISTINCT ?name; SEPARATOR=", ") AS ?names)
+		WHERE { ?id <dept> ?dept ; <name> ?name }
+		GROUP BY ?dept
+		HAVING (?n > 1) (SUM(?salary) >= 100)
+		ORDER BY DESC(?n)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := q.Options
+	expected := []*Aggregate{
+		&Aggregate{Op: "count", As: "n"},
+		&Aggregate{Op: "group_concat", Var: "name", Distinct: true, Separator: ", ", As: "names"},
+		&Aggregate{Op: "sum", Var: "salary", As: "_having2"},
+	}
+	if !reflect.DeepEqual(opts.Aggregates, expected) {
+		t.Error(opts.Aggregates)
+	}
+	if !reflect.DeepEqual(opts.GroupBy, []string{"dept"}) || opts.OrderBy != "-n" {
+		t.Error(opts.GroupBy, opts.OrderBy)
+	}
+	if !reflect.DeepEqual(q.Vars, []string{"dept", "n", "names"}) {
+		t.Error(q.Vars)
+	}
+	if !reflect.DeepEqual(opts.Having.Vars(), []string{"_having2", "n"}) {
+		t.Error(opts.Having)
+	}
+
+	var bad = []string{
+		`SELECT (COUNT(*)) WHERE { ?a ?b ?c }`,
+		`SELECT (SUM(*) AS ?s) WHERE { ?a ?b ?c }`,
+		`SELECT * WHERE { ?a ?b ?c } GROUP BY`,
+		`SELECT * WHERE { ?a ?b ?c } HAVING ?a`,
+		`SELECT * WHERE { ?a ?b ?c FILTER(COUNT(?a) > 1) }`,
+	}
+	for _, b := range bad {
+		if _, err := ParseSPARQL(b); err == nil {
+			t.Error("should have gotten error for ", b)
+		}
+	}
+}
+
+func TestParseSPARQLPath(t *testing.T) {
+	q, err := ParseSPARQL(`
+		PREFIX foaf: <http://xmlns.com/foaf/0.1/>
+		SELECT * WHERE {
+			?a foaf:knows+ ?b ;
+				^foaf:knows/foaf:name ?name ;
+				(foaf:knows|<http://a.com/likes>){1,2} ?c ;
+				a foaf:Person ;
+				<http://a.com/p> ?d .
+		}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preds := []interface{}{}
+	for _, clause := range q.Clauses {
+		preds = append(preds, clause[1])
+	}
+	expected := []interface{}{
+		"<http://xmlns.com/foaf/0.1/knows>+",
+		"^<http://xmlns.com/foaf/0.1/knows>/<http://xmlns.com/foaf/0.1/name>",
+		"(<http://xmlns.com/foaf/0.1/knows>|<http://a.com/likes>){1,2}",
+		rdfNS + "type",
+		"http://a.com/p",
+	}
+	if !reflect.DeepEqual(preds, expected) {
+		t.Error(preds)
+	}
+
+	if _, err := ParseSPARQL(`SELECT * WHERE { ?a foaf:knows/ ?b }`); err == nil {
+		t.Error("should have gotten error for a path without an end")
+	}
+}
+
+func TestSPARQLQuery(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	GRPH.Add("_:1", "foaf:name", "Albert")
+	GRPH.Add("_:1", "eu:age", 30.0)
+	GRPH.Add("_:1", "foaf:knows", "_:2")
+	GRPH.Add("_:2", "foaf:name", "Barry")
+	GRPH.Add("_:2", "eu:age", 12.0)
+
+	q, err := ParseSPARQL(`SELECT * WHERE { ?id foaf:name ?name ; eu:age ?age FILTER(?age > 18) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := q.Results(q.Run(GRPH))
+	if !reflect.DeepEqual(resp.Head.Vars, []string{"id", "name", "age"}) {
+		t.Error(resp.Head.Vars)
+	}
+	if len(resp.Results.Bindings) != 1 {
+		t.Fatal(resp.Results.Bindings)
+	}
+	row := resp.Results.Bindings[0]
+	if *row["id"] != (SPARQLTerm{Type: "bnode", Value: "1"}) {
+		t.Error(row["id"])
+	}
+	if *row["name"] != (SPARQLTerm{Type: "literal", Value: "Albert"}) {
+		t.Error(row["name"])
+	}
+	if *row["age"] != (SPARQLTerm{Type: "literal", Value: "30", Datatype: xsdNS + "integer"}) {
+		t.Error(row["age"])
+	}
+
+	q, err = ParseSPARQL(`SELECT (COUNT(?id) AS ?n) (AVG(?age) AS ?avg) WHERE { ?id foaf:name ?name ; eu:age ?age }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = q.Results(q.Run(GRPH))
+	if len(resp.Results.Bindings) != 1 {
+		t.Fatal(resp.Results.Bindings)
+	}
+	row = resp.Results.Bindings[0]
+	if row["n"].Value != "2" || row["avg"].Value != "21" {
+		t.Error(row["n"], row["avg"])
+	}
+}
+
+func TestSPARQLTerm(t *testing.T) {
+	var tests = []struct {
+		in  interface{}
+		out SPARQLTerm
+	}{
+		{"http://xmlns.com/foaf/0.1/name", SPARQLTerm{Type: "uri", Value: "http://xmlns.com/foaf/0.1/name"}},
+		{"_:b1", SPARQLTerm{Type: "bnode", Value: "b1"}},
+		{"Kevin Bacon", SPARQLTerm{Type: "literal", Value: "Kevin Bacon"}},
+		{"foaf:name", SPARQLTerm{Type: "literal", Value: "foaf:name"}},
+		{1.5, SPARQLTerm{Type: "literal", Value: "1.5", Datatype: xsdNS + "decimal"}},
+		{3, SPARQLTerm{Type: "literal", Value: "3", Datatype: xsdNS + "integer"}},
+		{true, SPARQLTerm{Type: "literal", Value: "true", Datatype: xsdNS + "boolean"}},
+	}
+	for i, tt := range tests {
+		if out := sparqlTerm(tt.in, nil); *out != tt.out {
+			t.Errorf("%d %v should be %+v got %+v", i, tt.in, tt.out, out)
+		}
+	}
+}
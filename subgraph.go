@@ -0,0 +1,278 @@
+package pfftdb
+
+import (
+	"fmt"
+	"math"
+)
+
+// default caps of a subgraph.
+const (
+	SubgraphMaxNodes = 500
+	SubgraphMaxEdges = 2000
+)
+
+// SubgraphOptions are the options of Subgraph. Seeds are the nodes to
+// start from and Depth the number of hops away from them, in either
+// direction, nodes are included. Edges are followed only for predicates in
+// Include if any and never for ones in Exclude. MaxNodes and MaxEdges cap
+// the result, SubgraphMaxNodes and SubgraphMaxEdges if 0.
+type SubgraphOptions struct {
+	Seeds    []string `json:"seeds"`
+	Depth    int      `json:"depth"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+	MaxNodes int      `json:"max_nodes"`
+	MaxEdges int      `json:"max_edges"`
+}
+
+// SubgraphNode is a node with its hops from the nearest seed. Attrs are
+// the literal objects of the node by predicate, a list if there are
+// several.
+type SubgraphNode struct {
+	ID    string                 `json:"id"`
+	Depth int                    `json:"depth"`
+	Attrs map[string]interface{} `json:"attrs"`
+}
+
+// SubgraphEdge is a triple between two nodes, labeled by its predicate.
+type SubgraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Label  string `json:"label"`
+}
+
+// Subgraph is the nodes and edges around seeds, Truncated is true if a
+// cap left some out.
+type Subgraph struct {
+	Nodes     []*SubgraphNode `json:"nodes"`
+	Edges     []*SubgraphEdge `json:"edges"`
+	Truncated bool            `json:"truncated"`
+}
+
+// check validates the options and sets the default caps.
+func (o *SubgraphOptions) check() error {
+	if len(o.Seeds) == 0 {
+		return fmt.Errorf("no seeds")
+	}
+	if o.Depth < 0 || o.MaxNodes < 0 || o.MaxEdges < 0 {
+		return fmt.Errorf("depth and caps can't be negative")
+	}
+	if o.MaxNodes == 0 {
+		o.MaxNodes = SubgraphMaxNodes
+	}
+	if o.MaxEdges == 0 {
+		o.MaxEdges = SubgraphMaxEdges
+	}
+	return nil
+}
+
+// subgraphBuilder walks a graph breadth first from the seeds.
+type subgraphBuilder struct {
+	g        *Graph
+	options  *SubgraphOptions
+	include  map[string]bool
+	exclude  map[string]bool
+	result   *Subgraph
+	nodes    map[string]*SubgraphNode
+	edges    map[Triple]bool
+	subjects map[string]bool // whether a string object has triples
+	complete bool            // subjects has every subject of the graph
+}
+
+// follows reports whether edges of pred are followed.
+func (b *subgraphBuilder) follows(pred string) bool {
+	if len(b.include) > 0 && !b.include[pred] {
+		return false
+	}
+	return !b.exclude[pred]
+}
+
+// isNode reports whether an object is a node rather than a literal,
+// blank nodes, iris and strings which are subjects themselves are.
+func (b *subgraphBuilder) isNode(obj interface{}) (string, bool) {
+	s, ok := obj.(string)
+	if !ok || s == "" {
+		return "", false
+	}
+	if validBlank(s) || isIRI(s, nil) {
+		return s, true
+	}
+	if isSub, ok := b.subjects[s]; ok || b.complete {
+		return s, isSub
+	}
+	n, err := b.g.Count(s, SPEMPTY, SPEMPTY)
+	b.subjects[s] = err == nil && n > 0
+	return s, b.subjects[s]
+}
+
+// fold adds a literal object to the attrs of a node.
+func (node *SubgraphNode) fold(pred string, obj interface{}) {
+	switch attr := node.Attrs[pred].(type) {
+	case nil:
+		node.Attrs[pred] = obj
+	case []interface{}:
+		node.Attrs[pred] = append(attr, obj)
+	default:
+		node.Attrs[pred] = []interface{}{attr, obj}
+	}
+}
+
+// add adds a node at depth, unless the node cap is reached.
+func (b *subgraphBuilder) add(id string, depth int) bool {
+	if _, ok := b.nodes[id]; ok {
+		return true
+	}
+	if len(b.nodes) >= b.options.MaxNodes {
+		b.result.Truncated = true
+		return false
+	}
+	node := &SubgraphNode{ID: id, Depth: depth, Attrs: map[string]interface{}{}}
+	b.nodes[id] = node
+	b.result.Nodes = append(b.result.Nodes, node)
+	return true
+}
+
+// link adds an edge from a node at depth to other, other is only added
+// within the depth.
+func (b *subgraphBuilder) link(triple *Triple, depth int, other string) {
+	if b.edges[*triple] {
+		return
+	}
+	if len(b.result.Edges) >= b.options.MaxEdges {
+		b.result.Truncated = true
+		return
+	}
+	if _, ok := b.nodes[other]; !ok {
+		if depth >= b.options.Depth {
+			return
+		}
+		if !b.add(other, depth+1) {
+			return
+		}
+	}
+	sub, pred, _ := SubPred(triple[0], triple[1])
+	obj, _ := triple[2].(string)
+	b.edges[*triple] = true
+	b.result.Edges = append(b.result.Edges, &SubgraphEdge{Source: sub, Target: obj, Label: pred})
+}
+
+// visit folds the literals of a node into its attrs and follows its edges
+// both ways.
+func (b *subgraphBuilder) visit(node *SubgraphNode) error {
+	out, err := b.g.Triples(node.ID, SPEMPTY, SPEMPTY, nil)
+	if err != nil {
+		return err
+	}
+	sortTriples(out, "o")
+	sortTriples(out, "p")
+	for _, triple := range out {
+		_, pred, err := SubPred(triple[0], triple[1])
+		if err != nil {
+			continue
+		}
+		obj, ok := b.isNode(triple[2])
+		if !ok {
+			node.fold(pred, triple[2])
+			continue
+		}
+		if b.follows(pred) {
+			b.link(triple, node.Depth, obj)
+		}
+	}
+
+	in, err := b.g.Triples(SPEMPTY, SPEMPTY, node.ID, nil)
+	if err != nil {
+		return err
+	}
+	sortTriples(in, "s")
+	sortTriples(in, "p")
+	for _, triple := range in {
+		sub, pred, err := SubPred(triple[0], triple[1])
+		if err != nil || !b.follows(pred) {
+			continue
+		}
+		b.link(triple, node.Depth, sub)
+	}
+	return nil
+}
+
+// newSubgraphBuilder returns a builder with options.
+func newSubgraphBuilder(g *Graph, options *SubgraphOptions) *subgraphBuilder {
+	b := &subgraphBuilder{
+		g:        g,
+		options:  options,
+		include:  map[string]bool{},
+		exclude:  map[string]bool{},
+		result:   &Subgraph{Nodes: []*SubgraphNode{}, Edges: []*SubgraphEdge{}},
+		nodes:    map[string]*SubgraphNode{},
+		edges:    map[Triple]bool{},
+		subjects: map[string]bool{},
+	}
+	for _, pred := range options.Include {
+		b.include[pred] = true
+	}
+	for _, pred := range options.Exclude {
+		b.exclude[pred] = true
+	}
+	return b
+}
+
+// Subgraph returns the nodes within options.Depth hops of the seeds and
+// the edges between them, for a visualization. Objects which aren't nodes
+// are folded into the attrs of their subject. Nodes are in breadth first
+// order from the seeds.
+func (g *Graph) Subgraph(options *SubgraphOptions) (*Subgraph, error) {
+	if options == nil {
+		return nil, fmt.Errorf("no options")
+	}
+	o := *options
+	if err := o.check(); err != nil {
+		return nil, err
+	}
+	b := newSubgraphBuilder(g, &o)
+	for _, seed := range o.Seeds {
+		b.add(seed, 0)
+	}
+	for i := 0; i < len(b.result.Nodes); i++ {
+		if err := b.visit(b.result.Nodes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return b.result, nil
+}
+
+// SubgraphOf returns the subgraph of triples, the ones between nodes are
+// edges and the others are folded into the attrs of their subject. Nodes
+// are in the order they first appear.
+func (g *Graph) SubgraphOf(triples []*Triple) *Subgraph {
+	return g.subgraphOf(triples, false)
+}
+
+// subgraphOf is SubgraphOf, with complete the triples are the whole graph
+// so strings which aren't their subjects aren't looked up.
+func (g *Graph) subgraphOf(triples []*Triple, complete bool) *Subgraph {
+	b := newSubgraphBuilder(g, &SubgraphOptions{MaxNodes: math.MaxInt32, MaxEdges: math.MaxInt32})
+	b.complete = complete
+	for _, triple := range triples {
+		if sub, ok := triple[0].(string); ok {
+			b.subjects[sub] = true
+		}
+	}
+	seen := map[string]bool{}
+	for _, triple := range triples {
+		sub, pred, err := SubPred(triple[0], triple[1])
+		if err != nil || seen[tripleKey(sub, pred, triple[2])] {
+			continue
+		}
+		seen[tripleKey(sub, pred, triple[2])] = true
+		b.add(sub, 0)
+		obj, ok := b.isNode(triple[2])
+		if !ok {
+			b.nodes[sub].fold(pred, triple[2])
+			continue
+		}
+		b.add(obj, 0)
+		b.link(triple, 0, obj)
+	}
+	return b.result
+}
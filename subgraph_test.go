@@ -0,0 +1,98 @@
+package pfftdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+// subgraphIDs returns the ids of the nodes and the edges of a subgraph.
+func subgraphIDs(sg *Subgraph) ([]string, []SubgraphEdge) {
+	ids := []string{}
+	for _, node := range sg.Nodes {
+		ids = append(ids, node.ID)
+	}
+	edges := []SubgraphEdge{}
+	for _, edge := range sg.Edges {
+		edges = append(edges, *edge)
+	}
+	return ids, edges
+}
+
+func TestSubgraph(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+
+	//	a -knows-> b -knows-> c -knows-> d
+	//	e -likes-> a
+	GRPH.Add("a", "knows", "b")
+	GRPH.Add("b", "knows", "c")
+	GRPH.Add("c", "knows", "d")
+	GRPH.Add("d", "name", "D")
+	GRPH.Add("e", "likes", "a")
+	GRPH.Add("a", "name", "A")
+	GRPH.Add("a", "nick", "ay")
+	GRPH.Add("a", "nick", "aa")
+	GRPH.Add("a", "age", 30)
+	GRPH.Add("a", "homepage", "http://example.com/a")
+
+	sg, err := GRPH.Subgraph(&SubgraphOptions{Seeds: []string{"a"}, Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, edges := subgraphIDs(sg)
+	if !reflect.DeepEqual(ids, []string{"a", "http://example.com/a", "b", "e"}) || sg.Truncated {
+		t.Errorf("%v %+v", ids, sg)
+	}
+	if len(edges) != 3 || edges[1] != (SubgraphEdge{Source: "a", Target: "b", Label: "knows"}) {
+		t.Errorf("%+v", edges)
+	}
+	attrs := map[string]interface{}{"name": "A", "nick": []interface{}{"aa", "ay"}, "age": 30}
+	if a := sg.Nodes[0]; !reflect.DeepEqual(a.Attrs, attrs) || a.Depth != 0 {
+		t.Errorf("%+v", a)
+	}
+	if sg.Nodes[2].Depth != 1 {
+		t.Errorf("%+v", sg.Nodes[2])
+	}
+
+	// only knows, two hops
+	sg, err = GRPH.Subgraph(&SubgraphOptions{Seeds: []string{"a"}, Depth: 2, Include: []string{"knows"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, edges = subgraphIDs(sg); !reflect.DeepEqual(ids, []string{"a", "b", "c"}) || len(edges) != 2 {
+		t.Errorf("%v %+v", ids, edges)
+	}
+
+	// the edges between the nodes at the depth are included
+	sg, err = GRPH.Subgraph(&SubgraphOptions{Seeds: []string{"b", "d"}, Depth: 0, Exclude: []string{"likes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, edges = subgraphIDs(sg); !reflect.DeepEqual(ids, []string{"b", "d"}) || len(edges) != 0 {
+		t.Errorf("%v %+v", ids, edges)
+	}
+	if sg.Nodes[1].Attrs["name"] != "D" {
+		t.Errorf("%+v", sg.Nodes[1])
+	}
+	sg, err = GRPH.Subgraph(&SubgraphOptions{Seeds: []string{"c", "d"}})
+	if err != nil || len(sg.Edges) != 1 {
+		t.Errorf("%+v %v", sg, err)
+	}
+
+	// caps
+	sg, err = GRPH.Subgraph(&SubgraphOptions{Seeds: []string{"a"}, Depth: 3, MaxNodes: 2})
+	if err != nil || len(sg.Nodes) != 2 || len(sg.Edges) != 1 || !sg.Truncated {
+		t.Errorf("%+v %v", sg, err)
+	}
+	sg, err = GRPH.Subgraph(&SubgraphOptions{Seeds: []string{"a"}, Depth: 3, MaxEdges: 2})
+	if err != nil || len(sg.Edges) != 2 || !sg.Truncated {
+		t.Errorf("%+v %v", sg, err)
+	}
+
+	if _, err := GRPH.Subgraph(&SubgraphOptions{}); err == nil {
+		t.Error("should have gotten error for no seeds")
+	}
+	if _, err := GRPH.Subgraph(&SubgraphOptions{Seeds: []string{"a"}, Depth: -1}); err == nil {
+		t.Error("should have gotten error for a negative depth")
+	}
+}
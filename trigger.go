@@ -0,0 +1,307 @@
+package pfftdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// triggerPred is the predicate of the triggers of a graph in its rules
+// graph.
+const triggerPred = "trigger"
+
+// TriggerRetryDelay is how long a trigger waits to apply a DeltaInference
+// again to the items it left pending.
+var TriggerRetryDelay = time.Minute
+
+// DeltaInference is an inference which applies to the triples added to
+// and removed from a graph, which makes it a trigger, see
+// Graph.SetTrigger. As a trigger the added triples of the subjects in the
+// Pending of its report are applied again after TriggerRetryDelay.
+type DeltaInference interface {
+	Inference
+	ApplyDelta(ctx context.Context, g *Graph, added, removed []*Triple) (*InferenceReport, error)
+}
+
+// triggerEvent is a write to a graph for its triggers, it either adds or
+// removes triples. A retry only applies its inference.
+type triggerEvent struct {
+	added     []*Triple
+	removed   []*Triple
+	inference string
+}
+
+// triggerQueue holds the writes to a graph its triggers didn't apply to
+// yet, and the names of the triggers once they are loaded. A goroutine
+// applies them while there are any.
+type triggerQueue struct {
+	mu      sync.Mutex
+	idle    *sync.Cond
+	events  []triggerEvent
+	running bool
+	loaded  bool
+	names   []string
+}
+
+func newTriggerQueue() *triggerQueue {
+	q := &triggerQueue{}
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+// Triggers returns the names of the triggers of the graph, rules and
+// inferences which apply to every write to the graph.
+func (g *Graph) Triggers() ([]string, error) {
+	if g.triggers != nil {
+		g.triggers.mu.Lock()
+		defer g.triggers.mu.Unlock()
+		if g.triggers.loaded {
+			return append([]string{}, g.triggers.names...), nil
+		}
+	}
+	names := []string{}
+	// read through the driver like Entailment, the rules graph has no
+	// rules graph
+	if _, ok := g.Driver.Graph(g.GraphID + RulesGraphSuffix); ok {
+		triples, err := ReadTriples(g.Driver.Triples(g.GraphID+RulesGraphSuffix, g.GraphID, triggerPred, SPEMPTY, nil))
+		if err != nil {
+			return nil, err
+		}
+		for _, triple := range triples {
+			if name, ok := triple[2].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	if g.triggers != nil {
+		g.triggers.names, g.triggers.loaded = names, true
+	}
+	return append([]string{}, names...), nil
+}
+
+// SetTrigger turns a trigger of the graph on or off. A trigger is the name
+// of a rule of the graph, whose triples are then inferred from the triples
+// added and retracted with the ones removed, or of a DeltaInference like
+// geo. Rules go first with a name of both. Triggers apply in the
+// background in the order of the writes, see WaitTriggers, and what they
+// infer doesn't fire them again.
+func (g *Graph) SetTrigger(name string, on bool) error {
+	if on {
+		rules, err := g.Rules()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, rule := range rules {
+			found = found || rule.Name == name
+		}
+		if _, ok := Inferences[name].(DeltaInference); !found && !ok {
+			return fmt.Errorf("no rule or delta inference %s", name)
+		}
+	}
+	names, err := g.Triggers()
+	if err != nil {
+		return err
+	}
+	rg, err := g.sideGraph(RulesGraphSuffix)
+	if err != nil {
+		return err
+	}
+	if err := rg.Remove(g.GraphID, triggerPred, name); err != nil {
+		return err
+	}
+	set := []string{}
+	for _, n := range names {
+		if n != name {
+			set = append(set, n)
+		}
+	}
+	if on {
+		if err := rg.Add(g.GraphID, triggerPred, name); err != nil {
+			return err
+		}
+		set = append(set, name)
+		sort.Strings(set)
+	}
+	if g.triggers != nil {
+		g.triggers.mu.Lock()
+		g.triggers.names, g.triggers.loaded = set, true
+		g.triggers.mu.Unlock()
+	}
+	return nil
+}
+
+// triggered reports whether the graph has triggers.
+func (g *Graph) triggered() bool {
+	if g.triggers == nil {
+		return false
+	}
+	names, err := g.Triggers()
+	if err != nil {
+		log.Error(err)
+	}
+	return len(names) > 0
+}
+
+// fire queues a write for the triggers of the graph.
+func (g *Graph) fire(added, removed []*Triple) {
+	if len(added) == 0 && len(removed) == 0 || !g.triggered() {
+		return
+	}
+	// the triples of a write may be reused, like by Import
+	g.queue(triggerEvent{
+		added:   append([]*Triple{}, added...),
+		removed: append([]*Triple{}, removed...),
+	})
+}
+
+// retry queues the added triples of the items an inference left pending
+// after TriggerRetryDelay.
+func (g *Graph) retry(name string, added []*Triple, pending []string) {
+	items := map[string]bool{}
+	for _, item := range pending {
+		items[item] = true
+	}
+	retried := []*Triple{}
+	for _, triple := range added {
+		if sub, ok := triple[0].(string); ok && items[sub] {
+			retried = append(retried, triple)
+		}
+	}
+	if len(retried) == 0 {
+		return
+	}
+	log.Info(name, " retrying ", len(pending), " pending in ", TriggerRetryDelay)
+	time.AfterFunc(TriggerRetryDelay, func() {
+		g.queue(triggerEvent{added: retried, inference: name})
+	})
+}
+
+// queue adds an event to the queue and applies it unless the queue is
+// already being applied.
+func (g *Graph) queue(event triggerEvent) {
+	q := g.triggers
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, event)
+	if !q.running {
+		q.running = true
+		go g.runTriggers()
+	}
+}
+
+// WaitTriggers waits until the triggers applied to the writes queued, not
+// to the retries of pending items which are yet to be queued.
+func (g *Graph) WaitTriggers() {
+	if g.triggers == nil {
+		return
+	}
+	q := g.triggers
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.running {
+		q.idle.Wait()
+	}
+}
+
+// runTriggers applies the triggers to the queued writes until there are
+// none, consecutive writes of a kind are applied together.
+func (g *Graph) runTriggers() {
+	q := g.triggers
+	q.mu.Lock()
+	for len(q.events) > 0 {
+		event := q.events[0]
+		n := 1
+		for ; n < len(q.events); n++ {
+			next := q.events[n]
+			if (len(next.added) > 0) != (len(event.added) > 0) || next.inference != event.inference {
+				break
+			}
+			event.added = append(event.added, next.added...)
+			event.removed = append(event.removed, next.removed...)
+		}
+		q.events = q.events[n:]
+		q.mu.Unlock()
+
+		if err := g.applyTriggers(context.Background(), event); err != nil {
+			log.Error(err)
+		}
+		q.mu.Lock()
+	}
+	q.running = false
+	q.idle.Broadcast()
+	q.mu.Unlock()
+}
+
+// applyTriggers applies the triggers of the graph to a write.
+func (g *Graph) applyTriggers(ctx context.Context, event triggerEvent) error {
+	names, err := g.Triggers()
+	if err != nil {
+		return err
+	}
+	all, err := g.Rules()
+	if err != nil {
+		return err
+	}
+	byName := map[string]*Rule{}
+	for _, rule := range all {
+		byName[rule.Name] = rule
+	}
+	rules := []*Rule{}
+	infs := []string{}
+	for _, name := range names {
+		if event.inference != "" && name != event.inference {
+			continue
+		}
+		if rule, ok := byName[name]; ok {
+			if event.inference == "" {
+				rules = append(rules, rule)
+			}
+		} else if _, ok := Inferences[name].(DeltaInference); ok {
+			infs = append(infs, name)
+		}
+	}
+	if event.inference != "" {
+		// a retried triple may have been removed since
+		added := []*Triple{}
+		for _, triple := range event.added {
+			sub, pred, err := SubPred(triple[0], triple[1])
+			if err != nil {
+				continue
+			}
+			if count, err := g.Driver.Count(g.GraphID, sub, pred, triple[2]); err != nil {
+				return err
+			} else if count > 0 {
+				added = append(added, triple)
+			}
+		}
+		event.added = added
+	}
+
+	if len(rules) > 0 && len(event.removed) > 0 {
+		if _, err := g.retractFrom(ctx, rules, event.removed); err != nil {
+			return err
+		}
+	}
+	if len(rules) > 0 && len(event.added) > 0 {
+		if _, err := g.inferFrom(ctx, rules, event.added); err != nil {
+			return err
+		}
+	}
+	for _, name := range infs {
+		report, err := Inferences[name].(DeltaInference).ApplyDelta(ctx, g, event.added, event.removed)
+		if err != nil {
+			return err
+		}
+		for item, e := range report.Failed {
+			log.Error(item, " ", e)
+		}
+		g.retry(name, event.added, report.Pending)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package pfftdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggers(t *testing.T) {
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+	defer STORE.Driver.RemoveAll(TESTGRAPH + GeocacheGraphSuffix)
+
+	for name, text := range map[string]string{
+		"ancestor":   `[?x parent ?y] => [?x ancestor ?y]`,
+		"transitive": `[?x ancestor ?y] [?y ancestor ?z] => [?x ancestor ?z]`,
+		"symmetric":  `[?a knows ?b] => [?b knows ?a]`,
+	} {
+		rule, err := ParseRule(name, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := GRPH.AddRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	geocoder, err := ReadCSVGeocoder(strings.NewReader("1 a street,1,2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo := Inferences["geo"]
+	Inferences["geo"] = GeoRule{Geocoder: geocoder}
+	defer func() { Inferences["geo"] = geo }()
+
+	for _, name := range []string{"ancestor", "transitive", "geo"} {
+		if err := GRPH.SetTrigger(name, true); err != nil {
+			t.Fatal(err)
+		}
+		defer GRPH.SetTrigger(name, false)
+	}
+	if err := GRPH.SetTrigger("rules", true); err == nil {
+		t.Error("should have gotten error for an inference which doesn't apply to writes")
+	}
+	if names, err := GRPH.Triggers(); err != nil || !reflect.DeepEqual(names, []string{"ancestor", "geo", "transitive"}) {
+		t.Error(names, err)
+	}
+
+	_, err = GRPH.AddBulk(GRPH.GraphID, []*Triple{
+		&Triple{"a", "parent", "b"},
+		&Triple{"b", "parent", "c"},
+		&Triple{"a", "knows", "b"},
+		nil,
+		&Triple{"a", "", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	GRPH.Add("c", "parent", "d")
+	GRPH.Add("home", "location:address", "1 A Street")
+	GRPH.WaitTriggers()
+
+	res := GRPH.Query([]*Triple{&Triple{"a", "ancestor", "?y"}}, nil)
+	if vals := pathValues(res, "y"); !reflect.DeepEqual(vals, []string{"b", "c", "d"}) {
+		t.Error(vals)
+	}
+	if count, _ := GRPH.Count("b", "knows", "a"); count != 0 {
+		t.Error("symmetric isn't a trigger")
+	}
+	if lat, _ := GRPH.Value("home", "location:lat", ""); lat != 1.0 {
+		t.Error(lat)
+	}
+
+	// the ancestors through c go with the premise, and the location with
+	// the address a pattern removes
+	if err := GRPH.RemoveBulk(GRPH.GraphID, []*Triple{&Triple{"b", "parent", "c"}, &Triple{"home", "location:address", ""}}); err != nil {
+		t.Fatal(err)
+	}
+	GRPH.WaitTriggers()
+	res = GRPH.Query([]*Triple{&Triple{"?x", "ancestor", "?y"}}, nil)
+	if len(res) != 2 {
+		t.Error(res)
+	}
+	if count, _ := GRPH.Count("home", "location:lat", ""); count != 0 {
+		t.Error("the location should go with the address")
+	}
+
+	// an ancestor which still follows another way stays
+	GRPH.Add("a", "parent", "c")
+	GRPH.Add("b", "parent", "c")
+	GRPH.WaitTriggers()
+	GRPH.Remove("b", "parent", "c")
+	GRPH.WaitTriggers()
+	res = GRPH.Query([]*Triple{&Triple{"a", "ancestor", "?y"}}, nil)
+	if vals := pathValues(res, "y"); !reflect.DeepEqual(vals, []string{"b", "c", "d"}) {
+		t.Error(vals)
+	}
+
+	// removing a rule turns off its trigger
+	if err := GRPH.RemoveRule("transitive"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := GRPH.Triggers(); !reflect.DeepEqual(names, []string{"ancestor", "geo"}) {
+		t.Error(names)
+	}
+}
+
+func TestTriggerRetry(t *testing.T) {
+	cleanupGraph()
+	cleanupRules()
+	defer cleanupGraph()
+	defer cleanupRules()
+	defer STORE.Driver.RemoveAll(TESTGRAPH + GeocacheGraphSuffix)
+
+	delay := TriggerRetryDelay
+	TriggerRetryDelay = 10 * time.Millisecond
+	defer func() { TriggerRetryDelay = delay }()
+	// over the limit past the retries of the first run
+	geocoder := &countingGeocoder{calls: map[string]int{}, limited: 2}
+	geo := Inferences["geo"]
+	Inferences["geo"] = GeoRule{Geocoder: geocoder, Retries: 1, Backoff: time.Millisecond}
+	defer func() { Inferences["geo"] = geo }()
+
+	if err := GRPH.SetTrigger("geo", true); err != nil {
+		t.Fatal(err)
+	}
+	defer GRPH.SetTrigger("geo", false)
+	GRPH.Add("a", "location:address", "1 a street")
+
+	located := false
+	for i := 0; i < 100 && !located; i++ {
+		GRPH.WaitTriggers()
+		count, _ := GRPH.Count("a", "location:lat", SPEMPTY)
+		located = count > 0
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !located {
+		t.Error("pending place should be located by a retry")
+	}
+	if geocoder.calls["1 a street"] != 3 {
+		t.Error("should have geocoded 3 times got:", geocoder.calls)
+	}
+}
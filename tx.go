@@ -0,0 +1,529 @@
+package pfftdb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// transaction operations.
+const (
+	TxAdd    = "add"
+	TxRemove = "remove"
+)
+
+// JournalGraphSuffix names the side graph with the journal of the
+// transactions of a graph whose driver isn't a TxDriver.
+const JournalGraphSuffix = ".journal"
+
+// journal predicates, an entry is the triples a transaction adds and
+// removes and a state triple written after them.
+const (
+	journalAdd     = "journal:add"
+	journalRemove  = "journal:remove"
+	journalState   = "journal:state"
+	journalPending = "pending"
+)
+
+// ErrTxDone is returned by a transaction which was committed or rolled
+// back.
+var ErrTxDone = fmt.Errorf("transaction already committed or rolled back")
+
+// TxOp is an operation of a transaction, an add of a triple or a remove
+// of the triples matching it where empty items match everything.
+type TxOp struct {
+	Op     string  `json:"op"`
+	Triple *Triple `json:"triple"`
+}
+
+// check validates an operation, adds need every item.
+func (op *TxOp) check() error {
+	switch op.Op {
+	case TxAdd:
+		return checkTriple(op.Triple, false)
+	case TxRemove:
+		return checkTriple(op.Triple, true)
+	}
+	return fmt.Errorf("unknown operation %s", op.Op)
+}
+
+// TxDriver is a Driver which applies the operations of a transaction to
+// a graph atomically and in order, it returns the triples added and
+// removed. Graph transactions on other drivers go through a journal.
+type TxDriver interface {
+	Transact(graph string, ops []*TxOp) (added, removed []*Triple, err error)
+}
+
+// TxResult is the number of triples a transaction added and removed.
+type TxResult struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// Tx is a batch of adds and removes on a graph, nothing is written until
+// Commit which applies all of them or none.
+type Tx struct {
+	g    *Graph
+	mu   sync.Mutex
+	ops  []*TxOp
+	done bool
+}
+
+// Begin starts a transaction on the graph.
+func (g *Graph) Begin() *Tx {
+	return &Tx{g: g}
+}
+
+// Add adds a triple in the transaction.
+func (tx *Tx) Add(sub, pred string, obj interface{}) error {
+	return tx.AddBulk([]*Triple{&Triple{sub, pred, obj}})
+}
+
+// AddBulk adds triples in the transaction, none are if one is invalid.
+func (tx *Tx) AddBulk(triples []*Triple) error {
+	return tx.Push(txOps(TxAdd, triples)...)
+}
+
+// Remove removes the triples matching sub, pred and obj in the
+// transaction.
+func (tx *Tx) Remove(sub, pred string, obj interface{}) error {
+	return tx.RemoveBulk([]*Triple{&Triple{sub, pred, obj}})
+}
+
+// RemoveBulk removes the triples matching each triple in the transaction.
+func (tx *Tx) RemoveBulk(triples []*Triple) error {
+	return tx.Push(txOps(TxRemove, triples)...)
+}
+
+// txOps returns an operation for each triple.
+func txOps(op string, triples []*Triple) []*TxOp {
+	ops := make([]*TxOp, len(triples))
+	for i, triple := range triples {
+		ops[i] = &TxOp{Op: op, Triple: triple}
+	}
+	return ops
+}
+
+// Push appends operations to the transaction, none are if one is invalid.
+func (tx *Tx) Push(ops ...*TxOp) error {
+	for i, op := range ops {
+		if op == nil {
+			return fmt.Errorf("operation %d: missing", i)
+		}
+		if err := op.check(); err != nil {
+			return fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.ops = append(tx.ops, ops...)
+	return nil
+}
+
+// Len returns the number of operations in the transaction.
+func (tx *Tx) Len() int {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return len(tx.ops)
+}
+
+// Rollback discards the transaction.
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.ops = nil
+	return nil
+}
+
+// Commit applies the operations in order, either all of them or none.
+// Transactions on a graph are applied one at a time and fire its
+// triggers with what they added and removed.
+func (tx *Tx) Commit() (*TxResult, error) {
+	start := time.Now()
+	defer func() { log.Info("Tx.Commit ", time.Since(start)) }()
+
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return nil, ErrTxDone
+	}
+	tx.done = true
+	ops := tx.ops
+	tx.ops = nil
+	tx.mu.Unlock()
+
+	g := tx.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.changed()
+	var added, removed []*Triple
+	var err error
+	if td, ok := g.Driver.(TxDriver); ok {
+		added, removed, err = td.Transact(g.GraphID, ops)
+	} else {
+		added, removed, err = g.journaled(ops)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	asserted := []*Triple{}
+	for _, op := range ops {
+		if op.Op == TxAdd {
+			asserted = append(asserted, op.Triple)
+		}
+	}
+	if err := g.unmark(asserted); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		g.fire(added, removed)
+	}
+	return &TxResult{Added: len(added), Removed: len(removed)}, nil
+}
+
+// txState is a triple seen by planTx, base if it is in the graph and
+// present if it is after the operations so far.
+type txState struct {
+	triple  *Triple
+	base    bool
+	present bool
+}
+
+// planTx returns the net effect of operations, the triples to add which
+// aren't in the graph and the ones to remove which are, in the order they
+// were first seen. lookup returns the triples of the graph matching sub,
+// pred and obj.
+func planTx(ops []*TxOp, lookup func(sub, pred string, obj interface{}) ([]*Triple, error)) ([]*Triple, []*Triple, error) {
+	states := map[string]*txState{}
+	order := []string{}
+	for _, op := range ops {
+		sub, pred, err := SubPred(op.Triple[0], op.Triple[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		obj := op.Triple[2]
+
+		// a single triple
+		if sub != SPEMPTY && pred != SPEMPTY && !isEmpty(obj) {
+			key := tripleKey(sub, pred, obj)
+			s, ok := states[key]
+			if !ok {
+				matches, err := lookup(sub, pred, obj)
+				if err != nil {
+					return nil, nil, err
+				}
+				s = &txState{triple: &Triple{sub, pred, obj}}
+				if len(matches) > 0 {
+					s.triple, s.base = matches[0], true
+				}
+				states[key] = s
+				order = append(order, key)
+			}
+			s.present = op.Op == TxAdd
+			continue
+		}
+
+		// a pattern, only removes have one
+		matches, err := lookup(sub, pred, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, triple := range matches {
+			s, p, err := SubPred(triple[0], triple[1])
+			if err != nil {
+				continue
+			}
+			key := tripleKey(s, p, triple[2])
+			if _, ok := states[key]; !ok {
+				states[key] = &txState{triple: triple, base: true, present: true}
+				order = append(order, key)
+			}
+		}
+		for _, key := range order {
+			if s := states[key]; s.present && matchTriple(s.triple, sub, pred, obj) {
+				s.present = false
+			}
+		}
+	}
+
+	added, removed := []*Triple{}, []*Triple{}
+	for _, key := range order {
+		s := states[key]
+		switch {
+		case s.present && !s.base:
+			added = append(added, s.triple)
+		case !s.present && s.base:
+			removed = append(removed, s.triple)
+		}
+	}
+	return added, removed, nil
+}
+
+// matchTriple reports whether a triple matches sub, pred and obj, empty
+// items match everything.
+func matchTriple(triple *Triple, sub, pred string, obj interface{}) bool {
+	if sub != SPEMPTY && triple[0] != sub {
+		return false
+	}
+	if pred != SPEMPTY && triple[1] != pred {
+		return false
+	}
+	return isEmpty(obj) || objKey(triple[2]) == objKey(obj)
+}
+
+// journaled applies operations through the journal graph, the caller
+// holds the lock of the graph. The net effect is written to the journal
+// before it is applied and undone if applying fails, removing the state
+// triple of the entry commits it. An entry left by a crash is undone by
+// the next transaction on the graph.
+func (g *Graph) journaled(ops []*TxOp) ([]*Triple, []*Triple, error) {
+	jg, err := g.sideGraph(JournalGraphSuffix)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = g.recoverJournal(jg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	added, removed, err := planTx(ops, func(sub, pred string, obj interface{}) ([]*Triple, error) {
+		return ReadTriples(g.Driver.Triples(g.GraphID, sub, pred, obj, nil))
+	})
+	if err != nil || len(added) == 0 && len(removed) == 0 {
+		return added, removed, err
+	}
+
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := hex.EncodeToString(b)
+	entry := []*Triple{}
+	for _, list := range []struct {
+		pred    string
+		triples []*Triple
+	}{{journalAdd, added}, {journalRemove, removed}} {
+		for _, triple := range list.triples {
+			dt, err := encodeDiskTriple(triple)
+			if err != nil {
+				return nil, nil, err
+			}
+			p, err := json.Marshal(dt)
+			if err != nil {
+				return nil, nil, err
+			}
+			entry = append(entry, &Triple{id, list.pred, string(p)})
+		}
+	}
+	_, err = g.Driver.AddBulk(jg.GraphID, entry)
+	if err == nil {
+		err = g.Driver.Add(jg.GraphID, id, journalState, journalPending)
+	}
+	if err != nil {
+		g.Driver.Remove(jg.GraphID, id, SPEMPTY, nil)
+		return nil, nil, err
+	}
+
+	err = g.Driver.RemoveBulk(g.GraphID, removed)
+	if err == nil {
+		_, err = g.Driver.AddBulk(g.GraphID, added)
+	}
+	if err == nil {
+		err = g.Driver.Remove(jg.GraphID, id, journalState, journalPending)
+	}
+	if err != nil {
+		if undoErr := g.undo(jg, id, added, removed); undoErr != nil {
+			return nil, nil, fmt.Errorf("%v, undo failed, retried by the next transaction: %v", err, undoErr)
+		}
+		return nil, nil, err
+	}
+	if err := g.Driver.Remove(jg.GraphID, id, SPEMPTY, nil); err != nil {
+		log.Error(err)
+	}
+	return added, removed, nil
+}
+
+// undo reverts a journal entry and removes it.
+func (g *Graph) undo(jg *Graph, id string, added, removed []*Triple) error {
+	err := g.Driver.RemoveBulk(g.GraphID, added)
+	if err != nil {
+		return err
+	}
+	_, err = g.Driver.AddBulk(g.GraphID, removed)
+	if err != nil {
+		return err
+	}
+	err = g.Driver.Remove(jg.GraphID, id, journalState, journalPending)
+	if err != nil {
+		return err
+	}
+	return g.Driver.Remove(jg.GraphID, id, SPEMPTY, nil)
+}
+
+// recoverTx undoes the transactions on the graph a crash or a failed undo
+// left half applied, drivers which journal transactions run it when they
+// open a graph so readers don't see them.
+func (g *Graph) recoverTx() error {
+	if _, ok := g.Driver.(TxDriver); ok {
+		return nil
+	}
+	jg, ok := g.Driver.Graph(g.GraphID + JournalGraphSuffix)
+	if !ok {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.recoverJournal(jg)
+}
+
+// recoverJournal undoes the entries of the journal with a state triple
+// and drops the others, which were committed or never applied.
+func (g *Graph) recoverJournal(jg *Graph) error {
+	triples, err := ReadTriples(g.Driver.Triples(jg.GraphID, SPEMPTY, SPEMPTY, nil, nil))
+	if err != nil || len(triples) == 0 {
+		return err
+	}
+	type entry struct {
+		pending        bool
+		added, removed []*Triple
+	}
+	entries := map[string]*entry{}
+	for _, triple := range triples {
+		id, pred, err := SubPred(triple[0], triple[1])
+		if err != nil {
+			continue
+		}
+		e, ok := entries[id]
+		if !ok {
+			e = &entry{}
+			entries[id] = e
+		}
+		if pred == journalState {
+			e.pending = true
+			continue
+		}
+		s, _ := triple[2].(string)
+		dt := &diskTriple{}
+		err = json.Unmarshal([]byte(s), dt)
+		if err != nil {
+			return err
+		}
+		tr, err := dt.decode()
+		if err != nil {
+			return err
+		}
+		if pred == journalAdd {
+			e.added = append(e.added, tr)
+		} else {
+			e.removed = append(e.removed, tr)
+		}
+	}
+	for id, e := range entries {
+		if !e.pending {
+			err = g.Driver.Remove(jg.GraphID, id, SPEMPTY, nil)
+		} else {
+			log.Errorf("undoing transaction %s of %s", id, g.GraphID)
+			err = g.undo(jg, id, e.added, e.removed)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TxTimeout is how long the api keeps an open transaction which isn't
+// written to, it is rolled back after.
+var TxTimeout = 5 * time.Minute
+
+// openTx is a transaction the api keeps between requests.
+type openTx struct {
+	tx      *Tx
+	graph   string
+	expires time.Time
+}
+
+// transactions holds the open transactions of the api by id.
+type transactions struct {
+	mu   sync.Mutex
+	open map[string]*openTx
+}
+
+// put stores a transaction on graph and returns its id.
+func (ts *transactions) put(graph string, tx *Tx) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.expire()
+	if ts.open == nil {
+		ts.open = map[string]*openTx{}
+	}
+	ts.open[id] = &openTx{tx: tx, graph: graph, expires: time.Now().Add(TxTimeout)}
+	return id, nil
+}
+
+// get returns the transaction with id and extends its timeout.
+func (ts *transactions) get(id string) (*openTx, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.expire()
+	ot, ok := ts.open[id]
+	if ok {
+		ot.expires = time.Now().Add(TxTimeout)
+	}
+	return ot, ok
+}
+
+// take removes and returns the transaction with id.
+func (ts *transactions) take(id string) (*openTx, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.expire()
+	ot, ok := ts.open[id]
+	delete(ts.open, id)
+	return ot, ok
+}
+
+// expire rolls back transactions past their timeout, the caller must hold
+// the lock.
+func (ts *transactions) expire() {
+	now := time.Now()
+	for id, ot := range ts.open {
+		if now.After(ot.expires) {
+			ot.tx.Rollback()
+			delete(ts.open, id)
+		}
+	}
+}
+
+// rollbackAll rolls back every open transaction.
+func (ts *transactions) rollbackAll() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for id, ot := range ts.open {
+		ot.tx.Rollback()
+		delete(ts.open, id)
+	}
+}
@@ -0,0 +1,170 @@
+package pfftdb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	GRPH.Add("a", "name", "A")
+	GRPH.Add("a", "knows", "b")
+	GRPH.Add("a", "knows", "c")
+
+	tx := GRPH.Begin()
+	if err := tx.Remove("a", "knows", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.AddBulk([]*Triple{{"a", "knows", "c"}, {"a", "knows", "d"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Add("a", "age", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Remove("a", "age", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.AddBulk([]*Triple{{"e", "name", "E"}, {"e", "", "x"}}); err == nil || tx.Len() != 5 {
+		t.Error("an invalid add should fail the whole bulk", err, tx.Len())
+	}
+
+	// nothing is written before the commit
+	if n, _ := GRPH.Count("a", "knows", ""); n != 2 {
+		t.Error(n)
+	}
+	result, err := tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *result != (TxResult{Added: 1, Removed: 1}) {
+		t.Errorf("%+v", result)
+	}
+	triples, _ := GRPH.Triples("a", "knows", "", &Options{OrderBy: "o"})
+	if len(triples) != 2 || triples[0][2] != "c" || triples[1][2] != "d" {
+		t.Error(triples)
+	}
+	if n, _ := GRPH.Count("a", "age", ""); n != 0 {
+		t.Error(n)
+	}
+
+	if _, err := tx.Commit(); err != ErrTxDone {
+		t.Error(err)
+	}
+	if err := tx.Add("a", "b", "c"); err != ErrTxDone {
+		t.Error(err)
+	}
+
+	tx = GRPH.Begin()
+	tx.Remove("", "", nil)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Commit(); err != ErrTxDone {
+		t.Error(err)
+	}
+	if n, _ := GRPH.Count("", "", nil); n != 3 {
+		t.Error(n)
+	}
+}
+
+// journalDriver hides the transactions of a driver so they are
+// journaled, the first failAdds adds to the test graph fail.
+type journalDriver struct {
+	Driver
+	failAdds int
+}
+
+func (jd *journalDriver) AddBulk(graph string, triples []*Triple) (int, error) {
+	if graph == TESTGRAPH && jd.failAdds > 0 {
+		jd.failAdds--
+		return 0, fmt.Errorf("add failed")
+	}
+	return jd.Driver.AddBulk(graph, triples)
+}
+
+func TestTxJournal(t *testing.T) {
+	cleanupGraph()
+	defer cleanupGraph()
+	defer STORE.Driver.RemoveAll(TESTGRAPH + JournalGraphSuffix)
+
+	jd := &journalDriver{Driver: STORE.Driver}
+	g, err := NewGraph(TESTGRAPH, jd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.Driver.(TxDriver); ok {
+		t.Fatal("should journal")
+	}
+	g.Add("a", "age", 30)
+	g.Add("a", "name", "A")
+
+	journal := func() []*Triple {
+		triples, _ := ReadTriples(STORE.Driver.Triples(TESTGRAPH+JournalGraphSuffix, "", "", nil, nil))
+		return triples
+	}
+	state := func() []*Triple {
+		triples, _ := g.Triples("a", "", nil, &Options{OrderBy: "p"})
+		return triples
+	}
+	before := state()
+
+	tx := g.Begin()
+	tx.Remove("a", "age", nil)
+	tx.Add("a", "age", 31)
+	result, err := tx.Commit()
+	if err != nil || *result != (TxResult{Added: 1, Removed: 1}) {
+		t.Fatal(result, err)
+	}
+	if v, _ := g.Value("a", "age", nil); v != 31 || len(journal()) != 0 {
+		t.Error(v, journal())
+	}
+
+	// the failed add is undone
+	jd.failAdds = 1
+	before = state()
+	tx = g.Begin()
+	tx.Remove("a", "", nil)
+	tx.Add("a", "age", 32)
+	if _, err := tx.Commit(); err == nil {
+		t.Fatal("should have failed")
+	}
+	if !reflect.DeepEqual(state(), before) || len(journal()) != 0 {
+		t.Error(state(), journal())
+	}
+
+	// the undo fails too, the next transaction undoes it
+	jd.failAdds = 2
+	tx = g.Begin()
+	tx.Remove("a", "age", nil)
+	tx.Add("a", "age", 40)
+	if _, err := tx.Commit(); err == nil {
+		t.Fatal("should have failed")
+	}
+	if len(state()) != 1 || len(journal()) == 0 {
+		t.Error(state(), journal())
+	}
+	result, err = g.Begin().Commit()
+	if err != nil || *result != (TxResult{}) {
+		t.Fatal(result, err)
+	}
+	if !reflect.DeepEqual(state(), before) || len(journal()) != 0 {
+		t.Error(state(), journal())
+	}
+
+	// or opening the graph does
+	jd.failAdds = 2
+	tx = g.Begin()
+	tx.Remove("a", "age", nil)
+	tx.Add("a", "age", 40)
+	if _, err := tx.Commit(); err == nil {
+		t.Fatal("should have failed")
+	}
+	if err := g.recoverTx(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state(), before) || len(journal()) != 0 {
+		t.Error(state(), journal())
+	}
+}
@@ -0,0 +1,48 @@
+package pfftdb
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkar/pfftdb/assets"
+)
+
+// assetPrefix is the prefix of the names of the web directory files in
+// assets, they are generated from the GOPATH with
+//
+//	go-bindata -pkg assets -o src/github.com/pkar/pfftdb/assets/assets.go src/github.com/pkar/pfftdb/web/...
+const assetPrefix = "src/github.com/pkar/pfftdb/web/"
+
+// assetsModTime is when the server started, the assets don't change
+// while it runs.
+var assetsModTime = time.Now()
+
+// assetHandler serves the graph visualization from the web directory files
+// embedded in assets, index.html for a directory.
+type assetHandler struct{}
+
+func (assetHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		e := methodNotAllowed(req.Method)
+		http.Error(w, e["err"].(string), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + req.URL.Path)
+	if strings.HasSuffix(req.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	data, err := assets.Asset(assetPrefix + strings.TrimPrefix(name, "/"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	http.ServeContent(w, req, name, assetsModTime, bytes.NewReader(data))
+}